@@ -30,14 +30,24 @@ import (
 
 const (
 	// The default port for vmt service server
-	KubeturboPort               = 10265
-	DefaultKubeletPort          = 10255
-	DefaultKubeletHttps         = false
-	defaultVMPriority           = -1
-	defaultVMIsBase             = true
-	defaultDiscoveryIntervalSec = 600
-	defaultValidationWorkers    = 10
-	defaultValidationTimeout    = 60
+	KubeturboPort                = 10265
+	DefaultKubeletPort           = 10255
+	DefaultKubeletHttps          = false
+	defaultVMPriority            = -1
+	defaultVMIsBase              = true
+	defaultDiscoveryIntervalSec  = 600
+	defaultValidationWorkers     = 10
+	defaultValidationTimeout     = 60
+	defaultContainerResizeMode   = "pod"
+	defaultHPAScalingPolicy      = "refuse"
+	defaultEmptyDirPolicy        = "allow"
+	defaultActionLockStore       = "memory"
+	defaultCloneGCMode           = "delete"
+	defaultCloneGCIntervalSec    = 300
+	defaultCloneGCGracePeriodSec = 1800
+
+	defaultActionAuditLogMaxSizeMB  = 100
+	defaultActionApprovalTimeoutSec = 3600
 )
 
 var (
@@ -87,6 +97,52 @@ type VMTServer struct {
 
 	// The Openshift SCC list allowed for action execution
 	sccSupport []string
+
+	// Delete the original pods through the Eviction API during actions, to honor PodDisruptionBudgets
+	UsePodEviction bool
+
+	// The container resize mode for the pods owned by controllers: pod or controller
+	ContainerResizeMode string
+
+	// How to scale the controllers which are scaled by HorizontalPodAutoscalers: refuse or adjust
+	HPAScalingPolicy string
+
+	// How to move the pods with emptyDir volumes: allow or refuse
+	EmptyDirPolicy string
+
+	// The extended resources of the containers resized by the commodities of the types
+	ExtendedResources []string
+
+	// Build and validate the actions with server-side dry-run, without changing anything
+	DryRun bool
+
+	// The namespace of the ConfigMap storing the action journal
+	ActionJournalNamespace string
+
+	// The store of the action locks: memory or lease
+	ActionLockStore string
+
+	// The garbage collector of the orphaned clone pods
+	CloneGCMode           string
+	CloneGCIntervalSec    int
+	CloneGCGracePeriodSec int
+
+	// The file declaring which actions may be executed, in which namespaces and on which pods
+	ActionPolicyFile string
+
+	// The concurrency budgets of the disruptive actions
+	ActionBudgetCluster            int
+	ActionBudgetNamespace          int
+	ActionBudgetController         int
+	ActionBudgetControllerFraction float64
+
+	// The audit log of the executed actions
+	ActionAuditLog          string
+	ActionAuditLogMaxSizeMB int
+
+	// Wait for the approval of all the actions through their TurboAction custom resources
+	ActionApproval           bool
+	ActionApprovalTimeoutSec int
 }
 
 // NewVMTServer creates a new VMTServer with default parameters
@@ -118,6 +174,26 @@ func (s *VMTServer) AddFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&s.ValidationWorkers, "validation-workers", defaultValidationWorkers, "The validation workers")
 	fs.IntVar(&s.ValidationTimeout, "validation-timeout-sec", defaultValidationTimeout, "The validation timeout in seconds")
 	fs.StringSliceVar(&s.sccSupport, "scc-support", defaultSccSupport, "The SCC list allowed for executing pod actions, e.g., --scc-support=restricted,anyuid or --scc-support=* to allow all")
+	fs.BoolVar(&s.UsePodEviction, "pod-eviction", false, "Delete the original pods through the Eviction API during pod actions, so that PodDisruptionBudgets are honored")
+	fs.StringVar(&s.ContainerResizeMode, "container-resize-mode", defaultContainerResizeMode, "The container resize mode for the pods owned by controllers: 'pod' to resize a clone of the pod, or 'controller' to resize the pod template of the controller and roll it out")
+	fs.StringVar(&s.EmptyDirPolicy, "empty-dir-policy", defaultEmptyDirPolicy, "How to move the pods with emptyDir volumes, whose data is lost by the move: 'allow' the moves, or 'refuse' them unless the pod has the annotation cluster-autoscaler.kubernetes.io/safe-to-evict=true")
+	fs.StringSliceVar(&s.ExtendedResources, "extended-resources", nil, "The extended resources of the containers with limits, sold as the commodities of the types and resized by them, in COMMODITY_TYPE=resource-name, e.g., --extended-resources=PROCESSING_UNITS=nvidia.com/gpu. The requests and limits of ephemeral-storage are resized by the VSTORAGE commodities")
+	fs.BoolVar(&s.DryRun, "dry-run", false, "Execute all the actions in dry-run mode: the changes are validated by the API server but not persisted. Set the annotation kubeturbo.io/dry-run=true on a namespace to do so for the actions in the namespace only")
+	fs.StringVar(&s.HPAScalingPolicy, "hpa-scaling-policy", defaultHPAScalingPolicy, "How to provision or suspend pods of a controller scaled by a HorizontalPodAutoscaler: 'refuse' the action, or 'adjust' the minReplicas and maxReplicas of the HorizontalPodAutoscaler")
+	fs.StringVar(&s.CloneGCMode, "clone-gc-mode", defaultCloneGCMode, "How to handle the orphaned clone pods left by interrupted move and resize actions: 'delete' them, 'report' them as warning events only, or 'disabled'")
+	fs.IntVar(&s.CloneGCIntervalSec, "clone-gc-interval-sec", defaultCloneGCIntervalSec, "The interval in seconds to look for the orphaned clone pods")
+	fs.IntVar(&s.CloneGCGracePeriodSec, "clone-gc-grace-period-sec", defaultCloneGCGracePeriodSec, "The grace period in seconds after its creation before a clone pod can be considered orphaned")
+	fs.StringVar(&s.ActionPolicyFile, "action-policy-file", "", "Path to the YAML or JSON file, e.g., mounted from a ConfigMap, declaring which action types may be executed in which namespaces and for which pod label selectors, and with what limits, and the maintenance windows of the disruptive actions. All actions are allowed at any time if not set")
+	fs.IntVar(&s.ActionBudgetCluster, "action-budget-cluster", 0, "The maximum number of disruptive actions, i.e., the moves, resizes and suspends, executed at the same time in the cluster; the actions over the budget wait in a queue. Not limited if 0")
+	fs.IntVar(&s.ActionBudgetNamespace, "action-budget-namespace", 0, "The maximum number of disruptive actions executed at the same time in a namespace. Not limited if 0")
+	fs.IntVar(&s.ActionBudgetController, "action-budget-controller", 0, "The maximum number of unavailable pods of a controller, including the one disrupted by an action. Not limited if 0")
+	fs.Float64Var(&s.ActionBudgetControllerFraction, "action-budget-controller-fraction", 0, "The maximum fraction of the replicas of a controller unavailable at a time, including the one disrupted by an action, e.g., 0.25; at least one pod may be disrupted. Not limited if 0")
+	fs.StringVar(&s.ActionAuditLog, "action-audit-log", "", "Path to the file appending an audit entry, in JSON Lines, for every executed action, or '-' for the standard output. Disabled if not set")
+	fs.IntVar(&s.ActionAuditLogMaxSizeMB, "action-audit-log-max-size-mb", defaultActionAuditLogMaxSizeMB, "The max size in MB of the action audit log file before it is rotated; the previous file is retained with the suffix '.1'. Not rotated if 0")
+	fs.BoolVar(&s.ActionApproval, "action-approval", false, "Create a TurboAction custom resource for every action, and execute the action only after it is approved. Set the annotation kubeturbo.io/action-approval=true on a namespace to do so for the actions in the namespace only")
+	fs.IntVar(&s.ActionApprovalTimeoutSec, "action-approval-timeout-sec", defaultActionApprovalTimeoutSec, "How long in seconds an action waits for the approval of its TurboAction before it fails")
+	fs.StringVar(&s.ActionLockStore, "action-lock-store", defaultActionLockStore, "Where the locks serializing the actions on the same controller are kept: 'memory' of this kubeturbo, or 'lease' to keep them in the Lease objects of the namespace kubeturbo runs in, shared by multiple kubeturbo instances, e.g., during a rolling upgrade")
+	fs.StringVar(&s.ActionJournalNamespace, "action-journal-namespace", "", "The namespace of the ConfigMap journaling the steps of the actions, which are completed or reverted after a restart. Default to the namespace kubeturbo runs in")
 }
 
 // create an eventRecorder to send events to Kubernetes APIserver
@@ -196,6 +272,30 @@ func (s *VMTServer) checkFlag() error {
 		return fmt.Errorf("[KubeletPort[%d] should be bigger than 0.", s.KubeletPort)
 	}
 
+	if mode := s.ContainerResizeMode; mode != "" && mode != "pod" && mode != "controller" {
+		return fmt.Errorf("Unsupported container resize mode[%s]: should be either pod or controller.", mode)
+	}
+
+	if policy := s.HPAScalingPolicy; policy != "" && policy != "refuse" && policy != "adjust" {
+		return fmt.Errorf("Unsupported HPA scaling policy[%s]: should be either refuse or adjust.", policy)
+	}
+
+	if policy := s.EmptyDirPolicy; policy != "" && policy != "allow" && policy != "refuse" {
+		return fmt.Errorf("Unsupported emptyDir policy[%s]: should be either allow or refuse.", policy)
+	}
+
+	if store := s.ActionLockStore; store != "" && store != "memory" && store != "lease" {
+		return fmt.Errorf("Unsupported action lock store[%s]: should be either memory or lease.", store)
+	}
+
+	if mode := s.CloneGCMode; mode != "" && mode != "delete" && mode != "report" && mode != "disabled" {
+		return fmt.Errorf("Unsupported clone GC mode[%s]: should be delete, report or disabled.", mode)
+	}
+
+	if s.ActionBudgetControllerFraction < 0 || s.ActionBudgetControllerFraction > 1 {
+		return fmt.Errorf("Action budget controller fraction[%v] should be between 0 and 1.", s.ActionBudgetControllerFraction)
+	}
+
 	return nil
 }
 
@@ -238,7 +338,21 @@ func (s *VMTServer) Run(_ []string) error {
 		WithDiscoveryInterval(s.DiscoveryIntervalSec).
 		WithValidationTimeout(s.ValidationTimeout).
 		WithValidationWorkers(s.ValidationWorkers).
-		WithSccSupport(s.sccSupport)
+		WithSccSupport(s.sccSupport).
+		WithPodEviction(s.UsePodEviction).
+		WithContainerResizeMode(s.ContainerResizeMode).
+		WithHPAScalingPolicy(s.HPAScalingPolicy).
+		WithEmptyDirPolicy(s.EmptyDirPolicy).
+		WithExtendedResources(s.ExtendedResources).
+		WithDryRun(s.DryRun).
+		WithEventRecorder(createRecorder(kubeClient)).
+		WithActionJournalNamespace(s.ActionJournalNamespace).
+		WithActionLockStore(s.ActionLockStore).
+		WithCloneGarbageCollector(s.CloneGCMode, s.CloneGCIntervalSec, s.CloneGCGracePeriodSec).
+		WithActionPolicyFile(s.ActionPolicyFile).
+		WithActionBudgets(s.ActionBudgetCluster, s.ActionBudgetNamespace, s.ActionBudgetController, s.ActionBudgetControllerFraction).
+		WithActionAuditLog(s.ActionAuditLog, s.ActionAuditLogMaxSizeMB).
+		WithActionApproval(s.ActionApproval, s.ActionApprovalTimeoutSec)
 	glog.V(3).Infof("Finished creating turbo configuration: %+v", vmtConfig)
 
 	// The KubeTurbo TAP service
@@ -0,0 +1,310 @@
+package action
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	defaultBudgetWaitTimeout = time.Minute * 30
+	defaultBudgetWaitSleep   = time.Second * 10
+)
+
+// ConcurrencyBudgets limits how many disruptive actions are executed at the same time; a budget is not limited
+// if it is not positive. The budget of a controller limits its unavailable pods instead, i.e., the pods not ready
+// or being deleted, plus the one disrupted. At least one pod of a controller may be disrupted if all its other pods
+// are available.
+// The budgets are acquired before the action lock, so several actions on the pods of a controller may pass the check
+// of its budget, and then wait for the lock in turn. The budget of the controller is checked again once the action
+// gets the lock, and the action gives its budgets back while it waits for its controller again.
+type ConcurrencyBudgets struct {
+	// the maximum number of the disruptive actions in the cluster, and in a namespace
+	Cluster   int
+	Namespace int
+	// the maximum number, and the maximum fraction of the replicas, of the unavailable pods of a controller
+	Controller         int
+	ControllerFraction float64
+}
+
+func (c ConcurrencyBudgets) enabled() bool {
+	return c.Cluster > 0 || c.Namespace > 0 || c.limitsController()
+}
+
+func (c ConcurrencyBudgets) limitsController() bool {
+	return c.Controller > 0 || c.ControllerFraction > 0
+}
+
+// get the maximum unavailable pods of a controller with the replicas
+func (c ConcurrencyBudgets) maxUnavailable(replicas int) int {
+	max := replicas
+	if c.Controller > 0 && c.Controller < max {
+		max = c.Controller
+	}
+	if c.ControllerFraction > 0 {
+		if n := int(math.Floor(c.ControllerFraction * float64(replicas))); n < max {
+			max = n
+		}
+	}
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
+
+// a disruptive action waiting in the queue of the budgets
+type budgetRequest struct {
+	id string
+	// the namespace of the related pod; empty for the actions on the nodes
+	namespace string
+	// whether the action is over the budget of its controller at the last check
+	controllerBlocked bool
+}
+
+// ActionBudget enforces the concurrency budgets on the disruptive actions. The actions over the budgets wait in a queue,
+// and they are granted in the order they arrive, unless an earlier action waits for the budget of its own namespace
+// or controller only.
+type ActionBudget struct {
+	budgets ConcurrencyBudgets
+	// gets the number of the replicas of the controller of the pod, and the unavailable ones other than the pod;
+	// the replicas are 0 if the pod has no controller
+	controllerFunc func(pod *api.Pod) (int, int, error)
+
+	waitTimeout time.Duration
+	waitSleep   time.Duration
+
+	mutex sync.Mutex
+	// the number of the granted actions in the cluster, and per namespace
+	cluster    int
+	namespaces map[string]int
+	queue      []*budgetRequest
+}
+
+func newActionBudget(budgets ConcurrencyBudgets, controllerFunc func(pod *api.Pod) (int, int, error)) *ActionBudget {
+	return &ActionBudget{
+		budgets:        budgets,
+		controllerFunc: controllerFunc,
+		waitTimeout:    defaultBudgetWaitTimeout,
+		waitSleep:      defaultBudgetWaitSleep,
+		namespaces:     make(map[string]int),
+	}
+}
+
+// Acquires the budgets for the disruptive action on the pod, which is nil for the actions on the nodes.
+// It waits in the queue until the action fits in the budgets, and returns the function to release the budgets
+// after the action.
+// An ActionError of ActionErrorBudgetTimeout is returned if the action waits too long, or it is stopped.
+func (b *ActionBudget) acquire(id string, pod *api.Pod, progress *executor.ActionProgress, stop <-chan struct{}) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	request := &budgetRequest{id: id}
+	if pod != nil {
+		request.namespace = pod.Namespace
+	}
+	b.enqueue(request)
+
+	deadline := time.Now().Add(b.waitTimeout)
+	for waited := false; ; waited = true {
+		controllerFits, err := b.controllerFits(pod)
+		if err != nil {
+			b.dequeue(request)
+			return nil, executor.NewActionError(executor.ActionErrorAPIFailure, err,
+				"cannot check the budget of the controller of pod %s/%s", pod.Namespace, pod.Name)
+		}
+		if b.tryGrant(request, controllerFits) {
+			glog.V(3).Infof("Action %s: concurrency budgets acquired", id)
+			return func() { b.release(request) }, nil
+		}
+
+		if !waited {
+			glog.V(2).Infof("Action %s is over the concurrency budgets, waiting in the queue", id)
+			progress.Update(executor.ProgressQueued, "Waiting for the concurrency budgets")
+		}
+		if time.Now().After(deadline) {
+			b.dequeue(request)
+			return nil, executor.NewActionError(executor.ActionErrorBudgetTimeout, nil,
+				"action %s is over the concurrency budgets for %v", id, b.waitTimeout)
+		}
+
+		select {
+		case <-time.After(b.waitSleep):
+		case <-stop:
+			b.dequeue(request)
+			return nil, executor.NewActionError(executor.ActionErrorBudgetTimeout, nil,
+				"action %s is stopped while waiting for the concurrency budgets", id)
+		}
+	}
+}
+
+// Checks the budget of the controller of the pod again once the action gets its lock, as the previous actions on the
+// controller may disrupt its pods while the action waits for the lock. If the action no longer fits, it releases
+// its budgets, and acquires them again in the queue.
+// Returns the function to release the budgets after the action, which is also valid to call if an error is returned.
+func (b *ActionBudget) recheck(id string, pod *api.Pod, release func(), progress *executor.ActionProgress, stop <-chan struct{}) (func(), error) {
+	if b == nil {
+		return release, nil
+	}
+
+	controllerFits, err := b.controllerFits(pod)
+	if err != nil {
+		return release, executor.NewActionError(executor.ActionErrorAPIFailure, err,
+			"cannot check the budget of the controller of pod %s/%s", pod.Namespace, pod.Name)
+	}
+	if controllerFits {
+		return release, nil
+	}
+
+	glog.V(2).Infof("Action %s is over the budget of its controller after getting the lock, releasing its budgets", id)
+	release()
+	release, err = b.acquire(id, pod, progress, stop)
+	if err != nil {
+		return func() {}, err
+	}
+	return release, nil
+}
+
+// check whether the disruption of the pod fits in the budget of its controller
+func (b *ActionBudget) controllerFits(pod *api.Pod) (bool, error) {
+	if pod == nil || !b.budgets.limitsController() {
+		return true, nil
+	}
+	replicas, unavailable, err := b.controllerFunc(pod)
+	if err != nil {
+		return false, err
+	}
+	if replicas == 0 {
+		return true, nil
+	}
+	max := b.budgets.maxUnavailable(replicas)
+	glog.V(4).Infof("Pod %s/%s: %d of %d replicas of its controller are unavailable, at most %d",
+		pod.Namespace, pod.Name, unavailable, replicas, max)
+	return unavailable+1 <= max, nil
+}
+
+func (b *ActionBudget) enqueue(request *budgetRequest) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.queue = append(b.queue, request)
+}
+
+func (b *ActionBudget) dequeue(request *budgetRequest) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remove(request)
+}
+
+// remove the request from the queue; the caller should hold the mutex
+func (b *ActionBudget) remove(request *budgetRequest) {
+	for i, r := range b.queue {
+		if r == request {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Grants the budgets to the request if it fits. The earlier requests in the queue which are not blocked by
+// their namespaces or controllers go first: they reserve the budgets of the cluster and of their namespaces.
+func (b *ActionBudget) tryGrant(request *budgetRequest, controllerFits bool) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	request.controllerBlocked = !controllerFits
+	if !controllerFits {
+		return false
+	}
+
+	aheadCluster, aheadNamespace := 0, 0
+	for _, r := range b.queue {
+		if r == request {
+			break
+		}
+		if r.controllerBlocked || !b.namespaceFits(r.namespace, 0) {
+			continue
+		}
+		aheadCluster++
+		if r.namespace != "" && r.namespace == request.namespace {
+			aheadNamespace++
+		}
+	}
+	if b.budgets.Cluster > 0 && b.cluster+aheadCluster >= b.budgets.Cluster {
+		return false
+	}
+	if !b.namespaceFits(request.namespace, aheadNamespace) {
+		return false
+	}
+
+	b.remove(request)
+	b.cluster++
+	if request.namespace != "" {
+		b.namespaces[request.namespace]++
+	}
+	return true
+}
+
+// check whether one more action fits in the budget of the namespace, after the reserved ones;
+// the caller should hold the mutex
+func (b *ActionBudget) namespaceFits(namespace string, reserved int) bool {
+	if namespace == "" || b.budgets.Namespace <= 0 {
+		return true
+	}
+	return b.namespaces[namespace]+reserved < b.budgets.Namespace
+}
+
+func (b *ActionBudget) release(request *budgetRequest) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.cluster--
+	if request.namespace != "" {
+		if b.namespaces[request.namespace]--; b.namespaces[request.namespace] <= 0 {
+			delete(b.namespaces, request.namespace)
+		}
+	}
+	glog.V(4).Infof("Action %s: concurrency budgets released", request.id)
+}
+
+// Gets the number of the replicas of the controller of the pod, and the unavailable ones other than the pod.
+// The replicas are 0 if the pod has no controller.
+func getControllerAvailability(podsGetter v1.PodsGetter, pod *api.Pod) (int, int, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return 0, 0, nil
+	}
+	podList, err := podsGetter.Pods(pod.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return 0, 0, err
+	}
+	replicas, unavailable := countControllerPods(podList.Items, pod, owner.UID)
+	return replicas, unavailable, nil
+}
+
+// Counts the pods of the controller: the replicas are the pods not being deleted, and the unavailable ones
+// other than the given pod are the pods not ready or being deleted.
+func countControllerPods(pods []api.Pod, pod *api.Pod, controllerUID types.UID) (int, int) {
+	replicas, unavailable := 0, 0
+	for i := range pods {
+		p := &pods[i]
+		owner := metav1.GetControllerOf(p)
+		if owner == nil || owner.UID != controllerUID {
+			continue
+		}
+		if p.DeletionTimestamp == nil {
+			replicas++
+		}
+		if p.UID != pod.UID && (p.DeletionTimestamp != nil || !podutil.PodIsReady(p)) {
+			unavailable++
+		}
+	}
+	return replicas, unavailable
+}
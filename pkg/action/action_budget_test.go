@@ -0,0 +1,176 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestActionBudget(budgets ConcurrencyBudgets) *ActionBudget {
+	budget := newActionBudget(budgets, func(pod *api.Pod) (int, int, error) {
+		return 0, 0, nil
+	})
+	budget.waitTimeout = time.Millisecond * 50
+	budget.waitSleep = time.Millisecond * 5
+	return budget
+}
+
+func TestConcurrencyBudgetsMaxUnavailable(t *testing.T) {
+	tests := []struct {
+		budgets  ConcurrencyBudgets
+		replicas int
+		expected int
+	}{
+		{ConcurrencyBudgets{ControllerFraction: 0.25}, 8, 2},
+		{ConcurrencyBudgets{ControllerFraction: 0.25}, 3, 1},
+		{ConcurrencyBudgets{Controller: 3}, 10, 3},
+		{ConcurrencyBudgets{Controller: 3, ControllerFraction: 0.1}, 10, 1},
+		{ConcurrencyBudgets{Controller: 5}, 2, 2},
+	}
+	for _, test := range tests {
+		if max := test.budgets.maxUnavailable(test.replicas); max != test.expected {
+			t.Errorf("%+v with %d replicas: expected %d but got %d", test.budgets, test.replicas, test.expected, max)
+		}
+	}
+}
+
+func TestActionBudgetClusterAndNamespace(t *testing.T) {
+	budget := newTestActionBudget(ConcurrencyBudgets{Cluster: 2, Namespace: 1})
+
+	release1, err := budget.acquire("a1", newTestPod("ns1", "p1"), nil, nil)
+	if err != nil {
+		t.Fatalf("Expect the first action to acquire the budgets: %v", err)
+	}
+	// over the budget of namespace ns1
+	_, err = budget.acquire("a2", newTestPod("ns1", "p2"), nil, nil)
+	if category := executor.GetActionErrorCategory(err); category != executor.ActionErrorBudgetTimeout {
+		t.Errorf("Expect the action in the same namespace to time out, but got %v", err)
+	}
+	release3, err := budget.acquire("a3", newTestPod("ns2", "p3"), nil, nil)
+	if err != nil {
+		t.Fatalf("Expect the action in another namespace to acquire the budgets: %v", err)
+	}
+	// over the budget of the cluster
+	_, err = budget.acquire("a4", nil, nil, nil)
+	if category := executor.GetActionErrorCategory(err); category != executor.ActionErrorBudgetTimeout {
+		t.Errorf("Expect the node action to time out, but got %v", err)
+	}
+
+	release1()
+	release5, err := budget.acquire("a5", newTestPod("ns1", "p5"), nil, nil)
+	if err != nil {
+		t.Fatalf("Expect the action to acquire the released budgets: %v", err)
+	}
+	release3()
+	release5()
+	if budget.cluster != 0 || len(budget.namespaces) != 0 || len(budget.queue) != 0 {
+		t.Errorf("Expect all budgets to be released, but got cluster %d, namespaces %v and queue %d",
+			budget.cluster, budget.namespaces, len(budget.queue))
+	}
+}
+
+func TestActionBudgetQueueOrder(t *testing.T) {
+	budget := newTestActionBudget(ConcurrencyBudgets{Cluster: 1, Namespace: 1})
+
+	// the first action waits for the cluster budget, the second one waits for the budget of its namespace
+	first := &budgetRequest{id: "first", namespace: "ns1"}
+	second := &budgetRequest{id: "second", namespace: "ns2"}
+	budget.namespaces["ns2"] = 1
+	budget.queue = []*budgetRequest{first, second}
+
+	request := &budgetRequest{id: "request", namespace: "ns3"}
+	budget.queue = append(budget.queue, request)
+	if budget.tryGrant(request, true) {
+		t.Errorf("Expect the request to wait behind the first action")
+	}
+
+	// the first action is over the budget of its controller, so it doesn't reserve the cluster budget
+	first.controllerBlocked = true
+	if !budget.tryGrant(request, true) {
+		t.Errorf("Expect the request to be granted while the others are blocked by their namespace or controller")
+	}
+	if budget.cluster != 1 || budget.namespaces["ns3"] != 1 || len(budget.queue) != 2 {
+		t.Errorf("Expect the request to be granted, but got cluster %d, namespaces %v and queue %d",
+			budget.cluster, budget.namespaces, len(budget.queue))
+	}
+}
+
+func TestActionBudgetController(t *testing.T) {
+	unavailable := 1
+	budget := newTestActionBudget(ConcurrencyBudgets{ControllerFraction: 0.2})
+	budget.controllerFunc = func(pod *api.Pod) (int, int, error) {
+		return 10, unavailable, nil
+	}
+
+	release, err := budget.acquire("a1", newTestPod("ns1", "p1"), nil, nil)
+	if err != nil {
+		t.Fatalf("Expect the action to acquire the budgets: %v", err)
+	}
+	release()
+
+	unavailable = 2
+	_, err = budget.acquire("a2", newTestPod("ns1", "p2"), nil, nil)
+	if category := executor.GetActionErrorCategory(err); category != executor.ActionErrorBudgetTimeout {
+		t.Errorf("Expect the action over the budget of its controller to time out, but got %v", err)
+	}
+
+	// node actions are not limited by the controllers
+	if _, err := budget.acquire("a3", nil, nil, nil); err != nil {
+		t.Errorf("Expect the node action to acquire the budgets: %v", err)
+	}
+}
+
+func TestActionBudgetRecheck(t *testing.T) {
+	unavailable := 0
+	budget := newTestActionBudget(ConcurrencyBudgets{Cluster: 1, Controller: 1})
+	budget.controllerFunc = func(pod *api.Pod) (int, int, error) {
+		return 10, unavailable, nil
+	}
+
+	pod := newTestPod("ns1", "p1")
+	release, err := budget.acquire("a1", pod, nil, nil)
+	if err != nil {
+		t.Fatalf("Expect the action to acquire the budgets: %v", err)
+	}
+	release, err = budget.recheck("a1", pod, release, nil, nil)
+	if err != nil || budget.cluster != 1 {
+		t.Fatalf("Expect the action to keep the budgets, but got error %v and cluster %d", err, budget.cluster)
+	}
+
+	// another action on the controller disrupted a pod while the action waited for the lock
+	unavailable = 1
+	release, err = budget.recheck("a1", pod, release, nil, nil)
+	if category := executor.GetActionErrorCategory(err); category != executor.ActionErrorBudgetTimeout {
+		t.Errorf("Expect the action over the budget of its controller to time out, but got %v", err)
+	}
+	release()
+	if budget.cluster != 0 || len(budget.queue) != 0 {
+		t.Errorf("Expect the budgets to be released while waiting for the controller, but got cluster %d and queue %d",
+			budget.cluster, len(budget.queue))
+	}
+}
+
+func TestCountControllerPods(t *testing.T) {
+	isController := true
+	owner := []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "rs", UID: "rs-uid", Controller: &isController}}
+	now := metav1.Now()
+	ready := []api.PodCondition{{Type: api.PodReady, Status: api.ConditionTrue}}
+	notReady := []api.PodCondition{{Type: api.PodReady, Status: api.ConditionFalse}}
+
+	pods := []api.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1", UID: "p1", OwnerReferences: owner}, Status: api.PodStatus{Conditions: notReady}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p2", UID: "p2", OwnerReferences: owner}, Status: api.PodStatus{Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p3", UID: "p3", OwnerReferences: owner}, Status: api.PodStatus{Conditions: notReady}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p4", UID: "p4", OwnerReferences: owner, DeletionTimestamp: &now}, Status: api.PodStatus{Conditions: ready}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other"}, Status: api.PodStatus{Conditions: notReady}},
+	}
+
+	// the pod itself is not counted as unavailable
+	replicas, unavailable := countControllerPods(pods, &pods[0], "rs-uid")
+	if replicas != 3 || unavailable != 2 {
+		t.Errorf("Expect 3 replicas and 2 unavailable, but got %d and %d", replicas, unavailable)
+	}
+}
@@ -0,0 +1,196 @@
+package action
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// the reasons of the Kubernetes Events for the actions
+const (
+	actionStartedEventReason   = "TurboActionStarted"
+	actionSucceededEventReason = "TurboActionSucceeded"
+	actionFailedEventReason    = "TurboActionFailed"
+	dryRunEventReason          = "TurboActionDryRun"
+)
+
+// actionEvents records the Kubernetes Events of an action on the objects it affects: the related pod and its controller,
+// the source and destination nodes of a move, the node of a node action, or the namespace of a quota resize.
+type actionEvents struct {
+	recorder    record.EventRecorder
+	id          string
+	description string
+	objects     []*api.ObjectReference
+}
+
+// Builds the events of the action on its related pod, which is nil for the actions without a related pod
+// or if the pod is not found.
+// Returns nil, which records nothing, if there is no event recorder.
+func newActionEvents(recorder record.EventRecorder, kubeClient *client.Clientset, actionItem *proto.ActionItemDTO, pod *api.Pod) *actionEvents {
+	if recorder == nil {
+		return nil
+	}
+
+	e := &actionEvents{
+		recorder:    recorder,
+		id:          actionItem.GetUuid(),
+		description: describeAction(actionItem, pod),
+	}
+	actionType := getTurboActionType(actionItem)
+	target := actionItem.GetTargetSE().GetDisplayName()
+	podEntity := relatedPodEntity(actionItem)
+
+	switch {
+	case pod != nil:
+		e.objects = append(e.objects, podReference(pod))
+		if controller := getControllerReference(kubeClient, pod); controller != nil {
+			e.objects = append(e.objects, controller)
+		}
+		if actionType == turboActionPodMove {
+			if pod.Spec.NodeName != "" {
+				e.objects = append(e.objects, nodeReference(pod.Spec.NodeName))
+			}
+			if node := actionItem.GetNewSE().GetDisplayName(); node != "" {
+				e.objects = append(e.objects, nodeReference(node))
+			}
+		}
+	case podEntity != nil:
+		// the pod is not found, so refer to it by its entity
+		if namespace, name, err := podutil.ParsePodDisplayName(podEntity.GetDisplayName()); err == nil {
+			e.objects = append(e.objects, &api.ObjectReference{
+				Kind:       "Pod",
+				APIVersion: "v1",
+				Namespace:  namespace,
+				Name:       name,
+				UID:        types.UID(podEntity.GetId()),
+			})
+		}
+	case actionType == turboActionQuotaResize:
+		e.objects = append(e.objects, &api.ObjectReference{Kind: "Namespace", Name: target})
+	case target != "":
+		e.objects = append(e.objects, nodeReference(target))
+	}
+	return e
+}
+
+// describe the action, e.g., "move of pod default/foo from node node-1 to node-2"
+func describeAction(actionItem *proto.ActionItemDTO, pod *api.Pod) string {
+	action := policyActionNames[actionItem.GetActionType()]
+	actionType := getTurboActionType(actionItem)
+	podEntity := relatedPodEntity(actionItem)
+
+	switch {
+	case actionType == turboActionContainerResize:
+		return fmt.Sprintf("%s of container %s", action, actionItem.GetTargetSE().GetDisplayName())
+	case pod != nil && actionType == turboActionPodMove:
+		return fmt.Sprintf("%s of pod %s/%s from node %s to %s", action, pod.Namespace, pod.Name,
+			pod.Spec.NodeName, actionItem.GetNewSE().GetDisplayName())
+	case pod != nil:
+		return fmt.Sprintf("%s of pod %s/%s", action, pod.Namespace, pod.Name)
+	case podEntity != nil:
+		return fmt.Sprintf("%s of pod %s", action, podEntity.GetDisplayName())
+	case actionType == turboActionQuotaResize:
+		return fmt.Sprintf("%s of quota %s", action, actionItem.GetTargetSE().GetDisplayName())
+	}
+	return fmt.Sprintf("%s of node %s", action, actionItem.GetTargetSE().GetDisplayName())
+}
+
+func (e *actionEvents) started() {
+	if e == nil {
+		return
+	}
+	e.record(api.EventTypeNormal, actionStartedEventReason, "Action %s started: %s", e.id, e.description)
+}
+
+// Records the result of the action: the dry run, the success with the new pod, if any, or the failure.
+func (e *actionEvents) finished(output *executor.TurboActionExecutorOutput, err error) {
+	if e == nil {
+		return
+	}
+	if err != nil {
+		e.record(api.EventTypeWarning, actionFailedEventReason, "Action %s failed: %s: %s", e.id, e.description,
+			executor.DescribeActionError(err))
+		return
+	}
+	if output != nil && output.DryRun {
+		e.record(api.EventTypeNormal, dryRunEventReason, "Dry run of action %s: %s", e.id, output.Diff)
+		return
+	}
+
+	if output != nil && output.NewPod != nil && output.NewPod.Name != "" {
+		ref := podReference(output.NewPod)
+		if ref.Namespace == "" && output.OldPod != nil {
+			ref.Namespace = output.OldPod.Namespace
+		}
+		// the original pod may be deleted, so the event is recorded on the new pod too
+		e.objects = append(e.objects, ref)
+		e.record(api.EventTypeNormal, actionSucceededEventReason, "Action %s succeeded: %s, new pod %s/%s", e.id, e.description,
+			ref.Namespace, ref.Name)
+		return
+	}
+	e.record(api.EventTypeNormal, actionSucceededEventReason, "Action %s succeeded: %s", e.id, e.description)
+}
+
+func (e *actionEvents) record(eventType, reason, messageFmt string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	for _, object := range e.objects {
+		e.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+	}
+}
+
+func podReference(pod *api.Pod) *api.ObjectReference {
+	return &api.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// The kubelet records the events of a node with its name as the UID, as expected by kubectl describe.
+func nodeReference(name string) *api.ObjectReference {
+	return &api.ObjectReference{
+		Kind:       "Node",
+		APIVersion: "v1",
+		Name:       name,
+		UID:        types.UID(name),
+	}
+}
+
+// Gets the reference of the controller of the pod; the Deployment is returned instead of its ReplicaSet.
+// Returns nil if the pod has no controller.
+func getControllerReference(kubeClient *client.Clientset, pod *api.Pod) *api.ObjectReference {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+
+	if strings.EqualFold(owner.Kind, "ReplicaSet") && kubeClient != nil {
+		rs, err := kubeClient.ExtensionsV1beta1().ReplicaSets(pod.Namespace).Get(owner.Name, metav1.GetOptions{})
+		if err != nil {
+			glog.Warningf("Failed to get ReplicaSet %s/%s of pod %s: %v", pod.Namespace, owner.Name, pod.Name, err)
+		} else if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil {
+			owner = rsOwner
+		}
+	}
+
+	return &api.ObjectReference{
+		Kind:       owner.Kind,
+		APIVersion: owner.APIVersion,
+		Namespace:  pod.Namespace,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/turbonomic/kubeturbo/pkg/action/executor"
 	"github.com/turbonomic/kubeturbo/pkg/action/util"
@@ -22,6 +26,12 @@ import (
 const (
 	defaultActionCacheTTL  = time.Second * 100
 	defaultPodNameCacheTTL = 10 * time.Minute
+
+	defaultCloneGCInterval    = 5 * time.Minute
+	defaultCloneGCGracePeriod = 30 * time.Minute
+
+	// the interval to reconcile the action journal, for the entries of the other instances which are gone later
+	defaultJournalReconcileInterval = 2 * time.Minute
 )
 
 type turboActionType struct {
@@ -34,6 +44,10 @@ var (
 	turboActionPodMove             turboActionType = turboActionType{proto.ActionItemDTO_MOVE, proto.EntityDTO_CONTAINER_POD}
 	turboActionContainerResize     turboActionType = turboActionType{proto.ActionItemDTO_RIGHT_SIZE, proto.EntityDTO_CONTAINER}
 	turboActionContainerPodSuspend turboActionType = turboActionType{proto.ActionItemDTO_SUSPEND, proto.EntityDTO_CONTAINER_POD}
+	turboActionNodeSuspend         turboActionType = turboActionType{proto.ActionItemDTO_SUSPEND, proto.EntityDTO_VIRTUAL_MACHINE}
+	turboActionNodeStart           turboActionType = turboActionType{proto.ActionItemDTO_START, proto.EntityDTO_VIRTUAL_MACHINE}
+	turboActionNodeProvision       turboActionType = turboActionType{proto.ActionItemDTO_PROVISION, proto.EntityDTO_VIRTUAL_MACHINE}
+	turboActionQuotaResize         turboActionType = turboActionType{proto.ActionItemDTO_RIGHT_SIZE, proto.EntityDTO_VIRTUAL_DATACENTER}
 
 	//turboActionUnbind          turboActionType = "unbind"
 )
@@ -43,6 +57,53 @@ type ActionHandlerConfig struct {
 	kubeletClient  *kubeclient.KubeletClient
 	StopEverything chan struct{}
 	sccAllowedSet  map[string]struct{}
+
+	// delete pods through the Eviction subresource to honor PodDisruptionBudgets
+	usePodEviction bool
+
+	// the container resize mode for the pods owned by controllers
+	containerResizeMode string
+
+	// how to scale the controllers which are scaled by HorizontalPodAutoscalers
+	hpaScalingPolicy string
+
+	// how to move the pods with emptyDir volumes: allow or refuse
+	emptyDirPolicy string
+
+	// the extended resources of the containers resized by the commodities of the types, e.g., nvidia.com/gpu
+	extendedResources map[proto.CommodityDTO_CommodityType]api.ResourceName
+
+	// execute all the actions in dry-run mode
+	dryRun bool
+
+	// the recorder of the Kubernetes Events for the actions
+	recorder record.EventRecorder
+
+	// the namespace of the ConfigMap storing the action journal; default to the namespace kubeturbo runs in
+	journalNamespace string
+
+	// the store of the action locks: memory, or lease to share the locks with the other kubeturbo instances
+	lockStore string
+
+	// the garbage collector of the orphaned clone pods: the mode, the interval to run,
+	// and how long a clone pod is left alone after its creation
+	cloneGCMode        string
+	cloneGCInterval    time.Duration
+	cloneGCGracePeriod time.Duration
+
+	// which actions may be executed; nil to allow all
+	executionPolicy *ExecutionPolicy
+
+	// how many disruptive actions may be executed at the same time
+	concurrencyBudgets ConcurrencyBudgets
+
+	// the audit log of the executed actions; nil if disabled
+	auditLog *AuditLog
+
+	// all the actions wait for the approval of their TurboActions before being executed, and how long they wait.
+	// Otherwise only the actions on the pods in the namespaces with the approval annotation wait for the approval.
+	approvalRequired bool
+	approvalTimeout  time.Duration
 }
 
 func NewActionHandlerConfig(kubeClient *client.Clientset, kubeletClient *kubeclient.KubeletClient, sccSupport []string) *ActionHandlerConfig {
@@ -57,20 +118,136 @@ func NewActionHandlerConfig(kubeClient *client.Clientset, kubeletClient *kubecli
 		kubeletClient:  kubeletClient,
 		StopEverything: make(chan struct{}),
 		sccAllowedSet:  sccAllowedSet,
+
+		containerResizeMode: executor.ContainerResizeModePod,
+		hpaScalingPolicy:    executor.HPAScalingPolicyRefuse,
+		emptyDirPolicy:      executor.EmptyDirPolicyAllow,
+		lockStore:           ActionLockStoreMemory,
+
+		cloneGCMode:        executor.CloneGCModeDelete,
+		cloneGCInterval:    defaultCloneGCInterval,
+		cloneGCGracePeriod: defaultCloneGCGracePeriod,
 	}
 
 	return config
 }
 
+func (c *ActionHandlerConfig) WithPodEviction(usePodEviction bool) *ActionHandlerConfig {
+	c.usePodEviction = usePodEviction
+	return c
+}
+
+func (c *ActionHandlerConfig) WithContainerResizeMode(mode string) *ActionHandlerConfig {
+	if mode != "" {
+		c.containerResizeMode = mode
+	}
+	return c
+}
+
+func (c *ActionHandlerConfig) WithHPAScalingPolicy(policy string) *ActionHandlerConfig {
+	if policy != "" {
+		c.hpaScalingPolicy = policy
+	}
+	return c
+}
+
+func (c *ActionHandlerConfig) WithEmptyDirPolicy(policy string) *ActionHandlerConfig {
+	if policy != "" {
+		c.emptyDirPolicy = policy
+	}
+	return c
+}
+
+func (c *ActionHandlerConfig) WithExtendedResources(resources map[proto.CommodityDTO_CommodityType]api.ResourceName) *ActionHandlerConfig {
+	c.extendedResources = resources
+	return c
+}
+
+func (c *ActionHandlerConfig) WithDryRun(dryRun bool) *ActionHandlerConfig {
+	c.dryRun = dryRun
+	return c
+}
+
+func (c *ActionHandlerConfig) WithEventRecorder(recorder record.EventRecorder) *ActionHandlerConfig {
+	c.recorder = recorder
+	return c
+}
+
+func (c *ActionHandlerConfig) WithActionLockStore(store string) *ActionHandlerConfig {
+	if store != "" {
+		c.lockStore = store
+	}
+	return c
+}
+
+func (c *ActionHandlerConfig) WithActionJournalNamespace(namespace string) *ActionHandlerConfig {
+	c.journalNamespace = namespace
+	return c
+}
+
+// Set the garbage collector of the orphaned clone pods; the empty mode and non-positive durations are ignored.
+func (c *ActionHandlerConfig) WithCloneGarbageCollector(mode string, interval, gracePeriod time.Duration) *ActionHandlerConfig {
+	if mode != "" {
+		c.cloneGCMode = mode
+	}
+	if interval > 0 {
+		c.cloneGCInterval = interval
+	}
+	if gracePeriod > 0 {
+		c.cloneGCGracePeriod = gracePeriod
+	}
+	return c
+}
+
+// the mode of the garbage collector of the orphaned clone pods, which only reports them under the global dry-run
+func (c *ActionHandlerConfig) getCloneGCMode() string {
+	if c.dryRun && c.cloneGCMode == executor.CloneGCModeDelete {
+		return executor.CloneGCModeReport
+	}
+	return c.cloneGCMode
+}
+
+func (c *ActionHandlerConfig) WithExecutionPolicy(policy *ExecutionPolicy) *ActionHandlerConfig {
+	c.executionPolicy = policy
+	return c
+}
+
+func (c *ActionHandlerConfig) WithApproval(required bool, timeout time.Duration) *ActionHandlerConfig {
+	c.approvalRequired = required
+	c.approvalTimeout = timeout
+	return c
+}
+
+func (c *ActionHandlerConfig) WithAuditLog(auditLog *AuditLog) *ActionHandlerConfig {
+	c.auditLog = auditLog
+	return c
+}
+
+func (c *ActionHandlerConfig) WithConcurrencyBudgets(budgets ConcurrencyBudgets) *ActionHandlerConfig {
+	c.concurrencyBudgets = budgets
+	return c
+}
+
 type ActionHandler struct {
 	config *ActionHandlerConfig
 
 	actionExecutors map[turboActionType]executor.TurboActionExecutor
+	// executes the action items of a composite action together
+	compositeExecutor executor.TurboActionExecutor
 
 	//concurrency control
 	lockStore IActionLockStore
 
 	podManager util.IPodManager
+
+	// to check the dry-run annotation of the namespaces
+	namespacesGetter v1.NamespacesGetter
+
+	// records the steps of the actions, to complete or revert them after a restart
+	journal *executor.ActionJournal
+
+	// the concurrency budgets of the disruptive actions; nil if not limited
+	budget *ActionBudget
 }
 
 // Build new ActionHandler and start it.
@@ -80,33 +257,75 @@ func NewActionHandler(config *ActionHandlerConfig) *ActionHandler {
 	podCachedManager := util.NewPodCachedManager(turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache, podsGetter)
 
 	handler := &ActionHandler{
-		config:          config,
-		actionExecutors: make(map[turboActionType]executor.TurboActionExecutor),
-		podManager:      podCachedManager,
+		config:           config,
+		actionExecutors:  make(map[turboActionType]executor.TurboActionExecutor),
+		podManager:       podCachedManager,
+		namespacesGetter: config.kubeClient.CoreV1(),
+		journal:          executor.NewActionJournal(config.kubeClient, config.journalNamespace),
 	}
 
 	go lmap.Run(config.StopEverything)
 	handler.registerActionExecutors()
-	handler.lockStore = newActionLockStore(lmap, handler.getRelatedPod)
+	if config.lockStore == ActionLockStoreLease {
+		leaseClient := newRESTLeaseClient(config.kubeClient, executor.GetKubeturboNamespace())
+		handler.lockStore = newLeaseActionLockStore(leaseClient, defaultActionCacheTTL, handler.getRelatedPod)
+	} else {
+		handler.lockStore = newActionLockStore(lmap, handler.getRelatedPod)
+	}
+	if config.concurrencyBudgets.enabled() {
+		handler.budget = newActionBudget(config.concurrencyBudgets, func(pod *api.Pod) (int, int, error) {
+			return getControllerAvailability(podsGetter, pod)
+		})
+	}
 
 	return handler
 }
 
+// Start completes or reverts the actions interrupted by the restarts of the kubeturbo instances, periodically
+// as the other instances sharing the journal may be gone later, deletes the completed TurboActions periodically,
+// and starts the garbage collector of the orphaned clone pods.
+// Under the global dry-run, nothing is changed: the interrupted actions are not reconciled, the TurboActions are not
+// deleted, and the orphaned clone pods are only reported.
+func (h *ActionHandler) Start() {
+	c := h.config
+	if c.dryRun {
+		glog.V(2).Infof("Dry run: the interrupted actions in the action journal are not reconciled.")
+	} else {
+		go wait.Until(h.journal.Reconcile, defaultJournalReconcileInterval, c.StopEverything)
+		go wait.Until(func() { collectTurboActions(c.kubeClient, defaultTurboActionRetention) }, defaultTurboActionGCInterval, c.StopEverything)
+	}
+
+	gc := executor.NewCloneGarbageCollector(c.kubeClient, c.getCloneGCMode(), c.cloneGCInterval, c.cloneGCGracePeriod).
+		WithJournal(h.journal).
+		WithEventRecorder(c.recorder)
+	go gc.Run(c.StopEverything)
+}
+
 // Register supported action executor.
 // As action executor is stateless, they can be safely reused.
 func (h *ActionHandler) registerActionExecutors() {
 	c := h.config
-	ae := executor.NewTurboK8sActionExecutor(c.kubeClient, h.podManager)
+	ae := executor.NewTurboK8sActionExecutor(c.kubeClient, h.podManager, c.usePodEviction, h.journal)
 
-	reScheduler := executor.NewReScheduler(ae, c.sccAllowedSet)
+	reScheduler := executor.NewReScheduler(ae, c.sccAllowedSet).WithEmptyDirPolicy(c.emptyDirPolicy)
 	h.actionExecutors[turboActionPodMove] = reScheduler
 
-	horizontalScaler := executor.NewHorizontalScaler(ae)
+	horizontalScaler := executor.NewHorizontalScaler(ae, c.hpaScalingPolicy)
 	h.actionExecutors[turboActionPodProvision] = horizontalScaler
 	h.actionExecutors[turboActionContainerPodSuspend] = horizontalScaler
 
-	containerResizer := executor.NewContainerResizer(ae, c.kubeletClient, c.sccAllowedSet)
+	containerResizer := executor.NewContainerResizer(ae, c.kubeletClient, c.sccAllowedSet, c.containerResizeMode).
+		WithExtendedResources(c.extendedResources)
 	h.actionExecutors[turboActionContainerResize] = containerResizer
+
+	nodeSuspender := executor.NewNodeSuspender(ae)
+	h.actionExecutors[turboActionNodeSuspend] = nodeSuspender
+	h.actionExecutors[turboActionNodeStart] = nodeSuspender
+	h.actionExecutors[turboActionNodeProvision] = executor.NewNodeProvisioner(ae)
+
+	h.actionExecutors[turboActionQuotaResize] = executor.NewQuotaResizer(ae, c.kubeletClient)
+
+	h.compositeExecutor = executor.NewCompositeActionExecutor(ae, reScheduler, containerResizer)
 }
 
 // Implement ActionExecutorClient interface defined in Go SDK.
@@ -115,72 +334,235 @@ func (h *ActionHandler) ExecuteAction(actionExecutionDTO *proto.ActionExecutionD
 	accountValues []*proto.AccountValue,
 	progressTracker sdkprobe.ActionProgressTracker) (*proto.ActionResult, error) {
 
-	// 1. get the action, NOTE: only deal with one action item in current implementation.
-	// Check if the action execution DTO is valid, including if the action is supported or not
+	// 1. get the action items; multiple action items are executed together as a composite action on the same pod.
+	// Check if the action execution DTO is valid, including if the actions are supported or not
 	if err := h.checkActionExecutionDTO(actionExecutionDTO); err != nil {
-		err := fmt.Errorf("Action is not valid: %v", err.Error())
+		if _, ok := err.(*executor.ActionError); !ok {
+			err = executor.NewActionError(executor.ActionErrorInvalidAction, err, "Action is not valid")
+		}
 		glog.Errorf(err.Error())
-		return h.failedResult(err.Error()), err
+		return h.failedResult(err), err
 	}
 
-	actionItemDTO := actionExecutionDTO.GetActionItem()[0]
+	actionItems := actionExecutionDTO.GetActionItem()
 
-	// 2. keep sending fake progress to prevent timeout
+	// 2. report the stages of the action, and keep re-sending the current stage to prevent timeout
+	progress := executor.NewActionProgress(progressTracker)
 	stop := make(chan struct{})
 	defer close(stop)
-	go keepAlive(progressTracker, stop)
+	go progress.KeepAlive(stop)
 
 	// 3. execute the action
 	glog.V(3).Infof("Now wait for action result")
-	err := h.execute(actionItemDTO)
+	output, err := h.execute(actionItems, progress)
 	if err != nil {
-		return h.failedResult(err.Error()), nil
+		return h.failedResult(err), nil
 	}
 
-	return h.goodResult(), nil
+	if output != nil && output.DryRun {
+		return h.dryRunResult(output.Diff), nil
+	}
+	return h.goodResult(output), nil
 }
 
-func (h *ActionHandler) execute(actionItem *proto.ActionItemDTO) error {
+// Executes the action items. A single action item is executed by the executor of its type; multiple action items
+// are executed together by the composite executor, and they must all relate to the same pod.
+// The start and the result of the action are recorded as Kubernetes Events on the objects it affects,
+// and every action is recorded in the audit log.
+func (h *ActionHandler) execute(actionItems []*proto.ActionItemDTO, progress *executor.ActionProgress) (output *executor.TurboActionExecutorOutput, err error) {
+	actionItem := actionItems[0]
+	actionType := getTurboActionType(actionItem)
+
+	var pod *api.Pod
+	start := time.Now()
+	defer func() {
+		h.config.auditLog.record(newAuditEntry(actionItems, pod, start, time.Now(), output, err))
+	}()
+
+	// Resolve the related pod, and whether the action is executed in dry-run mode, once for the checks before the lock.
+	// All actions but the ones on the nodes and the quotas need to get its related pod. If not needed, the pod is nil.
+	pod = h.getRelatedPod(actionItem)
+	// Record the events of the action from here on, so that the failures before the execution, e.g., a rejected
+	// approval or a lock timeout, are recorded too.
+	events := newActionEvents(h.config.recorder, h.config.kubeClient, actionItem, pod)
+	defer func() { events.finished(output, err) }()
+	if pod == nil && !hasNoRelatedPod(actionType) {
+		return nil, executor.NewActionError(executor.ActionErrorPodNotFound, nil, "Cannot find the related pod for action item %s", actionItem.GetUuid())
+	}
+	dryRun, err := h.isDryRun(pod)
+	if err != nil {
+		return nil, executor.NewActionError(executor.ActionErrorAPIFailure, err, "cannot check the dry-run annotation of namespace %s", pod.Namespace)
+	}
+
+	// Wait for the approval of the action before acquiring the lock, so that the other actions are not blocked.
+	approval, err := h.waitForApproval(actionItems, pod, dryRun, progress)
+	defer func() { approval.complete(err) }()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold or refuse the disruptive action outside its maintenance windows before acquiring the lock,
+	// so that the other actions are not blocked while it is held.
+	if err := h.waitForMaintenanceWindow(actionItem, pod, dryRun, progress); err != nil {
+		return nil, err
+	}
+
+	// Wait in the queue until the disruptive action fits in the concurrency budgets, also before acquiring the lock.
+	release, err := h.acquireBudget(actionItem, pod, dryRun, progress)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { release() }()
 
 	// Acquire the lock for the actionItem. It blocks the action execution if the lock
 	// is used by other action. It results in error return if timed out (set in lockStore).
-	if lock, err := h.lockStore.getLock(actionItem); err != nil {
-		return err
-	} else {
-		// Unlock the entity after the action execution is finished
-		defer glog.V(4).Infof("Action %s: releasing lock", actionItem.GetUuid())
-		defer lock.ReleaseLock()
-		lock.KeepRenewLock()
+	// The action items of a composite action relate to the same pod, so they share the lock of the first one.
+	lock, err := h.lockStore.getLock(actionItem)
+	if err != nil {
+		return nil, executor.NewActionError(executor.ActionErrorLockTimeout, err, "cannot acquire the lock for action %s", actionItem.GetUuid())
 	}
+	// Unlock the entity after the action execution is finished
+	defer glog.V(4).Infof("Action %s: releasing lock", actionItem.GetUuid())
+	defer lock.ReleaseLock()
+	lock.KeepRenewLock()
+	progress.Update(executor.ProgressLockAcquired, "Lock acquired for action %s", actionItem.GetUuid())
 
 	// After getting the lock, need to get the k8s pod again as the previous action could delete the pod and create a new one.
 	// In such case, the action should be applied on the new pod.
-	// Currently, all actions need to get its related pod. If not needed, the pod is nil.
-	pod := h.getRelatedPod(actionItem)
+	pod = h.getRelatedPod(actionItem)
+	if pod == nil && !hasNoRelatedPod(actionType) {
+		err := executor.NewActionError(executor.ActionErrorPodNotFound, nil, "Cannot find the related pod for action item %s", actionItem.GetUuid())
+		return nil, err
+	}
+	// The action is applied on the pod found after getting the lock, so record its events on that pod.
+	events = newActionEvents(h.config.recorder, h.config.kubeClient, actionItem, pod)
 
-	if pod == nil {
-		err := fmt.Errorf("Cannot find the related pod for action item %s", actionItem.GetUuid())
-		return err
+	if err := h.recheckMaintenanceWindow(actionItem, pod, dryRun); err != nil {
+		return nil, err
+	}
+	// The previous actions on the controller of the pod may disrupt its pods while waiting for the lock.
+	if release, err = h.recheckBudget(actionItem, pod, dryRun, release, progress); err != nil {
+		return nil, err
 	}
 
 	input := &executor.TurboActionExecutorInput{
-		ActionItem: actionItem,
-		Pod:        pod,
+		ActionItem:  actionItem,
+		ActionItems: actionItems,
+		Pod:         pod,
+		DryRun:      dryRun,
+		Progress:    progress,
 	}
-	actionType := getTurboActionType(actionItem)
 	worker := h.actionExecutors[actionType]
-	output, err := worker.Execute(input)
+	if len(actionItems) > 1 {
+		if err := h.checkCompositeAction(actionItems, pod); err != nil {
+			return nil, err
+		}
+		worker = h.compositeExecutor
+	}
+	if err := checkLockLost(actionItem, lock); err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		events.started()
+	}
+	output, err = worker.Execute(input)
 
 	if err != nil {
 		msg := fmt.Errorf("Action %v on %s failed.", actionType, actionItem.GetTargetSE().GetEntityType())
 		glog.Errorf(msg.Error())
-		return err
+		return nil, err
+	}
+	// Another action may have changed the same entity once the lock was lost, so the result can't be trusted.
+	if err := checkLockLost(actionItem, lock); err != nil {
+		return nil, err
+	}
+
+	if output.DryRun {
+		glog.V(2).Infof("Dry run of action %s: %s", actionItem.GetUuid(), output.Diff)
 	}
 
 	// Process the action execution output, including caching the pod name change.
 	h.processOutput(output)
 
-	return nil
+	return output, nil
+}
+
+// Checks whether the lock of the action is lost, i.e., it expired and is taken by another action.
+// Returns an ActionError of ActionErrorLockLost if so.
+func checkLockLost(actionItem *proto.ActionItemDTO, lock IActionLock) error {
+	select {
+	case <-lock.Lost():
+		return executor.NewActionError(executor.ActionErrorLockLost, nil, "lost the lock of action %s to another action", actionItem.GetUuid())
+	default:
+		return nil
+	}
+}
+
+// Checks whether the action on the pod should be executed in dry-run mode: either all the actions are
+// executed in dry-run mode, or the namespace of the pod has the dry-run annotation set to "true".
+// The actions without a related pod, e.g., the actions on the nodes, are only executed in dry-run mode in the former case.
+func (h *ActionHandler) isDryRun(pod *api.Pod) (bool, error) {
+	if h.config.dryRun {
+		return true, nil
+	}
+	return h.hasNamespaceAnnotation(pod, executor.DryRunAnnotationKey)
+}
+
+// Checks whether the action requires approval: either all the actions require approval, or the namespace of the pod
+// has the approval annotation set to "true". The actions in dry-run mode never require approval.
+func (h *ActionHandler) requiresApproval(pod *api.Pod, dryRun bool) (bool, error) {
+	if dryRun {
+		return false, nil
+	}
+	if h.config.approvalRequired {
+		return true, nil
+	}
+	return h.hasNamespaceAnnotation(pod, executor.ApprovalAnnotationKey)
+}
+
+// Checks whether the namespace of the pod has the annotation set to "true"; false if the pod is nil.
+func (h *ActionHandler) hasNamespaceAnnotation(pod *api.Pod, key string) (bool, error) {
+	if pod == nil || h.namespacesGetter == nil {
+		return false, nil
+	}
+
+	ns, err := h.namespacesGetter.Namespaces().Get(pod.Namespace, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get namespace %s to check the annotation %s: %v", pod.Namespace, key, err)
+		return false, err
+	}
+
+	return strings.EqualFold(ns.Annotations[key], "true"), nil
+}
+
+// Creates the TurboAction of the action items on the pod and waits until it is approved, if the action requires approval.
+// Returns nil if no approval is required, or an ActionError if the action is not approved.
+// The progress keeps being re-sent to the server while waiting.
+func (h *ActionHandler) waitForApproval(actionItems []*proto.ActionItemDTO, pod *api.Pod, dryRun bool, progress *executor.ActionProgress) (*turboActionApproval, error) {
+	actionItem := actionItems[0]
+	required, err := h.requiresApproval(pod, dryRun)
+	if err != nil {
+		return nil, executor.NewActionError(executor.ActionErrorAPIFailure, err, "cannot check whether action %s requires approval", actionItem.GetUuid())
+	}
+	if !required {
+		return nil, nil
+	}
+
+	namespace := newPolicyTarget(actionItem, pod).namespace
+	if namespace == "" {
+		namespace = executor.GetKubeturboNamespace()
+	}
+	approval := newTurboActionApproval(h.config.kubeClient, newTurboAction(namespace, actionItems, pod), h.config.approvalTimeout)
+	if err := approval.create(); err != nil {
+		return nil, executor.NewActionError(executor.ActionErrorAPIFailure, err, "cannot create %s for approval", approval)
+	}
+	glog.V(2).Infof("Action %s is waiting for the approval of %s", actionItem.GetUuid(), approval)
+	progress.Update(executor.ProgressStarted, "Waiting for the approval of %s", approval)
+
+	if err := approval.wait(h.config.StopEverything); err != nil {
+		return nil, err
+	}
+	return approval, nil
 }
 
 // Finds the pod associated to the action item dto. The pod, if any, will be used to lock the associated actions.
@@ -188,20 +570,8 @@ func (h *ActionHandler) execute(actionItem *proto.ActionItemDTO) error {
 // - Pod Move/Provision: returns the pod, which is the target SE in the action item
 // - Container Resize: returns the pod, which is the hostedBy SE in the action item
 func (h *ActionHandler) getRelatedPod(actionItem *proto.ActionItemDTO) *api.Pod {
-	actionType := getTurboActionType(actionItem)
-	var podEntity *proto.EntityDTO
-	se := actionItem.GetTargetSE()
-
-	switch actionType {
-	case turboActionContainerResize:
-		podEntity = actionItem.GetHostedBySE()
-	case turboActionPodMove:
-		podEntity = se
-	case turboActionPodProvision:
-		podEntity = se
-	case turboActionContainerPodSuspend:
-		podEntity = se
-	default:
+	podEntity := relatedPodEntity(actionItem)
+	if podEntity == nil {
 		return nil
 	}
 
@@ -214,6 +584,17 @@ func (h *ActionHandler) getRelatedPod(actionItem *proto.ActionItemDTO) *api.Pod
 	return pod
 }
 
+// Gets the entity of the pod related to the action item, or nil for the actions on the nodes and the quotas.
+func relatedPodEntity(actionItem *proto.ActionItemDTO) *proto.EntityDTO {
+	switch getTurboActionType(actionItem) {
+	case turboActionContainerResize:
+		return actionItem.GetHostedBySE()
+	case turboActionPodMove, turboActionPodProvision, turboActionContainerPodSuspend:
+		return actionItem.GetTargetSE()
+	}
+	return nil
+}
+
 // Processes the output of the action execution generated by the executor.
 // The pod change made by the executor, if any, will be cached in the pod manager for
 // further actions on the same pod.
@@ -231,11 +612,24 @@ func getTurboActionType(ai *proto.ActionItemDTO) turboActionType {
 	return turboActionType{ai.GetActionType(), ai.GetTargetSE().GetEntityType()}
 }
 
-func (h *ActionHandler) goodResult() *proto.ActionResult {
+// Checks whether the action has no related pod, e.g., the actions on the nodes and the namespace quotas
+func hasNoRelatedPod(actionType turboActionType) bool {
+	switch actionType {
+	case turboActionNodeSuspend, turboActionNodeStart, turboActionNodeProvision, turboActionQuotaResize:
+		return true
+	}
+	return false
+}
+
+// The description of the succeeded result is followed by the note of the output, if any.
+func (h *ActionHandler) goodResult(output *executor.TurboActionExecutorOutput) *proto.ActionResult {
 
 	state := proto.ActionResponseState_SUCCEEDED
 	progress := int32(100)
 	msg := "Success"
+	if output != nil && output.Note != "" {
+		msg += ": " + output.Note
+	}
 
 	res := &proto.ActionResponse{
 		ActionResponseState: &state,
@@ -248,11 +642,11 @@ func (h *ActionHandler) goodResult() *proto.ActionResult {
 	}
 }
 
-func (h *ActionHandler) failedResult(msg string) *proto.ActionResult {
+func (h *ActionHandler) dryRunResult(diff string) *proto.ActionResult {
 
-	state := proto.ActionResponseState_FAILED
-	progress := int32(0)
-	msg = "Failed"
+	state := proto.ActionResponseState_SUCCEEDED
+	progress := int32(100)
+	msg := "Dry run: " + diff
 
 	res := &proto.ActionResponse{
 		ActionResponseState: &state,
@@ -265,30 +659,23 @@ func (h *ActionHandler) failedResult(msg string) *proto.ActionResult {
 	}
 }
 
-func keepAlive(tracker sdkprobe.ActionProgressTracker, stop chan struct{}) {
-
-	//TODO: add timeout
-	go func() {
-		var progress int32 = 0
-		state := proto.ActionResponseState_IN_PROGRESS
+// The description of the failed result is the category of the error followed by the details,
+// e.g., "PDBBlocked: eviction of pod default/foo is blocked by PodDisruptionBudget: ...".
+func (h *ActionHandler) failedResult(err error) *proto.ActionResult {
 
-		for {
-			progress = progress + 1
-			if progress > 99 {
-				progress = 99
-			}
+	msg := executor.DescribeActionError(err)
+	state := proto.ActionResponseState_FAILED
+	progress := int32(0)
 
-			tracker.UpdateProgress(state, "in progress", progress)
+	res := &proto.ActionResponse{
+		ActionResponseState: &state,
+		Progress:            &progress,
+		ResponseDescription: &msg,
+	}
 
-			t := time.NewTimer(time.Second * 3)
-			select {
-			case <-stop:
-				glog.V(3).Infof("action keepAlive goroutine exit.")
-				return
-			case <-t.C:
-			}
-		}
-	}()
+	return &proto.ActionResult{
+		Response: res,
+	}
 }
 
 // Checks if the action execution DTO includes action item and the target SE. Also, check if
@@ -301,19 +688,149 @@ func (h *ActionHandler) checkActionExecutionDTO(actionExecutionDTO *proto.Action
 
 	}
 
-	ai := actionItems[0]
+	for _, ai := range actionItems {
+		if ai == nil {
+			return fmt.Errorf("Action execution (%v) validation failed: empty action item found", actionExecutionDTO)
+		}
+
+		if ai.GetTargetSE() == nil {
+			return fmt.Errorf("Action execution (%v) validation failed: no target SE found", actionExecutionDTO)
+		}
+
+		actionType := turboActionType{ai.GetActionType(), ai.GetTargetSE().GetEntityType()}
+		glog.V(2).Infof("Receive a action request of type: %++v", actionType)
+
+		// Check if action is supported
+		if _, supported := h.actionExecutors[actionType]; !supported {
+			return fmt.Errorf("Action execution (%v) validation failed: not supported type %++v", actionExecutionDTO, actionType)
+		}
+
+		// Only pod moves and container resizes can be executed together
+		if len(actionItems) > 1 && actionType != turboActionPodMove && actionType != turboActionContainerResize {
+			return fmt.Errorf("Action execution (%v) validation failed: type %++v is not supported in a composite action",
+				actionExecutionDTO, actionType)
+		}
+
+		// Check if action is allowed by the execution policy
+		if err := h.checkExecutionPolicy(ai); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks the action item against the execution policy, with the namespace and the labels of its related pod.
+func (h *ActionHandler) checkExecutionPolicy(actionItem *proto.ActionItemDTO) error {
+	policy := h.config.executionPolicy
+	if policy == nil {
+		return nil
+	}
+
+	var pod *api.Pod
+	if !hasNoRelatedPod(getTurboActionType(actionItem)) {
+		if pod = h.getRelatedPod(actionItem); pod == nil {
+			return executor.NewActionError(executor.ActionErrorPodNotFound, nil, "Cannot find the related pod for action item %s", actionItem.GetUuid())
+		}
+	}
+
+	return policy.check(newPolicyTarget(actionItem, pod))
+}
+
+// Waits until a maintenance window of the disruptive action on the pod opens, if the action is held outside its windows.
+// The actions in dry-run mode are never held.
+// Returns nil if the action is not held, or an ActionError if the action is refused.
+func (h *ActionHandler) waitForMaintenanceWindow(actionItem *proto.ActionItemDTO, pod *api.Pod, dryRun bool, progress *executor.ActionProgress) error {
+	if dryRun || !isDisruptiveAction(getTurboActionType(actionItem)) {
+		return nil
+	}
+
+	wait, err := h.config.executionPolicy.checkMaintenanceWindows(newPolicyTarget(actionItem, pod), time.Now())
+	if err != nil || wait <= 0 {
+		return err
+	}
+
+	openAt := time.Now().Add(wait).Format(time.RFC3339)
+	glog.V(2).Infof("Action %s is held until the maintenance window opens at %s", actionItem.GetUuid(), openAt)
+	progress.Update(executor.ProgressHeld, "Held until the maintenance window opens at %s", openAt)
+
+	select {
+	case <-time.After(wait):
+		glog.V(2).Infof("Maintenance window opens, resume action %s", actionItem.GetUuid())
+		return nil
+	case <-h.config.StopEverything:
+		return executor.NewActionError(executor.ActionErrorOutsideMaintenanceWindow, nil,
+			"action %s is stopped while waiting for the maintenance window", actionItem.GetUuid())
+	}
+}
 
-	if ai.GetTargetSE() == nil {
-		return fmt.Errorf("Action execution (%v) validation failed: no target SE found", actionExecutionDTO)
+// Checks the maintenance windows of the disruptive action on the pod again once the lock is acquired,
+// as a window may close while the action waits for the budgets and the lock.
+// The action is refused rather than held again, so that it doesn't block the other actions with its lock.
+func (h *ActionHandler) recheckMaintenanceWindow(actionItem *proto.ActionItemDTO, pod *api.Pod, dryRun bool) error {
+	if dryRun || !isDisruptiveAction(getTurboActionType(actionItem)) {
+		return nil
 	}
 
-	actionType := turboActionType{ai.GetActionType(), ai.GetTargetSE().GetEntityType()}
-	glog.V(2).Infof("Receive a action request of type: %++v", actionType)
+	wait, err := h.config.executionPolicy.checkMaintenanceWindows(newPolicyTarget(actionItem, pod), time.Now())
+	if err != nil || wait <= 0 {
+		return err
+	}
+	return executor.NewActionError(executor.ActionErrorOutsideMaintenanceWindow, nil,
+		"the maintenance window of action %s closed while waiting for the lock; the next window opens at %s",
+		actionItem.GetUuid(), time.Now().Add(wait).Format(time.RFC3339))
+}
 
-	// Check if action is supported
-	if _, supported := h.actionExecutors[actionType]; !supported {
-		return fmt.Errorf("Action execution (%v) validation failed: not supported type %++v", actionExecutionDTO, actionType)
+// Acquires the concurrency budgets for the disruptive action on the pod, waiting in the queue until the action fits in them.
+// The actions in dry-run mode don't consume the budgets.
+// Returns the function to release the budgets after the action, or an ActionError if the action waits too long.
+func (h *ActionHandler) acquireBudget(actionItem *proto.ActionItemDTO, pod *api.Pod, dryRun bool, progress *executor.ActionProgress) (func(), error) {
+	noop := func() {}
+	if dryRun || !isDisruptiveAction(getTurboActionType(actionItem)) {
+		return noop, nil
 	}
 
+	release, err := h.budget.acquire(actionItem.GetUuid(), pod, progress, h.config.StopEverything)
+	if err != nil {
+		return noop, err
+	}
+	return release, nil
+}
+
+// Checks the budget of the controller again for the disruptive action on the pod once the lock is acquired.
+// Returns the function to release the budgets after the action, which replaces the one of acquireBudget.
+func (h *ActionHandler) recheckBudget(actionItem *proto.ActionItemDTO, pod *api.Pod, dryRun bool, release func(), progress *executor.ActionProgress) (func(), error) {
+	if dryRun || !isDisruptiveAction(getTurboActionType(actionItem)) {
+		return release, nil
+	}
+	return h.budget.recheck(actionItem.GetUuid(), pod, release, progress, h.config.StopEverything)
+}
+
+// Checks whether the action disrupts the running pods: the moves and resizes recreating the pods,
+// and the suspends deleting the pods or draining the nodes.
+func isDisruptiveAction(actionType turboActionType) bool {
+	switch actionType {
+	case turboActionPodMove, turboActionContainerResize, turboActionContainerPodSuspend, turboActionNodeSuspend:
+		return true
+	}
+	return false
+}
+
+// Checks that all the action items of a composite action relate to the pod.
+func (h *ActionHandler) checkCompositeAction(actionItems []*proto.ActionItemDTO, pod *api.Pod) error {
+	if h.compositeExecutor == nil {
+		return executor.NewActionError(executor.ActionErrorInvalidAction, nil, "composite action is not supported")
+	}
+
+	for _, ai := range actionItems[1:] {
+		rpod := h.getRelatedPod(ai)
+		if rpod == nil {
+			return executor.NewActionError(executor.ActionErrorPodNotFound, nil, "Cannot find the related pod for action item %s", ai.GetUuid())
+		}
+		if rpod.UID != pod.UID {
+			return executor.NewActionError(executor.ActionErrorInvalidAction, nil, "action items %s and %s relate to different pods %s/%s and %s/%s",
+				actionItems[0].GetUuid(), ai.GetUuid(), pod.Namespace, pod.Name, rpod.Namespace, rpod.Name)
+		}
+	}
 	return nil
 }
@@ -1,7 +1,10 @@
 package action
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/turbonomic/kubeturbo/pkg/action/executor"
 	"github.com/turbonomic/kubeturbo/pkg/action/util"
@@ -11,6 +14,7 @@ import (
 	api "k8s.io/api/core/v1"
 	policy "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	client "k8s.io/client-go/kubernetes"
@@ -23,6 +27,7 @@ const (
 	mockPodName      = "pod-foo"
 	mockPodDispName  = mockPodNamespace + "/" + mockPodName
 	mockPodId        = "pod-foo-id"
+	mockDryRunDiff   = "pod workspace-foo/pod-foo: spec.nodeName: node-a -> node-b"
 )
 
 func TestActionHandler_registerActionExecutors(t *testing.T) {
@@ -30,7 +35,9 @@ func TestActionHandler_registerActionExecutors(t *testing.T) {
 
 	h.registerActionExecutors()
 
-	supportedActions := [...]turboActionType{turboActionPodProvision, turboActionPodMove, turboActionContainerResize, turboActionContainerPodSuspend}
+	supportedActions := [...]turboActionType{turboActionPodProvision, turboActionPodMove, turboActionContainerResize, turboActionContainerPodSuspend,
+		turboActionNodeSuspend, turboActionNodeStart, turboActionNodeProvision,
+		turboActionQuotaResize}
 	m := h.actionExecutors
 	if len(m) != len(supportedActions) {
 		t.Errorf("Action handler supports %d action types but got %d", len(supportedActions), len(m))
@@ -41,6 +48,10 @@ func TestActionHandler_registerActionExecutors(t *testing.T) {
 			t.Errorf("Missing action executor for %v", action)
 		}
 	}
+
+	if h.compositeExecutor == nil {
+		t.Errorf("Missing composite action executor")
+	}
 }
 
 func TestActionHandler_ExecuteAction_Succeed(t *testing.T) {
@@ -69,6 +80,32 @@ func TestActionHandler_ExecuteAction_Succeed(t *testing.T) {
 	}
 }
 
+func TestActionHandler_ExecuteAction_DryRun(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	h.config.dryRun = true
+	targetSE := newTargetSE()
+	actionExecutionDTO := newActionExecutionDTO(proto.ActionItemDTO_MOVE, targetSE)
+	result, err := h.ExecuteAction(actionExecutionDTO, nil, &mockProgressTrack{})
+
+	if err != nil {
+		t.Errorf("ActionHandler.ExecuteAction(): error = %v", err)
+	}
+
+	if *result.Response.ActionResponseState != proto.ActionResponseState_SUCCEEDED {
+		t.Errorf("ActionHandler.ExecuteAction(): action response (%v) is not %v",
+			result.Response.ActionResponseState, proto.ActionResponseState_SUCCEEDED)
+	}
+	if desc := result.Response.GetResponseDescription(); desc != "Dry run: "+mockDryRunDiff {
+		t.Errorf("ActionHandler.ExecuteAction(): unexpected response description: %s", desc)
+	}
+
+	// Nothing is changed in dry-run mode
+	if _, ok := podCache.Get(*targetSE.Id); ok {
+		t.Errorf("The pod change is cached in dry-run mode")
+	}
+}
+
 func TestActionHandler_ExecuteAction_Unsupported_Action(t *testing.T) {
 	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
 	h := newActionHandler(podCache)
@@ -86,6 +123,267 @@ func TestActionHandler_ExecuteAction_Unsupported_Action(t *testing.T) {
 		t.Errorf("ActionHandler.ExecuteAction(): action response (%v) is not %v",
 			result.Response.ActionResponseState, proto.ActionResponseState_FAILED)
 	}
+
+	// Check the category of the failure in the description
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorInvalidAction)+": ") {
+		t.Errorf("ActionHandler.ExecuteAction(): unexpected response description: %s", desc)
+	}
+}
+
+func TestActionHandler_ExecuteAction_Composite(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	composite := &mockCompositeExecutor{}
+	h.compositeExecutor = composite
+
+	actionExecutionDTO := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE())
+	actionExecutionDTO.ActionItem = append(actionExecutionDTO.ActionItem, newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()).ActionItem...)
+	result, err := h.ExecuteAction(actionExecutionDTO, nil, &mockProgressTrack{})
+
+	if err != nil {
+		t.Errorf("ActionHandler.ExecuteAction(): error = %v", err)
+	}
+	if *result.Response.ActionResponseState != proto.ActionResponseState_SUCCEEDED {
+		t.Errorf("ActionHandler.ExecuteAction(): action response (%v) is not %v",
+			result.Response.ActionResponseState, proto.ActionResponseState_SUCCEEDED)
+	}
+	if composite.items != 2 {
+		t.Errorf("Composite executor got %d action items, expect 2", composite.items)
+	}
+}
+
+func TestActionHandler_ExecuteAction_Composite_Unsupported(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	h.compositeExecutor = &mockCompositeExecutor{}
+	h.actionExecutors[turboActionPodProvision] = &mockExecutor{}
+
+	// provision can not be executed together with other actions
+	actionExecutionDTO := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE())
+	actionExecutionDTO.ActionItem = append(actionExecutionDTO.ActionItem, newActionExecutionDTO(proto.ActionItemDTO_PROVISION, newTargetSE()).ActionItem...)
+	result, err := h.ExecuteAction(actionExecutionDTO, nil, &mockProgressTrack{})
+
+	if err == nil {
+		t.Errorf("Expect error of composite action not supported")
+	}
+	if *result.Response.ActionResponseState != proto.ActionResponseState_FAILED {
+		t.Errorf("ActionHandler.ExecuteAction(): action response (%v) is not %v",
+			result.Response.ActionResponseState, proto.ActionResponseState_FAILED)
+	}
+}
+
+func TestActionHandler_ExecuteAction_PolicyDenied(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	policy, err := parseExecutionPolicy([]byte("rules:\n- name: protect-foo\n  actions: [move]\n  namespaces: [" + mockPodNamespace + "]\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	h.config.executionPolicy = policy
+
+	actionExecutionDTO := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE())
+	result, err := h.ExecuteAction(actionExecutionDTO, nil, &mockProgressTrack{})
+
+	if err == nil {
+		t.Errorf("Expect error of action denied by policy")
+	}
+	if *result.Response.ActionResponseState != proto.ActionResponseState_FAILED {
+		t.Errorf("ActionHandler.ExecuteAction(): action response (%v) is not %v",
+			result.Response.ActionResponseState, proto.ActionResponseState_FAILED)
+	}
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorPolicyDenied)+": ") {
+		t.Errorf("ActionHandler.ExecuteAction(): unexpected response description: %s", desc)
+	}
+}
+
+func TestActionHandler_ExecuteAction_Events(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	recorder := &mockEventRecorder{}
+	h.config.recorder = recorder
+
+	actionExecutionDTO := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE())
+	uuid := "action-foo"
+	nodeType := proto.EntityDTO_VIRTUAL_MACHINE
+	nodeName := "node-b"
+	actionItem := actionExecutionDTO.GetActionItem()[0]
+	actionItem.Uuid = &uuid
+	actionItem.NewSE = &proto.EntityDTO{EntityType: &nodeType, DisplayName: &nodeName}
+
+	if _, err := h.ExecuteAction(actionExecutionDTO, nil, &mockProgressTrack{}); err != nil {
+		t.Errorf("ActionHandler.ExecuteAction(): error = %v", err)
+	}
+
+	expected := []string{
+		"Pod/" + mockPodName + " " + actionStartedEventReason,
+		"Node/" + nodeName + " " + actionStartedEventReason,
+		"Pod/" + mockPodName + " " + actionSucceededEventReason,
+		"Node/" + nodeName + " " + actionSucceededEventReason,
+		"Pod/" + mockPodName + "-c " + actionSucceededEventReason,
+	}
+	if len(recorder.events) != len(expected) {
+		t.Fatalf("Expect events %v but got %v", expected, recorder.events)
+	}
+	for i, event := range recorder.events {
+		if !strings.HasPrefix(event, expected[i]+" ") || !strings.Contains(event, uuid) {
+			t.Errorf("Expect event %q with action %s but got %q", expected[i], uuid, event)
+		}
+	}
+}
+
+func TestActionHandler_ExecuteAction_EventsOfRefusal(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	recorder := &mockEventRecorder{}
+	h.config.recorder = recorder
+	// the window opens in an hour, and the action is refused outside it
+	now := time.Now().UTC()
+	policy, err := parseExecutionPolicy([]byte(fmt.Sprintf("maintenanceWindows:\n- name: later\n  namespaces: [%s]\n"+
+		"  start: %q\n  end: %q\n", mockPodNamespace, now.Add(time.Hour).Format("15:04"), now.Add(time.Hour*2).Format("15:04"))))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	h.config.executionPolicy = policy
+
+	result, _ := h.ExecuteAction(newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()), nil, &mockProgressTrack{})
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorOutsideMaintenanceWindow)+": ") {
+		t.Errorf("Expect the action to be refused outside the maintenance window, but got %s", desc)
+	}
+
+	expected := "Pod/" + mockPodName + " " + actionFailedEventReason + " "
+	if len(recorder.events) != 1 || !strings.HasPrefix(recorder.events[0], expected) ||
+		!strings.Contains(recorder.events[0], string(executor.ActionErrorOutsideMaintenanceWindow)) {
+		t.Errorf("Expect the event %q of the refusal but got %v", expected, recorder.events)
+	}
+}
+
+func TestActionHandler_ExecuteAction_HeldWithoutLock(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	// the window opens in an hour
+	now := time.Now().UTC()
+	policy, err := parseExecutionPolicy([]byte(fmt.Sprintf("maintenanceWindows:\n- name: later\n  namespaces: [%s]\n"+
+		"  start: %q\n  end: %q\n  outside: hold\n  maxHoldMinutes: 120\n",
+		mockPodNamespace, now.Add(time.Hour).Format("15:04"), now.Add(time.Hour*2).Format("15:04"))))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	h.config.executionPolicy = policy
+
+	progress := &mockProgressTrack{updates: make(chan int32, 10)}
+	done := make(chan *proto.ActionResult)
+	go func() {
+		result, _ := h.ExecuteAction(newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()), nil, progress)
+		done <- result
+	}()
+
+	select {
+	case stage := <-progress.updates:
+		if stage != executor.ProgressHeld {
+			t.Fatalf("Expect the action to be held, but got progress %d", stage)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Expect the action to be held")
+	}
+
+	// the lock of the pod is not held by the held action
+	actionItem := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()).GetActionItem()[0]
+	lock, err := h.lockStore.getLock(actionItem)
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired while the other action is held: %v", err)
+	}
+	lock.ReleaseLock()
+
+	close(h.config.StopEverything)
+	result := <-done
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorOutsideMaintenanceWindow)+": ") {
+		t.Errorf("Expect the stopped action to fail outside the maintenance window, but got %s", desc)
+	}
+}
+
+func TestActionHandler_RecheckMaintenanceWindow(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	// the window closed, and opens again in an hour
+	now := time.Now().UTC()
+	policy, err := parseExecutionPolicy([]byte(fmt.Sprintf("maintenanceWindows:\n- name: later\n  namespaces: [%s]\n"+
+		"  start: %q\n  end: %q\n  outside: hold\n  maxHoldMinutes: 120\n",
+		mockPodNamespace, now.Add(time.Hour).Format("15:04"), now.Add(time.Hour*2).Format("15:04"))))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	h.config.executionPolicy = policy
+
+	actionItem := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()).GetActionItem()[0]
+	pod := h.getRelatedPod(actionItem)
+	// the action holding the lock is refused instead of held
+	if err := h.recheckMaintenanceWindow(actionItem, pod, false); executor.GetActionErrorCategory(err) != executor.ActionErrorOutsideMaintenanceWindow {
+		t.Errorf("Expect the action to be refused after the window closed, but got %v", err)
+	}
+	if err := h.recheckMaintenanceWindow(actionItem, pod, true); err != nil {
+		t.Errorf("Expect the action in dry-run mode not to be refused, but got %v", err)
+	}
+}
+
+func TestActionHandler_ExecuteAction_QueuedWithoutLock(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	h.budget = newTestActionBudget(ConcurrencyBudgets{Cluster: 1})
+	h.budget.waitTimeout = time.Second * 10
+	// the only budget of the cluster is taken by another action
+	release, err := h.budget.acquire("other", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to acquire the budget: %v", err)
+	}
+	defer release()
+
+	progress := &mockProgressTrack{updates: make(chan int32, 10)}
+	done := make(chan *proto.ActionResult)
+	go func() {
+		result, _ := h.ExecuteAction(newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()), nil, progress)
+		done <- result
+	}()
+
+	select {
+	case stage := <-progress.updates:
+		if stage != executor.ProgressQueued {
+			t.Fatalf("Expect the action to be queued, but got progress %d", stage)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Expect the action to be queued")
+	}
+
+	// the lock of the pod is not held by the queued action
+	actionItem := newActionExecutionDTO(proto.ActionItemDTO_MOVE, newTargetSE()).GetActionItem()[0]
+	lock, err := h.lockStore.getLock(actionItem)
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired while the other action is queued: %v", err)
+	}
+	lock.ReleaseLock()
+
+	close(h.config.StopEverything)
+	result := <-done
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorBudgetTimeout)+": ") {
+		t.Errorf("Expect the stopped action to fail waiting for the budgets, but got %s", desc)
+	}
+}
+
+func TestActionHandler_ExecuteAction_LockLost(t *testing.T) {
+	var podCache turbostore.ITurboCache = turbostore.NewTurboCache(defaultPodNameCacheTTL).Cache
+	h := newActionHandler(podCache)
+	lost := make(chan struct{})
+	h.lockStore = &mockLockStore{lost: lost}
+	// the lock expires and is taken by another action while the action is executed
+	h.actionExecutors[turboActionPodMove] = &mockLockLostExecutor{lost: lost}
+
+	targetSE := newTargetSE()
+	result, _ := h.ExecuteAction(newActionExecutionDTO(proto.ActionItemDTO_MOVE, targetSE), nil, &mockProgressTrack{})
+	if desc := result.Response.GetResponseDescription(); !strings.HasPrefix(desc, string(executor.ActionErrorLockLost)+": ") {
+		t.Errorf("Expect the action to fail with the lost lock, but got %s", desc)
+	}
+	if _, ok := podCache.Get(*targetSE.Id); ok {
+		t.Errorf("Expect the pod change of the failed action not to be cached")
+	}
 }
 
 func newActionHandler(cache turbostore.ITurboCache) *ActionHandler {
@@ -141,6 +439,10 @@ func newTargetSE() *proto.EntityDTO {
 type mockExecutor struct{}
 
 func (m *mockExecutor) Execute(input *executor.TurboActionExecutorInput) (*executor.TurboActionExecutorOutput, error) {
+	if input.DryRun {
+		return &executor.TurboActionExecutorOutput{Succeeded: true, DryRun: true, Diff: mockDryRunDiff}, nil
+	}
+
 	oldPod := input.Pod
 	pod := &api.Pod{}
 	pod.Name = oldPod.Name + "-c"
@@ -154,9 +456,73 @@ func (m *mockExecutor) Execute(input *executor.TurboActionExecutorInput) (*execu
 	return output, nil
 }
 
-type mockProgressTrack struct{}
+type mockCompositeExecutor struct {
+	items int
+}
+
+func (m *mockCompositeExecutor) Execute(input *executor.TurboActionExecutorInput) (*executor.TurboActionExecutorOutput, error) {
+	m.items = len(input.ActionItems)
+	return (&mockExecutor{}).Execute(input)
+}
+
+type mockLockLostExecutor struct {
+	lost chan struct{}
+}
+
+func (m *mockLockLostExecutor) Execute(input *executor.TurboActionExecutorInput) (*executor.TurboActionExecutorOutput, error) {
+	close(m.lost)
+	return (&mockExecutor{}).Execute(input)
+}
+
+// mockLockStore always grants the lock, which is lost once the channel is closed
+type mockLockStore struct {
+	lost chan struct{}
+}
+
+func (s *mockLockStore) getLock(actionItem *proto.ActionItemDTO) (IActionLock, error) {
+	return s, nil
+}
+
+func (s *mockLockStore) KeepRenewLock() {}
+
+func (s *mockLockStore) ReleaseLock() {}
+
+func (s *mockLockStore) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// records the events as "kind/name reason message"
+type mockEventRecorder struct {
+	events []string
+}
+
+func (r *mockEventRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	ref := object.(*api.ObjectReference)
+	r.events = append(r.events, fmt.Sprintf("%s/%s %s %s", ref.Kind, ref.Name, reason, message))
+}
+
+func (r *mockEventRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *mockEventRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+func (r *mockEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// mockProgressTrack sends the progress updates to the channel, if any.
+type mockProgressTrack struct {
+	updates chan int32
+}
 
 func (p *mockProgressTrack) UpdateProgress(actionState proto.ActionResponseState, description string, progress int32) {
+	select {
+	case p.updates <- progress:
+	default:
+	}
 }
 
 type mockPodsGetter struct{}
@@ -209,3 +575,23 @@ func (p *mockPodInterface) Evict(eviction *policy.Eviction) error { return nil }
 func (p *mockPodInterface) GetLogs(name string, opts *api.PodLogOptions) *restclient.Request {
 	return nil
 }
+
+func TestActionHandlerConfig_CloneGCModeUnderDryRun(t *testing.T) {
+	tests := []struct {
+		mode   string
+		dryRun bool
+		want   string
+	}{
+		{executor.CloneGCModeDelete, false, executor.CloneGCModeDelete},
+		{executor.CloneGCModeDelete, true, executor.CloneGCModeReport},
+		{executor.CloneGCModeReport, true, executor.CloneGCModeReport},
+		{executor.CloneGCModeDisabled, true, executor.CloneGCModeDisabled},
+	}
+
+	for _, tt := range tests {
+		config := newActionHandlerConfig().WithCloneGarbageCollector(tt.mode, 0, 0).WithDryRun(tt.dryRun)
+		if got := config.getCloneGCMode(); got != tt.want {
+			t.Errorf("Expect clone GC mode %s with mode %s and dry run %v, but got %s", tt.want, tt.mode, tt.dryRun, got)
+		}
+	}
+}
@@ -14,7 +14,15 @@ import (
 )
 
 type IActionLockStore interface {
-	getLock(actionItem *proto.ActionItemDTO) (*util.LockHelper, error)
+	getLock(actionItem *proto.ActionItemDTO) (IActionLock, error)
+}
+
+// IActionLock is the lock of an action, which is renewed while the action is executed, and released after it.
+type IActionLock interface {
+	KeepRenewLock()
+	ReleaseLock()
+	// Lost is closed if the lock is lost while it is renewed, e.g., it expires and is taken by another action.
+	Lost() <-chan struct{}
 }
 
 type ActionLockStore struct {
@@ -42,7 +50,7 @@ const (
 //    the key is the "container name" + "image name" for bare-pod cases and its parent controller id for non-bare-pod cases.
 //
 // 2. Otherwise, the key is the id of the target SE of the action item.
-func (a *ActionLockStore) getLock(actionItem *proto.ActionItemDTO) (*util.LockHelper, error) {
+func (a *ActionLockStore) getLock(actionItem *proto.ActionItemDTO) (IActionLock, error) {
 	id := actionItem.GetUuid()
 	if key, err := a.getLockKey(actionItem); err != nil {
 		return nil, err
@@ -78,8 +86,11 @@ func (a *ActionLockStore) getLockHelper(key string) (*util.LockHelper, error) {
 
 // Gets the lock key for the action item.
 func (a *ActionLockStore) getLockKey(actionItem *proto.ActionItemDTO) (string, error) {
-	pod := a.podFunc(actionItem)
+	return getActionLockKey(actionItem, a.podFunc(actionItem))
+}
 
+// Gets the lock key for the action item with its related pod, which is nil if the action has no related pod.
+func getActionLockKey(actionItem *proto.ActionItemDTO, pod *api.Pod) (string, error) {
 	if pod == nil {
 		// If the pod is nil, simply returning the id of the target SE.
 		// Currently, for the actions supported by kubeturbo, there is no such use case for nil pod.
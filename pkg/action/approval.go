@@ -0,0 +1,334 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	client "k8s.io/client-go/kubernetes"
+)
+
+const (
+	TurboActionAPIVersion = "kubeturbo.io/v1alpha1"
+	TurboActionKind       = "TurboAction"
+	turboActionsResource  = "turboactions"
+
+	// the annotation of a TurboAction to approve or reject it, as an alternative to setting its status.phase
+	ApprovalDecisionAnnotationKey = "kubeturbo.io/approval"
+
+	// the phases of a TurboAction: it is approved or rejected by the users,
+	// and the other phases are set by kubeturbo
+	TurboActionPending   = "Pending"
+	TurboActionApproved  = "Approved"
+	TurboActionRejected  = "Rejected"
+	TurboActionExpired   = "Expired"
+	TurboActionSucceeded = "Succeeded"
+	TurboActionFailed    = "Failed"
+
+	defaultApprovalTimeout    = time.Hour
+	defaultApprovalCheckSleep = time.Second * 10
+
+	// the completed TurboActions are deleted after the retention
+	defaultTurboActionRetention  = time.Hour * 24
+	defaultTurboActionGCInterval = time.Hour
+)
+
+// TurboAction is the custom resource describing an action waiting for approval. It is created in the namespace
+// of the related pod, or of the quota, and in the namespace kubeturbo runs in for the actions on the nodes.
+// The action is approved or rejected by setting its status.phase, or its annotation kubeturbo.io/approval,
+// to Approved or Rejected, e.g.,
+//
+//  kubectl annotate turboaction turboaction-1234 kubeturbo.io/approval=approved
+type TurboAction struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TurboActionSpec   `json:"spec"`
+	Status TurboActionStatus `json:"status,omitempty"`
+}
+
+type TurboActionSpec struct {
+	UUID        string `json:"uuid"`
+	ActionType  string `json:"actionType"`
+	TargetType  string `json:"targetType"`
+	Target      string `json:"target"`
+	Destination string `json:"destination,omitempty"`
+	Description string `json:"description"`
+	// the related pod of the action, in namespace/name
+	Pod     string         `json:"pod,omitempty"`
+	Changes []*AuditChange `json:"changes,omitempty"`
+}
+
+type TurboActionStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// when the action is completed: rejected, expired, succeeded or failed
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+type TurboActionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []TurboAction `json:"items"`
+}
+
+// check whether the TurboAction is completed, i.e., its action is not executed again with the decision on it
+func isTurboActionCompleted(action *TurboAction) bool {
+	switch action.Status.Phase {
+	case TurboActionSucceeded, TurboActionFailed, TurboActionExpired:
+		return true
+	}
+	return false
+}
+
+// get the name of the TurboAction of the action with the uuid
+func turboActionName(uuid string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(uuid))
+	return "turboaction-" + strings.Trim(name, "-")
+}
+
+// build the TurboAction describing the action items executed together, with their related pod, which is nil
+// for the actions without a related pod
+func newTurboAction(namespace string, actionItems []*proto.ActionItemDTO, pod *api.Pod) *TurboAction {
+	actionItem := actionItems[0]
+	action := &TurboAction{
+		TypeMeta: metav1.TypeMeta{APIVersion: TurboActionAPIVersion, Kind: TurboActionKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      turboActionName(actionItem.GetUuid()),
+			Namespace: namespace,
+		},
+		Spec: TurboActionSpec{
+			UUID:        actionItem.GetUuid(),
+			ActionType:  actionItem.GetActionType().String(),
+			TargetType:  actionItem.GetTargetSE().GetEntityType().String(),
+			Target:      actionItem.GetTargetSE().GetDisplayName(),
+			Destination: actionItem.GetNewSE().GetDisplayName(),
+			Description: describeAction(actionItem, pod),
+			Changes:     newAuditChanges(actionItems),
+		},
+		Status: TurboActionStatus{Phase: TurboActionPending},
+	}
+	if pod != nil {
+		action.Spec.Pod = pod.Namespace + "/" + pod.Name
+	}
+	return action
+}
+
+// Gets the decision on the TurboAction: Approved, Rejected, or empty if not decided yet.
+// The annotation takes precedence over the phase. The decision on a completed TurboAction is stale, so it is ignored.
+func getApprovalDecision(action *TurboAction) string {
+	if isTurboActionCompleted(action) {
+		return ""
+	}
+	for _, value := range []string{action.Annotations[ApprovalDecisionAnnotationKey], action.Status.Phase} {
+		switch {
+		case strings.EqualFold(value, TurboActionApproved):
+			return TurboActionApproved
+		case strings.EqualFold(value, TurboActionRejected):
+			return TurboActionRejected
+		}
+	}
+	return ""
+}
+
+// turboActionApproval waits for the approval of an action through its TurboAction,
+// and reports the result of the approved action in the status of the TurboAction.
+type turboActionApproval struct {
+	kubeClient *client.Clientset
+	action     *TurboAction
+	timeout    time.Duration
+	sleep      time.Duration
+	approved   bool
+}
+
+func newTurboActionApproval(kubeClient *client.Clientset, action *TurboAction, timeout time.Duration) *turboActionApproval {
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	return &turboActionApproval{
+		kubeClient: kubeClient,
+		action:     action,
+		timeout:    timeout,
+		sleep:      defaultApprovalCheckSleep,
+	}
+}
+
+func (a *turboActionApproval) String() string {
+	return fmt.Sprintf("TurboAction %s/%s", a.action.Namespace, a.action.Name)
+}
+
+func (a *turboActionApproval) path() string {
+	return strings.Join([]string{goutil.GroupVersionPath(TurboActionAPIVersion), "namespaces", a.action.Namespace,
+		turboActionsResource, a.action.Name}, "/")
+}
+
+// Creates the TurboAction. An existing one of the same action, e.g., re-sent after a restart, is kept with its decision,
+// unless it is completed: the stale one is replaced with a new one to be decided again.
+func (a *turboActionApproval) create() error {
+	data, err := json.Marshal(a.action)
+	if err != nil {
+		return err
+	}
+	path := strings.Join([]string{goutil.GroupVersionPath(TurboActionAPIVersion), "namespaces", a.action.Namespace,
+		turboActionsResource}, "/")
+	_, err = a.kubeClient.Discovery().RESTClient().Post().AbsPath(path).Body(data).DoRaw()
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := a.get()
+	if err != nil {
+		return err
+	}
+	if !isTurboActionCompleted(existing) {
+		glog.V(2).Infof("%s already exists", a)
+		return nil
+	}
+	glog.V(2).Infof("%s already exists in phase %s, replacing it", a, existing.Status.Phase)
+	if err := a.delete(); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = a.kubeClient.Discovery().RESTClient().Post().AbsPath(path).Body(data).DoRaw()
+	return err
+}
+
+func (a *turboActionApproval) delete() error {
+	_, err := a.kubeClient.Discovery().RESTClient().Delete().AbsPath(a.path()).DoRaw()
+	return err
+}
+
+func (a *turboActionApproval) get() (*TurboAction, error) {
+	data, err := a.kubeClient.Discovery().RESTClient().Get().AbsPath(a.path()).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	action := &TurboAction{}
+	if err := json.Unmarshal(data, action); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// Waits until the TurboAction is approved. An ActionError of ActionErrorNotApproved is returned if it is rejected,
+// or not approved in time.
+func (a *turboActionApproval) wait(stop <-chan struct{}) error {
+	deadline := time.Now().Add(a.timeout)
+	for {
+		action, err := a.get()
+		if err != nil {
+			glog.Warningf("Failed to get %s: %v", a, err)
+		} else {
+			switch getApprovalDecision(action) {
+			case TurboActionApproved:
+				glog.V(2).Infof("%s is approved", a)
+				a.approved = true
+				a.updateStatus(TurboActionApproved, "")
+				return nil
+			case TurboActionRejected:
+				a.updateStatus(TurboActionRejected, action.Status.Message)
+				if action.Status.Message != "" {
+					return executor.NewActionError(executor.ActionErrorNotApproved, nil, "%s is rejected: %s", a, action.Status.Message)
+				}
+				return executor.NewActionError(executor.ActionErrorNotApproved, nil, "%s is rejected", a)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			a.updateStatus(TurboActionExpired, fmt.Sprintf("not approved in %v", a.timeout))
+			return executor.NewActionError(executor.ActionErrorNotApproved, nil, "%s is not approved in %v", a, a.timeout)
+		}
+		select {
+		case <-time.After(a.sleep):
+		case <-stop:
+			return executor.NewActionError(executor.ActionErrorNotApproved, nil, "action is stopped while waiting for the approval of %s", a)
+		}
+	}
+}
+
+// Reports the result of the approved action in the status of the TurboAction.
+func (a *turboActionApproval) complete(err error) {
+	if a == nil || !a.approved {
+		return
+	}
+	if err != nil {
+		a.updateStatus(TurboActionFailed, executor.DescribeActionError(err))
+		return
+	}
+	a.updateStatus(TurboActionSucceeded, "")
+}
+
+// update the status of the TurboAction; the failure is logged only
+func (a *turboActionApproval) updateStatus(phase, message string) {
+	status := TurboActionStatus{Phase: phase, Message: message}
+	if phase != TurboActionApproved {
+		now := metav1.Now()
+		status.CompletionTime = &now
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+	if err == nil {
+		_, err = a.kubeClient.Discovery().RESTClient().Patch(types.MergePatchType).AbsPath(a.path()).Body(data).DoRaw()
+	}
+	if err != nil {
+		glog.Warningf("Failed to update the phase of %s to %s: %v", a, phase, err)
+	}
+}
+
+// Deletes the TurboActions in all namespaces completed longer than the retention ago, including the rejected ones.
+// The TurboActions completed by an older kubeturbo without the completion time are deleted by their creation time.
+func collectTurboActions(kubeClient *client.Clientset, retention time.Duration) {
+	path := goutil.GroupVersionPath(TurboActionAPIVersion) + "/" + turboActionsResource
+	data, err := kubeClient.Discovery().RESTClient().Get().AbsPath(path).DoRaw()
+	if err != nil {
+		// the custom resource definition is not created if no action requires approval
+		glog.V(3).Infof("Failed to list TurboActions: %v", err)
+		return
+	}
+	list := &TurboActionList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		glog.Errorf("Failed to decode TurboActions: %v", err)
+		return
+	}
+
+	deadline := time.Now().Add(-retention)
+	for i := range list.Items {
+		action := &list.Items[i]
+		if !turboActionCompletedBefore(action, deadline) {
+			continue
+		}
+		approval := newTurboActionApproval(kubeClient, action, 0)
+		if err := approval.delete(); err != nil && !errors.IsNotFound(err) {
+			glog.Warningf("Failed to delete completed %s: %v", approval, err)
+			continue
+		}
+		glog.V(3).Infof("Deleted completed %s", approval)
+	}
+}
+
+// check whether the TurboAction is completed, or rejected, before the deadline
+func turboActionCompletedBefore(action *TurboAction, deadline time.Time) bool {
+	if !isTurboActionCompleted(action) && action.Status.Phase != TurboActionRejected {
+		return false
+	}
+	completed := action.CreationTimestamp.Time
+	if action.Status.CompletionTime != nil {
+		completed = action.Status.CompletionTime.Time
+	}
+	return completed.Before(deadline)
+}
@@ -0,0 +1,117 @@
+package action
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTurboActionName(t *testing.T) {
+	tests := map[string]string{
+		"637018237845":   "turboaction-637018237845",
+		"Action_Foo.Bar": "turboaction-action-foo-bar",
+		"_foo_":          "turboaction-foo",
+	}
+	for uuid, expected := range tests {
+		if name := turboActionName(uuid); name != expected {
+			t.Errorf("uuid %s: expected name %s but got %s", uuid, expected, name)
+		}
+	}
+}
+
+func TestNewTurboAction(t *testing.T) {
+	actionItem := newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0)
+	uuid := "1234"
+	nodeName := "node-b"
+	podType := proto.EntityDTO_CONTAINER_POD
+	actionItem.Uuid = &uuid
+	actionItem.TargetSE.EntityType = &podType
+	actionItem.NewSE = &proto.EntityDTO{DisplayName: &nodeName}
+	pod := newTestPod("default", "foo", withPodNode("node-a"))
+
+	action := newTurboAction("default", []*proto.ActionItemDTO{actionItem}, pod)
+	data, err := json.Marshal(action)
+	if err != nil {
+		t.Fatalf("Failed to marshal TurboAction: %v", err)
+	}
+	parsed := &TurboAction{}
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("Failed to unmarshal TurboAction: %v", err)
+	}
+
+	if parsed.APIVersion != TurboActionAPIVersion || parsed.Kind != TurboActionKind || parsed.Name != "turboaction-1234" {
+		t.Errorf("Unexpected TurboAction %s %s %s", parsed.APIVersion, parsed.Kind, parsed.Name)
+	}
+	spec := parsed.Spec
+	if spec.UUID != uuid || spec.ActionType != "MOVE" || spec.Pod != "default/foo" || spec.Destination != nodeName {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+	if expected := "move of pod default/foo from node node-a to node-b"; spec.Description != expected {
+		t.Errorf("Expected description %q but got %q", expected, spec.Description)
+	}
+	if parsed.Status.Phase != TurboActionPending {
+		t.Errorf("Expected phase %s but got %s", TurboActionPending, parsed.Status.Phase)
+	}
+}
+
+func TestGetApprovalDecision(t *testing.T) {
+	tests := []struct {
+		annotation string
+		phase      string
+		expected   string
+	}{
+		{"", TurboActionPending, ""},
+		{"", TurboActionApproved, TurboActionApproved},
+		{"approved", TurboActionPending, TurboActionApproved},
+		{"REJECTED", TurboActionPending, TurboActionRejected},
+		// the annotation takes precedence over the phase
+		{"rejected", TurboActionApproved, TurboActionRejected},
+		{"maybe", TurboActionRejected, TurboActionRejected},
+		// the decision on a completed TurboAction is stale
+		{"approved", TurboActionSucceeded, ""},
+		{"approved", TurboActionFailed, ""},
+		{"", TurboActionExpired, ""},
+	}
+	for _, test := range tests {
+		action := &TurboAction{Status: TurboActionStatus{Phase: test.phase}}
+		if test.annotation != "" {
+			action.Annotations = map[string]string{ApprovalDecisionAnnotationKey: test.annotation}
+		}
+		if decision := getApprovalDecision(action); decision != test.expected {
+			t.Errorf("annotation %q and phase %q: expected %q but got %q", test.annotation, test.phase, test.expected, decision)
+		}
+	}
+}
+
+func TestTurboActionCompletedBefore(t *testing.T) {
+	now := time.Now()
+	deadline := now.Add(-time.Hour)
+	completedAt := func(phase string, completed time.Time) *TurboAction {
+		completionTime := metav1.NewTime(completed)
+		return &TurboAction{Status: TurboActionStatus{Phase: phase, CompletionTime: &completionTime}}
+	}
+	// completed by an older kubeturbo without the completion time
+	old := &TurboAction{Status: TurboActionStatus{Phase: TurboActionFailed}}
+	old.CreationTimestamp = metav1.NewTime(now.Add(-2 * time.Hour))
+
+	tests := []struct {
+		name     string
+		action   *TurboAction
+		expected bool
+	}{
+		{"succeeded long ago", completedAt(TurboActionSucceeded, now.Add(-2*time.Hour)), true},
+		{"rejected long ago", completedAt(TurboActionRejected, now.Add(-2*time.Hour)), true},
+		{"expired recently", completedAt(TurboActionExpired, now.Add(-time.Minute)), false},
+		{"failed without completion time", old, true},
+		{"pending", &TurboAction{Status: TurboActionStatus{Phase: TurboActionPending}}, false},
+		{"approved", completedAt(TurboActionApproved, now.Add(-2*time.Hour)), false},
+	}
+	for _, test := range tests {
+		if completed := turboActionCompletedBefore(test.action, deadline); completed != test.expected {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, completed)
+		}
+	}
+}
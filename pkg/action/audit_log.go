@@ -0,0 +1,262 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// the path of the audit log writing to the standard output
+	AuditLogStdout = "-"
+
+	auditResultSucceeded = "succeeded"
+	auditResultFailed    = "failed"
+	auditResultDryRun    = "dryRun"
+)
+
+// AuditEntry is an entry of the audit log for an executed action.
+type AuditEntry struct {
+	UUID       string `json:"uuid"`
+	ActionType string `json:"actionType"`
+	TargetType string `json:"targetType"`
+	Target     string `json:"target"`
+	// the destination of a move
+	Destination string `json:"destination,omitempty"`
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+
+	// succeeded, failed or dryRun, with the error of the failure, or the changes of the dry run
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+
+	// the changes of the commodities requested by the action items
+	Changes []*AuditChange `json:"changes,omitempty"`
+	// the related pod before the action, and the new pod after it, if any
+	Before *AuditPodSpec `json:"before,omitempty"`
+	After  *AuditPodSpec `json:"after,omitempty"`
+	// the controller changed by the action, e.g., the scaled Deployment, before and after it
+	ControllerBefore *AuditControllerSpec `json:"controllerBefore,omitempty"`
+	ControllerAfter  *AuditControllerSpec `json:"controllerAfter,omitempty"`
+}
+
+// AuditChange is the change of a commodity requested by an action item.
+type AuditChange struct {
+	Target         string  `json:"target"`
+	Commodity      string  `json:"commodity"`
+	OldCapacity    float64 `json:"oldCapacity,omitempty"`
+	NewCapacity    float64 `json:"newCapacity,omitempty"`
+	OldReservation float64 `json:"oldReservation,omitempty"`
+	NewReservation float64 `json:"newReservation,omitempty"`
+}
+
+// AuditPodSpec is the fragment of the pod spec changed by the actions.
+type AuditPodSpec struct {
+	Pod        string            `json:"pod"`
+	Node       string            `json:"node,omitempty"`
+	Controller string            `json:"controller,omitempty"`
+	Containers []*AuditContainer `json:"containers,omitempty"`
+}
+
+// AuditControllerSpec is the fragment of the controller spec changed by the actions:
+// its replicas, or the resized containers of its pod template.
+type AuditControllerSpec struct {
+	Controller string            `json:"controller"`
+	Replicas   *int32            `json:"replicas,omitempty"`
+	Containers []*AuditContainer `json:"containers,omitempty"`
+}
+
+type AuditContainer struct {
+	Name      string                   `json:"name"`
+	Resources api.ResourceRequirements `json:"resources"`
+}
+
+// AuditLog appends an entry for every executed action to a file, or to the standard output, as JSON Lines.
+// The file is rotated once it reaches the max size: it is renamed with the suffix ".1", replacing the previous one,
+// so that at most twice the max size is retained.
+type AuditLog struct {
+	path    string
+	maxSize int64
+
+	mutex  sync.Mutex
+	writer io.Writer
+	file   *os.File
+	size   int64
+}
+
+// NewAuditLog opens the audit log at the path, or "-" for the standard output.
+// The file is not rotated if the max size is not positive.
+func NewAuditLog(path string, maxSizeMB int) (*AuditLog, error) {
+	l := &AuditLog{
+		path:    path,
+		maxSize: int64(maxSizeMB) * 1024 * 1024,
+	}
+	if path == AuditLogStdout {
+		l.writer = os.Stdout
+		return l, nil
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AuditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open action audit log %s: %v", l.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat action audit log %s: %v", l.path, err)
+	}
+	l.file, l.writer, l.size = file, file, info.Size()
+	return nil
+}
+
+// rename the file with the suffix ".1", and open a new one.
+// If the new one can't be opened, the writer is reset, so that it is opened again by the next record.
+func (l *AuditLog) rotate() error {
+	l.file.Close()
+	err := os.Rename(l.path, l.path+".1")
+	if openErr := l.open(); openErr != nil {
+		l.file, l.writer, l.size = nil, nil, 0
+		return openErr
+	}
+	return err
+}
+
+// Appends the entry to the audit log; the failures are logged only, so that they don't fail the action.
+func (l *AuditLog) record(entry *AuditEntry) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		glog.Errorf("Failed to marshal the audit entry of action %s: %v", entry.UUID, err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.writer == nil {
+		if err := l.open(); err != nil {
+			glog.Errorf("Failed to write the audit entry of action %s: %v", entry.UUID, err)
+			return
+		}
+	}
+	if l.file != nil && l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		glog.V(2).Infof("Rotating action audit log %s at %d bytes", l.path, l.size)
+		if err := l.rotate(); err != nil {
+			glog.Errorf("Failed to rotate action audit log %s: %v", l.path, err)
+		}
+		if l.writer == nil {
+			return
+		}
+	}
+	n, err := l.writer.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		glog.Errorf("Failed to write the audit entry of action %s: %v", entry.UUID, err)
+	}
+}
+
+// Builds the audit entry of the action items executed together, with their related pod, which is nil if not found
+// or not needed, and the output or the error of the execution.
+func newAuditEntry(actionItems []*proto.ActionItemDTO, pod *api.Pod, start, end time.Time,
+	output *executor.TurboActionExecutorOutput, err error) *AuditEntry {
+	actionItem := actionItems[0]
+	entry := &AuditEntry{
+		UUID:        actionItem.GetUuid(),
+		ActionType:  actionItem.GetActionType().String(),
+		TargetType:  actionItem.GetTargetSE().GetEntityType().String(),
+		Target:      actionItem.GetTargetSE().GetDisplayName(),
+		Destination: actionItem.GetNewSE().GetDisplayName(),
+		StartTime:   start,
+		EndTime:     end,
+	}
+
+	entry.Changes = newAuditChanges(actionItems)
+	if pod != nil {
+		entry.Before = newAuditPodSpec(pod)
+	}
+
+	switch {
+	case err != nil:
+		entry.Result = auditResultFailed
+		entry.Error = executor.DescribeActionError(err)
+	case output != nil && output.DryRun:
+		entry.Result = auditResultDryRun
+		entry.Diff = output.Diff
+	default:
+		entry.Result = auditResultSucceeded
+		if output != nil && output.NewPod != nil {
+			entry.After = newAuditPodSpec(output.NewPod)
+		}
+		if output != nil && output.OldController != nil {
+			entry.ControllerBefore = newAuditControllerSpec(output.OldController)
+		}
+		if output != nil && output.NewController != nil {
+			entry.ControllerAfter = newAuditControllerSpec(output.NewController)
+		}
+	}
+	return entry
+}
+
+// get the changes of the commodities requested by the action items
+func newAuditChanges(actionItems []*proto.ActionItemDTO) []*AuditChange {
+	var changes []*AuditChange
+	for _, ai := range actionItems {
+		if comm := ai.GetNewComm(); comm != nil {
+			current := ai.GetCurrentComm()
+			changes = append(changes, &AuditChange{
+				Target:         ai.GetTargetSE().GetDisplayName(),
+				Commodity:      comm.GetCommodityType().String(),
+				OldCapacity:    current.GetCapacity(),
+				NewCapacity:    comm.GetCapacity(),
+				OldReservation: current.GetReservation(),
+				NewReservation: comm.GetReservation(),
+			})
+		}
+	}
+	return changes
+}
+
+func newAuditPodSpec(pod *api.Pod) *AuditPodSpec {
+	spec := &AuditPodSpec{
+		Pod:  pod.Namespace + "/" + pod.Name,
+		Node: pod.Spec.NodeName,
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		spec.Controller = owner.Kind + "/" + owner.Name
+	}
+	for _, container := range pod.Spec.Containers {
+		spec.Containers = append(spec.Containers, &AuditContainer{Name: container.Name, Resources: container.Resources})
+	}
+	return spec
+}
+
+func newAuditControllerSpec(controller *executor.ControllerSpec) *AuditControllerSpec {
+	spec := &AuditControllerSpec{
+		Controller: controller.Name,
+		Replicas:   controller.Replicas,
+	}
+	for _, container := range controller.Containers {
+		spec.Containers = append(spec.Containers, &AuditContainer{Name: container.Name, Resources: container.Resources})
+	}
+	return spec
+}
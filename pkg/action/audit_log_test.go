@@ -0,0 +1,137 @@
+package action
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+)
+
+func TestNewAuditEntry(t *testing.T) {
+	actionItem := newPolicyActionItem(proto.ActionItemDTO_RIGHT_SIZE, 1000, 2000)
+	uuid := "action-foo"
+	actionItem.Uuid = &uuid
+	start := time.Now()
+
+	pod := newTestPod("default", "foo-1", withPodNode("node-a"), withPodOwner("ReplicaSet", "foo-rs"), withPodCPULimit("1"))
+	npod := newTestPod("default", "foo-1-c", withPodNode("node-a"), withPodOwner("ReplicaSet", "foo-rs"), withPodCPULimit("2"))
+	entry := newAuditEntry([]*proto.ActionItemDTO{actionItem}, pod, start, start,
+		&executor.TurboActionExecutorOutput{Succeeded: true, NewPod: npod}, nil)
+	if entry.UUID != uuid || entry.ActionType != "RIGHT_SIZE" || entry.Result != auditResultSucceeded {
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+	if len(entry.Changes) != 1 || entry.Changes[0].OldCapacity != 1000 || entry.Changes[0].NewCapacity != 2000 {
+		t.Errorf("Unexpected changes %+v", entry.Changes)
+	}
+	if entry.Before.Pod != "default/foo-1" || entry.Before.Controller != "ReplicaSet/foo-rs" || entry.Before.Node != "node-a" {
+		t.Errorf("Unexpected pod spec before the action %+v", entry.Before)
+	}
+	if limit := entry.After.Containers[0].Resources.Limits[api.ResourceCPU]; limit.String() != "2" {
+		t.Errorf("Unexpected cpu limit after the action: %s", limit.String())
+	}
+
+	err := executor.NewActionError(executor.ActionErrorPDBBlocked, nil, "blocked")
+	entry = newAuditEntry([]*proto.ActionItemDTO{actionItem}, nil, start, start, nil, err)
+	if entry.Result != auditResultFailed || entry.Error != "PDBBlocked: blocked" || entry.Before != nil || entry.After != nil {
+		t.Errorf("Unexpected audit entry of the failure %+v", entry)
+	}
+}
+
+func TestNewAuditEntryOfController(t *testing.T) {
+	actionItem := newPolicyActionItem(proto.ActionItemDTO_PROVISION, 0, 0)
+	start := time.Now()
+	current, replicas := int32(2), int32(3)
+
+	output := &executor.TurboActionExecutorOutput{
+		Succeeded:     true,
+		OldController: &executor.ControllerSpec{Name: "Deployment-default/foo", Replicas: &current},
+		NewController: &executor.ControllerSpec{Name: "Deployment-default/foo", Replicas: &replicas},
+	}
+	entry := newAuditEntry([]*proto.ActionItemDTO{actionItem}, nil, start, start, output, nil)
+	if entry.ControllerBefore == nil || entry.ControllerBefore.Controller != "Deployment-default/foo" || *entry.ControllerBefore.Replicas != 2 {
+		t.Errorf("Unexpected controller spec before the action %+v", entry.ControllerBefore)
+	}
+	if entry.ControllerAfter == nil || *entry.ControllerAfter.Replicas != 3 {
+		t.Errorf("Unexpected controller spec after the action %+v", entry.ControllerAfter)
+	}
+}
+
+func TestAuditLogRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := NewAuditLog(path, 1)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	// rotate after the first entry
+	auditLog.maxSize = 10
+
+	auditLog.record(&AuditEntry{UUID: "a1", Result: auditResultSucceeded})
+	auditLog.record(&AuditEntry{UUID: "a2", Result: auditResultFailed})
+
+	for file, uuid := range map[string]string{path + ".1": "a1", path: "a2"} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file, err)
+		}
+		var entries []*AuditEntry
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			entry := &AuditEntry{}
+			if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+				t.Errorf("Failed to parse the line %q of %s: %v", scanner.Text(), file, err)
+			}
+			entries = append(entries, entry)
+		}
+		f.Close()
+		if len(entries) != 1 || entries[0].UUID != uuid {
+			t.Errorf("Expect the entry of %s in %s but got %+v", uuid, file, entries)
+		}
+	}
+}
+
+func TestAuditLogRotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := NewAuditLog(path, 1)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	auditLog.maxSize = 10
+	auditLog.record(&AuditEntry{UUID: "a1", Result: auditResultSucceeded})
+
+	// the new file can't be opened without the directory
+	os.RemoveAll(dir)
+	auditLog.record(&AuditEntry{UUID: "a2", Result: auditResultSucceeded})
+	if auditLog.writer != nil {
+		t.Errorf("Expect the writer to be reset after the failed rotation")
+	}
+
+	// the file is opened again once it can be
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	auditLog.record(&AuditEntry{UUID: "a3", Result: auditResultSucceeded})
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"a3"`) {
+		t.Errorf("Expect the entry a3 in the reopened audit log, but got %q: %v", data, err)
+	}
+}
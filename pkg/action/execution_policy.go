@@ -0,0 +1,277 @@
+package action
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// the names of the actions in the execution policy
+const (
+	policyActionMove      = "move"
+	policyActionResize    = "resize"
+	policyActionProvision = "provision"
+	policyActionSuspend   = "suspend"
+	policyActionStart     = "start"
+)
+
+var policyActionNames = map[proto.ActionItemDTO_ActionType]string{
+	proto.ActionItemDTO_MOVE:       policyActionMove,
+	proto.ActionItemDTO_RIGHT_SIZE: policyActionResize,
+	proto.ActionItemDTO_PROVISION:  policyActionProvision,
+	proto.ActionItemDTO_SUSPEND:    policyActionSuspend,
+	proto.ActionItemDTO_START:      policyActionStart,
+}
+
+// ExecutionPolicy declares which actions may be executed, in which namespaces and on which pods.
+// The rules are checked in order, and the first rule matching the action decides whether it is allowed,
+// and with what limits. The actions matching no rule are allowed unless defaultAllow is set to false.
+// It is loaded from a YAML or JSON file, e.g., mounted from a ConfigMap:
+//
+//  defaultAllow: true
+//  rules:
+//  - name: protect-system
+//    namespaces: [kube-system]
+//    allow: false
+//  - name: limit-db-resize
+//    actions: [resize]
+//    selector: app=db
+//    allow: true
+//    limits:
+//      maxResizeUpPercent: 50
+//      maxResizeDownPercent: 20
+//  maintenanceWindows:
+//  - name: weekend
+//    days: [Sat, Sun]
+//    start: "00:00"
+//    end: "23:59"
+type ExecutionPolicy struct {
+	DefaultAllow *bool                  `json:"defaultAllow,omitempty"`
+	Rules        []*ExecutionPolicyRule `json:"rules,omitempty"`
+
+	// the maintenance windows of the disruptive actions
+	MaintenanceWindows []*MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+}
+
+// PolicyScope matches the actions by the namespaces and the labels of their related pods.
+// An empty field matches all.
+type PolicyScope struct {
+	// the namespaces of the related pods, or of the quotas; the actions on the nodes have no namespace
+	Namespaces []string `json:"namespaces,omitempty"`
+	// the label selector of the related pods, e.g., "app=db,tier in (backend)"
+	Selector string `json:"selector,omitempty"`
+
+	selector labels.Selector
+}
+
+// ExecutionPolicyRule matches the actions by their types, and by the scope of their related pods.
+// An empty field matches all.
+type ExecutionPolicyRule struct {
+	Name string `json:"name"`
+	// the action types: move, resize, provision, suspend and start
+	Actions []string `json:"actions,omitempty"`
+	PolicyScope
+
+	Allow  bool                   `json:"allow"`
+	Limits *ExecutionPolicyLimits `json:"limits,omitempty"`
+}
+
+// ExecutionPolicyLimits limits the allowed actions.
+type ExecutionPolicyLimits struct {
+	// the maximum increase and decrease of a resize, in percentage of the current capacity or reservation;
+	// not limited if it is not positive
+	MaxResizeUpPercent   float64 `json:"maxResizeUpPercent,omitempty"`
+	MaxResizeDownPercent float64 `json:"maxResizeDownPercent,omitempty"`
+}
+
+// the target of an action to check against the policy
+type policyTarget struct {
+	actionItem *proto.ActionItemDTO
+	// the namespace and the labels of the related pod; empty if there is no related pod
+	namespace string
+	labels    map[string]string
+	hasLabels bool
+}
+
+// build the target of the action with its related pod, which is nil for the actions without a related pod.
+// The namespace of a quota resize is the namespace of the quota.
+func newPolicyTarget(actionItem *proto.ActionItemDTO, pod *api.Pod) *policyTarget {
+	target := &policyTarget{actionItem: actionItem}
+	if pod != nil {
+		target.namespace = pod.Namespace
+		target.labels = pod.Labels
+		target.hasLabels = true
+	} else if getTurboActionType(actionItem) == turboActionQuotaResize {
+		target.namespace = actionItem.GetTargetSE().GetDisplayName()
+	}
+	return target
+}
+
+// LoadExecutionPolicy loads the execution policy from the YAML or JSON file.
+func LoadExecutionPolicy(path string) (*ExecutionPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution policy file %s: %v", path, err)
+	}
+	return parseExecutionPolicy(data)
+}
+
+func parseExecutionPolicy(data []byte) (*ExecutionPolicy, error) {
+	policy := &ExecutionPolicy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse execution policy: %v", err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("Loaded action execution policy with %d rules", len(policy.Rules))
+	return policy, nil
+}
+
+// check the action names, and parse the label selectors of the rules and the maintenance windows
+func (p *ExecutionPolicy) validate() error {
+	valid := make(map[string]bool)
+	for _, name := range policyActionNames {
+		valid[name] = true
+	}
+
+	for i, rule := range p.Rules {
+		if rule == nil {
+			return fmt.Errorf("execution policy rule[%d] is empty", i)
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		for _, action := range rule.Actions {
+			if !valid[action] {
+				return fmt.Errorf("execution policy rule %s: unknown action %q", rule.Name, action)
+			}
+		}
+		if err := rule.PolicyScope.parse(); err != nil {
+			return fmt.Errorf("execution policy rule %s: %v", rule.Name, err)
+		}
+	}
+
+	for i, window := range p.MaintenanceWindows {
+		if window == nil {
+			return fmt.Errorf("maintenance window[%d] is empty", i)
+		}
+		if window.Name == "" {
+			window.Name = fmt.Sprintf("window-%d", i)
+		}
+		if err := window.parse(); err != nil {
+			return fmt.Errorf("maintenance window %s: %v", window.Name, err)
+		}
+	}
+	return nil
+}
+
+// check the action against the policy; the violation is returned as an ActionError of ActionErrorPolicyDenied.
+func (p *ExecutionPolicy) check(target *policyTarget) error {
+	if p == nil {
+		return nil
+	}
+	actionItem := target.actionItem
+	action := policyActionNames[actionItem.GetActionType()]
+
+	for _, rule := range p.Rules {
+		if !rule.matches(action, target) {
+			continue
+		}
+		if !rule.Allow {
+			return executor.NewActionError(executor.ActionErrorPolicyDenied, nil, "%s of %s is denied by execution policy rule %s",
+				action, actionItem.GetTargetSE().GetDisplayName(), rule.Name)
+		}
+		if err := rule.Limits.check(actionItem); err != nil {
+			return executor.NewActionError(executor.ActionErrorPolicyDenied, nil, "%s of %s exceeds the limits of execution policy rule %s: %v",
+				action, actionItem.GetTargetSE().GetDisplayName(), rule.Name, err)
+		}
+		glog.V(3).Infof("Action %s is allowed by execution policy rule %s", actionItem.GetUuid(), rule.Name)
+		return nil
+	}
+
+	if p.DefaultAllow != nil && !*p.DefaultAllow {
+		return executor.NewActionError(executor.ActionErrorPolicyDenied, nil, "%s of %s matches no rule of the execution policy, which denies by default",
+			action, actionItem.GetTargetSE().GetDisplayName())
+	}
+	return nil
+}
+
+// check whether the rule matches the action
+func (r *ExecutionPolicyRule) matches(action string, target *policyTarget) bool {
+	if len(r.Actions) > 0 && !containsString(r.Actions, action) {
+		return false
+	}
+	return r.PolicyScope.matches(target)
+}
+
+// parse the label selector of the scope
+func (s *PolicyScope) parse() error {
+	selector, err := labels.Parse(s.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector %q: %v", s.Selector, err)
+	}
+	s.selector = selector
+	return nil
+}
+
+// check whether the scope matches the related pod of the action
+func (s *PolicyScope) matches(target *policyTarget) bool {
+	if len(s.Namespaces) > 0 && !containsString(s.Namespaces, target.namespace) {
+		return false
+	}
+	if s.selector != nil && !s.selector.Empty() {
+		// the actions without a related pod match the scopes without a selector only
+		if !target.hasLabels || !s.selector.Matches(labels.Set(target.labels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// check the resize against the limits
+func (l *ExecutionPolicyLimits) check(actionItem *proto.ActionItemDTO) error {
+	if l == nil || actionItem.GetActionType() != proto.ActionItemDTO_RIGHT_SIZE {
+		return nil
+	}
+	current := actionItem.GetCurrentComm()
+	comm := actionItem.GetNewComm()
+	if current == nil || comm == nil {
+		return nil
+	}
+
+	if err := l.checkResize("capacity", current.GetCapacity(), comm.GetCapacity()); err != nil {
+		return err
+	}
+	return l.checkResize("reservation", current.GetReservation(), comm.GetReservation())
+}
+
+func (l *ExecutionPolicyLimits) checkResize(name string, current, value float64) error {
+	if current <= 0 {
+		return nil
+	}
+	percent := math.Abs(value-current) / current * 100
+	if value > current && l.MaxResizeUpPercent > 0 && percent > l.MaxResizeUpPercent {
+		return fmt.Errorf("%s increases by %.1f%%, more than %.1f%%", name, percent, l.MaxResizeUpPercent)
+	}
+	if value < current && l.MaxResizeDownPercent > 0 && percent > l.MaxResizeDownPercent {
+		return fmt.Errorf("%s decreases by %.1f%%, more than %.1f%%", name, percent, l.MaxResizeDownPercent)
+	}
+	return nil
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
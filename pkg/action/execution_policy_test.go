@@ -0,0 +1,110 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+)
+
+const testExecutionPolicy = `
+rules:
+- name: protect-system
+  namespaces: [kube-system]
+  allow: false
+- name: no-db-move
+  actions: [move]
+  selector: app=db
+  allow: false
+- name: limit-resize
+  actions: [resize]
+  allow: true
+  limits:
+    maxResizeUpPercent: 50
+    maxResizeDownPercent: 20
+- name: no-node-suspend
+  actions: [suspend]
+  namespaces: [""]
+  allow: false
+`
+
+func newPolicyActionItem(actionType proto.ActionItemDTO_ActionType, current, capacity float64) *proto.ActionItemDTO {
+	ctype := proto.CommodityDTO_VMEM
+	name := "foo"
+	return &proto.ActionItemDTO{
+		ActionType:  &actionType,
+		TargetSE:    &proto.EntityDTO{DisplayName: &name},
+		CurrentComm: &proto.CommodityDTO{CommodityType: &ctype, Capacity: &current},
+		NewComm:     &proto.CommodityDTO{CommodityType: &ctype, Capacity: &capacity},
+	}
+}
+
+func TestExecutionPolicyCheck(t *testing.T) {
+	policy, err := parseExecutionPolicy([]byte(testExecutionPolicy))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+
+	dbLabels := map[string]string{"app": "db"}
+	webLabels := map[string]string{"app": "web"}
+	tests := []struct {
+		name     string
+		target   *policyTarget
+		category executor.ActionErrorCategory
+	}{
+		{"system namespace", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0), "kube-system", webLabels, true},
+			executor.ActionErrorPolicyDenied},
+		{"db move", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0), "default", dbLabels, true},
+			executor.ActionErrorPolicyDenied},
+		{"web move", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0), "default", webLabels, true}, ""},
+		{"resize within limits", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_RIGHT_SIZE, 100, 140), "default", dbLabels, true}, ""},
+		{"resize up too much", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_RIGHT_SIZE, 100, 160), "default", dbLabels, true},
+			executor.ActionErrorPolicyDenied},
+		{"resize down too much", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_RIGHT_SIZE, 100, 70), "default", dbLabels, true},
+			executor.ActionErrorPolicyDenied},
+		{"node suspend", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_SUSPEND, 0, 0), "", nil, false},
+			executor.ActionErrorPolicyDenied},
+		{"pod suspend", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_SUSPEND, 0, 0), "default", dbLabels, true}, ""},
+		{"node provision", &policyTarget{newPolicyActionItem(proto.ActionItemDTO_PROVISION, 0, 0), "", nil, false}, ""},
+	}
+
+	for _, test := range tests {
+		err := policy.check(test.target)
+		if category := executor.GetActionErrorCategory(err); category != test.category {
+			t.Errorf("%s: expected category %q but got %q: %v", test.name, test.category, category, err)
+		}
+	}
+}
+
+func TestExecutionPolicyDefaultDeny(t *testing.T) {
+	policy, err := parseExecutionPolicy([]byte(`{"defaultAllow": false, "rules": [{"name": "allow-move", "actions": ["move"], "allow": true}]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+
+	if err := policy.check(&policyTarget{actionItem: newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0)}); err != nil {
+		t.Errorf("Expect move to be allowed: %v", err)
+	}
+	err = policy.check(&policyTarget{actionItem: newPolicyActionItem(proto.ActionItemDTO_PROVISION, 0, 0)})
+	if executor.GetActionErrorCategory(err) != executor.ActionErrorPolicyDenied {
+		t.Errorf("Expect provision to be denied by default: %v", err)
+	}
+
+	var nilPolicy *ExecutionPolicy
+	if err := nilPolicy.check(&policyTarget{actionItem: newPolicyActionItem(proto.ActionItemDTO_PROVISION, 0, 0)}); err != nil {
+		t.Errorf("Expect all actions to be allowed without policy: %v", err)
+	}
+}
+
+func TestParseExecutionPolicyInvalid(t *testing.T) {
+	invalid := []string{
+		"rules:\n- name: foo\n  actions: [migrate]\n",
+		"rules:\n- name: foo\n  selector: 'app in (db'\n",
+		"rules: foo",
+	}
+	for _, data := range invalid {
+		if _, err := parseExecutionPolicy([]byte(data)); err == nil {
+			t.Errorf("Expect error parsing execution policy %q", data)
+		}
+	}
+}
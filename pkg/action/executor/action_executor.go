@@ -10,12 +10,45 @@ import (
 type TurboActionExecutorInput struct {
 	ActionItem *proto.ActionItemDTO
 	Pod        *api.Pod
+
+	// all the action items of a composite action, in the order of the ActionExecutionDTO;
+	// ActionItem is the first one of them
+	ActionItems []*proto.ActionItemDTO
+
+	// build the changes of the action and submit them with server-side dry-run, without mutating anything
+	DryRun bool
+
+	// publishes the stages of the action; nil to publish nothing
+	Progress *ActionProgress
 }
 
 type TurboActionExecutorOutput struct {
 	Succeeded bool
 	OldPod    *api.Pod
 	NewPod    *api.Pod
+
+	// the controller changed by the action, e.g., the scaled Deployment, before and after the action
+	OldController *ControllerSpec
+	NewController *ControllerSpec
+
+	// whether the action is executed in dry-run mode, and the changes it would make
+	DryRun bool
+	Diff   string
+
+	// the note on the result of the succeeded action, e.g., the pods not changed by the action
+	Note string
+}
+
+// ControllerSpec is the fragment of a controller changed by an action:
+// its replicas, or the resized containers of its pod template.
+type ControllerSpec struct {
+	Name       string
+	Replicas   *int32
+	Containers []api.Container
+}
+
+func newReplicasSpec(name string, replicas int32) *ControllerSpec {
+	return &ControllerSpec{Name: name, Replicas: &replicas}
 }
 
 type TurboActionExecutor interface {
@@ -26,11 +59,20 @@ type TurboK8sActionExecutor struct {
 	kubeClient *kclient.Clientset
 	//lockMap    *util.ExpirationMap
 	podManager util.IPodManager
+
+	// delete the original pods through the Eviction subresource, so that PodDisruptionBudgets are honored
+	usePodEviction bool
+
+	// records the steps of the actions, to complete or revert them after a restart; nil to record nothing
+	journal *ActionJournal
 }
 
-func NewTurboK8sActionExecutor(kubeClient *kclient.Clientset, podManager util.IPodManager) TurboK8sActionExecutor {
+func NewTurboK8sActionExecutor(kubeClient *kclient.Clientset, podManager util.IPodManager, usePodEviction bool,
+	journal *ActionJournal) TurboK8sActionExecutor {
 	return TurboK8sActionExecutor{
-		kubeClient: kubeClient,
-		podManager: podManager,
+		kubeClient:     kubeClient,
+		podManager:     podManager,
+		usePodEviction: usePodEviction,
+		journal:        journal,
 	}
 }
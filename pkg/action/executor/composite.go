@@ -0,0 +1,259 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+)
+
+// CompositeActionExecutor executes the action items of a composite action on the same pod together:
+// a move of the pod and/or the resizes of its containers.
+// All the changes are applied to a single clone pod, which replaces the original pod in one recreate:
+//  - the container resizes are applied to the clone pod in the order of the action items;
+//  - the clone pod is placed on the destination node of the move, or the current node without a move.
+// So the changes either succeed together, or none of them is made if the clone pod doesn't get ready.
+// If the new pod fails the verification after the original pod is deleted, all the changes are rolled back together.
+type CompositeActionExecutor struct {
+	TurboK8sActionExecutor
+	reScheduler *ReScheduler
+	resizer     *ContainerResizer
+}
+
+func NewCompositeActionExecutor(ae TurboK8sActionExecutor, reScheduler *ReScheduler, resizer *ContainerResizer) *CompositeActionExecutor {
+	return &CompositeActionExecutor{
+		TurboK8sActionExecutor: ae,
+		reScheduler:            reScheduler,
+		resizer:                resizer,
+	}
+}
+
+// the changes of the action items of a composite action
+type compositeChange struct {
+	// the destination node of the move; nil if there is no move
+	node *api.Node
+	// the container resizes, at most one per container
+	specs []*containerResizeSpec
+}
+
+func (c *CompositeActionExecutor) Execute(input *TurboActionExecutorInput) (*TurboActionExecutorOutput, error) {
+	pod := input.Pod
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+
+	//1. build the changes of the action items
+	change, err := c.buildChange(input.ActionItems, pod)
+	if err != nil {
+		glog.Errorf("Failed to build composite action on pod %s: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	//2. check the changes
+	if err = c.preActionCheck(change, pod); err != nil {
+		glog.Errorf("Composite action on pod %s aborted: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	//3. build the clone pod with all the changes
+	npod, err := buildCompositePod(pod, change)
+	if err != nil {
+		glog.Errorf("Composite action on pod %s aborted: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	if input.DryRun {
+		return c.dryRun(pod, npod, change)
+	}
+
+	//4. replace the pod with the clone pod
+	action := JournalActionResize
+	if change.node != nil {
+		action = JournalActionMove
+	}
+	xpod, err := replacePod(c.kubeClient, pod, npod, action, defaultRetryMore, c.usePodEviction, c.journal, input.Progress)
+	if err != nil {
+		glog.Errorf("Composite action on pod %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "failed to replace pod %s", fullName)
+	}
+
+	//5. check the new pod, and roll back all the changes if it doesn't get running
+	nodeName := npod.Spec.NodeName
+	if err = c.reScheduler.checkPod(xpod, nodeName); err != nil {
+		glog.Errorf("Checking composite action on pod %s failed: %v", fullName, err)
+		cause := NewActionError(ActionErrorVerificationFailed, err, "pod %s/%s is not running on node %s", xpod.Namespace, xpod.Name, nodeName)
+		return &TurboActionExecutorOutput{}, rollbackCompositePod(c, xpod, pod, change, cause, input.Progress)
+	}
+	glog.V(2).Infof("Composite action on pod %s succeeded: pod %s is running on node %s.", fullName, xpod.Name, nodeName)
+
+	return &TurboActionExecutorOutput{
+		Succeeded: true,
+		OldPod:    pod,
+		NewPod:    xpod,
+	}, nil
+}
+
+// build the changes of the action items: at most one move, and at most one resize per container.
+func (c *CompositeActionExecutor) buildChange(actionItems []*proto.ActionItemDTO, pod *api.Pod) (*compositeChange, error) {
+	change := &compositeChange{}
+	resized := make(map[int]bool)
+
+	for _, item := range actionItems {
+		switch {
+		case item.GetActionType() == proto.ActionItemDTO_MOVE && item.GetTargetSE().GetEntityType() == proto.EntityDTO_CONTAINER_POD:
+			if change.node != nil {
+				return nil, NewActionError(ActionErrorInvalidAction, nil, "more than one move of pod %s/%s", pod.Namespace, pod.Name)
+			}
+			node, err := c.reScheduler.getPodNode(item)
+			if err != nil {
+				return nil, err
+			}
+			change.node = node
+
+		case item.GetActionType() == proto.ActionItemDTO_RIGHT_SIZE && item.GetTargetSE().GetEntityType() == proto.EntityDTO_CONTAINER:
+			spec, err := c.resizer.buildResizeAction(item, pod)
+			if err != nil {
+				return nil, NewActionError(ActionErrorInvalidAction, err, "failed to build the container resize")
+			}
+			if resized[spec.Index] {
+				return nil, NewActionError(ActionErrorInvalidAction, nil, "more than one resize of container[%d] in pod %s/%s",
+					spec.Index, pod.Namespace, pod.Name)
+			}
+			resized[spec.Index] = true
+			change.specs = append(change.specs, spec)
+
+		default:
+			return nil, NewActionError(ActionErrorInvalidAction, nil, "action %v on %v is not supported in a composite action",
+				item.GetActionType(), item.GetTargetSE().GetEntityType())
+		}
+	}
+
+	return change, nil
+}
+
+// Check whether the changes should be executed: the checks of the move and the resizes,
+// and the parent of the pod must support cloning the pod.
+func (c *CompositeActionExecutor) preActionCheck(change *compositeChange, pod *api.Pod) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+
+	if change.node != nil {
+		if err := c.reScheduler.preActionCheck(pod, change.node); err != nil {
+			return err
+		}
+	}
+	for _, spec := range change.specs {
+		if err := c.resizer.preActionCheck(spec, pod); err != nil {
+			return err
+		}
+	}
+
+	parentKind, _, err := podutil.GetPodGrandInfo(c.kubeClient, pod)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
+	}
+	// The pod of StatefulSet is recreated instead of cloned, so it cannot be changed by a composite action.
+	if util.IsStatefulSet(parentKind) || !util.SupportedMoveParent(parentKind) {
+		return NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported in a composite action",
+			parentKind, fullName)
+	}
+	if change.node != nil {
+		if err := c.reScheduler.volumeChecker.check(pod, change.node, false); err != nil {
+			return err
+		}
+	}
+	if len(change.specs) > 0 {
+		kind, _, err := podutil.GetPodParentInfo(pod)
+		if err != nil {
+			return NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
+		}
+		if !util.SupportedParent(kind) {
+			return NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported", kind, fullName)
+		}
+	}
+
+	return nil
+}
+
+// build the clone pod (without labels) of the pod with all the changes:
+// on the destination node of the move, and with the resized containers.
+func buildCompositePod(pod *api.Pod, change *compositeChange) (*api.Pod, error) {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+
+	nodeName := pod.Spec.NodeName
+	if change.node != nil {
+		nodeName = change.node.Name
+	}
+	npod := buildClonePod(pod, nodeName)
+	if change.node == nil {
+		util.AddAnnotation(npod, TurboActionAnnotationKey, TurboResizeAnnotationValue)
+	}
+	changed := nodeName != pod.Spec.NodeName
+
+	for _, spec := range change.specs {
+		updated, err := updateResourceAmount(npod, spec)
+		if err != nil {
+			return nil, NewActionError(ActionErrorInvalidAction, err, "cannot resize container[%d] of pod %s", spec.Index, fullName)
+		}
+		changed = changed || updated
+	}
+
+	if !changed {
+		return nil, NewActionError(ActionErrorNoChange, nil, "no change to pod %s", fullName)
+	}
+	return npod, nil
+}
+
+// build the composite action without executing it, and submit the clone pod with server-side dry-run.
+func (c *CompositeActionExecutor) dryRun(pod, npod *api.Pod, change *compositeChange) (*TurboActionExecutorOutput, error) {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	if err := checkNodeFeasibility(c.kubeClient, pod, npod, false); err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+	helper := newDryRunHelper(c.kubeClient)
+
+	if npod.Spec.NodeName != pod.Spec.NodeName {
+		helper.addChange("pod %s: spec.nodeName: %s -> %s", fullName, pod.Spec.NodeName, npod.Spec.NodeName)
+	}
+	for _, spec := range change.specs {
+		container := &pod.Spec.Containers[spec.Index]
+		for _, diff := range containerResourceDiff(container, &npod.Spec.Containers[spec.Index]) {
+			helper.addChange("pod %s, container %s: %s", fullName, container.Name, diff)
+		}
+	}
+	helper.addChange("clone pod %s is created, and pod %s is deleted", util.BuildIdentifier(npod.Namespace, npod.Name), fullName)
+
+	if err := helper.create(c.kubeClient.CoreV1().RESTClient(), pod.Namespace, "pods", npod); err != nil {
+		glog.Errorf("Dry run of composite action on pod %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of composite action on pod %s failed", fullName)
+	}
+
+	glog.V(2).Infof("Dry run of composite action on pod %s succeeded: %s", fullName, helper.diff())
+	return helper.output(), nil
+}
+
+// Roll back all the changes of a composite action: replace the new pod npod with a clone pod
+// on the node of the original pod, with the original resources of the resized containers.
+// Returns a RollbackError carrying the cause and the result of the rollback.
+func rollbackCompositePod(c *CompositeActionExecutor, npod, original *api.Pod, change *compositeChange, cause error,
+	progress *ActionProgress) error {
+	glog.Warningf("Begin to roll back composite action on pod %s/%s: %v", npod.Namespace, npod.Name, cause)
+	progress.Update(ProgressStarted, "Rolling back pod %s: %v", npod.Name, cause)
+
+	rpod := buildClonePod(npod, original.Spec.NodeName)
+	for _, spec := range change.specs {
+		if spec.Index >= len(rpod.Spec.Containers) || spec.Index >= len(original.Spec.Containers) {
+			return NewRollbackError(cause, fmt.Errorf("cannot find container[%d] in pod %s/%s", spec.Index, npod.Namespace, npod.Name))
+		}
+		rpod.Spec.Containers[spec.Index].Resources = *original.Spec.Containers[spec.Index].Resources.DeepCopy()
+	}
+
+	xpod, err := replacePod(c.kubeClient, npod, rpod, JournalActionMove, defaultRetryMore, false, c.journal, progress)
+	if err != nil {
+		glog.Errorf("Failed to roll back composite action on pod %s/%s: %v", npod.Namespace, npod.Name, err)
+		return NewRollbackError(cause, err)
+	}
+
+	glog.V(2).Infof("Rolled back composite action: pod %s/%s is restored as %s.", original.Namespace, original.Name, xpod.Name)
+	return NewRollbackError(cause, nil)
+}
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildCompositePod(t *testing.T) {
+	pod := newTestPod("default", "foo-1", withPodNode("node-a"), withPodLabels(map[string]string{"app": "foo"}), withPodContainers(
+		api.Container{Name: "c1", Resources: api.ResourceRequirements{Limits: api.ResourceList{api.ResourceCPU: resource.MustParse("1")}}},
+		api.Container{Name: "c2", Resources: api.ResourceRequirements{Limits: api.ResourceList{api.ResourceMemory: resource.MustParse("1Gi")}}},
+	))
+
+	spec1 := NewContainerResizeSpec(0)
+	spec1.NewCapacity[api.ResourceCPU] = resource.MustParse("2")
+	spec2 := NewContainerResizeSpec(1)
+	spec2.NewCapacity[api.ResourceMemory] = resource.MustParse("2Gi")
+	node := &api.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}
+
+	npod, err := buildCompositePod(pod, &compositeChange{node: node, specs: []*containerResizeSpec{spec1, spec2}})
+	if err != nil {
+		t.Fatalf("Failed to build composite pod: %v", err)
+	}
+	if npod.Spec.NodeName != "node-b" {
+		t.Errorf("Unexpected node of composite pod: %s", npod.Spec.NodeName)
+	}
+	if cpu := npod.Spec.Containers[0].Resources.Limits[api.ResourceCPU]; cpu.String() != "2" {
+		t.Errorf("Unexpected cpu limit of container c1: %s", cpu.String())
+	}
+	if mem := npod.Spec.Containers[1].Resources.Limits[api.ResourceMemory]; mem.String() != "2Gi" {
+		t.Errorf("Unexpected memory limit of container c2: %s", mem.String())
+	}
+	if len(npod.Labels) != 0 || npod.Annotations[TurboActionAnnotationKey] != TurboMoveAnnotationValue {
+		t.Errorf("Unexpected labels %v or annotations %v of composite pod", npod.Labels, npod.Annotations)
+	}
+	// the original pod is not changed
+	if cpu := pod.Spec.Containers[0].Resources.Limits[api.ResourceCPU]; cpu.String() != "1" {
+		t.Errorf("The original pod is changed: %s", cpu.String())
+	}
+}
+
+func TestBuildCompositePodNoChange(t *testing.T) {
+	pod := newTestPod("default", "foo-1", withPodNode("node-a"))
+	node := &api.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}
+
+	_, err := buildCompositePod(pod, &compositeChange{node: node})
+	if GetActionErrorCategory(err) != ActionErrorNoChange {
+		t.Errorf("Expect error of no change, got %v", err)
+	}
+}
@@ -13,9 +13,34 @@ const (
 	defaultPodCreateSleep     = time.Second * 11
 	defaultUpdateReplicaSleep = time.Second * 20
 
+	defaultPodDeleteSleep   = time.Second * 1
+	defaultPodDeleteTimeout = time.Second * 30
+
+	defaultRetryRollout      = 60
+	defaultRolloutCheckSleep = time.Second * 10
+
+	// the timeout to drain a node, including the retries of the evictions refused by PodDisruptionBudgets
+	defaultDrainTimeout    = time.Minute * 10
+	defaultDrainRetrySleep = time.Second * 5
+
+	// the timeout for the new node of a provision to get ready, including the creation of the machine
+	defaultNodeProvisionTimeout = time.Minute * 20
+	defaultNodeProvisionSleep   = time.Second * 30
+
 	// this annotation is set for move/Resize actions;
 	// which can be used for future garbage collection if action is interrupted
 	TurboActionAnnotationKey   string = "kubeturbo.io/action"
 	TurboMoveAnnotationValue   string = "move"
 	TurboResizeAnnotationValue string = "resize"
+
+	// the actions on the pods in a namespace with this annotation set to "true" are executed in dry-run mode
+	DryRunAnnotationKey string = "kubeturbo.io/dry-run"
+
+	// the actions on the pods in a namespace with this annotation set to "true" wait for the approval
+	// of their TurboAction custom resources before being executed
+	ApprovalAnnotationKey string = "kubeturbo.io/action-approval"
+
+	// the nodes cordoned by the suspend actions have this annotation set to "true";
+	// only these nodes are uncordoned by kubeturbo, the others are left to whoever cordoned them
+	CordonedAnnotationKey string = "kubeturbo.io/cordoned"
 )
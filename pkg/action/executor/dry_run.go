@@ -0,0 +1,173 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	k8sapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	kclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// the query parameter for server-side dry-run: the request is validated and admitted, but not persisted.
+	dryRunParam = "dryRun"
+	dryRunAll   = "All"
+
+	// server-side dry-run is enabled by default since Kubernetes 1.13;
+	// older API servers ignore the dryRun parameter, and would persist the request.
+	dryRunMinMajorVersion = 1
+	dryRunMinMinorVersion = 13
+)
+
+// dryRunHelper collects the changes an action would make, and submits them with server-side dry-run,
+// so that they are validated and admitted by the API server without being persisted.
+type dryRunHelper struct {
+	client *kclient.Clientset
+
+	// whether the API server supports server-side dry-run; if not, the changes are not submitted at all.
+	validated bool
+
+	changes []string
+}
+
+func newDryRunHelper(client *kclient.Clientset) *dryRunHelper {
+	helper := &dryRunHelper{
+		client: client,
+	}
+
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		glog.Errorf("Failed to get server version, the dry-run changes will not be submitted: %v", err)
+		return helper
+	}
+	helper.validated = supportsDryRun(info)
+	if !helper.validated {
+		glog.Warningf("API server %s does not support server-side dry-run, the dry-run changes will not be submitted", info.GitVersion)
+	}
+
+	return helper
+}
+
+// check whether the API server of the version supports server-side dry-run
+func supportsDryRun(info *version.Info) bool {
+	major, err := strconv.Atoi(strings.TrimRight(info.Major, "+"))
+	if err != nil {
+		return false
+	}
+	// the minor version can be suffixed, e.g., "13+" for GKE
+	minor, err := strconv.Atoi(strings.TrimRight(info.Minor, "+"))
+	if err != nil {
+		return false
+	}
+
+	return major > dryRunMinMajorVersion || (major == dryRunMinMajorVersion && minor >= dryRunMinMinorVersion)
+}
+
+func (d *dryRunHelper) addChange(format string, args ...interface{}) {
+	d.changes = append(d.changes, fmt.Sprintf(format, args...))
+}
+
+// the diff of the changes, which is reported in the action result
+func (d *dryRunHelper) diff() string {
+	result := strings.Join(d.changes, "; ")
+	if !d.validated {
+		result += fmt.Sprintf(" (not validated by the API server: server-side dry-run requires Kubernetes %d.%d or later)",
+			dryRunMinMajorVersion, dryRunMinMinorVersion)
+	}
+	return result
+}
+
+func (d *dryRunHelper) output() *TurboActionExecutorOutput {
+	return &TurboActionExecutorOutput{
+		Succeeded: true,
+		DryRun:    true,
+		Diff:      d.diff(),
+	}
+}
+
+// submit the creation of the object with server-side dry-run
+func (d *dryRunHelper) create(c rest.Interface, namespace, resource string, obj runtime.Object) error {
+	if !d.validated {
+		return nil
+	}
+	return c.Post().Namespace(namespace).Resource(resource).
+		Param(dryRunParam, dryRunAll).Body(obj).Do().Error()
+}
+
+// submit the update of the object with server-side dry-run
+func (d *dryRunHelper) update(c rest.Interface, namespace, resource, name string, obj runtime.Object) error {
+	if !d.validated {
+		return nil
+	}
+	return c.Put().Namespace(namespace).Resource(resource).Name(name).
+		Param(dryRunParam, dryRunAll).Body(obj).Do().Error()
+}
+
+// submit the deletion of the object with server-side dry-run
+func (d *dryRunHelper) delete(c rest.Interface, namespace, resource, name string) error {
+	if !d.validated {
+		return nil
+	}
+	return c.Delete().Namespace(namespace).Resource(resource).Name(name).
+		Param(dryRunParam, dryRunAll).Do().Error()
+}
+
+// submit the update of the scale subresource of the owner with server-side dry-run
+func (d *dryRunHelper) updateScale(owner *goutil.OwnerInfo, scale *unstructured.Unstructured) error {
+	if !d.validated {
+		return nil
+	}
+	data, err := scale.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return d.client.Discovery().RESTClient().Put().AbsPath(owner.Path(goutil.ScaleSubResource)).
+		Param(dryRunParam, dryRunAll).SetHeader("Content-Type", "application/json").Body(data).Do().Error()
+}
+
+// describe the changes of the resource limits and requests of the container, e.g.,
+// "limits.cpu: 100m -> 200m", sorted by the resource names.
+func containerResourceDiff(oldContainer, newContainer *k8sapi.Container) []string {
+	result := resourceListDiff("limits", oldContainer.Resources.Limits, newContainer.Resources.Limits)
+	return append(result, resourceListDiff("requests", oldContainer.Resources.Requests, newContainer.Resources.Requests)...)
+}
+
+func resourceListDiff(prefix string, oldList, newList k8sapi.ResourceList) []string {
+	names := []string{}
+	for name := range newList {
+		names = append(names, string(name))
+	}
+	for name := range oldList {
+		if _, exist := newList[name]; !exist {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+
+	result := []string{}
+	for _, name := range names {
+		oldValue, oldExist := oldList[k8sapi.ResourceName(name)]
+		newValue, newExist := newList[k8sapi.ResourceName(name)]
+		if oldExist && newExist && oldValue.Cmp(newValue) == 0 {
+			continue
+		}
+
+		from, to := "<none>", "<none>"
+		if oldExist {
+			from = oldValue.String()
+		}
+		if newExist {
+			to = newValue.String()
+		}
+		result = append(result, fmt.Sprintf("%s.%s: %s -> %s", prefix, name, from, to))
+	}
+	return result
+}
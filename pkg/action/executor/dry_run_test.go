@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestSupportsDryRun(t *testing.T) {
+	tests := []struct {
+		major, minor string
+		want         bool
+	}{
+		{"1", "11", false},
+		{"1", "12+", false},
+		{"1", "13", true},
+		{"1", "14+", true},
+		{"2", "0", true},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		info := &version.Info{Major: tt.major, Minor: tt.minor}
+		if got := supportsDryRun(info); got != tt.want {
+			t.Errorf("supportsDryRun(%s.%s) = %v, want %v", tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestContainerResourceDiff(t *testing.T) {
+	oldContainer := &k8sapi.Container{}
+	oldContainer.Resources.Limits = k8sapi.ResourceList{
+		k8sapi.ResourceCPU:    resource.MustParse("100m"),
+		k8sapi.ResourceMemory: resource.MustParse("128Mi"),
+	}
+
+	newContainer := oldContainer.DeepCopy()
+	newContainer.Resources.Limits[k8sapi.ResourceCPU] = resource.MustParse("200m")
+	newContainer.Resources.Requests = k8sapi.ResourceList{
+		k8sapi.ResourceCPU: resource.MustParse("0"),
+	}
+
+	want := []string{"limits.cpu: 100m -> 200m", "requests.cpu: <none> -> 0"}
+	if got := containerResourceDiff(oldContainer, newContainer); !reflect.DeepEqual(got, want) {
+		t.Errorf("containerResourceDiff() = %v, want %v", got, want)
+	}
+}
+
+func TestDryRunHelperDiff(t *testing.T) {
+	helper := &dryRunHelper{validated: true}
+	helper.addChange("pod %s: spec.nodeName: %s -> %s", "ns/foo", "node-a", "node-b")
+	helper.addChange("clone pod %s is created", "ns/foo-c")
+
+	output := helper.output()
+	if !output.Succeeded || !output.DryRun {
+		t.Errorf("Unexpected dry-run output: %++v", output)
+	}
+	if want := "pod ns/foo: spec.nodeName: node-a -> node-b; clone pod ns/foo-c is created"; output.Diff != want {
+		t.Errorf("diff() = %s, want %s", output.Diff, want)
+	}
+
+	helper.validated = false
+	if diff := helper.diff(); !strings.Contains(diff, "not validated by the API server") {
+		t.Errorf("diff() should note the changes are not validated: %s", diff)
+	}
+}
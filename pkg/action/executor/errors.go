@@ -0,0 +1,138 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ActionErrorCategory is the category of the failure of an action.
+// It is reported to the server at the beginning of the description of the ActionResponse.
+type ActionErrorCategory string
+
+const (
+	// the action item is not valid, e.g., missing the target or the destination entity
+	ActionErrorInvalidAction ActionErrorCategory = "InvalidAction"
+	// the related pod of the action is not found
+	ActionErrorPodNotFound ActionErrorCategory = "PodNotFound"
+	// the parent controller of the pod is not supported by the action
+	ActionErrorUnsupportedParent ActionErrorCategory = "UnsupportedParent"
+	// the pod runs with an Openshift SCC which is not allowed by --scc-support
+	ActionErrorSCCDenied ActionErrorCategory = "SCCDenied"
+	// the controller is scaled by a HorizontalPodAutoscaler, which would revert the scaling
+	ActionErrorScaledByHPA ActionErrorCategory = "ScaledByHPA"
+	// the destination node of the move is not found
+	ActionErrorNodeNotFound ActionErrorCategory = "NodeNotFound"
+	// the volumes of the pod can not be attached on the destination node of the move, or their data would be lost
+	ActionErrorVolumeConflict ActionErrorCategory = "VolumeConflict"
+	// the pod doesn't fit its node by a scheduler predicate, e.g., the resources, taints or affinity
+	ActionErrorPredicateFailed ActionErrorCategory = "PredicateFailed"
+	// the clone pod of a move or resize doesn't get ready in time
+	ActionErrorCloneNotReady ActionErrorCategory = "CloneNotReady"
+	// the pod can not be created because it exceeds the ResourceQuota of the namespace
+	ActionErrorQuotaExceeded ActionErrorCategory = "QuotaExceeded"
+	// the action is rejected, or not approved in time, through its TurboAction custom resource
+	ActionErrorNotApproved ActionErrorCategory = "NotApproved"
+	// the action is denied by the execution policy
+	ActionErrorPolicyDenied ActionErrorCategory = "PolicyDenied"
+	// the disruptive action is outside the maintenance windows of the pod
+	ActionErrorOutsideMaintenanceWindow ActionErrorCategory = "OutsideMaintenanceWindow"
+	// the eviction of the pod is refused by its PodDisruptionBudget
+	ActionErrorPDBBlocked ActionErrorCategory = "PDBBlocked"
+	// the pod is not allowed to be changed by kubeturbo, e.g., it has the controllable annotation set to "false"
+	ActionErrorNotControllable ActionErrorCategory = "NotControllable"
+	// the pods are not evicted from the node in time
+	ActionErrorDrainTimeout ActionErrorCategory = "DrainTimeout"
+	// the new limit of a quota resize is below the current usage of the quota
+	ActionErrorBelowUsage ActionErrorCategory = "BelowUsage"
+	// the action makes no change, e.g., the pod is already on the destination node
+	ActionErrorNoChange ActionErrorCategory = "NoChange"
+	// the result of the action is not as expected after the change
+	ActionErrorVerificationFailed ActionErrorCategory = "VerificationFailed"
+	// the lock of the related entity is not acquired in time
+	ActionErrorLockTimeout ActionErrorCategory = "LockTimeout"
+	// the lock of the related entity expires and is taken by another action while the action is executed
+	ActionErrorLockLost ActionErrorCategory = "LockLost"
+	// the disruptive action waits too long in the queue of the concurrency budgets
+	ActionErrorBudgetTimeout ActionErrorCategory = "BudgetTimeout"
+	// a request to the API server failed
+	ActionErrorAPIFailure ActionErrorCategory = "APIFailure"
+	ActionErrorUnknown    ActionErrorCategory = "Unknown"
+)
+
+// ActionError is the failure of an action with its category and a detailed message.
+type ActionError struct {
+	Category ActionErrorCategory
+	Message  string
+	// the underlying error; nil if none
+	Cause error
+}
+
+func NewActionError(category ActionErrorCategory, cause error, format string, args ...interface{}) *ActionError {
+	return &ActionError{
+		Category: category,
+		Message:  fmt.Sprintf(format, args...),
+		Cause:    cause,
+	}
+}
+
+func (e *ActionError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Category, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Category, e.Message)
+}
+
+// GetActionErrorCategory returns the category of the error of an action.
+// Errors which are not ActionErrors are categorized by their types, or ActionErrorUnknown if not known.
+func GetActionErrorCategory(err error) ActionErrorCategory {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case *ActionError:
+		return e.Category
+	case *PodDisruptionBudgetError:
+		return ActionErrorPDBBlocked
+	case *RollbackError:
+		return GetActionErrorCategory(e.cause)
+	}
+
+	if isQuotaExceededError(err) {
+		return ActionErrorQuotaExceeded
+	}
+	return ActionErrorUnknown
+}
+
+// DescribeActionError builds the description of the failure of an action: its category followed by the details.
+func DescribeActionError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	msg := err.Error()
+	prefix := string(GetActionErrorCategory(err)) + ": "
+	if strings.HasPrefix(msg, prefix) {
+		return msg
+	}
+	return prefix + msg
+}
+
+// wrap the error of a step of an action as an ActionError with the given category.
+// The errors which are already categorized, e.g., ActionErrors and the refusals of PodDisruptionBudget,
+// are returned as they are; the error of exceeding the quota is categorized as ActionErrorQuotaExceeded.
+func wrapActionError(err error, category ActionErrorCategory, format string, args ...interface{}) error {
+	switch err.(type) {
+	case *ActionError, *PodDisruptionBudgetError, *RollbackError:
+		return err
+	}
+	if isQuotaExceededError(err) {
+		category = ActionErrorQuotaExceeded
+	}
+	return NewActionError(category, err, format, args...)
+}
+
+// check whether the API server refuses to create the pod because of the ResourceQuota of the namespace
+func isQuotaExceededError(err error) bool {
+	return errors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
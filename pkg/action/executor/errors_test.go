@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGetActionErrorCategory(t *testing.T) {
+	quotaErr := errors.NewForbidden(schema.GroupResource{Resource: "pods"}, "foo-1-a1",
+		fmt.Errorf("exceeded quota: compute-resources"))
+
+	tests := []struct {
+		name string
+		err  error
+		want ActionErrorCategory
+	}{
+		{"action error", NewActionError(ActionErrorSCCDenied, nil, "pod %s has unsupported SCC", "default/foo"), ActionErrorSCCDenied},
+		{"pdb error", &PodDisruptionBudgetError{podName: "default/foo", cause: fmt.Errorf("429")}, ActionErrorPDBBlocked},
+		{"rollback error", NewRollbackError(NewActionError(ActionErrorVerificationFailed, nil, "not running"), nil), ActionErrorVerificationFailed},
+		{"quota error", quotaErr, ActionErrorQuotaExceeded},
+		{"other error", fmt.Errorf("timeout"), ActionErrorUnknown},
+	}
+	for _, tt := range tests {
+		if got := GetActionErrorCategory(tt.err); got != tt.want {
+			t.Errorf("%s: expect category %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDescribeActionError(t *testing.T) {
+	err := NewActionError(ActionErrorCloneNotReady, fmt.Errorf("timeout"), "clone pod %s is not ready", "default/foo-1-a1")
+	if desc := DescribeActionError(err); desc != "CloneNotReady: clone pod default/foo-1-a1 is not ready: timeout" {
+		t.Errorf("Unexpected description: %s", desc)
+	}
+
+	rollbackErr := NewRollbackError(NewActionError(ActionErrorVerificationFailed, nil, "pod default/foo is not running"), nil)
+	if desc := DescribeActionError(rollbackErr); desc != "VerificationFailed: pod default/foo is not running; rolled back to the original configuration" {
+		t.Errorf("Unexpected description of rollback: %s", desc)
+	}
+
+	if desc := DescribeActionError(fmt.Errorf("timeout")); desc != "Unknown: timeout" {
+		t.Errorf("Unexpected description of unknown error: %s", desc)
+	}
+}
+
+func TestWrapActionError(t *testing.T) {
+	pdbErr := &PodDisruptionBudgetError{podName: "default/foo", cause: fmt.Errorf("429")}
+	if err := wrapActionError(pdbErr, ActionErrorAPIFailure, "failed to move pod"); !IsPodDisruptionBudgetError(err) {
+		t.Errorf("The refusal of PodDisruptionBudget is not kept: %v", err)
+	}
+
+	err := wrapActionError(fmt.Errorf("timeout"), ActionErrorAPIFailure, "failed to move pod %s", "default/foo")
+	if GetActionErrorCategory(err) != ActionErrorAPIFailure {
+		t.Errorf("Unexpected category of wrapped error: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package executor
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"strings"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+
+	api "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the cause and the message of the refusal of the API server to evict a pod violating its PodDisruptionBudget
+	disruptionBudgetCause   metav1.CauseType = "DisruptionBudget"
+	disruptionBudgetMessage                  = "disruption budget"
+)
+
+// PodDisruptionBudgetError indicates that the eviction of a pod is refused because it would
+// violate the PodDisruptionBudget(s) of the pod. The action should not be retried.
+type PodDisruptionBudgetError struct {
+	podName string
+	cause   error
+}
+
+func (e *PodDisruptionBudgetError) Error() string {
+	return fmt.Sprintf("eviction of pod %s is blocked by PodDisruptionBudget: %v", e.podName, e.cause)
+}
+
+// IsPodDisruptionBudgetError returns true if the error is caused by PodDisruptionBudget.
+func IsPodDisruptionBudgetError(err error) bool {
+	_, ok := err.(*PodDisruptionBudgetError)
+	return ok
+}
+
+// Deletes the pod. If evict is true, the pod is deleted through the Eviction subresource
+// so that the PodDisruptionBudgets of the pod are honored.
+func deletePod(client *kclient.Clientset, pod *api.Pod, evict bool) error {
+	if evict {
+		return evictPod(client, pod)
+	}
+
+	delOpt := &metav1.DeleteOptions{}
+	return client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, delOpt)
+}
+
+// Evicts the pod through the policy/v1beta1 Eviction subresource.
+// The API server refuses the eviction with "429 TooManyRequests" if it would violate a PodDisruptionBudget,
+// which results in a PodDisruptionBudgetError; the other 429 responses, e.g., of the throttling of the API server,
+// are returned as they are.
+func evictPod(client *kclient.Clientset, pod *api.Pod) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	uid := pod.UID
+
+	eviction := &policy.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "policy/v1beta1",
+			Kind:       "Eviction",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		},
+	}
+
+	err := client.CoreV1().Pods(pod.Namespace).Evict(eviction)
+	if err == nil {
+		glog.V(3).Infof("Evicted pod %s", fullName)
+		return nil
+	}
+
+	if isDisruptionBudgetRefusal(err) {
+		err = &PodDisruptionBudgetError{podName: fullName, cause: err}
+	}
+	glog.Errorf("Failed to evict pod %s: %v", fullName, err)
+
+	return err
+}
+
+// check whether the error is the refusal of the eviction by PodDisruptionBudget: "429 TooManyRequests" with
+// the DisruptionBudget cause, or with the message of the disruption budget by the API servers without the cause.
+func isDisruptionBudgetRefusal(err error) bool {
+	if !errors.IsTooManyRequests(err) {
+		return false
+	}
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		return false
+	}
+	if details := status.Status().Details; details != nil {
+		for _, cause := range details.Causes {
+			if cause.Type == disruptionBudgetCause {
+				return true
+			}
+		}
+	}
+	return strings.Contains(status.Status().Message, disruptionBudgetMessage)
+}
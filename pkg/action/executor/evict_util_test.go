@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const evictTestPodPath = "/api/v1/namespaces/default/pods/foo-1"
+
+// set up the pod foo-1, whose eviction is handled by the handler
+func newEvictTestServer(t *testing.T, handler func(w http.ResponseWriter, eviction *policy.Eviction)) *fakeAPIServer {
+	server := newFakeAPIServer(t)
+	server.set(evictTestPodPath, newTestPod("default", "foo-1"))
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if r.Method != http.MethodPost || r.URL.Path != evictTestPodPath+"/eviction" {
+			return false
+		}
+		eviction := &policy.Eviction{}
+		if err := json.Unmarshal(body, eviction); err != nil {
+			t.Errorf("Failed to decode eviction: %v", err)
+		}
+		handler(w, eviction)
+		return true
+	})
+	return server
+}
+
+func TestEvictPod(t *testing.T) {
+	var server *fakeAPIServer
+	server = newEvictTestServer(t, func(w http.ResponseWriter, eviction *policy.Eviction) {
+		if eviction.DeleteOptions == nil || eviction.DeleteOptions.Preconditions == nil || *eviction.DeleteOptions.Preconditions.UID != "foo-1" {
+			t.Errorf("Expect the eviction with the precondition of the pod uid, but got %+v", eviction.DeleteOptions)
+		}
+		server.delete(evictTestPodPath)
+		writeStatus(w, http.StatusCreated, "", "")
+	})
+	defer server.close()
+
+	if err := deletePod(server.client(), newTestPod("default", "foo-1"), true); err != nil {
+		t.Errorf("Failed to evict pod: %v", err)
+	}
+	if server.get(evictTestPodPath, &api.Pod{}) {
+		t.Errorf("Expect the pod to be evicted")
+	}
+}
+
+func TestEvictPodTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		causes  []metav1.StatusCause
+		wantPDB bool
+	}{
+		{"refused with cause", "Cannot evict pod as it would violate the pod's disruption budget.",
+			[]metav1.StatusCause{{Type: disruptionBudgetCause, Message: "The disruption budget foo needs 1 healthy pods"}}, true},
+		{"refused without cause", "Cannot evict pod as it would violate the pod's disruption budget.", nil, true},
+		{"throttled", "too many requests, please try again later", nil, false},
+	}
+
+	for _, tt := range tests {
+		server := newEvictTestServer(t, func(w http.ResponseWriter, eviction *policy.Eviction) {
+			writeStatus(w, http.StatusTooManyRequests, metav1.StatusReasonTooManyRequests, tt.message, tt.causes...)
+		})
+
+		err := evictPod(server.client(), newTestPod("default", "foo-1"))
+		if err == nil {
+			t.Errorf("%s: expect the eviction to fail", tt.name)
+		} else if IsPodDisruptionBudgetError(err) != tt.wantPDB {
+			t.Errorf("%s: expect PodDisruptionBudget error %v, but got %v", tt.name, tt.wantPDB, err)
+		}
+		server.close()
+	}
+}
+
+func TestDeletePodWithoutEviction(t *testing.T) {
+	server := newEvictTestServer(t, func(w http.ResponseWriter, eviction *policy.Eviction) {
+		t.Errorf("Unexpected eviction of pod %s", eviction.Name)
+		writeStatus(w, http.StatusTooManyRequests, metav1.StatusReasonTooManyRequests, "unexpected eviction")
+	})
+	defer server.close()
+
+	if err := deletePod(server.client(), newTestPod("default", "foo-1"), false); err != nil {
+		t.Errorf("Failed to delete pod: %v", err)
+	}
+	if server.get(evictTestPodPath, &api.Pod{}) {
+		t.Errorf("Expect the pod to be deleted")
+	}
+}
@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer serves the objects in memory by their paths, e.g., /api/v1/namespaces/default/pods/foo,
+// so that the executors are tested with a real Clientset:
+//   GET, PUT and DELETE operate the object of the path; POST creates the object in the collection of the path.
+// The requests can be intercepted by the hooks, e.g., to simulate the controllers or the refusals of the server.
+type fakeAPIServer struct {
+	t *testing.T
+
+	mutex   sync.Mutex
+	objects map[string][]byte
+
+	// handles the request before the objects; returns true if the request is handled
+	hooks []func(w http.ResponseWriter, r *http.Request, body []byte) bool
+
+	server *httptest.Server
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	s := &fakeAPIServer{t: t, objects: make(map[string][]byte)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeAPIServer) close() {
+	s.server.Close()
+}
+
+func (s *fakeAPIServer) client() *kclient.Clientset {
+	client, err := kclient.NewForConfig(&rest.Config{Host: s.server.URL})
+	if err != nil {
+		s.t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+func (s *fakeAPIServer) addHook(hook func(w http.ResponseWriter, r *http.Request, body []byte) bool) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// set the object of the path
+func (s *fakeAPIServer) set(path string, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		s.t.Fatalf("Failed to encode object %s: %v", path, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[path] = data
+}
+
+// get the object of the path into obj; returns false if not found
+func (s *fakeAPIServer) get(path string, obj interface{}) bool {
+	s.mutex.Lock()
+	data, exist := s.objects[path]
+	s.mutex.Unlock()
+	if !exist {
+		return false
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		s.t.Fatalf("Failed to decode object %s: %v", path, err)
+	}
+	return true
+}
+
+func (s *fakeAPIServer) delete(path string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, exist := s.objects[path]
+	delete(s.objects, path)
+	return exist
+}
+
+func (s *fakeAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	for _, hook := range s.hooks {
+		if hook(w, r, body) {
+			return
+		}
+	}
+
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		s.mutex.Lock()
+		data, exist := s.objects[path]
+		s.mutex.Unlock()
+		if !exist {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, path+" not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case http.MethodPut:
+		s.mutex.Lock()
+		s.objects[path] = body
+		s.mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	case http.MethodPost:
+		meta := &metav1.ObjectMeta{}
+		obj := struct {
+			Metadata *metav1.ObjectMeta `json:"metadata"`
+		}{meta}
+		json.Unmarshal(body, &obj)
+		path = strings.TrimSuffix(path, "/") + "/" + meta.Name
+		s.mutex.Lock()
+		_, exist := s.objects[path]
+		if !exist {
+			s.objects[path] = body
+		}
+		s.mutex.Unlock()
+		if exist {
+			writeStatus(w, http.StatusConflict, metav1.StatusReasonAlreadyExists, path+" already exists")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	case http.MethodDelete:
+		if !s.delete(path) {
+			writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, path+" not found")
+			return
+		}
+		writeStatus(w, http.StatusOK, "", "")
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// write the Status of the response, which is decoded as the StatusError by the client
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string, causes ...metav1.StatusCause) {
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  message,
+	}
+	if code >= http.StatusBadRequest {
+		status.Status = metav1.StatusFailure
+	}
+	if len(causes) > 0 {
+		status.Details = &metav1.StatusDetails{Causes: causes}
+	}
+	data, _ := json.Marshal(status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
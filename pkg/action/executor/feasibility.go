@@ -0,0 +1,249 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/kubeturbo/pkg/discovery/worker/compliance"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "k8s.io/client-go/kubernetes"
+)
+
+// the scheduler predicates checked before a pod is created on its node
+const (
+	predicateNodeUnschedulable = "CheckNodeUnschedulable"
+	predicateFitsResources     = "PodFitsResources"
+	predicateFitsHostPorts     = "PodFitsHostPorts"
+	predicateMatchNodeSelector = "MatchNodeSelector"
+	predicateToleratesTaints   = "PodToleratesNodeTaints"
+	predicateInterPodAffinity  = "MatchInterPodAffinity"
+)
+
+// predicateFailure is the scheduler predicate which the node fails for the pod, with the reason.
+type predicateFailure struct {
+	predicate string
+	reason    string
+}
+
+func (f *predicateFailure) String() string {
+	return fmt.Sprintf("%s: %s", f.predicate, f.reason)
+}
+
+// Checks whether the pod npod fits its node, before it is created on the node, with the scheduler predicates:
+// the allocatable resources versus the requests of the pods on the node, the host ports, the node selector and
+// affinity, the taints and tolerations, and the inter-pod affinity and anti-affinity.
+// The labels of the pod are taken from the original pod, as the clone pod is created without labels.
+// The original pod is not counted on the node if it is deleted before npod is created, e.g., the pod of a StatefulSet.
+// The original pod is never counted in the inter-pod affinity and anti-affinity, as npod replaces it.
+// An ActionError of ActionErrorPredicateFailed is returned if the pod doesn't fit.
+func checkNodeFeasibility(client *kclient.Clientset, pod, npod *api.Pod, originalDeleted bool) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	nodeName := npod.Spec.NodeName
+
+	nodeList, err := client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot list nodes to check node %s for pod %s", nodeName, fullName)
+	}
+	podList, err := client.CoreV1().Pods(api.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot list pods to check node %s for pod %s", nodeName, fullName)
+	}
+
+	var exclude *api.Pod
+	if originalDeleted {
+		exclude = pod
+	}
+	if failure := checkPredicates(pod, npod, nodeList.Items, podList.Items, exclude); failure != nil {
+		glog.Errorf("Pod %s does not fit node %s: %v", fullName, nodeName, failure)
+		return NewActionError(ActionErrorPredicateFailed, nil, "pod %s does not fit node %s: %v", fullName, nodeName, failure)
+	}
+	glog.V(3).Infof("Pod %s fits node %s", fullName, nodeName)
+	return nil
+}
+
+// Runs the predicates of the pod npod on its node, with all the nodes and pods in the cluster except the pod exclude.
+// The original pod is excluded from the inter-pod affinity and anti-affinity, otherwise npod, which carries its labels,
+// would be anti-affine to it, e.g., when resized on the same node or moved within the same zone.
+// Returns the first failed predicate, or nil if the pod fits the node.
+func checkPredicates(pod, npod *api.Pod, nodes []api.Node, pods []api.Pod, exclude *api.Pod) *predicateFailure {
+	//1. the node, and the existing pods on all the nodes
+	nodeName := npod.Spec.NodeName
+	nodeMap := make(map[string]*api.Node)
+	for i := range nodes {
+		nodeMap[nodes[i].Name] = &nodes[i]
+	}
+	node, exist := nodeMap[nodeName]
+	if !exist {
+		return &predicateFailure{predicateNodeUnschedulable, fmt.Sprintf("node %s is not found", nodeName)}
+	}
+
+	var nodePods []*api.Pod
+	podsNodes := make(map[*api.Pod]*api.Node)
+	for i := range pods {
+		p := &pods[i]
+		if isTerminated(p) || (exclude != nil && p.UID == exclude.UID) {
+			continue
+		}
+		if n, exist := nodeMap[p.Spec.NodeName]; exist && p.UID != pod.UID {
+			podsNodes[p] = n
+		}
+		if p.Spec.NodeName == nodeName {
+			nodePods = append(nodePods, p)
+		}
+	}
+
+	//2. the pod with the labels of the original pod, and the spec of the new pod
+	candidate := npod.DeepCopy()
+	candidate.Namespace = pod.Namespace
+	candidate.Labels = pod.Labels
+
+	if !podutil.NodeIsSchedulable(node) {
+		return &predicateFailure{predicateNodeUnschedulable, fmt.Sprintf("node %s is unschedulable", nodeName)}
+	}
+	if reason := checkResources(candidate, node, nodePods); reason != "" {
+		return &predicateFailure{predicateFitsResources, reason}
+	}
+	if reason := checkHostPorts(candidate, nodePods); reason != "" {
+		return &predicateFailure{predicateFitsHostPorts, reason}
+	}
+	if !compliance.MatchesNodeSelector(candidate, node) || !compliance.MatchesNodeAffinity(candidate, node) {
+		return &predicateFailure{predicateMatchNodeSelector, fmt.Sprintf("node %s doesn't match the node selector or affinity", nodeName)}
+	}
+	if reason := checkTaints(candidate, node); reason != "" {
+		return &predicateFailure{predicateToleratesTaints, reason}
+	}
+	if !compliance.InterPodAffinityMatches(candidate, node, podsNodes) {
+		return &predicateFailure{predicateInterPodAffinity, fmt.Sprintf("node %s doesn't satisfy the pod affinity or anti-affinity", nodeName)}
+	}
+	return nil
+}
+
+func isTerminated(pod *api.Pod) bool {
+	return pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed
+}
+
+// Gets the resource requests of the pod: the sum of the requests of the containers,
+// or the max of the requests of the init containers if bigger.
+func getPodRequests(pod *api.Pod) api.ResourceList {
+	result := make(api.ResourceList)
+	for _, container := range pod.Spec.Containers {
+		for name, q := range container.Resources.Requests {
+			sum := result[name]
+			sum.Add(q)
+			result[name] = sum
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, q := range container.Resources.Requests {
+			if current, exist := result[name]; !exist || q.Cmp(current) > 0 {
+				result[name] = q
+			}
+		}
+	}
+	return result
+}
+
+// check the requests of the pod and the pods on the node against the allocatable resources of the node
+func checkResources(pod *api.Pod, node *api.Node, nodePods []*api.Pod) string {
+	allocatable := node.Status.Allocatable
+	if maxPods, exist := allocatable[api.ResourcePods]; exist && int64(len(nodePods)+1) > maxPods.Value() {
+		return fmt.Sprintf("too many pods on node %s: %d allocatable", node.Name, maxPods.Value())
+	}
+
+	requests := getPodRequests(pod)
+	used := make(api.ResourceList)
+	for _, p := range nodePods {
+		for name, q := range getPodRequests(p) {
+			sum := used[name]
+			sum.Add(q)
+			used[name] = sum
+		}
+	}
+
+	// sort the resources to report the failures in a stable order
+	var names []string
+	for name := range requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		name := api.ResourceName(n)
+		request := requests[name]
+		if request.IsZero() {
+			continue
+		}
+		total := used[name]
+		total.Add(request)
+		capacity := allocatable[name]
+		if total.Cmp(capacity) > 0 {
+			usedQuantity := used[name]
+			return fmt.Sprintf("insufficient %s on node %s: requested %s, used %s, allocatable %s", name, node.Name,
+				request.String(), usedQuantity.String(), capacity.String())
+		}
+	}
+	return ""
+}
+
+// check the host ports of the pod against those used by the pods on the node
+func checkHostPorts(pod *api.Pod, nodePods []*api.Pod) string {
+	for _, port := range getHostPorts(pod) {
+		for _, p := range nodePods {
+			for _, used := range getHostPorts(p) {
+				if hostPortsConflict(port, used) {
+					return fmt.Sprintf("host port %s/%d is used by pod %s", getProtocol(port), port.HostPort,
+						util.BuildIdentifier(p.Namespace, p.Name))
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func getHostPorts(pod *api.Pod) []api.ContainerPort {
+	var ports []api.ContainerPort
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.HostPort > 0 {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// The ports conflict if they have the same port and protocol, on the same host IP or any of them on all the IPs.
+func hostPortsConflict(a, b api.ContainerPort) bool {
+	if a.HostPort != b.HostPort || getProtocol(a) != getProtocol(b) {
+		return false
+	}
+	return isAnyIP(a.HostIP) || isAnyIP(b.HostIP) || a.HostIP == b.HostIP
+}
+
+func getProtocol(port api.ContainerPort) api.Protocol {
+	if port.Protocol == "" {
+		return api.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+func isAnyIP(ip string) bool {
+	return ip == "" || ip == "0.0.0.0"
+}
+
+// check the NoSchedule and NoExecute taints of the node are tolerated by the pod
+func checkTaints(pod *api.Pod, node *api.Node) string {
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect != api.TaintEffectNoSchedule && taint.Effect != api.TaintEffectNoExecute {
+			continue
+		}
+		if !compliance.TolerationsTolerateTaint(pod.Spec.Tolerations, taint) {
+			return fmt.Sprintf("taint %s of node %s is not tolerated", taint.ToString(), node.Name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package executor
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// check the clone of the pod moved to the node
+func checkMovePredicates(pod api.Pod, nodeName string, nodes []api.Node, pods []api.Pod) *predicateFailure {
+	npod := buildClonePod(&pod, nodeName)
+	return checkPredicates(&pod, npod, nodes, pods, nil)
+}
+
+func TestCheckPredicatesResources(t *testing.T) {
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "2")}
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+	pods := []api.Pod{pod, *newTestPod("default", "bar", withPodNode("node-b"), withPodCPURequest("1500m"))}
+
+	failure := checkMovePredicates(pod, "node-b", nodes, pods)
+	if failure == nil || failure.predicate != predicateFitsResources {
+		t.Errorf("Expect the move to fail %s but got %v", predicateFitsResources, failure)
+	}
+
+	// the completed pods don't use the resources
+	pods[1].Status.Phase = api.PodSucceeded
+	if failure := checkMovePredicates(pod, "node-b", nodes, pods); failure != nil {
+		t.Errorf("Expect the move to succeed but got %v", failure)
+	}
+
+	// the clone pod and the original pod are on the same node at the same time
+	pods[0].Spec.Containers[0].Resources.Requests[api.ResourceCPU] = resource.MustParse("3")
+	if failure := checkMovePredicates(pods[0], "node-a", nodes, pods); failure == nil || failure.predicate != predicateFitsResources {
+		t.Errorf("Expect the clone on the same node to fail %s but got %v", predicateFitsResources, failure)
+	}
+	// unless the original pod is deleted before
+	npod := buildClonePod(&pods[0], "node-a")
+	if failure := checkPredicates(&pods[0], npod, nodes, pods, &pods[0]); failure != nil {
+		t.Errorf("Expect the recreated pod to fit but got %v", failure)
+	}
+}
+
+func TestCheckPredicatesTaintsAndSelector(t *testing.T) {
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4")}
+	nodes[1].Spec.Taints = []api.Taint{{Key: "dedicated", Value: "gpu", Effect: api.TaintEffectNoSchedule}}
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+
+	failure := checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod})
+	if failure == nil || failure.predicate != predicateToleratesTaints {
+		t.Errorf("Expect the move to fail %s but got %v", predicateToleratesTaints, failure)
+	}
+
+	pod.Spec.Tolerations = []api.Toleration{{Key: "dedicated", Operator: api.TolerationOpEqual, Value: "gpu", Effect: api.TaintEffectNoSchedule}}
+	if failure := checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod}); failure != nil {
+		t.Errorf("Expect the move to succeed but got %v", failure)
+	}
+
+	pod.Spec.NodeSelector = map[string]string{"kubernetes.io/hostname": "node-a"}
+	failure = checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod})
+	if failure == nil || failure.predicate != predicateMatchNodeSelector {
+		t.Errorf("Expect the move to fail %s but got %v", predicateMatchNodeSelector, failure)
+	}
+}
+
+func TestCheckPredicatesHostPortsAndAntiAffinity(t *testing.T) {
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4")}
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+	pod.Spec.Containers[0].Ports = []api.ContainerPort{{ContainerPort: 80, HostPort: 8080}}
+	other := *newTestPod("default", "bar", withPodNode("node-b"), withPodCPURequest("1"))
+	other.Spec.Containers[0].Ports = []api.ContainerPort{{ContainerPort: 80, HostPort: 8080, Protocol: api.ProtocolTCP}}
+
+	failure := checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod, other})
+	if failure == nil || failure.predicate != predicateFitsHostPorts {
+		t.Errorf("Expect the move to fail %s but got %v", predicateFitsHostPorts, failure)
+	}
+
+	// the existing pod on node-b is anti-affine to the pod by its labels, which are copied from the original pod
+	other.Spec.Containers[0].Ports = nil
+	other.Spec.Affinity = &api.Affinity{
+		PodAntiAffinity: &api.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []api.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+				TopologyKey:   "kubernetes.io/hostname",
+			}},
+		},
+	}
+	failure = checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod, other})
+	if failure == nil || failure.predicate != predicateInterPodAffinity {
+		t.Errorf("Expect the move to fail %s but got %v", predicateInterPodAffinity, failure)
+	}
+}
+
+// the pod is anti-affine to the other pods of the same app in the topology
+func newSelfAntiAffinity(app, topologyKey string) *api.Affinity {
+	return &api.Affinity{
+		PodAntiAffinity: &api.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []api.PodAffinityTerm{{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+				TopologyKey:   topologyKey,
+			}},
+		},
+	}
+}
+
+func TestCheckPredicatesSelfAntiAffinityOnHostname(t *testing.T) {
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4")}
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+	pod.Spec.Affinity = newSelfAntiAffinity("foo", "kubernetes.io/hostname")
+
+	// the composite resize clones the pod on the same node, which is not anti-affine to the original pod it replaces
+	npod := buildClonePod(&pod, "node-a")
+	npod.Spec.Containers[0].Resources.Requests[api.ResourceCPU] = resource.MustParse("2")
+	if failure := checkPredicates(&pod, npod, nodes, []api.Pod{pod}, nil); failure != nil {
+		t.Errorf("Expect the resize on the same node to succeed but got %v", failure)
+	}
+
+	// but it is still anti-affine to the other replicas
+	other := *newTestPod("default", "foo-2", withPodNode("node-a"), withPodCPURequest("1"))
+	other.Labels = pod.Labels
+	failure := checkPredicates(&pod, npod, nodes, []api.Pod{pod, other}, nil)
+	if failure == nil || failure.predicate != predicateInterPodAffinity {
+		t.Errorf("Expect the resize to fail %s but got %v", predicateInterPodAffinity, failure)
+	}
+}
+
+func TestCheckPredicatesSelfAntiAffinityOnZone(t *testing.T) {
+	zone := "failure-domain.beta.kubernetes.io/zone"
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4"), *newTestNode("node-c", "4")}
+	nodes[0].Labels[zone] = "zone-1"
+	nodes[1].Labels[zone] = "zone-1"
+	nodes[2].Labels[zone] = "zone-2"
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+	pod.Spec.Affinity = newSelfAntiAffinity("foo", zone)
+	other := *newTestPod("default", "foo-2", withPodNode("node-c"), withPodCPURequest("1"))
+	other.Labels = pod.Labels
+	pods := []api.Pod{pod, other}
+
+	// the move within the same zone is not anti-affine to the original pod it replaces
+	if failure := checkMovePredicates(pod, "node-b", nodes, pods); failure != nil {
+		t.Errorf("Expect the move within the same zone to succeed but got %v", failure)
+	}
+
+	// but the move to the zone of the other replica is
+	failure := checkMovePredicates(pod, "node-c", nodes, pods)
+	if failure == nil || failure.predicate != predicateInterPodAffinity {
+		t.Errorf("Expect the move to fail %s but got %v", predicateInterPodAffinity, failure)
+	}
+}
+
+func TestCheckPredicatesUnschedulable(t *testing.T) {
+	nodes := []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4")}
+	nodes[1].Spec.Unschedulable = true
+	pod := *newTestPod("default", "foo", withPodNode("node-a"), withPodCPURequest("1"), withPodLabels(map[string]string{"app": "foo"}))
+
+	failure := checkMovePredicates(pod, "node-b", nodes, []api.Pod{pod})
+	if failure == nil || failure.predicate != predicateNodeUnschedulable {
+		t.Errorf("Expect the move to fail %s but got %v", predicateNodeUnschedulable, failure)
+	}
+	if failure := checkMovePredicates(pod, "node-c", nodes, []api.Pod{pod}); failure == nil {
+		t.Errorf("Expect the move to a missing node to fail")
+	}
+}
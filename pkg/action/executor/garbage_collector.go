@@ -0,0 +1,199 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// The modes of the garbage collector of the clone pods:
+	//  delete: delete the orphaned clone pods;
+	//  report: only log the orphaned clone pods, and report them as Kubernetes Events;
+	//  disabled: don't look for the orphaned clone pods.
+	CloneGCModeDelete   = "delete"
+	CloneGCModeReport   = "report"
+	CloneGCModeDisabled = "disabled"
+
+	// the reason of the Kubernetes Event reporting an orphaned clone pod
+	orphanClonePodEventReason = "TurboOrphanClonePod"
+)
+
+// CloneGarbageCollector periodically finds the clone pods left by interrupted move and resize actions.
+// A clone pod, which has the TurboActionAnnotationKey annotation, gets the labels of the original pod
+// when the action completes. It is orphaned if it is older than the grace period, and it is either not ready
+// or not labeled, while the pod it is cloned from is still running.
+// The clone pods of the actions in progress, which are recorded in the journal, are skipped.
+type CloneGarbageCollector struct {
+	client      *kclient.Clientset
+	mode        string
+	interval    time.Duration
+	gracePeriod time.Duration
+
+	// the journal of the actions in progress; nil if not available
+	journal *ActionJournal
+	// the recorder of the Events in report mode; nil to log only
+	recorder record.EventRecorder
+}
+
+func NewCloneGarbageCollector(client *kclient.Clientset, mode string, interval, gracePeriod time.Duration) *CloneGarbageCollector {
+	return &CloneGarbageCollector{
+		client:      client,
+		mode:        mode,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+	}
+}
+
+func (gc *CloneGarbageCollector) WithJournal(journal *ActionJournal) *CloneGarbageCollector {
+	gc.journal = journal
+	return gc
+}
+
+func (gc *CloneGarbageCollector) WithEventRecorder(recorder record.EventRecorder) *CloneGarbageCollector {
+	gc.recorder = recorder
+	return gc
+}
+
+// Run collects the orphaned clone pods periodically until stop is closed.
+func (gc *CloneGarbageCollector) Run(stop <-chan struct{}) {
+	if gc.mode == CloneGCModeDisabled {
+		glog.V(2).Infof("Garbage collector of clone pods is disabled.")
+		return
+	}
+
+	glog.V(2).Infof("Start garbage collector of clone pods: mode=%s, interval=%v, grace period=%v",
+		gc.mode, gc.interval, gc.gracePeriod)
+	wait.Until(gc.collect, gc.interval, stop)
+}
+
+func (gc *CloneGarbageCollector) collect() {
+	podList, err := gc.client.CoreV1().Pods(api.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("Garbage collector failed to list pods: %v", err)
+		return
+	}
+
+	// without the journal, the clone pods of the actions in progress can't be told from the orphaned ones
+	inProgress, err := gc.inProgressClones()
+	if err != nil {
+		if gc.mode == CloneGCModeDelete {
+			glog.Errorf("Garbage collector failed to read the action journal, skip deleting the orphaned clone pods: %v", err)
+			return
+		}
+		glog.Warningf("Garbage collector failed to read the action journal: %v", err)
+	}
+
+	orphans := findOrphanClonePods(podList.Items, inProgress, time.Now(), gc.gracePeriod)
+	for _, pod := range orphans {
+		fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+		msg := fmt.Sprintf("Pod %s is an orphaned clone of pod %s left by an interrupted %s action",
+			fullName, util.BuildIdentifier(pod.Namespace, getOriginalPodName(pod)), pod.Annotations[TurboActionAnnotationKey])
+
+		if gc.mode != CloneGCModeDelete {
+			glog.Warning(msg)
+			if gc.recorder != nil {
+				gc.recorder.Event(pod, api.EventTypeWarning, orphanClonePodEventReason, msg)
+			}
+			continue
+		}
+
+		err := gc.client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			glog.Errorf("Failed to delete orphaned clone pod %s: %v", fullName, err)
+			continue
+		}
+		glog.V(2).Infof("%s; deleted it.", msg)
+	}
+}
+
+// the names of the clone pods of the actions in progress, as namespace/name
+func (gc *CloneGarbageCollector) inProgressClones() (map[string]bool, error) {
+	result := make(map[string]bool)
+	if gc.journal == nil {
+		return result, nil
+	}
+
+	entries, err := gc.journal.entries()
+	if err != nil {
+		return result, err
+	}
+	for _, entry := range entries {
+		if entry.ClonePodName != "" {
+			result[util.BuildIdentifier(entry.Namespace, entry.ClonePodName)] = true
+		}
+	}
+	return result, nil
+}
+
+// find the orphaned clone pods among the pods.
+func findOrphanClonePods(pods []api.Pod, inProgress map[string]bool, now time.Time, gracePeriod time.Duration) []*api.Pod {
+	// the running pods by their original pod names
+	running := make(map[string][]*api.Pod)
+	for i := range pods {
+		pod := &pods[i]
+		if isRunningPod(pod) {
+			key := util.BuildIdentifier(pod.Namespace, getOriginalPodName(pod))
+			running[key] = append(running[key], pod)
+		}
+	}
+
+	result := []*api.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		if !isClonePod(pod) || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if inProgress[util.BuildIdentifier(pod.Namespace, pod.Name)] {
+			continue
+		}
+		if now.Sub(pod.CreationTimestamp.Time) < gracePeriod {
+			continue
+		}
+		// the clone completed the action: it is running and has got the labels of the original pod
+		if isRunningPod(pod) && len(pod.Labels) > 0 {
+			continue
+		}
+
+		for _, sibling := range running[util.BuildIdentifier(pod.Namespace, getOriginalPodName(pod))] {
+			if sibling.UID != pod.UID {
+				result = append(result, pod)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// check whether the pod is created by a move or resize action
+func isClonePod(pod *api.Pod) bool {
+	value := pod.Annotations[TurboActionAnnotationKey]
+	return value == TurboMoveAnnotationValue || value == TurboResizeAnnotationValue
+}
+
+// check whether the pod is running and ready, and not being deleted
+func isRunningPod(pod *api.Pod) bool {
+	return pod.DeletionTimestamp == nil && pod.Status.Phase == api.PodRunning && podutil.PodIsReady(pod)
+}
+
+// get the name of the pod which the clone pod is cloned from: the name without the timestamp suffix
+// appended by genNewPodName; the name of the pod itself if it is not a clone pod.
+func getOriginalPodName(pod *api.Pod) string {
+	if _, ok := pod.Annotations[TurboActionAnnotationKey]; !ok {
+		return pod.Name
+	}
+	if idx := strings.LastIndex(pod.Name, "-"); idx >= 0 {
+		return pod.Name[:idx]
+	}
+	return pod.Name
+}
@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindOrphanClonePods(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour)
+	grace := 30 * time.Minute
+	labels := map[string]string{"app": "foo"}
+
+	pods := []api.Pod{
+		// the original pod still running
+		*newTestPod("default", "foo-1", withPodCreated(old), withPodLabels(labels)),
+		// not ready clone of foo-1: orphan
+		*newTestPod("default", "foo-1-a1", withPodCreated(old), withPodAction(TurboMoveAnnotationValue), withPodPhase(api.PodPending)),
+		// ready clone of foo-1 without labels: orphan
+		*newTestPod("default", "foo-1-a2", withPodCreated(old), withPodAction(TurboResizeAnnotationValue)),
+		// not ready clone of foo-1 within the grace period
+		*newTestPod("default", "foo-1-a3", withPodCreated(now), withPodAction(TurboMoveAnnotationValue), withPodPhase(api.PodPending)),
+		// not ready clone of foo-1 of the action in progress
+		*newTestPod("default", "foo-1-a4", withPodCreated(old), withPodAction(TurboMoveAnnotationValue), withPodPhase(api.PodPending)),
+		// completed clone of bar-1 which is gone
+		*newTestPod("default", "bar-1-b1", withPodCreated(old), withPodAction(TurboMoveAnnotationValue), withPodLabels(labels)),
+		// not ready clone of baz-1 which is gone
+		*newTestPod("default", "baz-1-c1", withPodCreated(old), withPodAction(TurboMoveAnnotationValue), withPodPhase(api.PodPending)),
+	}
+	inProgress := map[string]bool{"default/foo-1-a4": true}
+
+	orphans := findOrphanClonePods(pods, inProgress, now, grace)
+	if len(orphans) != 2 {
+		t.Fatalf("Expect 2 orphaned clone pods, got %d", len(orphans))
+	}
+	if orphans[0].Name != "foo-1-a1" || orphans[1].Name != "foo-1-a2" {
+		t.Errorf("Unexpected orphaned clone pods: %s, %s", orphans[0].Name, orphans[1].Name)
+	}
+}
+
+func TestGetOriginalPodName(t *testing.T) {
+	pod := newTestPod("default", "foo-1-a1", withPodAction(TurboMoveAnnotationValue))
+	if name := getOriginalPodName(pod); name != "foo-1" {
+		t.Errorf("Unexpected original pod name of clone pod: %s", name)
+	}
+
+	pod = newTestPod("default", "foo-1")
+	if name := getOriginalPodName(pod); name != "foo-1" {
+		t.Errorf("Unexpected original pod name of pod: %s", name)
+	}
+}
+
+func TestCollectSkippedWithoutJournal(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	old := time.Now().Add(-time.Hour)
+	server.set("/api/v1/pods", &api.PodList{Items: []api.Pod{
+		*newTestPod("default", "foo-1", withPodCreated(old), withPodLabels(map[string]string{"app": "foo"})),
+		*newTestPod("default", "foo-1-a1", withPodCreated(old), withPodAction(TurboMoveAnnotationValue), withPodPhase(api.PodPending)),
+	}})
+	deleted := false
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/default/configmaps/"+JournalConfigMapName:
+			writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, "journal is not available")
+			return true
+		case r.Method == http.MethodDelete:
+			deleted = true
+		}
+		return false
+	})
+
+	// the clone pod may be of an action in progress, which is unknown without the journal
+	gc := NewCloneGarbageCollector(server.client(), CloneGCModeDelete, time.Minute, 30*time.Minute).
+		WithJournal(NewActionJournal(server.client(), "default"))
+	gc.collect()
+	if deleted {
+		t.Errorf("Expect no clone pod to be deleted when the journal can't be read")
+	}
+}
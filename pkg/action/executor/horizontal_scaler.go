@@ -6,20 +6,31 @@ import (
 	"time"
 
 	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/turbonomic/kubeturbo/pkg/action/util"
-	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
 	goutil "github.com/turbonomic/kubeturbo/pkg/util"
 	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
 )
 
+const (
+	// refuse to scale a controller which is scaled by a HorizontalPodAutoscaler
+	HPAScalingPolicyRefuse = "refuse"
+	// adjust the minReplicas and maxReplicas of the HorizontalPodAutoscaler, so that it keeps the new number of replicas
+	HPAScalingPolicyAdjust = "adjust"
+)
+
 type HorizontalScaler struct {
 	TurboK8sActionExecutor
+
+	// how to scale a controller which is scaled by a HorizontalPodAutoscaler
+	hpaPolicy string
 }
 
-func NewHorizontalScaler(ae TurboK8sActionExecutor) *HorizontalScaler {
+func NewHorizontalScaler(ae TurboK8sActionExecutor, hpaPolicy string) *HorizontalScaler {
 	return &HorizontalScaler{
 		TurboK8sActionExecutor: ae,
+		hpaPolicy:              hpaPolicy,
 	}
 }
 
@@ -32,24 +43,53 @@ func (h *HorizontalScaler) Execute(input *TurboActionExecutorInput) (*TurboActio
 	helper, err := h.prepareHelper(actionItem, pod)
 	if err != nil {
 		glog.Errorf("Failed to prepare action:%v, abort action %++v", err, actionItem)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Aborted")
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	if input.DryRun {
+		return h.dryRun(helper)
+	}
+
+	//2. check the HorizontalPodAutoscaler, which may revert the replica change
+	if err = h.checkHPA(helper, nil); err != nil {
+		glog.Errorf("Failed to scale %s: %v, abort action %++v", helper.fullName(), err, actionItem)
+		return &TurboActionExecutorOutput{}, err
 	}
 
-	//2. execute the action
+	//3. get the target number of replicas once, so that the retries of the update don't change the replicas again,
+	// and record the action in the journal, to revert it if kubeturbo restarts before the update is recorded
+	current, replicas, err := getTargetReplicaNum(h.kubeClient, helper.owner, helper.diff)
+	if err != nil {
+		glog.Errorf("Failed to scale %s: %v, abort action %++v", helper.fullName(), err, actionItem)
+		return &TurboActionExecutorOutput{}, err
+	}
+	helper.replicas = replicas
+	entry := newScaleJournalEntry(helper.owner, current, replicas)
+	h.journal.Start(entry)
+	defer h.journal.Finish(entry)
+
+	//4. execute the action
 	if err = h.do(helper); err != nil {
 		glog.Errorf("Failed to execute action: %v, abort action %++v", err, actionItem)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Failed")
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "failed to update replicas of %s", helper.fullName())
 	}
+	h.journal.Record(entry, journalStepReplicasUpdated)
+	input.Progress.Update(progressReplicasUpdated, "Replicas of %s updated to %d", helper.fullName(), helper.replicas)
 
-	//3. check action result
+	//5. check action result
 	glog.V(2).Infof("Begin to check action resulf of HorizontalScale for pod[%v]", podFullName)
 	if err = h.checkResult(helper); err != nil {
 		glog.Errorf("HorizontalScale checking failed: %v", err)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Failed")
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorVerificationFailed, err, "replicas of %s are not ready", helper.fullName())
 	}
+	input.Progress.Update(progressReplicasReady, "All %d replicas of %s are ready", helper.replicas, helper.fullName())
 	glog.V(2).Infof("Action HorizontalScale for pod[%v] succeeded.", podFullName)
 
-	return &TurboActionExecutorOutput{Succeeded: true}, nil
+	return &TurboActionExecutorOutput{
+		Succeeded:     true,
+		OldController: newReplicasSpec(helper.fullName(), current),
+		NewController: newReplicasSpec(helper.fullName(), replicas),
+	}, nil
 }
 
 func (h *HorizontalScaler) preActionCheck(action *proto.ActionItemDTO) error {
@@ -64,18 +104,18 @@ func (h *HorizontalScaler) prepareHelper(action *proto.ActionItemDTO, pod *api.P
 	diff, err := h.getReplicaDiff(action)
 	if err != nil {
 		glog.Errorf("Failed to get ReplicaDiff: %v", err)
-		return nil, err
+		return nil, NewActionError(ActionErrorInvalidAction, err, "invalid scaling action")
 	}
 	helper.diff = diff
 
-	//3. find parent info
-	parentKind, parentName, err := podutil.GetPodGrandInfo(h.kubeClient, pod)
+	//3. find the highest owner with scale subresource by walking the owner references
+	owner, err := goutil.GetScalableOwner(h.kubeClient, pod)
 	if err != nil {
-		glog.Errorf("Failed to get parent info for pod: %s/%s", pod.Namespace, pod.Name)
-		return nil, err
+		glog.Errorf("Failed to get parent info for pod: %s/%s: %v", pod.Namespace, pod.Name, err)
+		return nil, NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s/%s", pod.Namespace, pod.Name)
 	}
-	if err = helper.SetParent(parentKind, parentName); err != nil {
-		return nil, err
+	if err = helper.SetParent(owner); err != nil {
+		return nil, NewActionError(ActionErrorUnsupportedParent, err, "cannot scale pod %s/%s", pod.Namespace, pod.Name)
 	}
 
 	return helper, nil
@@ -96,18 +136,103 @@ func (h *HorizontalScaler) getReplicaDiff(action *proto.ActionItemDTO) (int32, e
 	}
 }
 
+// checkHPA checks whether the controller is scaled by a HorizontalPodAutoscaler.
+// If so, either refuses the action, or adjusts the replica range of the HorizontalPodAutoscaler
+// to the new number of replicas according to the policy.
+// If dryRun is not nil, the adjustment is submitted with server-side dry-run only.
+func (h *HorizontalScaler) checkHPA(helper *scaleHelper, dryRun *dryRunHelper) error {
+	hpa, err := util.FindHorizontalPodAutoscaler(h.kubeClient, helper.owner)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get HorizontalPodAutoscaler of %s", helper.fullName())
+	}
+	if hpa == nil {
+		return nil
+	}
+
+	hpaName := util.BuildIdentifier(hpa.Namespace, hpa.Name)
+	if h.hpaPolicy != HPAScalingPolicyAdjust {
+		return NewActionError(ActionErrorScaledByHPA, nil, "%s is scaled by HorizontalPodAutoscaler %s", helper.fullName(), hpaName)
+	}
+
+	scale, err := goutil.GetScale(h.kubeClient, helper.owner)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get scale of %s", helper.fullName())
+	}
+	current, _ := getScaleReplicas(scale)
+	replicas, err := setNum(current, helper.diff)
+	if err != nil {
+		return NewActionError(ActionErrorInvalidAction, err, "cannot scale %s", helper.fullName())
+	}
+
+	if dryRun == nil {
+		if err = updateHPAReplicaRange(h.kubeClient, hpa, replicas, helper.diff); err != nil {
+			return wrapActionError(err, ActionErrorAPIFailure, "cannot adjust HorizontalPodAutoscaler %s", hpaName)
+		}
+		return nil
+	}
+
+	min, max := util.GetHPAReplicaRange(hpa)
+	changed, err := setHPAReplicaRange(hpa, replicas, helper.diff)
+	if err != nil {
+		return NewActionError(ActionErrorInvalidAction, err, "cannot adjust HorizontalPodAutoscaler %s", hpaName)
+	}
+	if !changed {
+		return nil
+	}
+	dryRun.addChange("HorizontalPodAutoscaler %s: replica range: [%d, %d] -> [%d, %d]",
+		hpaName, min, max, *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	if err = dryRun.update(h.kubeClient.AutoscalingV1().RESTClient(), hpa.Namespace, "horizontalpodautoscalers", hpa.Name, hpa); err != nil {
+		return wrapActionError(err, ActionErrorAPIFailure, "dry run of adjusting HorizontalPodAutoscaler %s failed", hpaName)
+	}
+	return nil
+}
+
+// build the replica change without executing it, and submit the changes with server-side dry-run.
+func (h *HorizontalScaler) dryRun(helper *scaleHelper) (*TurboActionExecutorOutput, error) {
+	fullName := helper.fullName()
+	dryRun := newDryRunHelper(h.kubeClient)
+
+	scale, err := goutil.GetScale(h.kubeClient, helper.owner)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot get scale of %s", fullName)
+	}
+	current, _ := getScaleReplicas(scale)
+	replicas, err := setNum(current, helper.diff)
+	if err != nil {
+		glog.Warningf("%s resulting replica num less than 0. (diff=%v)", fullName, helper.diff)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorInvalidAction, err, "cannot scale %s", fullName)
+	}
+	dryRun.addChange("%s: spec.replicas: %d -> %d", fullName, current, replicas)
+
+	if err = h.checkHPA(helper, dryRun); err != nil {
+		glog.Errorf("Dry run of scaling %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	if err = unstructured.SetNestedField(scale.Object, int64(replicas), "spec", "replicas"); err != nil {
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot set replicas of %s", fullName)
+	}
+	if err = dryRun.updateScale(helper.owner, scale); err != nil {
+		glog.Errorf("Dry run of scaling %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of scaling %s failed", fullName)
+	}
+
+	glog.V(2).Infof("Dry run of scaling %s succeeded: %s", fullName, dryRun.diff())
+	return dryRun.output(), nil
+}
+
+// update the replicas of the owner to the target number
 func (h *HorizontalScaler) do(helper *scaleHelper) error {
-	fullName := fmt.Sprintf("%s-%s/%s", helper.kind, helper.nameSpace, helper.controllerName)
+	fullName := helper.fullName()
 
 	// update replica number
 	retryNum := defaultRetryLess
 	interval := defaultUpdateReplicaSleep
 	timeout := time.Duration(retryNum+1) * interval
 	err := goutil.RetryDuring(retryNum, timeout, interval, func() error {
-		inerr := helper.updateReplicaNum(h.kubeClient, helper.nameSpace, helper.controllerName, helper.diff)
+		inerr := updateReplicaNum(h.kubeClient, helper.owner, helper.replicas)
 		if inerr != nil {
 			glog.Errorf("[%s] failed to update replica num: %v", fullName, inerr)
-			return fmt.Errorf("Failed")
 		}
 		return inerr
 	})
@@ -115,7 +240,19 @@ func (h *HorizontalScaler) do(helper *scaleHelper) error {
 	return err
 }
 
+// wait until the new number of replicas is observed, and all the replicas are ready
 func (h *HorizontalScaler) checkResult(helper *scaleHelper) error {
-	// do nothing
+	retryNum := defaultRetryMore
+	interval := defaultPodCreateSleep
+	timeout := time.Duration(retryNum+1) * interval
+	err := goutil.RetrySimple(retryNum, timeout, interval, func() (bool, error) {
+		return checkReplicaNum(h.kubeClient, helper.owner, helper.replicas)
+	})
+
+	if err != nil {
+		glog.Errorf("[%s] replicas are not ready: %v", helper.fullName(), err)
+		return err
+	}
+
 	return nil
 }
@@ -4,26 +4,28 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 
-	"github.com/turbonomic/kubeturbo/pkg/util"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kclient "k8s.io/client-go/kubernetes"
 )
 
-type updateReplicaNumFunc func(client *kclient.Clientset, nameSpace, name string, diff int32) error
-
 type scaleHelper struct {
 	client    *kclient.Clientset
 	nameSpace string
 	podName   string
 
-	//parent controller's kind: ReplicationController/ReplicaSet
-	kind string
-	//parent controller's name
-	controllerName string
-	diff           int32
+	// the top-level owner of the pod, e.g., Deployment, StatefulSet, DeploymentConfig or a custom resource;
+	// it is scaled through its /scale subresource.
+	owner *goutil.OwnerInfo
+	diff  int32
 
-	// update number of Replicas of parent controller
-	updateReplicaNum updateReplicaNumFunc
+	// the number of replicas after scaling
+	replicas int32
 }
 
 func NewScaleHelper(client *kclient.Clientset, nameSpace, podName string) (*scaleHelper, error) {
@@ -36,26 +38,21 @@ func NewScaleHelper(client *kclient.Clientset, nameSpace, podName string) (*scal
 	return p, nil
 }
 
-func (helper *scaleHelper) SetParent(kind, name string) error {
-	helper.kind = kind
-	helper.controllerName = name
-
-	switch kind {
-	case util.KindReplicationController:
-		helper.updateReplicaNum = updateRCReplicaNum
-	case util.KindReplicaSet:
-		helper.updateReplicaNum = updateRSReplicaNum
-	case util.KindDeployment:
-		helper.updateReplicaNum = updateDeploymentReplicaNum
-	default:
-		err := fmt.Errorf("Unsupport ControllerType[%s] for scaling Pod.", kind)
-		glog.Errorf(err.Error())
+func (helper *scaleHelper) SetParent(owner *goutil.OwnerInfo) error {
+	if !owner.Scalable {
+		err := fmt.Errorf("Unsupport ControllerType[%s] for scaling Pod: none of its owners up to %s has scale subresource.", owner.Kind, owner)
+		glog.Error(err)
 		return err
 	}
 
+	helper.owner = owner
 	return nil
 }
 
+func (helper *scaleHelper) fullName() string {
+	return helper.owner.String()
+}
+
 //------------------------------------------------------------
 func setNum(current, diff int32) (int32, error) {
 	if current < 1 && diff < 0 {
@@ -70,95 +67,193 @@ func setNum(current, diff int32) (int32, error) {
 	return result, nil
 }
 
-// update the number of pod replicas for ReplicationController
-func updateRCReplicaNum(client *kclient.Clientset, namespace, name string, diff int32) error {
-	rcClient := client.CoreV1().ReplicationControllers(namespace)
-
-	//1. get
-	fullName := fmt.Sprintf("%s/%s", namespace, name)
-	getOption := metav1.GetOptions{}
-	rc, err := rcClient.Get(name, getOption)
+// update the scale subresource of the owner.
+func updateScale(client *kclient.Clientset, owner *goutil.OwnerInfo, scale *unstructured.Unstructured) error {
+	data, err := scale.MarshalJSON()
 	if err != nil {
-		glog.Errorf("Failed to get ReplicationController: %s: %v", fullName, err)
 		return err
 	}
 
-	//2. modify it
-	num, err := setNum(*(rc.Spec.Replicas), diff)
+	_, err = client.Discovery().RESTClient().Put().AbsPath(owner.Path(goutil.ScaleSubResource)).
+		SetHeader("Content-Type", "application/json").Body(data).DoRaw()
 	if err != nil {
-		glog.Warningf("RC-%s resulting replica num[%v] less than 0. (diff=%v)", fullName, num, diff)
-		return fmt.Errorf("Aborted")
+		glog.Errorf("Failed to update scale of %s: %v", owner, err)
+		return err
 	}
-	rc.Spec.Replicas = &num
 
-	//3. update it
-	_, err = rcClient.Update(rc)
+	return nil
+}
+
+// get the replicas in spec and status of the scale
+func getScaleReplicas(scale *unstructured.Unstructured) (int32, int32) {
+	spec, _, _ := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	status, _, _ := unstructured.NestedInt64(scale.Object, "status", "replicas")
+	return int32(spec), int32(status)
+}
+
+// get the number of pod replicas of the owner after changing it by diff
+func getTargetReplicaNum(client *kclient.Clientset, owner *goutil.OwnerInfo, diff int32) (int32, int32, error) {
+	scale, err := goutil.GetScale(client, owner)
 	if err != nil {
-		glog.Errorf("Failed to update ReplicationController[%s]: %v", fullName, err)
-		return fmt.Errorf("Failed")
+		return 0, 0, wrapActionError(err, ActionErrorAPIFailure, "cannot get scale of %s", owner)
 	}
 
-	return nil
+	current, _ := getScaleReplicas(scale)
+	num, err := setNum(current, diff)
+	if err != nil {
+		glog.Warningf("%s resulting replica num[%v] less than 0. (diff=%v)", owner, num, diff)
+		return 0, 0, NewActionError(ActionErrorInvalidAction, err, "cannot scale %s", owner)
+	}
+	return current, num, nil
 }
 
-// update the number of pod replicas for ReplicaSet
-func updateRSReplicaNum(client *kclient.Clientset, namespace, name string, diff int32) error {
-	rsClient := client.ExtensionsV1beta1().ReplicaSets(namespace)
-
+// update the number of pod replicas of the owner to the given number through its scale subresource.
+// The number is absolute, so that the update can be retried without changing the replicas again.
+func updateReplicaNum(client *kclient.Clientset, owner *goutil.OwnerInfo, num int32) error {
 	//1. get it
-	fullName := fmt.Sprintf("%s/%s", namespace, name)
-	getOption := metav1.GetOptions{}
-	rs, err := rsClient.Get(name, getOption)
+	scale, err := goutil.GetScale(client, owner)
 	if err != nil {
-		glog.Errorf("Failed to get ReplicaSet: %s: %v", fullName, err)
 		return err
 	}
 
 	//2. modify it
-	num, err := setNum(*(rs.Spec.Replicas), diff)
-	if err != nil {
-		glog.Warningf("RS-%s resulting replica num[%v] less than 0. (diff=%v)", fullName, num, diff)
-		return fmt.Errorf("Aborted")
+	current, _ := getScaleReplicas(scale)
+	if err := unstructured.SetNestedField(scale.Object, int64(num), "spec", "replicas"); err != nil {
+		return err
 	}
-	rs.Spec.Replicas = &num
 
 	//3. update it
-	_, err = rsClient.Update(rs)
-	if err != nil {
-		glog.Errorf("Failed to update ReplicaSet[%s]: %v", fullName, err)
-		return fmt.Errorf("Failed")
+	if err := updateScale(client, owner, scale); err != nil {
+		return wrapActionError(err, ActionErrorAPIFailure, "cannot update replicas of %s", owner)
 	}
 
+	glog.V(2).Infof("Updated replicas of %s from %d to %d", owner, current, num)
 	return nil
 }
 
-// update the number of pod replicas for Deployment
-func updateDeploymentReplicaNum(client *kclient.Clientset, namespace, name string, diff int32) error {
-	depClient := client.AppsV1beta1().Deployments(namespace)
+// set the replicas of the owner back to the original number, if they are still the target number set by the action,
+// i.e., not changed by others since then. Returns whether the replicas are reverted.
+func revertReplicaNum(client *kclient.Clientset, owner *goutil.OwnerInfo, original, target int32) (bool, error) {
+	scale, err := goutil.GetScale(client, owner)
+	if err != nil {
+		return false, err
+	}
+	current, _ := getScaleReplicas(scale)
+	if current != target || current == original {
+		return false, nil
+	}
+
+	if err = unstructured.SetNestedField(scale.Object, int64(original), "spec", "replicas"); err != nil {
+		return false, err
+	}
+	if err = updateScale(client, owner, scale); err != nil {
+		return false, err
+	}
+	glog.V(2).Infof("Reverted replicas of %s from %d to %d", owner, current, original)
+	return true, nil
+}
 
-	//1. get it
-	fullName := fmt.Sprintf("%s/%s", namespace, name)
-	getOption := metav1.GetOptions{}
-	rs, err := depClient.Get(name, getOption)
+// check whether the owner has the expected number of replicas, and all of them are ready.
+// return (retry, error)
+func checkReplicaNum(client *kclient.Clientset, owner *goutil.OwnerInfo, replicas int32) (bool, error) {
+	scale, err := goutil.GetScale(client, owner)
 	if err != nil {
-		glog.Errorf("Failed to get Deployment: %s: %v", fullName, err)
-		return err
+		return true, err
 	}
 
-	//2. modify it
-	num, err := setNum(*(rs.Spec.Replicas), diff)
+	spec, status := getScaleReplicas(scale)
+	if spec != replicas {
+		return false, fmt.Errorf("replicas of %s is changed to %d by others, expected %d", owner, spec, replicas)
+	}
+	if status != replicas {
+		return true, fmt.Errorf("%s has %d replicas, expected %d", owner, status, replicas)
+	}
+
+	selector, err := goutil.GetScaleSelector(scale)
 	if err != nil {
-		glog.Warningf("RS-%s resulting replica num[%v] less than 0. (diff=%v)", fullName, num, diff)
-		return fmt.Errorf("Aborted")
+		return false, err
 	}
-	rs.Spec.Replicas = &num
 
-	//3. update it
-	_, err = depClient.Update(rs)
+	podList, err := client.CoreV1().Pods(owner.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return true, err
+	}
+
+	active, ready := countActivePods(podList.Items)
+	if active != replicas || ready != replicas {
+		return true, fmt.Errorf("%s has %d active pods and %d ready pods, expected %d", owner, active, ready, replicas)
+	}
+
+	return false, nil
+}
+
+// count the pods which are not being deleted, and the ready ones of them
+func countActivePods(pods []api.Pod) (int32, int32) {
+	active, ready := int32(0), int32(0)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed {
+			continue
+		}
+
+		active++
+		if podutil.PodIsReady(pod) {
+			ready++
+		}
+	}
+	return active, ready
+}
+
+// set the replica range of the HorizontalPodAutoscaler, so that it keeps the given number of replicas:
+// for scaling out, minReplicas is raised to the replicas; for scaling in, maxReplicas is lowered to the replicas.
+// return whether the range is changed.
+func setHPAReplicaRange(hpa *autoscalingv1.HorizontalPodAutoscaler, replicas, diff int32) (bool, error) {
+	if replicas < 1 {
+		return false, fmt.Errorf("HorizontalPodAutoscaler %s cannot keep %d replicas", hpa.Name, replicas)
+	}
+
+	min, max := util.GetHPAReplicaRange(hpa)
+	newMin, newMax := min, max
+	if diff > 0 {
+		newMin = replicas
+		if newMax < replicas {
+			newMax = replicas
+		}
+	} else {
+		newMax = replicas
+		if newMin > replicas {
+			newMin = replicas
+		}
+	}
+
+	if newMin == min && newMax == max {
+		return false, nil
+	}
+	hpa.Spec.MinReplicas = &newMin
+	hpa.Spec.MaxReplicas = newMax
+	return true, nil
+}
+
+// update the replica range of the HorizontalPodAutoscaler to keep the given number of replicas
+func updateHPAReplicaRange(client *kclient.Clientset, hpa *autoscalingv1.HorizontalPodAutoscaler, replicas, diff int32) error {
+	hpaName := util.BuildIdentifier(hpa.Namespace, hpa.Name)
+	min, max := util.GetHPAReplicaRange(hpa)
+
+	changed, err := setHPAReplicaRange(hpa, replicas, diff)
 	if err != nil {
-		glog.Errorf("Failed to update Deployment[%s]: %v", fullName, err)
-		return fmt.Errorf("Failed")
+		glog.Errorf("Failed to adjust HorizontalPodAutoscaler %s: %v", hpaName, err)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	if _, err := client.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(hpa); err != nil {
+		glog.Errorf("Failed to update HorizontalPodAutoscaler %s: %v", hpaName, err)
+		return NewActionError(ActionErrorAPIFailure, err, "cannot update HorizontalPodAutoscaler %s", hpaName)
 	}
 
+	glog.V(2).Infof("Updated replica range of HorizontalPodAutoscaler %s from [%d, %d] to [%d, %d]",
+		hpaName, min, max, *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
 	return nil
 }
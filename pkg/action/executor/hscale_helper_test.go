@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"testing"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetNum(t *testing.T) {
+	if num, err := setNum(2, 1); err != nil || num != 3 {
+		t.Errorf("setNum(2, 1) = (%d, %v), want 3", num, err)
+	}
+	if num, err := setNum(1, -1); err != nil || num != 0 {
+		t.Errorf("setNum(1, -1) = (%d, %v), want 0", num, err)
+	}
+	if _, err := setNum(0, -1); err == nil {
+		t.Errorf("setNum(0, -1) should fail")
+	}
+}
+
+func TestGetScaleReplicas(t *testing.T) {
+	// autoscaling/v1 Scale
+	scale := &unstructured.Unstructured{}
+	err := scale.UnmarshalJSON([]byte(`{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"web"},
+		"spec":{"replicas":3},"status":{"replicas":2,"selector":"app=web,tier=frontend"}}`))
+	if err != nil {
+		t.Fatalf("Failed to decode scale: %v", err)
+	}
+
+	if spec, status := getScaleReplicas(scale); spec != 3 || status != 2 {
+		t.Errorf("getScaleReplicas() = (%d, %d), want (3, 2)", spec, status)
+	}
+}
+
+func TestCountActivePods(t *testing.T) {
+	ready := api.PodCondition{Type: api.PodReady, Status: api.ConditionTrue}
+	now := metav1.Now()
+
+	pods := []api.Pod{
+		{Status: api.PodStatus{Phase: api.PodRunning, Conditions: []api.PodCondition{ready}}},
+		{Status: api.PodStatus{Phase: api.PodPending}},
+		{Status: api.PodStatus{Phase: api.PodFailed}},
+		{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}, Status: api.PodStatus{Phase: api.PodRunning}},
+	}
+
+	if active, ready := countActivePods(pods); active != 2 || ready != 1 {
+		t.Errorf("countActivePods() = (%d, %d), want (2, 1)", active, ready)
+	}
+}
+
+func TestSetHPAReplicaRange(t *testing.T) {
+	two := int32(2)
+	tests := []struct {
+		name        string
+		min         *int32
+		max         int32
+		replicas    int32
+		diff        int32
+		wantChanged bool
+		wantMin     int32
+		wantMax     int32
+		wantErr     bool
+	}{
+		{"scale out within range", &two, 5, 3, 1, true, 3, 5, false},
+		{"scale out beyond max", &two, 5, 6, 1, true, 6, 6, false},
+		{"scale in within range", &two, 5, 3, -1, true, 2, 3, false},
+		{"scale in below min", nil, 5, 1, -1, true, 1, 1, false},
+		{"unchanged", nil, 1, 1, -1, false, 1, 1, false},
+		{"scale in to zero", nil, 5, 0, -1, false, 1, 5, true},
+	}
+
+	for _, tt := range tests {
+		hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+		hpa.Name = "web"
+		hpa.Spec.MinReplicas = tt.min
+		hpa.Spec.MaxReplicas = tt.max
+
+		changed, err := setHPAReplicaRange(hpa, tt.replicas, tt.diff)
+		if changed != tt.wantChanged || (err != nil) != tt.wantErr {
+			t.Errorf("%s: setHPAReplicaRange() = (%v, %v), want (%v, error=%v)", tt.name, changed, err, tt.wantChanged, tt.wantErr)
+			continue
+		}
+		if changed && (*hpa.Spec.MinReplicas != tt.wantMin || hpa.Spec.MaxReplicas != tt.wantMax) {
+			t.Errorf("%s: replica range = [%d, %d], want [%d, %d]", tt.name, *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestPrepareHelperScalableOwner(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	isController := true
+	controlledBy := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &isController}}
+	}
+	server.set("/apis/apps/v1beta1", &metav1.APIResourceList{GroupVersion: "apps/v1beta1", APIResources: []metav1.APIResource{
+		{Name: "deployments", Kind: "Deployment"}, {Name: "deployments/scale", Kind: "Scale"},
+	}})
+	server.set("/apis/extensions/v1beta1", &metav1.APIResourceList{GroupVersion: "extensions/v1beta1", APIResources: []metav1.APIResource{
+		{Name: "replicasets", Kind: "ReplicaSet"}, {Name: "replicasets/scale", Kind: "Scale"},
+	}})
+	// the custom resource managing the Deployment has no scale subresource
+	server.set("/apis/example.com/v1", &metav1.APIResourceList{GroupVersion: "example.com/v1", APIResources: []metav1.APIResource{
+		{Name: "webapps", Kind: "WebApp"},
+	}})
+	server.set("/apis/extensions/v1beta1/namespaces/default/replicasets/web-1",
+		map[string]interface{}{"metadata": &metav1.ObjectMeta{Name: "web-1", OwnerReferences: controlledBy("apps/v1beta1", "Deployment", "web")}})
+	server.set("/apis/apps/v1beta1/namespaces/default/deployments/web",
+		map[string]interface{}{"metadata": &metav1.ObjectMeta{Name: "web", OwnerReferences: controlledBy("example.com/v1", "WebApp", "web")}})
+	server.set("/apis/example.com/v1/namespaces/default/webapps/web", map[string]interface{}{"metadata": &metav1.ObjectMeta{Name: "web"}})
+
+	pod := newTestPod("default", "web-1-abc")
+	pod.OwnerReferences = controlledBy("extensions/v1beta1", "ReplicaSet", "web-1")
+	provision := proto.ActionItemDTO_PROVISION
+	scaler := NewHorizontalScaler(TurboK8sActionExecutor{kubeClient: server.client()}, HPAScalingPolicyRefuse)
+	helper, err := scaler.prepareHelper(&proto.ActionItemDTO{ActionType: &provision}, pod)
+	if err != nil {
+		t.Fatalf("Failed to prepare scaling: %v", err)
+	}
+	if helper.owner.Kind != "Deployment" || helper.owner.Name != "web" {
+		t.Errorf("Expect the Deployment to be scaled, but got %s", helper.owner)
+	}
+}
+
+func TestUpdateReplicaNum(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	owner := &goutil.OwnerInfo{APIVersion: "apps/v1beta1", Kind: "Deployment", Resource: "deployments", Namespace: "default", Name: "web"}
+	server.set(owner.Path(goutil.ScaleSubResource), map[string]interface{}{
+		"apiVersion": "apps/v1beta1", "kind": "Scale",
+		"metadata": map[string]interface{}{"namespace": "default", "name": "web"},
+		"spec":     map[string]interface{}{"replicas": 2},
+	})
+
+	current, replicas, err := getTargetReplicaNum(server.client(), owner, 1)
+	if err != nil || current != 2 || replicas != 3 {
+		t.Fatalf("getTargetReplicaNum() = (%d, %d, %v), want (2, 3)", current, replicas, err)
+	}
+	// the update is retried with the same target, e.g., after its response is lost
+	for i := 0; i < 2; i++ {
+		if err := updateReplicaNum(server.client(), owner, replicas); err != nil {
+			t.Fatalf("Failed to update replicas: %v", err)
+		}
+	}
+	scale, _ := goutil.GetScale(server.client(), owner)
+	if spec, _ := getScaleReplicas(scale); spec != 3 {
+		t.Errorf("Expect 3 replicas after the retried update, but got %d", spec)
+	}
+}
@@ -0,0 +1,477 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the name of the ConfigMap storing the action journal
+	JournalConfigMapName = "kubeturbo-action-journal"
+
+	// the namespace of the service account, i.e., the namespace kubeturbo runs in
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	defaultJournalNamespace     = "default"
+
+	// the environment variable of the name of the kubeturbo container in its pod, and the default name
+	kubeturboContainerEnv     = "KUBETURBO_CONTAINER_NAME"
+	defaultKubeturboContainer = "kubeturbo"
+
+	// the number of attempts to update the ConfigMap on conflicts
+	journalUpdateRetry = 5
+
+	// the actions recorded in the journal
+	JournalActionMove            = "move"
+	JournalActionMoveStatefulSet = "moveStatefulSet"
+	JournalActionResize          = "resize"
+	JournalActionScale           = "scale"
+
+	// the steps of the actions:
+	// for move and resize: started -> cloneCreating -> originalDeleted;
+	// for move of StatefulSet pod: started -> templatePinned -> originalDeleted;
+	// for scale: started -> replicasUpdated.
+	journalStepStarted         = "started"
+	journalStepCloneCreating   = "cloneCreating"
+	journalStepTemplatePinned  = "templatePinned"
+	journalStepOriginalDeleted = "originalDeleted"
+	journalStepReplicasUpdated = "replicasUpdated"
+)
+
+// JournalEntry records the progress of an action, so that an action interrupted by a restart
+// of kubeturbo can be completed or reverted.
+type JournalEntry struct {
+	ID        string      `json:"id"`
+	Action    string      `json:"action"`
+	Step      string      `json:"step"`
+	StartTime metav1.Time `json:"startTime"`
+
+	// the original pod of move and resize, and its labels to be set to the clone pod
+	Namespace    string            `json:"namespace"`
+	PodName      string            `json:"podName,omitempty"`
+	PodUID       string            `json:"podUID,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	ClonePodName string            `json:"clonePodName,omitempty"`
+
+	// the StatefulSet of the moved pod, and its original state before its pod template is pinned to the node
+	StatefulSet string          `json:"statefulSet,omitempty"`
+	Pin         *statefulSetPin `json:"pin,omitempty"`
+
+	// the scaled owner, and the numbers of replicas before and after scaling
+	Owner            *goutil.OwnerInfo `json:"owner,omitempty"`
+	OriginalReplicas *int32            `json:"originalReplicas,omitempty"`
+	Replicas         int32             `json:"replicas,omitempty"`
+
+	// the kubeturbo instance executing the action, i.e., its pod, and when the instance started
+	Instance      string      `json:"instance,omitempty"`
+	InstanceStart metav1.Time `json:"instanceStart,omitempty"`
+}
+
+func newPodJournalEntry(action string, pod *api.Pod) *JournalEntry {
+	return &JournalEntry{
+		Action:    action,
+		Namespace: pod.Namespace,
+		PodName:   pod.Name,
+		PodUID:    string(pod.UID),
+		Labels:    pod.Labels,
+	}
+}
+
+func newStatefulSetJournalEntry(pod *api.Pod, setName string, original *statefulSetPin) *JournalEntry {
+	entry := newPodJournalEntry(JournalActionMoveStatefulSet, pod)
+	entry.StatefulSet = setName
+	entry.Pin = original
+	return entry
+}
+
+func newScaleJournalEntry(owner *goutil.OwnerInfo, original, replicas int32) *JournalEntry {
+	return &JournalEntry{
+		Action:           JournalActionScale,
+		Namespace:        owner.Namespace,
+		Owner:            owner,
+		OriginalReplicas: &original,
+		Replicas:         replicas,
+	}
+}
+
+func (e *JournalEntry) String() string {
+	if e.Owner != nil {
+		return fmt.Sprintf("%s of %s [%s]", e.Action, e.Owner, e.Step)
+	}
+	return fmt.Sprintf("%s of pod %s [%s]", e.Action, util.BuildIdentifier(e.Namespace, e.PodName), e.Step)
+}
+
+// ActionJournal persists the steps of the move, resize and scale actions in a ConfigMap.
+// The entries left by an interrupted action are reconciled when kubeturbo starts:
+// the move and resize are completed if the original pod is gone, otherwise reverted; the scale is reverted.
+// The ConfigMap is shared by the kubeturbo instances of the cluster, e.g., during a rolling upgrade, so an entry
+// is only reconciled once the instance executing its action is gone.
+// The journal is best effort: a failure to write it is logged, but doesn't fail the action.
+// A nil journal records nothing.
+type ActionJournal struct {
+	client    *kclient.Clientset
+	namespace string
+	name      string
+
+	// this kubeturbo instance: its pod name, and when it started
+	instance      string
+	instanceStart metav1.Time
+	// the name of the kubeturbo container in the pods of the instances
+	container string
+
+	// serializes the updates of the ConfigMap from the concurrent actions
+	lock sync.Mutex
+}
+
+func NewActionJournal(client *kclient.Clientset, namespace string) *ActionJournal {
+	if namespace == "" {
+		namespace = GetKubeturboNamespace()
+	}
+	instance, err := os.Hostname()
+	if err != nil {
+		glog.Warningf("Failed to get the hostname of kubeturbo to identify its journal entries: %v", err)
+	}
+	container := os.Getenv(kubeturboContainerEnv)
+	if container == "" {
+		container = defaultKubeturboContainer
+	}
+	return &ActionJournal{
+		client:    client,
+		namespace: namespace,
+		name:      JournalConfigMapName,
+		instance:  instance,
+		// the time in the entries is in seconds
+		instanceStart: metav1.Now().Rfc3339Copy(),
+		container:     container,
+	}
+}
+
+// GetKubeturboNamespace gets the namespace kubeturbo runs in; "default" if kubeturbo runs out of the cluster.
+func GetKubeturboNamespace() string {
+	data, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return defaultJournalNamespace
+	}
+	if namespace := strings.TrimSpace(string(data)); namespace != "" {
+		return namespace
+	}
+	return defaultJournalNamespace
+}
+
+// Start records the beginning of the action.
+func (j *ActionJournal) Start(entry *JournalEntry) {
+	if j == nil || entry == nil {
+		return
+	}
+	entry.StartTime = metav1.Now()
+	entry.ID = genJournalEntryID(entry)
+	entry.Instance = j.instance
+	entry.InstanceStart = j.instanceStart
+	j.Record(entry, journalStepStarted)
+}
+
+// Record records the step of the action.
+func (j *ActionJournal) Record(entry *JournalEntry, step string) {
+	if j == nil || entry == nil {
+		return
+	}
+	entry.Step = step
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		glog.Warningf("Failed to encode journal entry %v: %v", entry, err)
+		return
+	}
+	err = j.update(func(entries map[string]string) {
+		entries[entry.ID] = string(data)
+	})
+	if err != nil {
+		glog.Warningf("Failed to record journal entry %v: %v", entry, err)
+		return
+	}
+	glog.V(4).Infof("Recorded journal entry %v", entry)
+}
+
+// Finish removes the entry of the action, whether it has succeeded or failed.
+func (j *ActionJournal) Finish(entry *JournalEntry) {
+	if j == nil || entry == nil || entry.ID == "" {
+		return
+	}
+	if err := j.remove(entry.ID); err != nil {
+		glog.Warningf("Failed to remove journal entry %v: %v", entry, err)
+	}
+}
+
+// Reconcile completes or reverts the actions interrupted by the restarts of the kubeturbo instances.
+// The entries of the actions still executed by their instances are skipped, and so are the entries failed to be
+// reconciled; they are reconciled by a later call.
+func (j *ActionJournal) Reconcile() {
+	if j == nil {
+		return
+	}
+
+	entries, err := j.entries()
+	if err != nil {
+		glog.Errorf("Failed to read action journal %s/%s: %v", j.namespace, j.name, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	glog.V(2).Infof("Begin to reconcile %d incomplete actions in journal %s/%s", len(entries), j.namespace, j.name)
+	for _, entry := range entries {
+		running, err := j.isInstanceRunning(entry)
+		if err != nil {
+			glog.Errorf("Failed to check the kubeturbo instance %s of action %v: %v", entry.Instance, entry, err)
+			continue
+		}
+		if running {
+			glog.V(3).Infof("Action %v is still executed by kubeturbo instance %s", entry, entry.Instance)
+			continue
+		}
+		if err := j.reconcileEntry(entry); err != nil {
+			glog.Errorf("Failed to reconcile incomplete action %v: %v", entry, err)
+			continue
+		}
+		if err := j.remove(entry.ID); err != nil {
+			glog.Warningf("Failed to remove journal entry %v: %v", entry, err)
+		}
+	}
+}
+
+// Checks whether the kubeturbo instance executing the action of the entry is still running: it is this instance,
+// or its pod is running with the kubeturbo container started before the instance, i.e., not restarted since.
+// The other containers of the pod, e.g., the sidecars, are ignored; the kubeturbo container is named by the
+// environment variable KUBETURBO_CONTAINER_NAME, "kubeturbo" by default.
+// The instance of an entry written by an older kubeturbo is unknown, and regarded as gone.
+func (j *ActionJournal) isInstanceRunning(entry *JournalEntry) (bool, error) {
+	if entry.Instance == "" {
+		return false, nil
+	}
+	if entry.Instance == j.instance && entry.InstanceStart.Equal(&j.instanceStart) {
+		return true, nil
+	}
+
+	pod, err := j.client.CoreV1().Pods(GetKubeturboNamespace()).Get(entry.Instance, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if pod.Status.Phase != api.PodRunning {
+		return false, nil
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != j.container {
+			continue
+		}
+		running := status.State.Running
+		return running != nil && !running.StartedAt.After(entry.InstanceStart.Time), nil
+	}
+	return false, nil
+}
+
+func (j *ActionJournal) reconcileEntry(entry *JournalEntry) error {
+	switch entry.Action {
+	case JournalActionMove, JournalActionResize:
+		return j.reconcilePodEntry(entry)
+	case JournalActionMoveStatefulSet:
+		return j.reconcileStatefulSetEntry(entry)
+	case JournalActionScale:
+		return j.reconcileScaleEntry(entry)
+	default:
+		glog.Warningf("Drop journal entry of unknown action %v", entry)
+		return nil
+	}
+}
+
+// The move and resize actions clone the original pod, delete the original pod, and then move the labels to the clone.
+// If the original pod still exists, the action is reverted by deleting the clone;
+// otherwise, it is completed by setting the labels of the original pod to the clone.
+func (j *ActionJournal) reconcilePodEntry(entry *JournalEntry) error {
+	podClient := j.client.CoreV1().Pods(entry.Namespace)
+
+	pod, err := podClient.Get(entry.PodName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	originalExists := err == nil && string(pod.UID) == entry.PodUID && pod.DeletionTimestamp == nil
+
+	if entry.ClonePodName == "" {
+		glog.V(2).Infof("No clone pod is created for interrupted action %v", entry)
+		return nil
+	}
+
+	if originalExists {
+		err = podClient.Delete(entry.ClonePodName, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		glog.V(2).Infof("Reverted interrupted action %v: deleted clone pod %s", entry, entry.ClonePodName)
+		return nil
+	}
+
+	clone, err := podClient.Get(entry.ClonePodName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			glog.V(2).Infof("Both the original and the clone pods of interrupted action %v are gone", entry)
+			return nil
+		}
+		return err
+	}
+	if clone.DeletionTimestamp != nil || len(entry.Labels) == 0 {
+		return nil
+	}
+
+	clone.Labels = entry.Labels
+	if _, err = podClient.Update(clone); err != nil {
+		return err
+	}
+	glog.V(2).Infof("Completed interrupted action %v: set labels to clone pod %s", entry, entry.ClonePodName)
+	return nil
+}
+
+// The move of StatefulSet pod pins the pod template of the StatefulSet to the node before deleting the pod.
+// The pod template is restored, and the recreated pod is kept if it is ready, otherwise recreated from the restored template.
+func (j *ActionJournal) reconcileStatefulSetEntry(entry *JournalEntry) error {
+	if entry.Pin == nil {
+		return nil
+	}
+	rpod, err := unpinStatefulSet(j.client, entry.Namespace, entry.PodName, types.UID(entry.PodUID), entry.StatefulSet, entry.Pin)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	glog.V(2).Infof("Reverted interrupted action %v: restored pod template of StatefulSet %s, pod recreated: %v",
+		entry, entry.StatefulSet, rpod != nil)
+	return nil
+}
+
+// The scale action is reverted by setting the replicas of the owner back to the original number, if the replicas
+// were updated to the expected number before the interruption, i.e., the action didn't record the update.
+// Once the update is recorded, the owner takes care of the rest.
+// The replicas are never set to the expected number by the reconciliation, as the action may have been refused
+// by the checks, e.g., of the HorizontalPodAutoscaler, if it had not been interrupted.
+func (j *ActionJournal) reconcileScaleEntry(entry *JournalEntry) error {
+	if entry.Step != journalStepStarted || entry.Owner == nil || entry.OriginalReplicas == nil {
+		return nil
+	}
+
+	reverted, err := revertReplicaNum(j.client, entry.Owner, *entry.OriginalReplicas, entry.Replicas)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if reverted {
+		glog.V(2).Infof("Reverted interrupted action %v: updated replicas back to %d", entry, *entry.OriginalReplicas)
+	}
+	return nil
+}
+
+// read the entries in the journal, ordered by their start time
+func (j *ActionJournal) entries() ([]*JournalEntry, error) {
+	cm, err := j.client.CoreV1().ConfigMaps(j.namespace).Get(j.name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeJournalEntries(cm.Data), nil
+}
+
+func (j *ActionJournal) remove(id string) error {
+	return j.update(func(entries map[string]string) {
+		delete(entries, id)
+	})
+}
+
+// update the entries in the ConfigMap, which is created if not exist.
+func (j *ActionJournal) update(mutate func(entries map[string]string)) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	cmClient := j.client.CoreV1().ConfigMaps(j.namespace)
+	var err error
+	for i := 0; i < journalUpdateRetry; i++ {
+		var cm *api.ConfigMap
+		cm, err = cmClient.Get(j.name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+
+		if errors.IsNotFound(err) {
+			cm = &api.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: j.name, Namespace: j.namespace},
+				Data:       make(map[string]string),
+			}
+			mutate(cm.Data)
+			_, err = cmClient.Create(cm)
+		} else {
+			if cm.Data == nil {
+				cm.Data = make(map[string]string)
+			}
+			mutate(cm.Data)
+			_, err = cmClient.Update(cm)
+		}
+
+		if err == nil || !(errors.IsConflict(err) || errors.IsAlreadyExists(err)) {
+			return err
+		}
+		glog.V(3).Infof("Conflict on updating action journal %s/%s, retry: %v", j.namespace, j.name, err)
+	}
+	return err
+}
+
+// generate the key of the entry in the ConfigMap, e.g., move.default.foo.1d2k4m
+func genJournalEntryID(entry *JournalEntry) string {
+	name := entry.PodName
+	if entry.Owner != nil {
+		name = strings.ToLower(entry.Owner.Kind) + "." + entry.Owner.Name
+	}
+	return fmt.Sprintf("%s.%s.%s.%s", entry.Action, entry.Namespace, name,
+		strconv.FormatInt(entry.StartTime.UnixNano(), 32))
+}
+
+// decode the entries in the ConfigMap data, ordered by their start time; the malformed ones are skipped
+func decodeJournalEntries(data map[string]string) []*JournalEntry {
+	result := []*JournalEntry{}
+	for id, value := range data {
+		entry := &JournalEntry{}
+		if err := json.Unmarshal([]byte(value), entry); err != nil {
+			glog.Warningf("Skip malformed journal entry %s: %v", id, err)
+			continue
+		}
+		entry.ID = id
+		result = append(result, entry)
+	}
+
+	sort.Slice(result, func(i, k int) bool {
+		ti, tk := result[i].StartTime.Time, result[k].StartTime.Time
+		if ti.Equal(tk) {
+			return result[i].ID < result[k].ID
+		}
+		return ti.Before(tk)
+	})
+	return result
+}
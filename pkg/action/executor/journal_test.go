@@ -0,0 +1,195 @@
+package executor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGenJournalEntryID(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-1", Namespace: "default", UID: "foo-1-UID"},
+	}
+	entry := newPodJournalEntry(JournalActionMove, pod)
+	entry.StartTime = metav1.Now()
+	if id := genJournalEntryID(entry); !strings.HasPrefix(id, "move.default.foo-1.") {
+		t.Errorf("Unexpected entry id of pod: %s", id)
+	}
+
+	owner := &goutil.OwnerInfo{Kind: "Deployment", Namespace: "default", Name: "foo"}
+	entry = newScaleJournalEntry(owner, 2, 3)
+	entry.StartTime = metav1.Now()
+	if id := genJournalEntryID(entry); !strings.HasPrefix(id, "scale.default.deployment.foo.") {
+		t.Errorf("Unexpected entry id of owner: %s", id)
+	}
+}
+
+func TestDecodeJournalEntries(t *testing.T) {
+	now := time.Now()
+	first := &JournalEntry{
+		Action:       JournalActionResize,
+		Step:         journalStepCloneCreating,
+		StartTime:    metav1.NewTime(now.Add(-time.Minute)),
+		Namespace:    "default",
+		PodName:      "foo-1",
+		Labels:       map[string]string{"app": "foo"},
+		ClonePodName: "foo-1-abc",
+	}
+	second := &JournalEntry{
+		Action:    JournalActionScale,
+		Step:      journalStepStarted,
+		StartTime: metav1.NewTime(now),
+		Namespace: "default",
+		Owner:     &goutil.OwnerInfo{Kind: "Deployment", Namespace: "default", Name: "foo"},
+		Replicas:  3,
+	}
+
+	data := map[string]string{"malformed": "{"}
+	for _, entry := range []*JournalEntry{second, first} {
+		entry.ID = genJournalEntryID(entry)
+		value, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("Failed to encode entry: %v", err)
+		}
+		data[entry.ID] = string(value)
+	}
+
+	entries := decodeJournalEntries(data)
+	if len(entries) != 2 {
+		t.Fatalf("Expect 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID != first.ID || entries[1].ID != second.ID {
+		t.Errorf("Entries are not ordered by start time: %v, %v", entries[0], entries[1])
+	}
+	if entries[0].ClonePodName != "foo-1-abc" || entries[0].Labels["app"] != "foo" {
+		t.Errorf("Unexpected pod entry: %+v", entries[0])
+	}
+	if entries[1].Owner == nil || entries[1].Owner.Name != "foo" || entries[1].Replicas != 3 {
+		t.Errorf("Unexpected scale entry: %+v", entries[1])
+	}
+}
+
+func TestNilActionJournal(t *testing.T) {
+	var journal *ActionJournal
+	entry := &JournalEntry{Action: JournalActionMove}
+
+	// a nil journal records nothing
+	journal.Start(entry)
+	journal.Record(entry, journalStepOriginalDeleted)
+	journal.Finish(entry)
+	journal.Reconcile()
+
+	if entry.ID != "" || entry.Step != "" {
+		t.Errorf("Unexpected change of entry by nil journal: %+v", entry)
+	}
+}
+
+func TestReconcileEntriesOfGoneInstances(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	now := time.Now()
+	podPath := "/api/v1/namespaces/default/pods/"
+	// kubeturbo-1 is running since an hour ago, and its sidecar since three hours ago
+	instance := newTestPod("default", "kubeturbo-1")
+	instance.Status.ContainerStatuses = []api.ContainerStatus{{
+		Name:  "sidecar",
+		State: api.ContainerState{Running: &api.ContainerStateRunning{StartedAt: metav1.NewTime(now.Add(-3 * time.Hour))}},
+	}, {
+		Name:  "kubeturbo",
+		State: api.ContainerState{Running: &api.ContainerStateRunning{StartedAt: metav1.NewTime(now.Add(-time.Hour))}},
+	}}
+	server.set(podPath+"kubeturbo-1", instance)
+
+	newEntry := func(name, instance string, instanceStart time.Time) *JournalEntry {
+		pod := newTestPod("default", name)
+		server.set(podPath+name, pod)
+		server.set(podPath+name+"-clone", newTestPod("default", name+"-clone"))
+		entry := newPodJournalEntry(JournalActionMove, pod)
+		entry.StartTime = metav1.NewTime(now)
+		entry.ID = genJournalEntryID(entry)
+		entry.Step = journalStepCloneCreating
+		entry.ClonePodName = name + "-clone"
+		entry.Instance = instance
+		entry.InstanceStart = metav1.NewTime(instanceStart)
+		return entry
+	}
+	entries := []*JournalEntry{
+		// the action is still executed by kubeturbo-1
+		newEntry("running", "kubeturbo-1", now.Add(-time.Minute)),
+		// kubeturbo-1 has restarted since the action started
+		newEntry("restarted", "kubeturbo-1", now.Add(-2*time.Hour)),
+		// the pod of kubeturbo-2 is gone, e.g., replaced by a rolling upgrade
+		newEntry("gone", "kubeturbo-2", now.Add(-time.Minute)),
+	}
+	data := make(map[string]string)
+	for _, entry := range entries {
+		value, _ := json.Marshal(entry)
+		data[entry.ID] = string(value)
+	}
+	cmPath := "/api/v1/namespaces/default/configmaps/" + JournalConfigMapName
+	server.set(cmPath, &api.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: JournalConfigMapName}, Data: data})
+
+	NewActionJournal(server.client(), "default").Reconcile()
+
+	// the clone pods of the interrupted actions are deleted, as their original pods still exist
+	pod := &api.Pod{}
+	if !server.get(podPath+"running-clone", pod) {
+		t.Errorf("Expect the clone pod of the running action to be kept")
+	}
+	for _, name := range []string{"restarted", "gone"} {
+		if server.get(podPath+name+"-clone", pod) {
+			t.Errorf("Expect the clone pod of the interrupted action %s to be deleted", name)
+		}
+	}
+	cm := &api.ConfigMap{}
+	server.get(cmPath, cm)
+	if _, exist := cm.Data[entries[0].ID]; len(cm.Data) != 1 || !exist {
+		t.Errorf("Expect only the entry of the running action to be kept, but got %v", cm.Data)
+	}
+}
+
+func TestReconcileScaleEntry(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	owner := &goutil.OwnerInfo{APIVersion: "apps/v1beta1", Kind: "Deployment", Resource: "deployments", Namespace: "default", Name: "foo"}
+	journal := NewActionJournal(server.client(), "default")
+	setReplicas := func(replicas int64) {
+		server.set(owner.Path(goutil.ScaleSubResource), map[string]interface{}{
+			"apiVersion": "apps/v1beta1", "kind": "Scale",
+			"metadata": map[string]interface{}{"namespace": "default", "name": "foo"},
+			"spec":     map[string]interface{}{"replicas": replicas},
+		})
+	}
+	getReplicas := func() int64 {
+		scale := map[string]interface{}{}
+		server.get(owner.Path(goutil.ScaleSubResource), &scale)
+		return int64(scale["spec"].(map[string]interface{})["replicas"].(float64))
+	}
+
+	// the replicas were updated, but the update was not recorded: reverted
+	setReplicas(3)
+	entry := newScaleJournalEntry(owner, 2, 3)
+	entry.Step = journalStepStarted
+	if err := journal.reconcileEntry(entry); err != nil || getReplicas() != 2 {
+		t.Errorf("Expect the replicas to be reverted to 2, but got %d: %v", getReplicas(), err)
+	}
+
+	// the replicas were not updated before the interruption: never set to the target
+	if err := journal.reconcileEntry(entry); err != nil || getReplicas() != 2 {
+		t.Errorf("Expect the replicas to be kept at 2, but got %d: %v", getReplicas(), err)
+	}
+
+	// the update was recorded: the owner takes care of the rest
+	setReplicas(3)
+	entry.Step = journalStepReplicasUpdated
+	if err := journal.reconcileEntry(entry); err != nil || getReplicas() != 3 {
+		t.Errorf("Expect the replicas to be kept at 3, but got %d: %v", getReplicas(), err)
+	}
+}
@@ -10,8 +10,11 @@ import (
 	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
 	goutil "github.com/turbonomic/kubeturbo/pkg/util"
 
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	kclient "k8s.io/client-go/kubernetes"
 	"strconv"
 )
@@ -20,6 +23,10 @@ import (
 // kubernetes/pkg/controller/controller_utils.go#GetPodFromTemplate
 // https://github.com/kubernetes/kubernetes/blob/0c7e7ae1d9cccd0cca7313ee5a8ae3c313b72139/pkg/controller/controller_utils.go#L553
 func copyPodInfo(oldPod, newPod *api.Pod) {
+	// deep copy the old pod, so that the new pod shares no maps or slices with it,
+	// e.g., updating the resources of the new pod's containers doesn't change the old pod.
+	oldPod = oldPod.DeepCopy()
+
 	//1. typeMeta
 	newPod.TypeMeta = oldPod.TypeMeta
 
@@ -50,6 +57,18 @@ func copyPodWithoutLabel(oldPod, newPod *api.Pod) {
 	newPod.OwnerReferences = []metav1.OwnerReference{}
 }
 
+// Copies the pod of StatefulSet. Different from copyPodInfo, the labels, ownerReferences,
+// hostname and subdomain are kept so that the new pod keeps the identity of the original pod
+// and can be managed by the StatefulSet controller.
+func copyStatefulSetPodInfo(oldPod, newPod *api.Pod) {
+	copyPodInfo(oldPod, newPod)
+
+	newPod.UID = ""
+	newPod.Spec.Hostname = oldPod.Spec.Hostname
+	newPod.Spec.Subdomain = oldPod.Spec.Subdomain
+	newPod.Status = api.PodStatus{}
+}
+
 // Generates a name for the new pod from the old one. The new pod name will
 // be the original pod name followed by "-" + current timestamp.
 func genNewPodName(oldPod *api.Pod) string {
@@ -110,21 +129,40 @@ func waitForReady(client *kclient.Clientset, namespace, name, nodeName string, r
 	return err
 }
 
-// Move pod to node nodeName in three steps:
-//  step1: create a clone pod of the original pod (without labels)
-//  step2: delete the original pod;
+// Move pod to node nodeName by replacing it with a clone pod on the node.
+func movePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum int, evict bool, journal *ActionJournal,
+	progress *ActionProgress) (*api.Pod, error) {
+	return replacePod(client, pod, buildClonePod(pod, nodeName), JournalActionMove, retryNum, evict, journal, progress)
+}
+
+// Replace pod with its clone pod cpod, built by buildClonePod, in three steps:
+//  step1: create the clone pod of the original pod (without labels) on the node of cpod;
+//  step2: delete the original pod; if evict is true, the pod is evicted honoring its PodDisruptionBudgets;
 //  step3: add the labels to the cloned pod;
-func movePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum int) (*api.Pod, error) {
+// The steps are recorded in the journal, so that the replacement can be completed or reverted if kubeturbo restarts.
+func replacePod(client *kclient.Clientset, pod, cpod *api.Pod, action string, retryNum int, evict bool, journal *ActionJournal,
+	progress *ActionProgress) (*api.Pod, error) {
 	podClient := client.CoreV1().Pods(pod.Namespace)
 	//NOTE: do deep-copy if the original pod may be modified outside this function
 	labels := pod.Labels
+	nodeName := cpod.Spec.NodeName
+
+	//0. check the clone pod fits its node, instead of waiting for it to get ready
+	if err := checkNodeFeasibility(client, pod, cpod, false); err != nil {
+		return nil, err
+	}
+
+	entry := newPodJournalEntry(action, pod)
+	journal.Start(entry)
+	defer journal.Finish(entry)
 
 	//1. create a clone pod--podC of the original pod--podA
-	npod, err := createClonePod(client, pod, nodeName)
+	npod, err := createClonePod(client, cpod, journal, entry)
 	if err != nil {
 		glog.Errorf("Move pod failed: failed to create a clone pod: %v", err)
 		return nil, err
 	}
+	progress.Update(progressCloneCreated, "Clone pod %s created on node %s", npod.Name, nodeName)
 
 	//delete the clone pod if this action fails
 	flag := false
@@ -140,15 +178,18 @@ func movePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum
 	err = waitForReady(client, npod.Namespace, npod.Name, nodeName, retryNum)
 	if err != nil {
 		glog.Errorf("Wait for cloned Pod ready timeout: %v", err)
-		return nil, err
+		return nil, NewActionError(ActionErrorCloneNotReady, err, "clone pod %s is not ready on node %s",
+			util.BuildIdentifier(npod.Namespace, npod.Name), nodeName)
 	}
+	progress.Update(progressCloneReady, "Clone pod %s is ready", npod.Name)
 
 	//2. delete the original pod--podA
-	delOpt := &metav1.DeleteOptions{}
-	if err := podClient.Delete(pod.Name, delOpt); err != nil {
+	if err := deletePod(client, pod, evict); err != nil {
 		glog.Errorf("Move pod warning: failed to delete original pod: %v", err)
 		return nil, err
 	}
+	journal.Record(entry, journalStepOriginalDeleted)
+	progress.Update(progressOriginalDeleted, "Original pod %s deleted", pod.Name)
 
 	//3. add labels to podC
 	xpod, err := podClient.Get(npod.Name, metav1.GetOptions{})
@@ -165,20 +206,30 @@ func movePod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum
 			return nil, err
 		}
 	}
+	progress.Update(progressLabelsRestored, "Labels restored to pod %s", xpod.Name)
 
 	flag = true
 	return xpod, nil
 }
 
-func createClonePod(client *kclient.Clientset, pod *api.Pod, nodeName string) (*api.Pod, error) {
+// build the clone pod of the original pod (without labels) on node nodeName
+func buildClonePod(pod *api.Pod, nodeName string) *api.Pod {
 	npod := &api.Pod{}
 	copyPodWithoutLabel(pod, npod)
 	npod.Spec.NodeName = nodeName
 	npod.Name = genNewPodName(pod)
 	// this annotation can be used for future garbage collection if action is interrupted
 	util.AddAnnotation(npod, TurboActionAnnotationKey, TurboMoveAnnotationValue)
+	return npod
+}
 
-	podClient := client.CoreV1().Pods(pod.Namespace)
+// create the clone pod npod built by buildClonePod.
+// The name of the clone pod is recorded in the journal entry before it is created.
+func createClonePod(client *kclient.Clientset, npod *api.Pod, journal *ActionJournal, entry *JournalEntry) (*api.Pod, error) {
+	entry.ClonePodName = npod.Name
+	journal.Record(entry, journalStepCloneCreating)
+
+	podClient := client.CoreV1().Pods(npod.Namespace)
 	rpod, err := podClient.Create(npod)
 	if err != nil {
 		glog.Errorf("Failed to create a new pod: %s/%s, %v", npod.Namespace, npod.Name, err)
@@ -190,3 +241,258 @@ func createClonePod(client *kclient.Clientset, pod *api.Pod, nodeName string) (*
 
 	return rpod, nil
 }
+
+// Move pod of StatefulSet setName to node nodeName.
+// A StatefulSet pod cannot be cloned as its name (ordinal) and PVC binding must be kept, and it is recreated
+// by the StatefulSet controller as soon as it is deleted. So the controller is made to recreate it on the node:
+//  step1: pin the pod template of the StatefulSet to the node by a required node affinity, with the OnDelete
+//         update strategy so that the other pods are not rolled out by the change;
+//  step2: delete (or evict, if evict is true) the original pod, and wait until it is recreated and ready on the node;
+//  step3: restore the pod template and the update strategy, see unpinStatefulSet.
+// The steps are recorded in the journal, so that the pod template is restored if kubeturbo restarts.
+func moveStatefulSetPod(client *kclient.Clientset, pod *api.Pod, setName, nodeName string, retryNum int, evict bool,
+	journal *ActionJournal, progress *ActionProgress) (*api.Pod, error) {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	setFullName := util.BuildIdentifier(pod.Namespace, setName)
+
+	//0. check the pod fits the node before the original one is deleted
+	npod := &api.Pod{}
+	copyStatefulSetPodInfo(pod, npod)
+	npod.Spec.NodeName = nodeName
+	if err := checkNodeFeasibility(client, pod, npod, true); err != nil {
+		return nil, err
+	}
+
+	//1. pin the pod template to the node
+	ss, err := client.AppsV1beta1().StatefulSets(pod.Namespace).Get(setName, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Move StatefulSet pod failed: failed to get StatefulSet %s: %v", setFullName, err)
+		return nil, err
+	}
+	if ss.Status.CurrentRevision != ss.Status.UpdateRevision {
+		return nil, NewActionError(ActionErrorUnsupportedParent, nil, "StatefulSet %s of pod %s is being rolled out", setFullName, fullName)
+	}
+	original := newStatefulSetPin(ss)
+
+	entry := newStatefulSetJournalEntry(pod, setName, original)
+	journal.Start(entry)
+	defer journal.Finish(entry)
+
+	if err := updateStatefulSet(client, pod.Namespace, setName, func(ss *appsv1beta1.StatefulSet) {
+		pinTemplateToNode(&ss.Spec.Template, nodeName)
+		ss.Spec.UpdateStrategy = appsv1beta1.StatefulSetUpdateStrategy{Type: appsv1beta1.OnDeleteStatefulSetStrategyType}
+	}); err != nil {
+		glog.Errorf("Move StatefulSet pod failed: failed to pin pod template of StatefulSet %s to node %s: %v", setFullName, nodeName, err)
+		return nil, err
+	}
+	journal.Record(entry, journalStepTemplatePinned)
+	progress.Update(progressTemplatePinned, "Pod template of StatefulSet %s pinned to node %s", setFullName, nodeName)
+
+	//2. delete the original pod, and wait for the controller to recreate it on the node
+	err = recreateStatefulSetPod(client, pod, nodeName, retryNum, evict, journal, entry, progress)
+
+	//3. restore the pod template, whether the pod is moved or not
+	rpod, rerr := unpinStatefulSet(client, pod.Namespace, pod.Name, pod.UID, setName, original)
+	if err == nil {
+		err = rerr
+	}
+	if err == nil && rpod == nil {
+		err = NewActionError(ActionErrorCloneNotReady, nil, "pod %s is not recreated on node %s", fullName, nodeName)
+	}
+	if err != nil {
+		glog.Errorf("Move StatefulSet pod %s failed: %v", fullName, err)
+		return nil, err
+	}
+	progress.Update(progressPodRecreated, "Pod %s recreated on node %s", pod.Name, nodeName)
+	return rpod, nil
+}
+
+// Deletes the original pod of StatefulSet, and waits until it is recreated and ready on node nodeName.
+func recreateStatefulSetPod(client *kclient.Clientset, pod *api.Pod, nodeName string, retryNum int, evict bool,
+	journal *ActionJournal, entry *JournalEntry, progress *ActionProgress) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+
+	var err error
+	if evict {
+		err = evictPod(client, pod)
+	} else {
+		uid := pod.UID
+		delOpt := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}}
+		err = client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, delOpt)
+	}
+	if err != nil {
+		glog.Errorf("Failed to delete original pod %s: %v", fullName, err)
+		return err
+	}
+	journal.Record(entry, journalStepOriginalDeleted)
+
+	if _, err := waitForPodDeleted(client, pod, retryNum); err != nil {
+		glog.Errorf("Original pod %s is not deleted: %v", fullName, err)
+		return err
+	}
+	progress.Update(progressPodDeleted, "Original pod %s deleted", pod.Name)
+
+	if err := waitForReady(client, pod.Namespace, pod.Name, nodeName, retryNum); err != nil {
+		return NewActionError(ActionErrorCloneNotReady, err, "pod %s is not recreated on node %s", fullName, nodeName)
+	}
+	return nil
+}
+
+// Restores the StatefulSet whose pod template is pinned to a node to move its pod podName, whose original uid is podUID.
+// The pod recreated from the pinned template is set to the original revision if it is ready, so that it is not
+// rolled out again once the template is restored; otherwise it is deleted after the template is restored,
+// to be recreated from the original template.
+// Returns the recreated pod if it is ready, otherwise nil.
+func unpinStatefulSet(client *kclient.Clientset, namespace, podName string, podUID types.UID, setName string,
+	original *statefulSetPin) (*api.Pod, error) {
+	podClient := client.CoreV1().Pods(namespace)
+	fullName := util.BuildIdentifier(namespace, podName)
+
+	rpod, err := podClient.Get(podName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil || rpod.UID == podUID || rpod.DeletionTimestamp != nil {
+		// the pod is not recreated yet, or the original pod is not deleted
+		rpod = nil
+	}
+
+	var result *api.Pod
+	if rpod != nil && podutil.PodIsReady(rpod) {
+		result = rpod
+		if original.Revision != "" && rpod.Labels[appsv1beta1.StatefulSetRevisionLabel] != original.Revision {
+			if rpod.Labels == nil {
+				rpod.Labels = make(map[string]string)
+			}
+			rpod.Labels[appsv1beta1.StatefulSetRevisionLabel] = original.Revision
+			if result, err = podClient.Update(rpod); err != nil {
+				glog.Errorf("Failed to set revision %s to pod %s: %v", original.Revision, fullName, err)
+			}
+		}
+	}
+
+	if rerr := restoreStatefulSet(client, namespace, setName, original); rerr != nil {
+		glog.Errorf("Failed to restore pod template of StatefulSet %s: %v", util.BuildIdentifier(namespace, setName), rerr)
+		return nil, rerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rpod != nil && result == nil {
+		uid := rpod.UID
+		delOpt := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}}
+		if err := podClient.Delete(podName, delOpt); err != nil && !errors.IsNotFound(err) {
+			glog.Errorf("Failed to delete pod %s which is not ready on the pinned node: %v", fullName, err)
+		}
+	}
+	return result, nil
+}
+
+// the field of the node name in the node selector requirements
+const nodeNameField = "metadata.name"
+
+// statefulSetPin is the original state of the StatefulSet whose pod template is pinned to a node.
+type statefulSetPin struct {
+	Affinity *api.Affinity                         `json:"affinity,omitempty"`
+	Strategy appsv1beta1.StatefulSetUpdateStrategy `json:"strategy"`
+	// the revision of the original pod template
+	Revision string `json:"revision,omitempty"`
+}
+
+func newStatefulSetPin(ss *appsv1beta1.StatefulSet) *statefulSetPin {
+	return &statefulSetPin{
+		Affinity: ss.Spec.Template.Spec.Affinity.DeepCopy(),
+		Strategy: *ss.Spec.UpdateStrategy.DeepCopy(),
+		Revision: ss.Status.UpdateRevision,
+	}
+}
+
+// Pins the pods of the template to node nodeName, by the node name in all the terms of the required node affinity.
+func pinTemplateToNode(template *api.PodTemplateSpec, nodeName string) {
+	spec := &template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &api.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &api.NodeAffinity{}
+	}
+	required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		required = &api.NodeSelector{}
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []api.NodeSelectorTerm{{}}
+	}
+
+	requirement := api.NodeSelectorRequirement{
+		Key:      nodeNameField,
+		Operator: api.NodeSelectorOpIn,
+		Values:   []string{nodeName},
+	}
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchFields = append(term.MatchFields, requirement)
+	}
+}
+
+// Restores the pod template and the update strategy of the StatefulSet.
+// The restored template is the same as the original one, so it is of the original revision.
+func restoreStatefulSet(client *kclient.Clientset, namespace, name string, original *statefulSetPin) error {
+	return updateStatefulSet(client, namespace, name, func(ss *appsv1beta1.StatefulSet) {
+		ss.Spec.Template.Spec.Affinity = original.Affinity.DeepCopy()
+		ss.Spec.UpdateStrategy = *original.Strategy.DeepCopy()
+	})
+}
+
+// Updates the StatefulSet by mutate, retrying on conflicts.
+func updateStatefulSet(client *kclient.Clientset, namespace, name string, mutate func(ss *appsv1beta1.StatefulSet)) error {
+	ssClient := client.AppsV1beta1().StatefulSets(namespace)
+	var err error
+	for i := 0; i < defaultRetryLess; i++ {
+		var ss *appsv1beta1.StatefulSet
+		if ss, err = ssClient.Get(name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+		mutate(ss)
+		if _, err = ssClient.Update(ss); err == nil || !errors.IsConflict(err) {
+			return err
+		}
+		glog.V(3).Infof("Conflict on updating StatefulSet %s/%s, retry: %v", namespace, name, err)
+	}
+	return err
+}
+
+// Waits until the original pod is deleted.
+// It returns the pod with the same name if it is already recreated (with a different uid), otherwise nil.
+func waitForPodDeleted(client *kclient.Clientset, pod *api.Pod, retryNum int) (*api.Pod, error) {
+	var rpod *api.Pod
+	podClient := client.CoreV1().Pods(pod.Namespace)
+
+	interval := defaultPodDeleteSleep
+	timeout := defaultPodDeleteTimeout
+	if grace := pod.Spec.TerminationGracePeriodSeconds; grace != nil {
+		timeout += time.Duration(*grace) * time.Second
+	}
+	attempts := int(timeout/interval) + retryNum
+
+	err := goutil.RetrySimple(attempts, timeout, interval, func() (bool, error) {
+		xpod, err := podClient.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return true, err
+		}
+
+		if xpod.UID != pod.UID {
+			rpod = xpod
+			return false, nil
+		}
+
+		return true, fmt.Errorf("pod(%s) is being deleted", pod.Name)
+	})
+
+	return rpod, err
+}
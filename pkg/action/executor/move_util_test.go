@@ -0,0 +1,175 @@
+package executor
+
+import (
+	"net/http"
+	"testing"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCopyStatefulSetPodInfo(t *testing.T) {
+	isController := true
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-0",
+			Namespace:       "default",
+			UID:             "web-0-UID",
+			ResourceVersion: "100",
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "StatefulSet", Name: "web", Controller: &isController},
+			},
+		},
+		Spec: api.PodSpec{
+			Hostname:  "web-0",
+			Subdomain: "web",
+			NodeName:  "node-1",
+		},
+		Status: api.PodStatus{Phase: api.PodRunning},
+	}
+
+	npod := &api.Pod{}
+	copyStatefulSetPodInfo(pod, npod)
+
+	if npod.Name != pod.Name {
+		t.Errorf("Pod name is changed: %s Vs. %s", npod.Name, pod.Name)
+	}
+	if npod.UID != "" || npod.ResourceVersion != "" {
+		t.Errorf("UID or ResourceVersion is not cleared: %v, %v", npod.UID, npod.ResourceVersion)
+	}
+	if npod.Labels["app"] != "web" || len(npod.OwnerReferences) != 1 {
+		t.Errorf("Labels or OwnerReferences are not kept: %v, %v", npod.Labels, npod.OwnerReferences)
+	}
+	if npod.Spec.Hostname != "web-0" || npod.Spec.Subdomain != "web" {
+		t.Errorf("Hostname or Subdomain is not kept: %v, %v", npod.Spec.Hostname, npod.Spec.Subdomain)
+	}
+	if npod.Spec.NodeName != "" {
+		t.Errorf("NodeName is not cleared: %v", npod.Spec.NodeName)
+	}
+	if npod.Status.Phase != "" {
+		t.Errorf("Status is not cleared: %v", npod.Status.Phase)
+	}
+}
+
+func TestCopyPodInfoDeepCopy(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "default",
+			Annotations: map[string]string{"a": "b"},
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "bar", Image: "bar:1"}},
+		},
+	}
+
+	npod := &api.Pod{}
+	copyPodInfo(pod, npod)
+	npod.Annotations["c"] = "d"
+	npod.Spec.Containers[0].Image = "bar:2"
+
+	if _, exist := pod.Annotations["c"]; exist {
+		t.Errorf("Annotations of the original pod are changed: %v", pod.Annotations)
+	}
+	if pod.Spec.Containers[0].Image != "bar:1" {
+		t.Errorf("Containers of the original pod are changed: %v", pod.Spec.Containers[0].Image)
+	}
+}
+
+func TestPinTemplateToNode(t *testing.T) {
+	template := &api.PodTemplateSpec{}
+	pinTemplateToNode(template, "node-b")
+	terms := template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchFields) != 1 || terms[0].MatchFields[0].Values[0] != "node-b" {
+		t.Errorf("Unexpected node affinity of pinned template: %+v", terms)
+	}
+
+	// the node name is required in all the terms, which are ORed
+	zone := api.NodeSelectorRequirement{Key: "zone", Operator: api.NodeSelectorOpIn, Values: []string{"zone-1"}}
+	template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = []api.NodeSelectorTerm{
+		{MatchExpressions: []api.NodeSelectorRequirement{zone}}, {MatchExpressions: []api.NodeSelectorRequirement{zone}},
+	}
+	pinTemplateToNode(template, "node-b")
+	for _, term := range template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if len(term.MatchExpressions) != 1 || len(term.MatchFields) != 1 || term.MatchFields[0].Key != nodeNameField {
+			t.Errorf("Unexpected term of pinned template: %+v", term)
+		}
+	}
+}
+
+// the node the pod of the template is scheduled to: the pinned node, or the original node if not pinned
+func scheduleTemplate(template *api.PodTemplateSpec, defaultNode string) string {
+	affinity := template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return defaultNode
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, field := range term.MatchFields {
+			if field.Key == nodeNameField {
+				return field.Values[0]
+			}
+		}
+	}
+	return defaultNode
+}
+
+func TestMoveStatefulSetPodRecreatedByController(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	setPath := "/apis/apps/v1beta1/namespaces/default/statefulsets/web"
+	podPath := "/api/v1/namespaces/default/pods/web-0"
+	partition := int32(0)
+	ss := &appsv1beta1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: appsv1beta1.StatefulSetSpec{
+			Template: api.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}},
+			UpdateStrategy: appsv1beta1.StatefulSetUpdateStrategy{
+				Type:          appsv1beta1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1beta1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+			},
+		},
+		Status: appsv1beta1.StatefulSetStatus{CurrentRevision: "web-1", UpdateRevision: "web-1"},
+	}
+	pod := newTestPod("default", "web-0", withPodNode("node-a"), withPodLabels(map[string]string{"app": "web"}))
+	nodes := &api.NodeList{Items: []api.Node{*newTestNode("node-a", "4"), *newTestNode("node-b", "4")}}
+	server.set(setPath, ss)
+	server.set(podPath, pod)
+	server.set("/api/v1/nodes", nodes)
+	server.set("/api/v1/pods", &api.PodList{Items: []api.Pod{*pod}})
+
+	// the StatefulSet controller recreates the pod as soon as it is deleted, which is scheduled by its template
+	var recreatedFrom *appsv1beta1.StatefulSet
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if r.Method != http.MethodDelete || r.URL.Path != podPath {
+			return false
+		}
+		recreatedFrom = &appsv1beta1.StatefulSet{}
+		server.get(setPath, recreatedFrom)
+		rpod := newTestPod("default", "web-0", withPodNode(scheduleTemplate(&recreatedFrom.Spec.Template, "node-a")),
+			withPodLabels(map[string]string{"app": "web", appsv1beta1.StatefulSetRevisionLabel: "web-2"}))
+		rpod.UID = "web-0-recreated"
+		server.set(podPath, rpod)
+		writeStatus(w, http.StatusOK, "", "")
+		return true
+	})
+
+	rpod, err := moveStatefulSetPod(server.client(), pod, "web", "node-b", 1, false, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to move StatefulSet pod: %v", err)
+	}
+	if recreatedFrom == nil || recreatedFrom.Spec.UpdateStrategy.Type != appsv1beta1.OnDeleteStatefulSetStrategyType {
+		t.Errorf("Expect the pod to be recreated from the pinned template with OnDelete strategy: %+v", recreatedFrom)
+	}
+	if rpod.Spec.NodeName != "node-b" || rpod.Labels[appsv1beta1.StatefulSetRevisionLabel] != "web-1" {
+		t.Errorf("Expect the pod to be recreated on node-b of the original revision, but got %s, %v", rpod.Spec.NodeName, rpod.Labels)
+	}
+
+	restored := &appsv1beta1.StatefulSet{}
+	server.get(setPath, restored)
+	if restored.Spec.Template.Spec.Affinity != nil || restored.Spec.UpdateStrategy.Type != appsv1beta1.RollingUpdateStatefulSetStrategyType {
+		t.Errorf("Expect the pod template and update strategy to be restored: %+v", restored.Spec)
+	}
+}
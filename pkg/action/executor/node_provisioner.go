@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	nodeutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NodeProvisioner provisions a node like the given one through Cluster API:
+// the node is mapped to its Machine by the annotations or the providerID of the node, and to the MachineSet
+// owning the Machine, or the MachineDeployment owning the MachineSet; the replicas of the owner are increased by one,
+// and the action succeeds when the node of the new Machine gets ready. Otherwise the increase is rolled back.
+// Both the upstream Cluster API (cluster.x-k8s.io) and the Openshift Machine API (machine.openshift.io) are supported.
+type NodeProvisioner struct {
+	TurboK8sActionExecutor
+
+	// how long and how often to check whether the new node gets ready
+	waitTimeout time.Duration
+	waitSleep   time.Duration
+}
+
+func NewNodeProvisioner(ae TurboK8sActionExecutor) *NodeProvisioner {
+	return &NodeProvisioner{
+		TurboK8sActionExecutor: ae,
+		waitTimeout:            defaultNodeProvisionTimeout,
+		waitSleep:              defaultNodeProvisionSleep,
+	}
+}
+
+func (p *NodeProvisioner) Execute(input *TurboActionExecutorInput) (*TurboActionExecutorOutput, error) {
+	targetSE := input.ActionItem.GetTargetSE()
+	rc := goutil.NewResourceClient(p.kubeClient)
+
+	//1. get the node and the owner of its Machine
+	node, err := getNodeOfEntity(p.kubeClient, targetSE)
+	if err != nil {
+		glog.Errorf("Failed to execute node provision: %v", err)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorNodeNotFound, err, "failed to get node %s", targetSE.GetDisplayName())
+	}
+	owner, err := util.GetMachineOwnerOfNode(rc, node)
+	if err != nil {
+		glog.Errorf("Failed to execute node provision: %v", err)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorUnsupportedParent, err,
+			"node %s is not provisioned by a Cluster API MachineSet", node.Name)
+	}
+
+	//2. get the current replicas
+	scale, err := goutil.GetScale(p.kubeClient, owner)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot get scale of %s", owner)
+	}
+	current, _ := getScaleReplicas(scale)
+
+	if input.DryRun {
+		return p.dryRun(owner, scale, current)
+	}
+
+	//3. the Machines of the owner before provisioning, to find the new one
+	existing, err := util.GetOwnedMachines(rc, owner)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot get Machines of %s", owner)
+	}
+
+	//4. increase the replicas of the owner, recorded in the journal to revert it if kubeturbo restarts
+	// before the update is recorded
+	replicas := current + 1
+	entry := newScaleJournalEntry(owner, current, replicas)
+	p.journal.Start(entry)
+	defer p.journal.Finish(entry)
+
+	if err := updateReplicaNum(p.kubeClient, owner, replicas); err != nil {
+		glog.Errorf("Failed to scale %s: %v", owner, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "failed to update replicas of %s", owner)
+	}
+	p.journal.Record(entry, journalStepReplicasUpdated)
+	input.Progress.Update(progressMachineSetScaled, "Replicas of %s updated to %d", owner, replicas)
+
+	//5. wait for the new node to get ready, otherwise roll back the increase
+	nodeName, err := p.waitForNewNode(rc, owner, existing)
+	if err != nil {
+		glog.Errorf("New node of %s is not ready: %v", owner, err)
+		if rerr := p.rollback(rc, owner, existing, current, replicas); rerr != nil {
+			glog.Errorf("Failed to roll back the replicas of %s to %d: %v", owner, current, rerr)
+			return &TurboActionExecutorOutput{}, NewActionError(ActionErrorVerificationFailed, err,
+				"new node of %s is not ready, and failed to roll back its replicas to %d: %v", owner, current, rerr)
+		}
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorVerificationFailed, err,
+			"new node of %s is not ready, its replicas are rolled back to %d", owner, current)
+	}
+	input.Progress.Update(progressNewNodeReady, "New node %s of %s is ready", nodeName, owner)
+
+	glog.V(2).Infof("Provisioned node %s like node %s through %s.", nodeName, node.Name, owner)
+	return &TurboActionExecutorOutput{
+		Succeeded:     true,
+		OldController: newReplicasSpec(owner.String(), current),
+		NewController: newReplicasSpec(owner.String(), replicas),
+	}, nil
+}
+
+// wait until the node of a Machine of the owner, which is not one of the existing Machines, gets ready.
+func (p *NodeProvisioner) waitForNewNode(rc goutil.ResourceClient, owner *goutil.OwnerInfo, existing []*util.MachineInfo) (string, error) {
+	interval := p.waitSleep
+	timeout := p.waitTimeout
+	attempts := int(timeout / interval)
+
+	nodeName := ""
+	err := goutil.RetrySimple(attempts, timeout, interval, func() (bool, error) {
+		machines, err := util.GetOwnedMachines(rc, owner)
+		if err != nil {
+			return true, err
+		}
+
+		for _, machine := range getNewMachines(machines, existing) {
+			if machine.NodeName == "" {
+				continue
+			}
+			node, err := p.kubeClient.CoreV1().Nodes().Get(machine.NodeName, metav1.GetOptions{})
+			if err != nil {
+				glog.V(3).Infof("Failed to get new node %s of %s: %v", machine.NodeName, owner, err)
+				continue
+			}
+			if nodeutil.NodeIsReady(node) {
+				nodeName = node.Name
+				return false, nil
+			}
+		}
+		return true, fmt.Errorf("no new node of %s is ready yet", owner)
+	})
+
+	return nodeName, err
+}
+
+// roll back the increase of the replicas of the owner, if they are not changed by others since then.
+// The new Machines are annotated to be deleted first, so that the existing nodes are kept.
+func (p *NodeProvisioner) rollback(rc goutil.ResourceClient, owner *goutil.OwnerInfo, existing []*util.MachineInfo, original, replicas int32) error {
+	machines, err := util.GetOwnedMachines(rc, owner)
+	if err != nil {
+		glog.Warningf("Failed to get the new Machines of %s to delete them first: %v", owner, err)
+	}
+	for _, machine := range getNewMachines(machines, existing) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{machine.DeleteAnnotation(): "true"},
+			},
+		})
+		_, err := p.kubeClient.Discovery().RESTClient().Patch(types.MergePatchType).AbsPath(machine.Path()).Body(data).DoRaw()
+		if err != nil {
+			glog.Warningf("Failed to annotate new %s to delete it first: %v", machine, err)
+		}
+	}
+
+	reverted, err := revertReplicaNum(p.kubeClient, owner, original, replicas)
+	if err != nil {
+		return err
+	}
+	if !reverted {
+		glog.Warningf("Replicas of %s are changed since the provision, not rolled back to %d", owner, original)
+	}
+	return nil
+}
+
+// get the Machines which are not in the existing ones
+func getNewMachines(machines, existing []*util.MachineInfo) []*util.MachineInfo {
+	known := make(map[string]bool)
+	for _, machine := range existing {
+		known[machine.Name] = true
+	}
+
+	result := []*util.MachineInfo{}
+	for _, machine := range machines {
+		if !known[machine.Name] {
+			result = append(result, machine)
+		}
+	}
+	return result
+}
+
+// build the node provision without executing it, and submit the replica change with server-side dry-run.
+func (p *NodeProvisioner) dryRun(owner *goutil.OwnerInfo, scale *unstructured.Unstructured, current int32) (*TurboActionExecutorOutput, error) {
+	helper := newDryRunHelper(p.kubeClient)
+	helper.addChange("%s: spec.replicas: %d -> %d", owner, current, current+1)
+
+	if err := unstructured.SetNestedField(scale.Object, int64(current+1), "spec", "replicas"); err != nil {
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot set replicas of %s", owner)
+	}
+	if err := helper.updateScale(owner, scale); err != nil {
+		glog.Errorf("Dry run of scaling %s failed: %v", owner, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of scaling %s failed", owner)
+	}
+
+	glog.V(2).Infof("Dry run of provisioning node through %s succeeded: %s", owner, helper.diff())
+	return helper.output(), nil
+}
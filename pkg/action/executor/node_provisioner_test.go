@@ -0,0 +1,162 @@
+package executor
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testClusterAPIPath = "/apis/cluster.x-k8s.io/v1alpha3"
+
+// newTestMachineObject creates the Machine, MachineSet or MachineDeployment controlled by the owner, if any
+func newTestMachineObject(kind, name, ownerKind, owner, nodeName string) map[string]interface{} {
+	metadata := map[string]interface{}{"namespace": "ns", "name": name}
+	if owner != "" {
+		metadata["ownerReferences"] = []interface{}{map[string]interface{}{
+			"apiVersion": "cluster.x-k8s.io/v1alpha3", "kind": ownerKind, "name": owner, "uid": owner, "controller": true,
+		}}
+	}
+	obj := map[string]interface{}{"apiVersion": "cluster.x-k8s.io/v1alpha3", "kind": kind, "metadata": metadata}
+	if nodeName != "" {
+		obj["status"] = map[string]interface{}{"nodeRef": map[string]interface{}{"name": nodeName}}
+	}
+	return obj
+}
+
+func newTestList(items ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"apiVersion": "cluster.x-k8s.io/v1alpha3", "kind": "List", "items": items}
+}
+
+func newTestMachineNode(name, machine string, ready api.ConditionStatus) *api.Node {
+	node := newTestNode(name, "4")
+	node.Annotations = map[string]string{"cluster.x-k8s.io/machine": machine, "cluster.x-k8s.io/cluster-namespace": "ns"}
+	node.Status.Conditions = []api.NodeCondition{{Type: api.NodeReady, Status: ready}}
+	return node
+}
+
+// set up the node-1 of Machine m1, owned by the MachineSet ms1 of the MachineDeployment md with 1 replica.
+// The MachineDeployment controller creates the Machine m2 of the node-2 with the readiness when it is scaled up.
+func newNodeProvisionTestServer(t *testing.T, ready api.ConditionStatus) *fakeAPIServer {
+	server := newFakeAPIServer(t)
+	version := metav1.GroupVersionForDiscovery{GroupVersion: "cluster.x-k8s.io/v1alpha3", Version: "v1alpha3"}
+	server.set("/apis", &metav1.APIGroupList{Groups: []metav1.APIGroup{
+		{Name: "cluster.x-k8s.io", Versions: []metav1.GroupVersionForDiscovery{version}, PreferredVersion: version},
+	}})
+	server.set(testClusterAPIPath, &metav1.APIResourceList{GroupVersion: version.GroupVersion, APIResources: []metav1.APIResource{
+		{Name: "machines", Kind: "Machine"},
+		{Name: "machinesets", Kind: "MachineSet"}, {Name: "machinesets/scale", Kind: "Scale"},
+		{Name: "machinedeployments", Kind: "MachineDeployment"}, {Name: "machinedeployments/scale", Kind: "Scale"},
+	}})
+
+	m1 := newTestMachineObject("Machine", "m1", "MachineSet", "ms1", "node-1")
+	ms1 := newTestMachineObject("MachineSet", "ms1", "MachineDeployment", "md", "")
+	server.set(testClusterAPIPath+"/namespaces/ns/machines/m1", m1)
+	server.set(testClusterAPIPath+"/namespaces/ns/machinesets/ms1", ms1)
+	server.set(testClusterAPIPath+"/namespaces/ns/machinedeployments/md", newTestMachineObject("MachineDeployment", "md", "", "", ""))
+	server.set(testClusterAPIPath+"/namespaces/ns/machines", newTestList(m1))
+	server.set(testClusterAPIPath+"/namespaces/ns/machinesets", newTestList(ms1))
+	server.set("/api/v1/nodes/node-1", newTestMachineNode("node-1", "m1", api.ConditionTrue))
+	setTestScale(server, 1)
+
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if r.Method != http.MethodPut || r.URL.Path != testClusterAPIPath+"/namespaces/ns/machinedeployments/md/scale" {
+			return false
+		}
+		if getTestScale(server) == 1 {
+			m2 := newTestMachineObject("Machine", "m2", "MachineSet", "ms1", "node-2")
+			server.set(testClusterAPIPath+"/namespaces/ns/machines/m2", m2)
+			server.set(testClusterAPIPath+"/namespaces/ns/machines", newTestList(m1, m2))
+			server.set("/api/v1/nodes/node-2", newTestMachineNode("node-2", "m2", ready))
+		}
+		return false
+	})
+	return server
+}
+
+func setTestScale(server *fakeAPIServer, replicas int) {
+	server.set(testClusterAPIPath+"/namespaces/ns/machinedeployments/md/scale", map[string]interface{}{
+		"apiVersion": "autoscaling/v1", "kind": "Scale",
+		"metadata": map[string]interface{}{"namespace": "ns", "name": "md"},
+		"spec":     map[string]interface{}{"replicas": replicas},
+	})
+}
+
+func getTestScale(server *fakeAPIServer) int {
+	scale := &struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+		} `json:"spec"`
+	}{}
+	server.get(testClusterAPIPath+"/namespaces/ns/machinedeployments/md/scale", scale)
+	return scale.Spec.Replicas
+}
+
+func newNodeProvisionInput() *TurboActionExecutorInput {
+	actionType := proto.ActionItemDTO_PROVISION
+	entityType := proto.EntityDTO_VIRTUAL_MACHINE
+	nodeName := "node-1"
+	return &TurboActionExecutorInput{ActionItem: &proto.ActionItemDTO{
+		ActionType: &actionType,
+		TargetSE:   &proto.EntityDTO{EntityType: &entityType, Id: &nodeName, DisplayName: &nodeName},
+	}}
+}
+
+func newTestNodeProvisioner(server *fakeAPIServer) *NodeProvisioner {
+	provisioner := NewNodeProvisioner(TurboK8sActionExecutor{kubeClient: server.client()})
+	provisioner.waitTimeout = time.Millisecond * 100
+	provisioner.waitSleep = time.Millisecond * 10
+	return provisioner
+}
+
+func TestNodeProvisionerExecute(t *testing.T) {
+	server := newNodeProvisionTestServer(t, api.ConditionTrue)
+	defer server.close()
+
+	output, err := newTestNodeProvisioner(server).Execute(newNodeProvisionInput())
+	if err != nil || !output.Succeeded {
+		t.Fatalf("Failed to provision node: %v", err)
+	}
+	// the MachineDeployment is scaled, instead of its MachineSet
+	if replicas := getTestScale(server); replicas != 2 {
+		t.Errorf("Expect the MachineDeployment to be scaled to 2, but got %d", replicas)
+	}
+	if *output.OldController.Replicas != 1 || *output.NewController.Replicas != 2 {
+		t.Errorf("Expect the replicas of the MachineDeployment from 1 to 2 in the output, but got %+v, %+v", output.OldController, output.NewController)
+	}
+}
+
+func TestNodeProvisionerRollback(t *testing.T) {
+	server := newNodeProvisionTestServer(t, api.ConditionFalse)
+	defer server.close()
+
+	var annotations map[string]string
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if r.Method != http.MethodPatch || r.URL.Path != testClusterAPIPath+"/namespaces/ns/machines/m2" {
+			return false
+		}
+		patch := &struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}{}
+		json.Unmarshal(body, patch)
+		annotations = patch.Metadata.Annotations
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+		return true
+	})
+
+	_, err := newTestNodeProvisioner(server).Execute(newNodeProvisionInput())
+	if category := GetActionErrorCategory(err); category != ActionErrorVerificationFailed {
+		t.Errorf("Expect the provision to fail verification, but got %v", err)
+	}
+	if replicas := getTestScale(server); replicas != 1 {
+		t.Errorf("Expect the replicas to be rolled back to 1, but got %d", replicas)
+	}
+	if annotations["cluster.x-k8s.io/delete-machine"] != "true" {
+		t.Errorf("Expect the new Machine to be deleted first, but got annotations %v", annotations)
+	}
+}
@@ -0,0 +1,340 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	kclient "k8s.io/client-go/kubernetes"
+)
+
+// NodeSuspender executes the actions on the nodes (VIRTUAL_MACHINE entities):
+//  suspend: cordon the node, and drain it by evicting its controllable pods;
+//  start: uncordon the node, which is the reverse of suspend.
+// The pods are evicted through the Eviction subresource, so that their PodDisruptionBudgets are honored;
+// an eviction refused by PodDisruptionBudget is retried until the drain times out.
+// The cordon of kubeturbo is recorded in the CordonedAnnotationKey annotation of the node: if the drain fails,
+// the node is uncordoned again, unless it was cordoned by others before; and only such nodes are started.
+type NodeSuspender struct {
+	TurboK8sActionExecutor
+}
+
+func NewNodeSuspender(ae TurboK8sActionExecutor) *NodeSuspender {
+	return &NodeSuspender{
+		TurboK8sActionExecutor: ae,
+	}
+}
+
+func (s *NodeSuspender) Execute(input *TurboActionExecutorInput) (*TurboActionExecutorOutput, error) {
+	actionItem := input.ActionItem
+
+	//1. get the node
+	node, err := getNodeOfEntity(s.kubeClient, actionItem.GetTargetSE())
+	if err != nil {
+		glog.Errorf("Failed to execute node action: %v", err)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorNodeNotFound, err, "failed to get node %s",
+			actionItem.GetTargetSE().GetDisplayName())
+	}
+
+	//2. cordon and drain, or uncordon the node
+	switch actionItem.GetActionType() {
+	case proto.ActionItemDTO_SUSPEND:
+		if input.DryRun {
+			return s.dryRun(node)
+		}
+		err = s.suspend(node, input.Progress)
+	case proto.ActionItemDTO_START:
+		if input.DryRun {
+			return s.dryRunStart(node)
+		}
+		err = s.start(node, input.Progress)
+	default:
+		err = NewActionError(ActionErrorInvalidAction, nil, "action %v on node %s is not supported", actionItem.GetActionType(), node.Name)
+	}
+
+	if err != nil {
+		glog.Errorf("Failed to execute %v of node %s: %v", actionItem.GetActionType(), node.Name, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+	return &TurboActionExecutorOutput{Succeeded: true}, nil
+}
+
+// cordon the node, and evict its pods; uncordon the node if the drain fails, unless it was cordoned by others.
+func (s *NodeSuspender) suspend(node *api.Node, progress *ActionProgress) error {
+	//1. check the pods on the node before cordoning it
+	pods, err := s.listPods(node.Name)
+	if err != nil {
+		return err
+	}
+	evictable, err := getPodsToDrain(pods)
+	if err != nil {
+		return err
+	}
+
+	//2. cordon the node
+	cordoned, err := cordonNode(s.kubeClient, node.Name)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "failed to cordon node %s", node.Name)
+	}
+	progress.Update(progressNodeCordoned, "Node %s cordoned", node.Name)
+
+	//3. evict the pods, and wait until they are gone
+	if err = s.drain(node.Name, evictable, progress); err != nil {
+		if !cordoned {
+			glog.Warningf("Failed to drain node %s, which is left cordoned by others: %v", node.Name, err)
+			return err
+		}
+		glog.Warningf("Failed to drain node %s, begin to uncordon it: %v", node.Name, err)
+		progress.Update(ProgressStarted, "Uncordoning node %s: %v", node.Name, err)
+		return NewRollbackError(err, uncordonNode(s.kubeClient, node.Name))
+	}
+	progress.Update(progressNodeDrained, "Node %s drained", node.Name)
+
+	glog.V(2).Infof("Node %s is cordoned and drained: %d pods evicted.", node.Name, len(evictable))
+	return nil
+}
+
+// uncordon the node cordoned by kubeturbo.
+func (s *NodeSuspender) start(node *api.Node, progress *ActionProgress) error {
+	if err := checkNodeToStart(node); err != nil {
+		return err
+	}
+	if err := uncordonNode(s.kubeClient, node.Name); err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "failed to uncordon node %s", node.Name)
+	}
+	progress.Update(progressNodeUncordoned, "Node %s uncordoned", node.Name)
+
+	glog.V(2).Infof("Node %s is uncordoned.", node.Name)
+	return nil
+}
+
+// Evict the pods one by one, retrying the evictions refused by PodDisruptionBudget,
+// and wait until all of them are deleted. The progress is reported per evicted pod.
+func (s *NodeSuspender) drain(nodeName string, pods []*api.Pod, progress *ActionProgress) error {
+	deadline := time.Now().Add(defaultDrainTimeout)
+	total := len(pods)
+
+	for i, pod := range pods {
+		fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+		for {
+			err := evictPod(s.kubeClient, pod)
+			if err == nil || errors.IsNotFound(err) {
+				break
+			}
+			if !IsPodDisruptionBudgetError(err) {
+				return NewActionError(ActionErrorAPIFailure, err, "failed to evict pod %s from node %s", fullName, nodeName)
+			}
+			if time.Now().After(deadline) {
+				return err
+			}
+			glog.V(3).Infof("Eviction of pod %s is refused by PodDisruptionBudget, retry in %v", fullName, defaultDrainRetrySleep)
+			time.Sleep(defaultDrainRetrySleep)
+		}
+
+		if rpod, err := waitForPodDeleted(s.kubeClient, pod, defaultRetryMore); err != nil {
+			return NewActionError(ActionErrorDrainTimeout, err, "pod %s is not deleted from node %s", fullName, nodeName)
+		} else if rpod != nil && rpod.Spec.NodeName == nodeName {
+			glog.Warningf("Pod %s is recreated on node %s which is being drained", fullName, nodeName)
+		}
+
+		progress.Update(drainProgress(i+1, total), "%d of %d pods evicted from node %s", i+1, total, nodeName)
+	}
+
+	return nil
+}
+
+// the percentage of the drain after the evicted pods, between the stages of cordoned and drained.
+func drainProgress(evicted, total int) int32 {
+	if total <= 0 {
+		return progressNodeDrained
+	}
+	return progressNodeCordoned + int32(evicted)*(progressNodeDrained-progressNodeCordoned)/int32(total)
+}
+
+// build the node suspend without executing it, and submit the cordon with server-side dry-run.
+func (s *NodeSuspender) dryRun(node *api.Node) (*TurboActionExecutorOutput, error) {
+	pods, err := s.listPods(node.Name)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+	evictable, err := getPodsToDrain(pods)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	helper := newDryRunHelper(s.kubeClient)
+	nnode := node.DeepCopy()
+	if setCordoned(nnode) {
+		helper.addChange("node %s: spec.unschedulable: false -> true", node.Name)
+	}
+	for _, pod := range evictable {
+		helper.addChange("pod %s is evicted", util.BuildIdentifier(pod.Namespace, pod.Name))
+	}
+
+	if err = helper.update(s.kubeClient.CoreV1().RESTClient(), "", "nodes", node.Name, nnode); err != nil {
+		glog.Errorf("Dry run of suspending node %s failed: %v", node.Name, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of cordoning node %s failed", node.Name)
+	}
+
+	glog.V(2).Infof("Dry run of suspending node %s succeeded: %s", node.Name, helper.diff())
+	return helper.output(), nil
+}
+
+// build the node start without executing it, and submit the uncordon with server-side dry-run.
+func (s *NodeSuspender) dryRunStart(node *api.Node) (*TurboActionExecutorOutput, error) {
+	if err := checkNodeToStart(node); err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	helper := newDryRunHelper(s.kubeClient)
+	helper.addChange("node %s: spec.unschedulable: true -> false", node.Name)
+
+	nnode := node.DeepCopy()
+	setUncordoned(nnode)
+	if err := helper.update(s.kubeClient.CoreV1().RESTClient(), "", "nodes", node.Name, nnode); err != nil {
+		glog.Errorf("Dry run of starting node %s failed: %v", node.Name, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of uncordoning node %s failed", node.Name)
+	}
+
+	glog.V(2).Infof("Dry run of starting node %s succeeded: %s", node.Name, helper.diff())
+	return helper.output(), nil
+}
+
+// list the pods on the node
+func (s *NodeSuspender) listPods(nodeName string) ([]*api.Pod, error) {
+	opts := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	}
+	podList, err := s.kubeClient.CoreV1().Pods(api.NamespaceAll).List(opts)
+	if err != nil {
+		return nil, NewActionError(ActionErrorAPIFailure, err, "failed to list pods on node %s", nodeName)
+	}
+
+	pods := make([]*api.Pod, len(podList.Items))
+	for i := range podList.Items {
+		pods[i] = &podList.Items[i]
+	}
+	return pods, nil
+}
+
+// Get the pods to evict to drain the node: the controllable pods which are not terminated.
+// The pods of DaemonSets and the mirror pods, which are not controllable, are left on the node.
+// The drain is refused if there is a pod which would be lost or is not allowed to be evicted:
+// a pod with the controllable annotation set to "false", or a pod without a controller.
+func getPodsToDrain(pods []*api.Pod) ([]*api.Pod, error) {
+	result := []*api.Pod{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == api.PodSucceeded || pod.Status.Phase == api.PodFailed {
+			continue
+		}
+
+		fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+		if !podutil.IsControllableFromAnnotation(pod.Annotations) {
+			return nil, NewActionError(ActionErrorNotControllable, nil, "pod %s on node %s is not controllable", fullName, pod.Spec.NodeName)
+		}
+		if !podutil.Controllable(pod) {
+			glog.V(4).Infof("Pod %s is left on node %s when draining the node", fullName, pod.Spec.NodeName)
+			continue
+		}
+
+		kind, _, err := podutil.GetPodParentInfo(pod)
+		if err != nil {
+			return nil, NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
+		}
+		if kind == "" {
+			return nil, NewActionError(ActionErrorUnsupportedParent, nil, "pod %s on node %s has no controller to recreate it",
+				fullName, pod.Spec.NodeName)
+		}
+
+		result = append(result, pod)
+	}
+	return result, nil
+}
+
+// check whether the node is cordoned by kubeturbo, so that it can be started.
+func checkNodeToStart(node *api.Node) error {
+	if !node.Spec.Unschedulable {
+		return NewActionError(ActionErrorNoChange, nil, "node %s is not cordoned", node.Name)
+	}
+	if node.Annotations[CordonedAnnotationKey] != "true" {
+		return NewActionError(ActionErrorInvalidAction, nil, "node %s is not cordoned by kubeturbo", node.Name)
+	}
+	return nil
+}
+
+// cordon the node, and record the cordon of kubeturbo in the annotation of the node.
+// return true if the node is cordoned by kubeturbo, now or before; false if it was cordoned by others,
+// which is left as it is.
+func cordonNode(client *kclient.Clientset, nodeName string) (bool, error) {
+	cordoned := false
+	err := updateNode(client, nodeName, func(node *api.Node) bool {
+		if node.Spec.Unschedulable {
+			cordoned = node.Annotations[CordonedAnnotationKey] == "true"
+			return false
+		}
+		cordoned = true
+		return setCordoned(node)
+	})
+	return cordoned, err
+}
+
+// uncordon the node if it is cordoned by kubeturbo, and remove the annotation of the cordon.
+func uncordonNode(client *kclient.Clientset, nodeName string) error {
+	return updateNode(client, nodeName, func(node *api.Node) bool {
+		if _, exist := node.Annotations[CordonedAnnotationKey]; !exist {
+			return false
+		}
+		setUncordoned(node)
+		return true
+	})
+}
+
+// set the node unschedulable with the annotation of the cordon of kubeturbo; return false if it is unschedulable already.
+func setCordoned(node *api.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	node.Spec.Unschedulable = true
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[CordonedAnnotationKey] = "true"
+	return true
+}
+
+func setUncordoned(node *api.Node) {
+	node.Spec.Unschedulable = false
+	delete(node.Annotations, CordonedAnnotationKey)
+}
+
+// update the node by the mutation, which returns false if there is nothing to update, retrying on conflicts.
+func updateNode(client *kclient.Clientset, nodeName string, mutate func(node *api.Node) bool) error {
+	nodeClient := client.CoreV1().Nodes()
+
+	var err error
+	for i := 0; i < defaultRetryLess; i++ {
+		var node *api.Node
+		if node, err = nodeClient.Get(nodeName, metav1.GetOptions{}); err != nil {
+			return err
+		}
+		if !mutate(node) {
+			return nil
+		}
+
+		if _, err = nodeClient.Update(node); err == nil {
+			glog.V(3).Infof("Set node %s unschedulable to %v", nodeName, node.Spec.Unschedulable)
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update node %s after %d attempts: %v", nodeName, defaultRetryLess, err)
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPodsToDrain(t *testing.T) {
+	pods := []*api.Pod{
+		newTestPod("default", "foo-1", withPodNode("node-a"), withPodOwner("ReplicaSet", "foo-1-owner")),
+		// left on the node
+		newTestPod("default", "ds-1", withPodNode("node-a"), withPodOwner("DaemonSet", "ds-1-owner")),
+		newTestPod("default", "job-1", withPodNode("node-a"), withPodOwner("Job", "job-1-owner"), withPodPhase(api.PodSucceeded)),
+	}
+
+	result, err := getPodsToDrain(pods)
+	if err != nil {
+		t.Fatalf("Failed to get the pods to drain: %v", err)
+	}
+	if len(result) != 1 || result[0].Name != "foo-1" {
+		t.Errorf("Unexpected pods to drain: %v", result)
+	}
+
+	// not controllable
+	notControllable := newTestPod("default", "bar-1", withPodNode("node-a"), withPodOwner("ReplicaSet", "bar-1-owner"),
+		withPodAnnotations(map[string]string{"kubeturbo.io/controllable": "false"}))
+	if _, err = getPodsToDrain(append(pods, notControllable)); GetActionErrorCategory(err) != ActionErrorNotControllable {
+		t.Errorf("Expect error of not controllable pod, got %v", err)
+	}
+
+	// bare pod
+	bare := newTestPod("default", "baz", withPodNode("node-a"))
+	if _, err = getPodsToDrain(append(pods, bare)); GetActionErrorCategory(err) != ActionErrorUnsupportedParent {
+		t.Errorf("Expect error of bare pod, got %v", err)
+	}
+}
+
+func TestDrainProgress(t *testing.T) {
+	if p := drainProgress(0, 0); p != progressNodeDrained {
+		t.Errorf("Unexpected progress of draining empty node: %d", p)
+	}
+	if p := drainProgress(1, 2); p != 55 {
+		t.Errorf("Unexpected progress of draining half of the pods: %d", p)
+	}
+	if p := drainProgress(2, 2); p != progressNodeDrained {
+		t.Errorf("Unexpected progress of draining all the pods: %d", p)
+	}
+}
+
+// set up the node with the pod foo-1, whose eviction fails
+func newNodeSuspendTestServer(t *testing.T, node *api.Node) *fakeAPIServer {
+	server := newFakeAPIServer(t)
+	server.set("/api/v1/nodes/"+node.Name, node)
+	server.set("/api/v1/pods", &api.PodList{Items: []api.Pod{*newTestPod("default", "foo-1", withPodNode("node-a"), withPodOwner("ReplicaSet", "foo-1-owner"))}})
+	server.addHook(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if !strings.HasSuffix(r.URL.Path, "/eviction") {
+			return false
+		}
+		writeStatus(w, http.StatusInternalServerError, metav1.StatusReasonInternalError, "eviction failed")
+		return true
+	})
+	return server
+}
+
+func TestSuspendUncordonsOnlyItsOwnCordon(t *testing.T) {
+	tests := []struct {
+		name          string
+		unschedulable bool
+	}{
+		{"cordoned by kubeturbo", false},
+		{"cordoned by others before", true},
+	}
+
+	for _, tt := range tests {
+		node := newTestNode("node-a", "4")
+		node.Spec.Unschedulable = tt.unschedulable
+		server := newNodeSuspendTestServer(t, node)
+
+		err := NewNodeSuspender(TurboK8sActionExecutor{kubeClient: server.client()}).suspend(node, nil)
+		if err == nil {
+			t.Errorf("%s: expect the drain to fail", tt.name)
+		}
+		// the node is left as it was before the suspend
+		result := &api.Node{}
+		server.get("/api/v1/nodes/node-a", result)
+		if result.Spec.Unschedulable != tt.unschedulable {
+			t.Errorf("%s: expect the node unschedulable to be %v, but got %v", tt.name, tt.unschedulable, result.Spec.Unschedulable)
+		}
+		if _, exist := result.Annotations[CordonedAnnotationKey]; exist {
+			t.Errorf("%s: unexpected annotation of the cordon: %v", tt.name, result.Annotations)
+		}
+		server.close()
+	}
+}
+
+func TestStartOnlyNodeCordonedByKubeturbo(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+	suspender := NewNodeSuspender(TurboK8sActionExecutor{kubeClient: server.client()})
+
+	// cordoned by others
+	node := newTestNode("node-a", "4")
+	node.Spec.Unschedulable = true
+	server.set("/api/v1/nodes/node-a", node)
+	if err := suspender.start(node, nil); GetActionErrorCategory(err) != ActionErrorInvalidAction {
+		t.Errorf("Expect the start of the node cordoned by others to be refused, but got %v", err)
+	}
+
+	// cordoned by kubeturbo
+	node.Annotations = map[string]string{CordonedAnnotationKey: "true"}
+	server.set("/api/v1/nodes/node-a", node)
+	if err := suspender.start(node, nil); err != nil {
+		t.Errorf("Failed to start the node cordoned by kubeturbo: %v", err)
+	}
+	result := &api.Node{}
+	server.get("/api/v1/nodes/node-a", result)
+	if _, exist := result.Annotations[CordonedAnnotationKey]; result.Spec.Unschedulable || exist {
+		t.Errorf("Expect the node to be uncordoned, but got %v, %v", result.Spec.Unschedulable, result.Annotations)
+	}
+}
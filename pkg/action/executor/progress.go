@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	sdkprobe "github.com/turbonomic/turbo-go-sdk/pkg/probe"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+)
+
+// The progress percentages of the stages of the actions.
+const (
+	ProgressStarted int32 = 0
+	// held outside the maintenance windows, then queued for the concurrency budgets, before acquiring the lock
+	ProgressHeld         int32 = 2
+	ProgressQueued       int32 = 5
+	ProgressLockAcquired int32 = 10
+
+	// move and resize by cloning the pod
+	progressCloneCreated    int32 = 30
+	progressCloneReady      int32 = 60
+	progressOriginalDeleted int32 = 80
+	progressLabelsRestored  int32 = 90
+
+	// move of StatefulSet pod by recreating the pod on the node the template is pinned to: pinned -> deleted -> recreated
+	progressTemplatePinned int32 = 20
+	progressPodDeleted     int32 = 50
+	progressPodRecreated   int32 = 80
+
+	// resize by updating the pod template of the controller: updated -> (pod deleted) -> rolled out
+	progressTemplateUpdated int32 = 30
+	progressRolloutFinished int32 = 90
+
+	// scale
+	progressReplicasUpdated int32 = 40
+	progressReplicasReady   int32 = 90
+
+	// suspend of node: cordoned -> (pods evicted one by one) -> drained; start of node: uncordoned
+	progressNodeCordoned   int32 = 20
+	progressNodeDrained    int32 = 90
+	progressNodeUncordoned int32 = 90
+
+	// provision of node: MachineSet or MachineDeployment scaled -> new node ready
+	progressMachineSetScaled int32 = 20
+	progressNewNodeReady     int32 = 90
+
+	// resize of namespace quota
+	progressQuotaUpdated int32 = 90
+
+	// the interval to re-send the current stage, so that the action is not timed out by the server
+	defaultProgressKeepAliveInterval = time.Second * 3
+)
+
+// ActionProgress publishes the stages of an action through the ActionProgressTracker,
+// with a description and a percentage for each stage.
+// A nil ActionProgress publishes nothing.
+type ActionProgress struct {
+	tracker sdkprobe.ActionProgressTracker
+
+	lock        sync.Mutex
+	description string
+	progress    int32
+}
+
+func NewActionProgress(tracker sdkprobe.ActionProgressTracker) *ActionProgress {
+	return &ActionProgress{
+		tracker:     tracker,
+		description: "Action started",
+		progress:    ProgressStarted,
+	}
+}
+
+// Update publishes the stage of the action. The percentage never goes backwards, e.g., when
+// the action is rolled back, only the description is updated.
+func (p *ActionProgress) Update(progress int32, format string, args ...interface{}) {
+	if p == nil {
+		return
+	}
+
+	p.lock.Lock()
+	p.description = fmt.Sprintf(format, args...)
+	if progress > p.progress {
+		p.progress = progress
+	}
+	description, current := p.description, p.progress
+	p.lock.Unlock()
+
+	glog.V(3).Infof("Action progress %d%%: %s", current, description)
+	p.send(description, current)
+}
+
+// KeepAlive re-sends the current stage periodically until stop is closed,
+// so that a long stage, e.g., waiting for a pod to get ready, doesn't time out the action.
+func (p *ActionProgress) KeepAlive(stop <-chan struct{}) {
+	if p == nil {
+		return
+	}
+
+	ticker := time.NewTicker(defaultProgressKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			glog.V(3).Infof("action keepAlive goroutine exit.")
+			return
+		case <-ticker.C:
+			p.lock.Lock()
+			description, current := p.description, p.progress
+			p.lock.Unlock()
+			p.send(description, current)
+		}
+	}
+}
+
+func (p *ActionProgress) send(description string, progress int32) {
+	if p.tracker == nil {
+		return
+	}
+	p.tracker.UpdateProgress(proto.ActionResponseState_IN_PROGRESS, description, progress)
+}
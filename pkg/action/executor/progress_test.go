@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+)
+
+type fakeProgressTracker struct {
+	descriptions []string
+	progresses   []int32
+}
+
+func (t *fakeProgressTracker) UpdateProgress(state proto.ActionResponseState, description string, progress int32) {
+	t.descriptions = append(t.descriptions, description)
+	t.progresses = append(t.progresses, progress)
+}
+
+func TestActionProgressUpdate(t *testing.T) {
+	tracker := &fakeProgressTracker{}
+	progress := NewActionProgress(tracker)
+
+	progress.Update(ProgressLockAcquired, "Lock acquired")
+	progress.Update(progressCloneCreated, "Clone pod %s created", "foo-1-a1")
+	// the percentage doesn't go backwards when rolling back
+	progress.Update(ProgressStarted, "Rolling back")
+
+	expected := []int32{ProgressLockAcquired, progressCloneCreated, progressCloneCreated}
+	if len(tracker.progresses) != len(expected) {
+		t.Fatalf("Expect %d updates, got %d", len(expected), len(tracker.progresses))
+	}
+	for i, p := range expected {
+		if tracker.progresses[i] != p {
+			t.Errorf("Update %d: expect progress %d, got %d", i, p, tracker.progresses[i])
+		}
+	}
+	if tracker.descriptions[1] != "Clone pod foo-1-a1 created" || tracker.descriptions[2] != "Rolling back" {
+		t.Errorf("Unexpected descriptions: %v", tracker.descriptions)
+	}
+}
+
+func TestNilActionProgress(t *testing.T) {
+	var progress *ActionProgress
+	progress.Update(ProgressLockAcquired, "Lock acquired")
+	progress.KeepAlive(make(chan struct{}))
+
+	// no tracker
+	NewActionProgress(nil).Update(ProgressLockAcquired, "Lock acquired")
+}
@@ -0,0 +1,243 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	"github.com/turbonomic/kubeturbo/pkg/discovery/metrics"
+	"github.com/turbonomic/kubeturbo/pkg/discovery/repository"
+	nodeutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/kubeturbo/pkg/kubeclient"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the commodities sold by the quota (VIRTUAL_DATACENTER) entity, and the allocation resources of them
+var quotaResourceTypes = map[proto.CommodityDTO_CommodityType]metrics.ResourceType{
+	proto.CommodityDTO_CPU_ALLOCATION: metrics.CPULimit,
+	proto.CommodityDTO_MEM_ALLOCATION: metrics.MemoryLimit,
+}
+
+// QuotaResizer resizes the quota of a namespace (VIRTUAL_DATACENTER entity) by updating the hard limit
+// of its ResourceQuota objects.
+// If several ResourceQuotas limit the same resource, the most restrictive one is changed, which is the one
+// the quota entity is discovered from (see KubeQuota.ReconcileQuotas).
+// The resize is refused if the new limit is below the current usage of the ResourceQuota.
+type QuotaResizer struct {
+	TurboK8sActionExecutor
+	kubeletClient *kubeclient.KubeletClient
+}
+
+func NewQuotaResizer(ae TurboK8sActionExecutor, kubeletClient *kubeclient.KubeletClient) *QuotaResizer {
+	return &QuotaResizer{
+		TurboK8sActionExecutor: ae,
+		kubeletClient:          kubeletClient,
+	}
+}
+
+func (q *QuotaResizer) Execute(input *TurboActionExecutorInput) (*TurboActionExecutorOutput, error) {
+	actionItem := input.ActionItem
+	namespace := actionItem.GetTargetSE().GetDisplayName()
+
+	//1. get the resource to resize
+	resourceType, newValue, err := getQuotaResize(actionItem)
+	if err != nil {
+		glog.Errorf("Failed to execute quota resize of namespace %s: %v", namespace, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+	resourceName := metrics.ReverseKubeResourceTypes[resourceType]
+
+	//2. find the most restrictive ResourceQuota of the resource
+	quota, err := q.getMostRestrictiveQuota(namespace, resourceType)
+	if err != nil {
+		glog.Errorf("Failed to execute quota resize of namespace %s: %v", namespace, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	//3. build the new hard limit, and check it against the usage
+	quantity, err := q.buildQuantity(resourceType, newValue)
+	if err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+	if err = checkQuotaResize(quota, resourceName, quantity); err != nil {
+		glog.Errorf("Quota resize of namespace %s aborted: %v", namespace, err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	if input.DryRun {
+		return q.dryRun(quota, resourceName, quantity)
+	}
+
+	//4. update the ResourceQuota
+	if err = q.updateQuotaHard(quota.Namespace, quota.Name, resourceName, quantity); err != nil {
+		glog.Errorf("Failed to update ResourceQuota %s/%s: %v", quota.Namespace, quota.Name, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "failed to update ResourceQuota %s/%s",
+			quota.Namespace, quota.Name)
+	}
+	input.Progress.Update(progressQuotaUpdated, "ResourceQuota %s/%s updated", quota.Namespace, quota.Name)
+
+	glog.V(2).Infof("Resized quota of namespace %s: %s of ResourceQuota %s is set to %s.", namespace, resourceName,
+		quota.Name, quantity.String())
+	return &TurboActionExecutorOutput{Succeeded: true}, nil
+}
+
+// get the resource type and the new capacity of the quota resize
+func getQuotaResize(actionItem *proto.ActionItemDTO) (metrics.ResourceType, float64, error) {
+	current := actionItem.GetCurrentComm()
+	comm := actionItem.GetNewComm()
+	if comm == nil {
+		return "", 0, NewActionError(ActionErrorInvalidAction, nil, "the new commodity of the quota resize is not set")
+	}
+	if current != nil && current.GetCommodityType() != comm.GetCommodityType() {
+		return "", 0, NewActionError(ActionErrorInvalidAction, nil, "commodity type mismatch %v Vs. %v",
+			current.GetCommodityType(), comm.GetCommodityType())
+	}
+
+	resourceType, exist := quotaResourceTypes[comm.GetCommodityType()]
+	if !exist {
+		return "", 0, NewActionError(ActionErrorInvalidAction, nil, "resize of commodity %v of quota is not supported",
+			comm.GetCommodityType())
+	}
+	if comm.GetCapacity() < smallestAmount {
+		return "", 0, NewActionError(ActionErrorInvalidAction, nil, "new capacity %v of %v is too small", comm.GetCapacity(),
+			comm.GetCommodityType())
+	}
+	return resourceType, comm.GetCapacity(), nil
+}
+
+// get the ResourceQuota of the namespace with the most restrictive hard limit of the resource
+func (q *QuotaResizer) getMostRestrictiveQuota(namespace string, resourceType metrics.ResourceType) (*api.ResourceQuota, error) {
+	quotaList, err := q.kubeClient.CoreV1().ResourceQuotas(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, NewActionError(ActionErrorAPIFailure, err, "failed to list ResourceQuotas of namespace %s", namespace)
+	}
+	quotas := make([]*api.ResourceQuota, len(quotaList.Items))
+	for i := range quotaList.Items {
+		quotas[i] = &quotaList.Items[i]
+	}
+
+	kubeQuota := repository.NewKubeQuota("", namespace, "")
+	kubeQuota.ReconcileQuotas(quotas)
+
+	quota, exist := kubeQuota.AllocationQuota[resourceType]
+	if !exist || quota == nil {
+		return nil, NewActionError(ActionErrorInvalidAction, nil, "no ResourceQuota of namespace %s limits %s", namespace,
+			metrics.ReverseKubeResourceTypes[resourceType])
+	}
+	return quota, nil
+}
+
+// build the hard limit from the new capacity: CPU in MHz, and Memory in KB
+func (q *QuotaResizer) buildQuantity(resourceType metrics.ResourceType, value float64) (resource.Quantity, error) {
+	if !metrics.IsCPUType(resourceType) {
+		return genMemoryQuantity(value)
+	}
+
+	// the CPU capacity of the quota is discovered with the average CPU frequency of the active nodes
+	cpuFrequency, err := q.getAverageNodeCPUFrequency()
+	if err != nil {
+		return resource.Quantity{}, NewActionError(ActionErrorAPIFailure, err, "failed to get the cpu frequency of the nodes")
+	}
+	return genCPUQuantity(value, cpuFrequency)
+}
+
+// get the average CPU frequency of the ready and schedulable nodes, in KHz
+func (q *QuotaResizer) getAverageNodeCPUFrequency() (uint64, error) {
+	nodeList, err := q.kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	count := 0
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if !nodeutil.NodeIsReady(node) || !nodeutil.NodeIsSchedulable(node) {
+			continue
+		}
+		frequency, err := getNodeCPUFrequency(q.kubeClient, q.kubeletClient, node.Name)
+		if err != nil {
+			glog.Warningf("Failed to get cpu frequency of node %s: %v", node.Name, err)
+			continue
+		}
+		total += float64(frequency)
+		count++
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("no active node with cpu frequency")
+	}
+	return uint64(math.Round(total / float64(count))), nil
+}
+
+// check whether the hard limit of the resource can be set to the quantity: it must differ from the current one,
+// and it must not be below the current usage.
+func checkQuotaResize(quota *api.ResourceQuota, resourceName api.ResourceName, quantity resource.Quantity) error {
+	fullName := util.BuildIdentifier(quota.Namespace, quota.Name)
+
+	if hard, exist := quota.Spec.Hard[resourceName]; exist && hard.Cmp(quantity) == 0 {
+		return NewActionError(ActionErrorNoChange, nil, "%s of ResourceQuota %s is already %s", resourceName, fullName, quantity.String())
+	}
+	if used, exist := quota.Status.Used[resourceName]; exist && quantity.Cmp(used) < 0 {
+		return NewActionError(ActionErrorBelowUsage, nil, "new %s %s of ResourceQuota %s is below the usage %s",
+			resourceName, quantity.String(), fullName, used.String())
+	}
+	return nil
+}
+
+// build the quota resize without executing it, and submit the ResourceQuota with server-side dry-run.
+func (q *QuotaResizer) dryRun(quota *api.ResourceQuota, resourceName api.ResourceName, quantity resource.Quantity) (*TurboActionExecutorOutput, error) {
+	fullName := util.BuildIdentifier(quota.Namespace, quota.Name)
+	helper := newDryRunHelper(q.kubeClient)
+
+	hard := quota.Spec.Hard[resourceName]
+	helper.addChange("ResourceQuota %s: spec.hard.%s: %s -> %s", fullName, resourceName, hard.String(), quantity.String())
+
+	nquota := quota.DeepCopy()
+	if nquota.Spec.Hard == nil {
+		nquota.Spec.Hard = api.ResourceList{}
+	}
+	nquota.Spec.Hard[resourceName] = quantity
+	if err := helper.update(q.kubeClient.CoreV1().RESTClient(), quota.Namespace, "resourcequotas", quota.Name, nquota); err != nil {
+		glog.Errorf("Dry run of resizing ResourceQuota %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of resizing ResourceQuota %s failed", fullName)
+	}
+
+	glog.V(2).Infof("Dry run of resizing ResourceQuota %s succeeded: %s", fullName, helper.diff())
+	return helper.output(), nil
+}
+
+// set the hard limit of the resource in the ResourceQuota, retrying on conflicts.
+func (q *QuotaResizer) updateQuotaHard(namespace, name string, resourceName api.ResourceName, quantity resource.Quantity) error {
+	quotaClient := q.kubeClient.CoreV1().ResourceQuotas(namespace)
+
+	var err error
+	for i := 0; i < defaultRetryLess; i++ {
+		var quota *api.ResourceQuota
+		if quota, err = quotaClient.Get(name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+		// check again with the latest usage
+		if err = checkQuotaResize(quota, resourceName, quantity); err != nil {
+			return err
+		}
+
+		if quota.Spec.Hard == nil {
+			quota.Spec.Hard = api.ResourceList{}
+		}
+		quota.Spec.Hard[resourceName] = quantity
+		if _, err = quotaClient.Update(quota); err == nil {
+			glog.V(3).Infof("Set %s of ResourceQuota %s/%s to %s", resourceName, namespace, name, quantity.String())
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update ResourceQuota %s/%s after %d attempts: %v", namespace, name, defaultRetryLess, err)
+}
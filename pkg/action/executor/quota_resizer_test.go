@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/turbonomic/kubeturbo/pkg/discovery/metrics"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newQuotaResizeActionItem(ctype proto.CommodityDTO_CommodityType, current, capacity float64) *proto.ActionItemDTO {
+	return &proto.ActionItemDTO{
+		CurrentComm: &proto.CommodityDTO{CommodityType: &ctype, Capacity: &current},
+		NewComm:     &proto.CommodityDTO{CommodityType: &ctype, Capacity: &capacity},
+	}
+}
+
+func TestGetQuotaResize(t *testing.T) {
+	resourceType, value, err := getQuotaResize(newQuotaResizeActionItem(proto.CommodityDTO_MEM_ALLOCATION, 1024, 2048))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resourceType != metrics.MemoryLimit || value != 2048 {
+		t.Errorf("expected (%v, 2048) but got (%v, %v)", metrics.MemoryLimit, resourceType, value)
+	}
+
+	resourceType, _, err = getQuotaResize(newQuotaResizeActionItem(proto.CommodityDTO_CPU_ALLOCATION, 1000, 2000))
+	if err != nil || resourceType != metrics.CPULimit {
+		t.Errorf("expected %v but got %v: %v", metrics.CPULimit, resourceType, err)
+	}
+
+	_, _, err = getQuotaResize(newQuotaResizeActionItem(proto.CommodityDTO_VCPU, 1000, 2000))
+	if GetActionErrorCategory(err) != ActionErrorInvalidAction {
+		t.Errorf("expected %v but got %v", ActionErrorInvalidAction, err)
+	}
+
+	_, _, err = getQuotaResize(newQuotaResizeActionItem(proto.CommodityDTO_MEM_ALLOCATION, 1024, 0.5))
+	if GetActionErrorCategory(err) != ActionErrorInvalidAction {
+		t.Errorf("expected %v but got %v", ActionErrorInvalidAction, err)
+	}
+}
+
+func TestCheckQuotaResize(t *testing.T) {
+	quota := &api.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "quota1"},
+		Spec: api.ResourceQuotaSpec{
+			Hard: api.ResourceList{api.ResourceLimitsMemory: resource.MustParse("4Gi")},
+		},
+		Status: api.ResourceQuotaStatus{
+			Used: api.ResourceList{api.ResourceLimitsMemory: resource.MustParse("2Gi")},
+		},
+	}
+
+	tests := []struct {
+		quantity string
+		category ActionErrorCategory
+	}{
+		{"8Gi", ""},
+		{"2Gi", ""},
+		{"4Gi", ActionErrorNoChange},
+		{"1Gi", ActionErrorBelowUsage},
+	}
+
+	for _, test := range tests {
+		err := checkQuotaResize(quota, api.ResourceLimitsMemory, resource.MustParse(test.quantity))
+		if category := GetActionErrorCategory(err); category != test.category {
+			t.Errorf("quantity %s: expected category %q but got %q", test.quantity, test.category, category)
+		}
+	}
+}
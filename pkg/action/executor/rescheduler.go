@@ -6,23 +6,38 @@ import (
 	"time"
 
 	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
 	goutil "github.com/turbonomic/kubeturbo/pkg/util"
 	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	kclient "k8s.io/client-go/kubernetes"
 )
 
 type ReScheduler struct {
 	TurboK8sActionExecutor
 	sccAllowedSet map[string]struct{}
+
+	// checks the volumes of the pods moved to the destination nodes
+	volumeChecker *volumeChecker
 }
 
 func NewReScheduler(ae TurboK8sActionExecutor, sccAllowedSet map[string]struct{}) *ReScheduler {
 	return &ReScheduler{
 		TurboK8sActionExecutor: ae,
 		sccAllowedSet:          sccAllowedSet,
+		volumeChecker:          newVolumeChecker(ae.kubeClient, EmptyDirPolicyAllow),
+	}
+}
+
+// Set how to move the pods with emptyDir volumes: allow or refuse; the empty policy is ignored.
+func (r *ReScheduler) WithEmptyDirPolicy(policy string) *ReScheduler {
+	if policy != "" {
+		r.volumeChecker.emptyDirPolicy = policy
 	}
+	return r
 }
 
 //Note: the error info will be shown in UI
@@ -34,11 +49,15 @@ func (r *ReScheduler) Execute(input *TurboActionExecutorInput) (*TurboActionExec
 	node, err := r.getPodNode(actionItem)
 	if err != nil {
 		glog.Errorf("Failed to execute pod move: failed to get target pod or new hosting node: %v", err)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Failed")
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	if input.DryRun {
+		return r.dryRun(pod, node)
 	}
 
 	//2. move pod to the node
-	npod, err := r.reSchedule(pod, node)
+	npod, err := r.reSchedule(pod, node, input.Progress)
 	if err != nil {
 		glog.Errorf("Failed to execute pod move: %v\n %++v", err, actionItem)
 		return &TurboActionExecutorOutput{}, err
@@ -50,7 +69,7 @@ func (r *ReScheduler) Execute(input *TurboActionExecutorInput) (*TurboActionExec
 	glog.V(2).Infof("Begin to check pod move for pod[%v]", fullName)
 	if err = r.checkPod(npod, nodeName); err != nil {
 		glog.Errorf("Checking pod move failed: pod[%v] failed: %v", fullName, err)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Check Failed")
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorVerificationFailed, err, "pod %s is not running on node %s", fullName, nodeName)
 	}
 	glog.V(2).Infof("Checking pod move succeeded: pod[%v] is on node[%v].", fullName, nodeName)
 
@@ -89,6 +108,11 @@ func (r *ReScheduler) getNode(action *proto.ActionItemDTO) (*api.Node, error) {
 		return nil, err
 	}
 
+	return getNodeOfEntity(r.kubeClient, hostSE)
+}
+
+// get k8s.node of the VM or PM entity, by its properties, displayName, UUID or IPs in turn.
+func getNodeOfEntity(client *kclient.Clientset, hostSE *proto.EntityDTO) (*api.Node, error) {
 	var err error = nil
 	var node *api.Node = nil
 
@@ -101,21 +125,21 @@ func (r *ReScheduler) getNode(action *proto.ActionItemDTO) (*api.Node, error) {
 	}
 
 	//1. get node from properties
-	node, err = util.GetNodeFromProperties(r.kubeClient, hostSE.GetEntityProperties())
+	node, err = util.GetNodeFromProperties(client, hostSE.GetEntityProperties())
 	if err == nil {
 		glog.V(2).Infof("Get node(%v) from properties.", node.Name)
 		return node, nil
 	}
 
 	//2. get node by displayName
-	node, err = util.GetNodebyName(r.kubeClient, hostSE.GetDisplayName())
+	node, err = util.GetNodebyName(client, hostSE.GetDisplayName())
 	if err == nil {
 		glog.V(2).Infof("Get node(%v) by displayName.", node.Name)
 		return node, nil
 	}
 
 	//3. get node by UUID
-	node, err = util.GetNodebyUUID(r.kubeClient, hostSE.GetId())
+	node, err = util.GetNodebyUUID(client, hostSE.GetId())
 	if err == nil {
 		glog.V(2).Infof("Get node(%v) by UUID(%v).", node.Name, hostSE.GetId())
 		return node, nil
@@ -124,7 +148,7 @@ func (r *ReScheduler) getNode(action *proto.ActionItemDTO) (*api.Node, error) {
 	//4. get node by IP
 	vmIPs := getVMIps(hostSE)
 	if len(vmIPs) > 0 {
-		node, err = util.GetNodebyIP(r.kubeClient, vmIPs)
+		node, err = util.GetNodebyIP(client, vmIPs)
 		if err == nil {
 			glog.V(2).Infof("Get node(%v) by IP.", hostSE.GetDisplayName())
 			return node, nil
@@ -145,16 +169,14 @@ func (r *ReScheduler) getPodNode(action *proto.ActionItemDTO) (*api.Node, error)
 	//1. check
 	glog.V(4).Infof("MoveActionItem: %++v", action)
 	if err := r.checkActionItem(action); err != nil {
-		err = fmt.Errorf("Move Action aborted: check action item failed: %v", err)
-		glog.Errorf(err.Error())
-		return nil, err
+		glog.Errorf("Move Action aborted: check action item failed: %v", err)
+		return nil, NewActionError(ActionErrorInvalidAction, err, "invalid move action")
 	}
 	//2. find the new hosting node for the pod.
 	node, err := r.getNode(action)
 	if err != nil {
-		err = fmt.Errorf("Move action aborted: failed to get new hosting node: %v", err)
-		glog.Error(err.Error())
-		return nil, err
+		glog.Errorf("Move action aborted: failed to get new hosting node: %v", err)
+		return nil, NewActionError(ActionErrorNodeNotFound, err, "failed to get new hosting node")
 	}
 
 	return node, nil
@@ -167,7 +189,7 @@ func (r *ReScheduler) preActionCheck(pod *api.Pod, node *api.Node) error {
 
 	// Check if the pod privilege is supported
 	if !util.SupportPrivilegePod(pod, r.sccAllowedSet) {
-		err := fmt.Errorf("Pod %s has unsupported SCC", fullName)
+		err := NewActionError(ActionErrorSCCDenied, nil, "pod %s has unsupported SCC", fullName)
 		glog.Error(err)
 		return err
 	}
@@ -194,11 +216,11 @@ func (r *ReScheduler) preActionCheck(pod *api.Pod, node *api.Node) error {
 	return nil
 }
 
-func (r *ReScheduler) reSchedule(pod *api.Pod, node *api.Node) (*api.Pod, error) {
+func (r *ReScheduler) reSchedule(pod *api.Pod, node *api.Node, progress *ActionProgress) (*api.Pod, error) {
 	//1. do some check
 	if err := r.preActionCheck(pod, node); err != nil {
 		glog.Errorf("Move action aborted: %v", err)
-		return nil, fmt.Errorf("Failed")
+		return nil, err
 	}
 
 	nodeName := node.Name
@@ -206,38 +228,119 @@ func (r *ReScheduler) reSchedule(pod *api.Pod, node *api.Node) (*api.Pod, error)
 	// if the pod is already on the target node, then simply return success.
 	if pod.Spec.NodeName == nodeName {
 		glog.V(2).Infof("Move action aborted: pod[%v] is already on host[%v].", fullName, nodeName)
-		return nil, fmt.Errorf("Aborted")
+		return nil, NewActionError(ActionErrorNoChange, nil, "pod %s is already on node %s", fullName, nodeName)
 	}
 
 	//2. move
-	parentKind, parentName, err := podutil.GetPodParentInfo(pod)
+	// Use the grand parent info so that the pods of Deployment are resolved to the Deployment.
+	parentKind, parentName, err := podutil.GetPodGrandInfo(r.kubeClient, pod)
 	if err != nil {
 		glog.Errorf("Move action aborted: cannot get pod-%v parent info: %v", fullName, err)
-		return nil, fmt.Errorf("Failed")
+		return nil, NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
 	}
 
-	if !util.SupportedParent(parentKind) {
+	if !util.SupportedMoveParent(parentKind) {
 		glog.Errorf("Move action aborted: parent kind(%v) is not supported.", parentKind)
-		return nil, fmt.Errorf("Unsupported")
+		return nil, NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported", parentKind, fullName)
+	}
+
+	// the pod of StatefulSet is recreated, so its volumes are detached before being attached on the node
+	if err := r.volumeChecker.check(pod, node, util.IsStatefulSet(parentKind)); err != nil {
+		glog.Errorf("Move action aborted: %v", err)
+		return nil, err
 	}
 
 	var npod *api.Pod
 	if parentKind == "" {
-		npod, err = r.moveBarePod(pod, nodeName)
+		npod, err = r.moveBarePod(pod, nodeName, progress)
+	} else if util.IsStatefulSet(parentKind) {
+		npod, err = r.moveStatefulSetPod(pod, parentName, nodeName, progress)
 	} else {
-		npod, err = r.moveControllerPod(pod, parentKind, parentName, nodeName)
+		npod, err = r.moveControllerPod(pod, parentKind, parentName, nodeName, progress)
 	}
 
 	if err != nil {
 		glog.Errorf("Move Pod(%v) action failed: %v", fullName, err)
-		return nil, fmt.Errorf("Failed")
+		// The refusal from PodDisruptionBudget is reported as it is, so it is not retried.
+		return nil, wrapActionError(err, ActionErrorAPIFailure, "failed to move pod %s to node %s", fullName, nodeName)
 	}
 	return npod, nil
 }
 
+// build the pod move without executing it, and submit the changes with server-side dry-run.
+func (r *ReScheduler) dryRun(pod *api.Pod, node *api.Node) (*TurboActionExecutorOutput, error) {
+	if err := r.preActionCheck(pod, node); err != nil {
+		glog.Errorf("Move action aborted: %v", err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	nodeName := node.Name
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	if pod.Spec.NodeName == nodeName {
+		glog.V(2).Infof("Move action aborted: pod[%v] is already on host[%v].", fullName, nodeName)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorNoChange, nil, "pod %s is already on node %s", fullName, nodeName)
+	}
+
+	parentKind, parentName, err := podutil.GetPodGrandInfo(r.kubeClient, pod)
+	if err != nil {
+		glog.Errorf("Move action aborted: cannot get pod-%v parent info: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
+	}
+	if !util.SupportedMoveParent(parentKind) {
+		glog.Errorf("Move action aborted: parent kind(%v) is not supported.", parentKind)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported", parentKind, fullName)
+	}
+	if err := r.volumeChecker.check(pod, node, util.IsStatefulSet(parentKind)); err != nil {
+		glog.Errorf("Move action aborted: %v", err)
+		return &TurboActionExecutorOutput{}, err
+	}
+	npod := buildClonePod(pod, nodeName)
+	if err := checkNodeFeasibility(r.kubeClient, pod, npod, util.IsStatefulSet(parentKind)); err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	helper := newDryRunHelper(r.kubeClient)
+	helper.addChange("pod %s: spec.nodeName: %s -> %s", fullName, pod.Spec.NodeName, nodeName)
+	if util.IsStatefulSet(parentKind) {
+		err = r.dryRunStatefulSetPod(helper, pod, parentName, nodeName)
+	} else {
+		helper.addChange("clone pod %s is created, and pod %s is deleted", util.BuildIdentifier(npod.Namespace, npod.Name), fullName)
+		err = helper.create(r.kubeClient.CoreV1().RESTClient(), pod.Namespace, "pods", npod)
+	}
+	if err != nil {
+		glog.Errorf("Dry run of moving pod %s failed: %v", fullName, err)
+		return &TurboActionExecutorOutput{}, wrapActionError(err, ActionErrorAPIFailure, "dry run of moving pod %s failed", fullName)
+	}
+
+	glog.V(2).Infof("Dry run of moving pod %s succeeded: %s", fullName, helper.diff())
+	return helper.output(), nil
+}
+
+// submit the pinned pod template of the StatefulSet and the deletion of its pod with dry-run
+func (r *ReScheduler) dryRunStatefulSetPod(helper *dryRunHelper, pod *api.Pod, setName, nodeName string) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	setFullName := util.BuildIdentifier(pod.Namespace, setName)
+	ss, err := r.kubeClient.AppsV1beta1().StatefulSets(pod.Namespace).Get(setName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if ss.Status.CurrentRevision != ss.Status.UpdateRevision {
+		return NewActionError(ActionErrorUnsupportedParent, nil, "StatefulSet %s of pod %s is being rolled out", setFullName, fullName)
+	}
+
+	pinTemplateToNode(&ss.Spec.Template, nodeName)
+	ss.Spec.UpdateStrategy = appsv1beta1.StatefulSetUpdateStrategy{Type: appsv1beta1.OnDeleteStatefulSetStrategyType}
+	helper.addChange("pod template of StatefulSet %s is pinned to node %s until the pod is recreated", setFullName, nodeName)
+	if err := helper.update(r.kubeClient.AppsV1beta1().RESTClient(), pod.Namespace, "statefulsets", setName, ss); err != nil {
+		return err
+	}
+	helper.addChange("pod %s is deleted and recreated on node %s", fullName, nodeName)
+	return helper.delete(r.kubeClient.CoreV1().RESTClient(), pod.Namespace, "pods", pod.Name)
+}
+
 // move the pods controlled by ReplicationController/ReplicaSet
-func (r *ReScheduler) moveControllerPod(pod *api.Pod, parentKind, parentName, nodeName string) (*api.Pod, error) {
-	npod, err := movePod(r.kubeClient, pod, nodeName, defaultRetryMore)
+func (r *ReScheduler) moveControllerPod(pod *api.Pod, parentKind, parentName, nodeName string, progress *ActionProgress) (*api.Pod, error) {
+	npod, err := movePod(r.kubeClient, pod, nodeName, defaultRetryMore, r.usePodEviction, r.journal, progress)
 	if err != nil {
 		glog.Errorf("Move contorller pod(%s) failed: %v", pod.Name, err)
 	}
@@ -245,11 +348,24 @@ func (r *ReScheduler) moveControllerPod(pod *api.Pod, parentKind, parentName, no
 	return npod, err
 }
 
+// move the pods controlled by StatefulSet.
+// The pod keeps its name (ordinal) and PVC binding, so it is recreated by the controller on the node instead of cloned.
+func (r *ReScheduler) moveStatefulSetPod(pod *api.Pod, parentName, nodeName string, progress *ActionProgress) (*api.Pod, error) {
+	glog.V(2).Infof("Begin to move StatefulSet(%s/%s) pod(%s) to node(%s).", pod.Namespace, parentName, pod.Name, nodeName)
+
+	npod, err := moveStatefulSetPod(r.kubeClient, pod, parentName, nodeName, defaultRetryMore, r.usePodEviction, r.journal, progress)
+	if err != nil {
+		glog.Errorf("Move StatefulSet pod(%s) failed: %v", pod.Name, err)
+	}
+
+	return npod, err
+}
+
 // as there may be concurrent actions on the same bare pod:
 //   for example, one action is to move Pod, and the other is to Resize Pod.container;
 // thus, concurrent control should also be applied to bare pods.
-func (r *ReScheduler) moveBarePod(pod *api.Pod, nodeName string) (*api.Pod, error) {
-	npod, err := movePod(r.kubeClient, pod, nodeName, defaultRetryMore)
+func (r *ReScheduler) moveBarePod(pod *api.Pod, nodeName string, progress *ActionProgress) (*api.Pod, error) {
+	npod, err := movePod(r.kubeClient, pod, nodeName, defaultRetryMore, r.usePodEviction, r.journal, progress)
 	if err != nil {
 		glog.Errorf("Move contorller pod(%s) failed: %v", pod.Name, err)
 	}
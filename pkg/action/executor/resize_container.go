@@ -28,6 +28,10 @@ type containerResizeSpec struct {
 	NewCapacity k8sapi.ResourceList
 	NewRequest  k8sapi.ResourceList
 
+	// the resources to replace the container's resources as a whole, e.g., to roll back a resize;
+	// if set, NewCapacity and NewRequest are ignored.
+	Resources *k8sapi.ResourceRequirements
+
 	// index of Pod's containers
 	Index int
 }
@@ -40,6 +44,12 @@ type ContainerResizer struct {
 	enableNonDisruptiveSupport bool
 	sccAllowedSet              map[string]struct{}
 
+	// the resize mode for the pods owned by controllers: pod or controller
+	resizeMode string
+
+	// the extended resources resized by the commodities of the types, e.g., nvidia.com/gpu
+	extendedResources map[proto.CommodityDTO_CommodityType]k8sapi.ResourceName
+
 	spec *containerResizeSpec
 }
 
@@ -51,23 +61,35 @@ func NewContainerResizeSpec(idx int) *containerResizeSpec {
 	}
 }
 
-func NewContainerResizer(ae TurboK8sActionExecutor, kubeletClient *kubeclient.KubeletClient, sccAllowedSet map[string]struct{}) *ContainerResizer {
+func NewContainerResizer(ae TurboK8sActionExecutor, kubeletClient *kubeclient.KubeletClient, sccAllowedSet map[string]struct{},
+	resizeMode string) *ContainerResizer {
 	return &ContainerResizer{
 		TurboK8sActionExecutor: ae,
 		kubeletClient:          kubeletClient,
 		sccAllowedSet:          sccAllowedSet,
+		resizeMode:             resizeMode,
 	}
 }
 
+func (r *ContainerResizer) WithExtendedResources(resources map[proto.CommodityDTO_CommodityType]k8sapi.ResourceName) *ContainerResizer {
+	r.extendedResources = resources
+	return r
+}
+
 // get node cpu frequency, in KHz;
 func (r *ContainerResizer) getNodeCPUFrequency(host string) (uint64, error) {
-	result, err := r.kubeletClient.GetMachineCpuFrequency(host)
+	return getNodeCPUFrequency(r.kubeClient, r.kubeletClient, host)
+}
+
+// get node cpu frequency from the kubelet, in KHz; by the hostname first, then by the IP of the node.
+func getNodeCPUFrequency(kubeClient *kclient.Clientset, kubeletClient *kubeclient.KubeletClient, host string) (uint64, error) {
+	result, err := kubeletClient.GetMachineCpuFrequency(host)
 	if err == nil {
 		return result, nil
 	}
 	glog.Warningf("Failed to get node node cpuFrequency by hostname: %v, will try to get it by IP.", err)
 
-	node, err := util.GetNodebyName(r.kubeClient, host)
+	node, err := util.GetNodebyName(kubeClient, host)
 	if err != nil {
 		glog.Errorf("failed to get node by name: %v", err)
 		return 1, err
@@ -79,7 +101,7 @@ func (r *ContainerResizer) getNodeCPUFrequency(host string) (uint64, error) {
 		return 1, err
 	}
 
-	return r.kubeletClient.GetMachineCpuFrequency(ip)
+	return kubeletClient.GetMachineCpuFrequency(ip)
 }
 
 func (r *ContainerResizer) setCPUQuantity(cpuMhz float64, host string, rlist k8sapi.ResourceList) error {
@@ -115,10 +137,21 @@ func (r *ContainerResizer) buildResourceList(pod *k8sapi.Pod, ctype proto.Commod
 			return err
 		}
 		result[k8sapi.ResourceMemory] = memory
+	case proto.CommodityDTO_VSTORAGE:
+		storage, err := genStorageQuantity(amount)
+		if err != nil {
+			glog.Errorf("failed to build ephemeral-storage.Capacity: %v", err)
+			return err
+		}
+		result[k8sapi.ResourceEphemeralStorage] = storage
 	default:
-		err := fmt.Errorf("Unsupport Commodity type[%v]", ctype)
-		glog.Error(err)
-		return err
+		name, exist := r.extendedResources[ctype]
+		if !exist {
+			err := fmt.Errorf("Unsupport Commodity type[%v]", ctype)
+			glog.Error(err)
+			return err
+		}
+		result[name] = genExtendedResourceQuantity(amount)
 	}
 
 	return nil
@@ -234,6 +267,7 @@ func (r *ContainerResizer) buildResizeAction(actionItem *proto.ActionItemDTO, po
 		return nil, err
 	}
 
+	alignExtendedResources(resizeSpec)
 	if err = r.setZeroRequest(pod, containerIndex, resizeSpec); err != nil {
 		glog.Errorf("failed to adjust request.")
 		return nil, err
@@ -250,22 +284,59 @@ func (r *ContainerResizer) Execute(input *TurboActionExecutorInput) (*TurboActio
 	spec, err := r.buildResizeAction(actionItem, pod)
 	if err != nil {
 		glog.Errorf("failed to execute container resize: %v", err)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Failed.")
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorInvalidAction, err, "failed to build the container resize")
+	}
+
+	if input.DryRun {
+		return r.dryRun(spec, pod)
 	}
 
 	//2. execute the Action
-	npod, err := r.executeAction(spec, pod)
+	// In controller resize mode, the pod template of the controller is resized, and the
+	// action succeeds only after the rollout of the controller converges.
+	helper, err := r.getTemplateHelper(pod)
+	if err != nil {
+		glog.Errorf("failed to execute Action: %v", err)
+		return &TurboActionExecutorOutput{}, err
+	}
+	if helper != nil {
+		npod, err := r.executeControllerAction(helper, spec, pod, input.Progress)
+		if err != nil {
+			glog.Errorf("failed to execute Action: %v", err)
+			return &TurboActionExecutorOutput{}, err
+		}
+		original, resized := newResizedTemplateSpecs(helper, pod, spec)
+		output := &TurboActionExecutorOutput{Succeeded: true, OldController: original, NewController: resized}
+		if npod != nil {
+			// the controller doesn't roll out the template by itself, so only the pod is recreated with it
+			output.OldPod, output.NewPod = pod, npod
+			output.Note = fmt.Sprintf("only pod %s/%s is recreated as %s with the resized pod template of %s; "+
+				"the other pods keep the original resources until they are recreated", pod.Namespace, pod.Name, npod.Name, helper.fullName())
+		}
+		return output, nil
+	}
+
+	// record the original resources of the container before the pod is resized, to roll back the resize
+	if spec.Index >= len(pod.Spec.Containers) {
+		glog.Errorf("failed to execute Action: cannot find container[%d] in pod[%s/%s]", spec.Index, pod.Namespace, pod.Name)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorInvalidAction, nil, "cannot find container[%d] in pod %s/%s",
+			spec.Index, pod.Namespace, pod.Name)
+	}
+	original := pod.Spec.Containers[spec.Index].Resources.DeepCopy()
+
+	npod, err := r.executeAction(spec, pod, input.Progress)
 	if err != nil {
 		glog.Errorf("failed to execute Action: %v", err)
 		return &TurboActionExecutorOutput{}, err
 	}
 
-	//3. check action result
+	//3. check action result, and roll back the resize if the resized pod doesn't get running
 	fullName := util.BuildIdentifier(npod.Namespace, npod.Name)
 	glog.V(2).Infof("begin to check result of resizeContainer[%v].", fullName)
-	if err = r.checkPod(pod); err != nil {
+	if err = r.checkPod(npod); err != nil {
 		glog.Errorf("failed to check pod[%v] for resize action: %v", fullName, err)
-		return &TurboActionExecutorOutput{}, fmt.Errorf("Check Failed")
+		return &TurboActionExecutorOutput{}, rollbackResizedPod(r, npod, original, spec.Index,
+			NewActionError(ActionErrorVerificationFailed, err, "resized pod %s is not running", fullName), input.Progress)
 	}
 	glog.V(2).Infof("Checking action resizeContainer[%v] succeeded.", fullName)
 
@@ -276,11 +347,11 @@ func (r *ContainerResizer) Execute(input *TurboActionExecutorInput) (*TurboActio
 	}, nil
 }
 
-func (r *ContainerResizer) executeAction(resizeSpec *containerResizeSpec, pod *k8sapi.Pod) (*k8sapi.Pod, error) {
+func (r *ContainerResizer) executeAction(resizeSpec *containerResizeSpec, pod *k8sapi.Pod, progress *ActionProgress) (*k8sapi.Pod, error) {
 	//1. check
 	if err := r.preActionCheck(resizeSpec, pod); err != nil {
 		glog.Errorf("Resize action aborted: %v", err)
-		return nil, fmt.Errorf("Failed")
+		return nil, err
 	}
 
 	//2. get parent controller
@@ -288,33 +359,178 @@ func (r *ContainerResizer) executeAction(resizeSpec *containerResizeSpec, pod *k
 	parentKind, parentName, err := podutil.GetPodParentInfo(pod)
 	if err != nil {
 		glog.Errorf("Resize action failed: failed to get pod[%s] parent info: %v", fullName, err)
-		return nil, fmt.Errorf("Failed")
+		return nil, NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
 	}
 
 	if !util.SupportedParent(parentKind) {
 		glog.Errorf("Resize action aborted: parent kind(%v) is not supported.", parentKind)
-		return nil, fmt.Errorf("Unsupported")
+		return nil, NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported", parentKind, fullName)
 	}
 
 	var npod *k8sapi.Pod
 	if parentKind == "" {
-		npod, err = r.resizeBarePodContainer(pod, resizeSpec)
+		npod, err = r.resizeBarePodContainer(pod, resizeSpec, progress)
 	} else {
-		npod, err = r.resizeControllerContainer(pod, parentKind, parentName, resizeSpec)
+		npod, err = r.resizeControllerContainer(pod, parentKind, parentName, resizeSpec, progress)
 	}
 
 	if err != nil {
 		glog.Errorf("Resize Pod(%s) container action failed: %v", fullName, err)
-		return nil, fmt.Errorf("Failed")
+		// The refusal from PodDisruptionBudget is reported as it is, so it is not retried.
+		return nil, wrapActionError(err, ActionErrorAPIFailure, "failed to resize container[%d] of pod %s", resizeSpec.Index, fullName)
 	}
 	return npod, nil
 }
 
-func (r *ContainerResizer) resizeControllerContainer(pod *k8sapi.Pod, parentKind, parentName string, spec *containerResizeSpec) (*k8sapi.Pod, error) {
+// resize the container in the pod template of the pod's controller, and wait for the rollout.
+// Returns the pod recreated with the resized template if the controller doesn't roll out the template by itself.
+func (r *ContainerResizer) executeControllerAction(helper *templateHelper, resizeSpec *containerResizeSpec, pod *k8sapi.Pod,
+	progress *ActionProgress) (*k8sapi.Pod, error) {
+	//1. check
+	if err := r.preActionCheck(resizeSpec, pod); err != nil {
+		glog.Errorf("Resize action aborted: %v", err)
+		return nil, err
+	}
+
+	//2. update the template and wait for the rollout
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	glog.V(2).Infof("begin to resize container[%s-%d] in pod template of %s.", fullName, resizeSpec.Index, helper.fullName())
+	npod, err := resizeControllerTemplate(helper, pod, resizeSpec, r.usePodEviction, progress)
+	if err != nil {
+		glog.Errorf("Resize container[%s-%d] in pod template of %s failed: %v", fullName, resizeSpec.Index, helper.fullName(), err)
+		// The refusal from PodDisruptionBudget and the result of the rollback are reported as they are.
+		return nil, wrapActionError(err, ActionErrorAPIFailure, "failed to resize container[%d] in pod template of %s",
+			resizeSpec.Index, helper.fullName())
+	}
+
+	return npod, nil
+}
+
+// build the container resize without executing it, and submit the changes with server-side dry-run:
+// the resized clone pod in pod resize mode, or the resized pod template in controller resize mode.
+func (r *ContainerResizer) dryRun(resizeSpec *containerResizeSpec, pod *k8sapi.Pod) (*TurboActionExecutorOutput, error) {
+	if err := r.preActionCheck(resizeSpec, pod); err != nil {
+		glog.Errorf("Resize action aborted: %v", err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	if resizeSpec.Index >= len(pod.Spec.Containers) {
+		glog.Errorf("Resize action aborted: cannot find container[%d] in pod[%s]", resizeSpec.Index, fullName)
+		return &TurboActionExecutorOutput{}, NewActionError(ActionErrorInvalidAction, nil, "cannot find container[%d] in pod %s",
+			resizeSpec.Index, fullName)
+	}
+
+	tHelper, err := r.getTemplateHelper(pod)
+	if err != nil {
+		glog.Errorf("Resize action aborted: %v", err)
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	helper := newDryRunHelper(r.kubeClient)
+	if tHelper != nil {
+		err = r.dryRunControllerTemplate(helper, tHelper, resizeSpec, pod)
+	} else {
+		err = r.dryRunClonePod(helper, resizeSpec, pod)
+	}
+	if err != nil {
+		return &TurboActionExecutorOutput{}, err
+	}
+
+	glog.V(2).Infof("Dry run of resizing container[%s-%d] succeeded: %s", fullName, resizeSpec.Index, helper.diff())
+	return helper.output(), nil
+}
+
+// dry run of resizing the container in the pod template of the pod's controller.
+func (r *ContainerResizer) dryRunControllerTemplate(helper *dryRunHelper, tHelper *templateHelper, resizeSpec *containerResizeSpec,
+	pod *k8sapi.Pod) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	container := &pod.Spec.Containers[resizeSpec.Index]
+	ncontainer := container.DeepCopy()
+	if _, err := updateContainerResourceAmount(ncontainer, resizeSpec, fullName); err != nil {
+		return NewActionError(ActionErrorInvalidAction, err, "cannot resize container %s of pod %s", container.Name, fullName)
+	}
+	for _, change := range containerResourceDiff(container, ncontainer) {
+		helper.addChange("pod template of %s, container %s: %s", tHelper.fullName(), container.Name, change)
+	}
+
+	if _, _, err := tHelper.updateTemplate(r.kubeClient, pod.Namespace, tHelper.controllerName, container.Name, resizeSpec, helper); err != nil {
+		glog.Errorf("Dry run of resizing pod template of %s failed: %v", tHelper.fullName(), err)
+		return wrapActionError(err, ActionErrorAPIFailure, "dry run of resizing pod template of %s failed", tHelper.fullName())
+	}
+	return nil
+}
+
+// dry run of creating the resized clone pod of the pod.
+func (r *ContainerResizer) dryRunClonePod(helper *dryRunHelper, resizeSpec *containerResizeSpec, pod *k8sapi.Pod) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	parentKind, _, err := podutil.GetPodParentInfo(pod)
+	if err != nil {
+		glog.Errorf("Resize action failed: failed to get pod[%s] parent info: %v", fullName, err)
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get parent info of pod %s", fullName)
+	}
+	if !util.SupportedParent(parentKind) {
+		glog.Errorf("Resize action aborted: parent kind(%v) is not supported.", parentKind)
+		return NewActionError(ActionErrorUnsupportedParent, nil, "parent kind %s of pod %s is not supported", parentKind, fullName)
+	}
+
+	npod, changed, err := buildResizePod(pod, resizeSpec)
+	if err != nil {
+		return NewActionError(ActionErrorInvalidAction, err, "cannot build resized pod of %s", fullName)
+	}
+	if !changed {
+		return NewActionError(ActionErrorNoChange, nil, "no need to resize container[%d] of pod %s", resizeSpec.Index, fullName)
+	}
+
+	container := &pod.Spec.Containers[resizeSpec.Index]
+	for _, change := range containerResourceDiff(container, &npod.Spec.Containers[resizeSpec.Index]) {
+		helper.addChange("pod %s, container %s: %s", fullName, container.Name, change)
+	}
+	helper.addChange("clone pod %s is created, and pod %s is deleted", util.BuildIdentifier(npod.Namespace, npod.Name), fullName)
+
+	if err = helper.create(r.kubeClient.CoreV1().RESTClient(), pod.Namespace, "pods", npod); err != nil {
+		glog.Errorf("Dry run of creating resized pod for %s failed: %v", fullName, err)
+		return wrapActionError(err, ActionErrorAPIFailure, "dry run of creating resized pod of %s failed", fullName)
+	}
+	return nil
+}
+
+// get the helper to resize the pod template of the controller owning the pod template of the pod in controller
+// resize mode, e.g., Deployment for the pods of ReplicaSet.
+// nil is returned in pod resize mode, for the bare pods, and for the pods of the controllers whose pod template
+// can't be resized, e.g., ReplicationController; these pods are resized by creating a resized clone pod.
+func (r *ContainerResizer) getTemplateHelper(pod *k8sapi.Pod) (*templateHelper, error) {
+	if r.resizeMode != ContainerResizeModeController || !isControllerPod(pod) {
+		return nil, nil
+	}
+
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	kind, name, err := podutil.GetPodGrandInfo(r.kubeClient, pod)
+	if err != nil {
+		glog.Errorf("Resize action failed: failed to get pod[%s] controller info: %v", fullName, err)
+		return nil, NewActionError(ActionErrorAPIFailure, err, "cannot get controller info of pod %s", fullName)
+	}
+
+	helper := NewTemplateHelper(r.kubeClient, pod.Namespace)
+	if err = helper.SetController(kind, name); err != nil {
+		glog.V(2).Infof("Pod template of %s is not resizable, resizing pod %s by cloning it.", kind, fullName)
+		return nil, nil
+	}
+	return helper, nil
+}
+
+// check whether the pod is owned by a controller
+func isControllerPod(pod *k8sapi.Pod) bool {
+	kind, _, err := podutil.GetPodParentInfo(pod)
+	return err == nil && kind != ""
+}
+
+func (r *ContainerResizer) resizeControllerContainer(pod *k8sapi.Pod, parentKind, parentName string, spec *containerResizeSpec,
+	progress *ActionProgress) (*k8sapi.Pod, error) {
 	id := fmt.Sprintf("%s/%s-%d", pod.Namespace, pod.Name, spec.Index)
 	glog.V(2).Infof("begin to resizeContainer[%s] parent=%s/%s.", id, parentKind, parentName)
 
-	npod, err := resizeContainer(r.kubeClient, pod, spec, defaultRetryMore)
+	npod, err := resizeContainer(r.kubeClient, pod, spec, defaultRetryMore, r.usePodEviction, r.journal, progress)
 	if err != nil {
 		glog.Errorf("Resize contorller container(%v) failed: %v", id, err)
 	}
@@ -322,11 +538,11 @@ func (r *ContainerResizer) resizeControllerContainer(pod *k8sapi.Pod, parentKind
 	return npod, err
 }
 
-func (r *ContainerResizer) resizeBarePodContainer(pod *k8sapi.Pod, spec *containerResizeSpec) (*k8sapi.Pod, error) {
+func (r *ContainerResizer) resizeBarePodContainer(pod *k8sapi.Pod, spec *containerResizeSpec, progress *ActionProgress) (*k8sapi.Pod, error) {
 	id := fmt.Sprintf("%s/%s-%d", pod.Namespace, pod.Name, spec.Index)
 	glog.V(2).Infof("begin to resize barePod Container[%s].", id)
 
-	npod, err := resizeContainer(r.kubeClient, pod, spec, defaultRetryMore)
+	npod, err := resizeContainer(r.kubeClient, pod, spec, defaultRetryMore, r.usePodEviction, r.journal, progress)
 	if err != nil {
 		glog.Errorf("Resize contorller container(%s) failed: %v", id, err)
 	}
@@ -375,14 +591,14 @@ func (r *ContainerResizer) preActionCheck(resizeSpec *containerResizeSpec, pod *
 
 	// Check if the pod privilege is supported
 	if !util.SupportPrivilegePod(pod, r.sccAllowedSet) {
-		err := fmt.Errorf("Pod %s has unsupported SCC", fullName)
+		err := NewActionError(ActionErrorSCCDenied, nil, "pod %s has unsupported SCC", fullName)
 		glog.Error(err)
 		return err
 	}
 
 	// Check if the resize spec is empty
 	if len(resizeSpec.NewCapacity) < 1 && len(resizeSpec.NewRequest) < 1 {
-		err := fmt.Errorf("Resize specification is empty.")
+		err := NewActionError(ActionErrorInvalidAction, nil, "resize specification is empty")
 		glog.Error(err)
 		return err
 	}
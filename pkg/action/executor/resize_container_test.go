@@ -2,6 +2,7 @@ package executor
 
 import (
 	"fmt"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
 	k8sapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
@@ -254,3 +255,53 @@ func TestSetZeroRequestCPUMemory2(t *testing.T) {
 		fmt.Printf("rtype=%v, v=%++v", rtypeCPU, v)
 	}
 }
+
+func TestRollbackError(t *testing.T) {
+	err := NewRollbackError(fmt.Errorf("Check Failed"), nil)
+	if !err.RolledBack() || !IsRollbackError(err) {
+		t.Errorf("Expect a rolled back RollbackError: %v", err)
+	}
+	if msg := err.Error(); msg != "Check Failed; rolled back to the original configuration" {
+		t.Errorf("Unexpected error message: %s", msg)
+	}
+
+	err = NewRollbackError(fmt.Errorf("Check Failed"), fmt.Errorf("timeout"))
+	if err.RolledBack() {
+		t.Errorf("Expect a failed rollback: %v", err)
+	}
+	if msg := err.Error(); msg != "Check Failed; rollback failed: timeout" {
+		t.Errorf("Unexpected error message: %s", msg)
+	}
+
+	if IsRollbackError(fmt.Errorf("Failed")) {
+		t.Errorf("Unexpected RollbackError")
+	}
+}
+
+func TestBuildResourceListStorageAndExtendedResources(t *testing.T) {
+	gpu := k8sapi.ResourceName("nvidia.com/gpu")
+	resizer := &ContainerResizer{}
+	pod := createPod()
+	result := make(k8sapi.ResourceList)
+
+	if err := resizer.buildResourceList(pod, proto.CommodityDTO_PROCESSING_UNITS, 1, result); err == nil {
+		t.Errorf("expect an error for the commodity without extended resource")
+	}
+
+	resizer.WithExtendedResources(map[proto.CommodityDTO_CommodityType]k8sapi.ResourceName{
+		proto.CommodityDTO_PROCESSING_UNITS: gpu,
+	})
+	if err := resizer.buildResourceList(pod, proto.CommodityDTO_PROCESSING_UNITS, 2, result); err != nil {
+		t.Errorf("failed to build the extended resource: %v", err)
+	}
+	if err := resizer.buildResourceList(pod, proto.CommodityDTO_VSTORAGE, 2048, result); err != nil {
+		t.Errorf("failed to build the ephemeral-storage: %v", err)
+	}
+
+	if q := result[gpu]; q.Value() != 2 {
+		t.Errorf("unexpected gpu: %v", q.String())
+	}
+	if q := result[k8sapi.ResourceEphemeralStorage]; q.String() != "2Gi" {
+		t.Errorf("unexpected ephemeral-storage: %v", q.String())
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"math"
+	"strings"
 
 	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
 	k8sapi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -67,7 +69,9 @@ func updateCapacity(container *k8sapi.Container, patchCapacity k8sapi.ResourceLi
 	return true, nil
 }
 
-// make sure that the Request.Value is not bigger than the Limit.Value
+// make sure that the Request.Value is not bigger than the Limit.Value, for all the resources including
+// ephemeral-storage, and that the Request.Value equals the Limit.Value for the extended resources,
+// which can not be overcommitted.
 // Note: It is certain that OpsMgr will make sure reservation is less than capacity.
 func checkLimitsRequests(container *k8sapi.Container) error {
 	if container.Resources.Limits == nil || container.Resources.Requests == nil {
@@ -88,11 +92,43 @@ func checkLimitsRequests(container *k8sapi.Container) error {
 			glog.Errorf(err.Error())
 			return err
 		}
+
+		if isExtendedResourceName(k) && rv.Cmp(v) != 0 {
+			err := fmt.Errorf("Requested extended resource is not equal to limits: %v %v Vs. %v", k.String(), v.String(), rv.String())
+			glog.Error(err)
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Checks whether the resource is an extended resource, e.g., nvidia.com/gpu: a resource name with a domain
+// out of kubernetes.io, and not prefixed by "requests.".
+func isExtendedResourceName(name k8sapi.ResourceName) bool {
+	s := string(name)
+	if !strings.Contains(s, "/") || strings.HasPrefix(s, "requests.") {
+		return false
+	}
+	domain := s[:strings.Index(s, "/")]
+	return domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io")
+}
+
+// The requests of the extended resources must equal their limits, so that the resize of either one of
+// the request and the limit of an extended resource resizes both.
+func alignExtendedResources(spec *containerResizeSpec) {
+	for k, v := range spec.NewCapacity {
+		if _, exist := spec.NewRequest[k]; !exist && isExtendedResourceName(k) {
+			spec.NewRequest[k] = v
+		}
+	}
+	for k, v := range spec.NewRequest {
+		if _, exist := spec.NewCapacity[k]; !exist && isExtendedResourceName(k) {
+			spec.NewCapacity[k] = v
+		}
+	}
+}
+
 func updateResourceAmount(pod *k8sapi.Pod, spec *containerResizeSpec) (bool, error) {
 	index := spec.Index
 	fullName := fmt.Sprintf("%s/%s-%d", pod.Namespace, pod.Name, index)
@@ -106,6 +142,21 @@ func updateResourceAmount(pod *k8sapi.Pod, spec *containerResizeSpec) (bool, err
 	}
 	container := &(pod.Spec.Containers[index])
 
+	return updateContainerResourceAmount(container, spec, fullName)
+}
+
+// update the container's resources Limits and Requests by the resize spec.
+func updateContainerResourceAmount(container *k8sapi.Container, spec *containerResizeSpec, fullName string) (bool, error) {
+	//1. replace the resources as a whole if specified
+	if spec.Resources != nil {
+		ncontainer := container.DeepCopy()
+		ncontainer.Resources = *spec.Resources.DeepCopy()
+		changed := len(containerResourceDiff(container, ncontainer)) > 0
+		container.Resources = ncontainer.Resources
+		glog.V(4).Infof("Replaced resources of container %v: changed=%v", fullName, changed)
+		return changed, nil
+	}
+
 	//2. update Limits
 	flag := false
 	if spec.NewCapacity != nil && len(spec.NewCapacity) > 0 {
@@ -175,11 +226,60 @@ func genMemoryQuantity(newValue float64) (resource.Quantity, error) {
 	return result, nil
 }
 
+// generate a resource.Quantity for ephemeral-storage
+// @newValue is from OpsMgr, in MB of 1024*1024 bytes, i.e., in Mi as discovered
+func genStorageQuantity(newValue float64) (resource.Quantity, error) {
+	tmp := int64(math.Ceil(newValue))
+	if tmp < 1 {
+		tmp = 1
+	}
+	result, err := resource.ParseQuantity(fmt.Sprintf("%dMi", tmp))
+	if err != nil {
+		glog.Errorf("failed to generate ephemeral-storage quantity: %v", err)
+		return result, err
+	}
+
+	return result, nil
+}
+
+// generate a resource.Quantity for an extended resource, which is an integer count
+func genExtendedResourceQuantity(newValue float64) resource.Quantity {
+	count := int64(math.Ceil(newValue - epsilon))
+	if count < 0 {
+		count = 0
+	}
+	return *resource.NewQuantity(count, resource.DecimalSI)
+}
+
+// ParseExtendedResources parses the extended resources resized by the commodities of the types,
+// in COMMODITY_TYPE=resource-name, e.g., PROCESSING_UNITS=nvidia.com/gpu.
+func ParseExtendedResources(specs []string) (map[proto.CommodityDTO_CommodityType]k8sapi.ResourceName, error) {
+	resources := make(map[proto.CommodityDTO_CommodityType]k8sapi.ResourceName)
+	for _, spec := range specs {
+		parts := strings.SplitN(strings.TrimSpace(spec), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid extended resource %q: should be COMMODITY_TYPE=resource-name", spec)
+		}
+		ctype, exist := proto.CommodityDTO_CommodityType_value[strings.ToUpper(parts[0])]
+		if !exist {
+			return nil, fmt.Errorf("invalid extended resource %q: unknown commodity type %s", spec, parts[0])
+		}
+		name := k8sapi.ResourceName(parts[1])
+		if !isExtendedResourceName(name) {
+			return nil, fmt.Errorf("invalid extended resource %q: %s is not an extended resource name", spec, name)
+		}
+		resources[proto.CommodityDTO_CommodityType(ctype)] = name
+	}
+	return resources, nil
+}
+
 // Resize pod in three steps:
 //   step1: create a clone pod of the original pod (without labels), with new resource limits/requests;
-//   step2: delete the orginal pod;
+//   step2: delete the orginal pod; if evict is true, the pod is evicted honoring its PodDisruptionBudgets;
 //   step3: add the labels to the cloned pod;
-func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containerResizeSpec, retryNum int) (*k8sapi.Pod, error) {
+// The steps are recorded in the journal, so that the resize can be completed or reverted if kubeturbo restarts.
+func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containerResizeSpec, retryNum int, evict bool,
+	journal *ActionJournal, progress *ActionProgress) (*k8sapi.Pod, error) {
 	index := spec.Index
 	id := fmt.Sprintf("%s/%s-%d", tpod.Namespace, tpod.Name, index)
 	glog.V(2).Infof("begin to resize Pod container[%s].", id)
@@ -200,8 +300,12 @@ func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containe
 	}
 	labels := pod.Labels
 
+	entry := newPodJournalEntry(JournalActionResize, pod)
+	journal.Start(entry)
+	defer journal.Finish(entry)
+
 	// 1. create a clone pod
-	npod, changed, err := createResizePod(client, pod, spec)
+	npod, changed, err := createResizePod(client, pod, spec, journal, entry)
 	if err != nil {
 		glog.Errorf("resizeContainer failed[%s]: failed to create a resized pod: %v", id, err)
 		return nil, err
@@ -209,8 +313,9 @@ func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containe
 
 	if !changed {
 		glog.Warningf("resizeContainer aborted[%s]: no need do resize container.", id)
-		return nil, fmt.Errorf("Aborted due to not enough change")
+		return nil, NewActionError(ActionErrorNoChange, nil, "no need to resize container %s", id)
 	}
+	progress.Update(progressCloneCreated, "Resized clone pod %s created", npod.Name)
 	//delete the clone pod if this action fails
 	flag := false
 	defer func() {
@@ -225,14 +330,21 @@ func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containe
 	err = waitForReady(client, npod.Namespace, npod.Name, "", retryNum)
 	if err != nil {
 		glog.Errorf("Wait for cloned Pod ready timeout: %v", err)
-		return nil, err
+		return nil, NewActionError(ActionErrorCloneNotReady, err, "resized clone pod %s/%s is not ready", npod.Namespace, npod.Name)
 	}
+	progress.Update(progressCloneReady, "Resized clone pod %s is ready", npod.Name)
 
 	//2. delete the original pod--podA
-	delOpt := &metav1.DeleteOptions{}
-	if err := podClient.Delete(pod.Name, delOpt); err != nil {
+	if err := deletePod(client, pod, evict); err != nil {
+		// The cloned pod will be deleted if the eviction is refused by PodDisruptionBudget.
+		if IsPodDisruptionBudgetError(err) {
+			glog.Errorf("Resize podContainer failed: failed to evict original pod: %v", err)
+			return nil, err
+		}
 		glog.Warningf("Resize podContainer warning: failed to delete original pod: %v", err)
 	}
+	journal.Record(entry, journalStepOriginalDeleted)
+	progress.Update(progressOriginalDeleted, "Original pod %s deleted", pod.Name)
 
 	//3. add labels to podC
 	xpod, err := podClient.Get(npod.Name, metav1.GetOptions{})
@@ -249,14 +361,15 @@ func resizeContainer(client *kclient.Clientset, tpod *k8sapi.Pod, spec *containe
 			return nil, err
 		}
 	}
+	progress.Update(progressLabelsRestored, "Labels restored to pod %s", xpod.Name)
 
 	flag = true
 	return xpod, nil
 }
 
-// create a pod with new resource limit/requests
+// build a clone pod (without labels) with new resource limit/requests
 //    return false if there is no need to update resource amount
-func createResizePod(client *kclient.Clientset, pod *k8sapi.Pod, spec *containerResizeSpec) (*k8sapi.Pod, bool, error) {
+func buildResizePod(pod *k8sapi.Pod, spec *containerResizeSpec) (*k8sapi.Pod, bool, error) {
 	id := fmt.Sprintf("%s/%s-%d", pod.Namespace, pod.Name, spec.Index)
 
 	//1. copy pod
@@ -276,6 +389,22 @@ func createResizePod(client *kclient.Clientset, pod *k8sapi.Pod, spec *container
 		return nil, false, nil
 	}
 
+	return npod, true, nil
+}
+
+// create a pod with new resource limit/requests
+//    return false if there is no need to update resource amount
+// The name of the resized pod is recorded in the journal entry before it is created.
+func createResizePod(client *kclient.Clientset, pod *k8sapi.Pod, spec *containerResizeSpec, journal *ActionJournal,
+	entry *JournalEntry) (*k8sapi.Pod, bool, error) {
+	//1-2. build the resized pod
+	npod, changed, err := buildResizePod(pod, spec)
+	if err != nil || !changed {
+		return nil, changed, err
+	}
+	entry.ClonePodName = npod.Name
+	journal.Record(entry, journalStepCloneCreating)
+
 	//3. create pod
 	podClient := client.CoreV1().Pods(pod.Namespace)
 	rpod, err := podClient.Create(npod)
@@ -3,6 +3,7 @@ package executor
 import (
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
 	k8sapi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"testing"
@@ -150,3 +151,134 @@ func TestUpdateCapacity(t *testing.T) {
 	//printResourceList(container.Resources.Limits)
 	//printResourceList(container.Resources.Requests)
 }
+
+func TestUpdateContainerResourceAmountWithResources(t *testing.T) {
+	container := &k8sapi.Container{Name: "hello"}
+	setContainerResourceLimit(container, 300, 410)
+	original := container.Resources.DeepCopy()
+
+	spec := NewContainerResizeSpec(0)
+	patch, err := generateResourceList(250, 500)
+	if err != nil {
+		t.Errorf("unable to test: %v", err)
+	}
+	spec.NewCapacity = patch
+	spec.NewRequest = k8sapi.ResourceList{k8sapi.ResourceCPU: resource.MustParse("100m")}
+	if _, err := updateContainerResourceAmount(container, spec, "ns/pod-0"); err != nil {
+		t.Errorf("Failed to resize container: %v", err)
+	}
+
+	// the requests added by the resize are removed by the rollback
+	changed, err := updateContainerResourceAmount(container, newRollbackSpec(0, original), "ns/pod-0")
+	if err != nil || !changed {
+		t.Errorf("Failed to roll back container: changed=%v, err=%v", changed, err)
+	}
+	if err := compareResourceList(container.Resources.Limits, 300, 410); err != nil {
+		t.Error(err)
+	}
+	if len(container.Resources.Requests) != 0 {
+		t.Errorf("Requests are not rolled back: %v", container.Resources.Requests)
+	}
+
+	changed, err = updateContainerResourceAmount(container, newRollbackSpec(0, original), "ns/pod-0")
+	if err != nil || changed {
+		t.Errorf("Unexpected change of the rolled back container: changed=%v, err=%v", changed, err)
+	}
+}
+
+func TestGenStorageQuantity(t *testing.T) {
+	inputArray := []float64{0, 1, 1024, 1500.5}
+	expectArray := []int64{1024 * 1024, 1024 * 1024, 1024 * 1024 * 1024, 1501 * 1024 * 1024}
+
+	for i, input := range inputArray {
+		q, err := genStorageQuantity(input)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if rq := q.Value(); rq != expectArray[i] {
+			t.Errorf("failed: %d Vs. %d", rq, expectArray[i])
+		}
+	}
+}
+
+func TestGenExtendedResourceQuantity(t *testing.T) {
+	inputArray := []float64{0, 1, 1.0001, 1.5, 2}
+	expectArray := []int64{0, 1, 1, 2, 2}
+
+	for i, input := range inputArray {
+		q := genExtendedResourceQuantity(input)
+		if rq := q.Value(); rq != expectArray[i] {
+			t.Errorf("failed for %v: %d Vs. %d", input, rq, expectArray[i])
+		}
+	}
+}
+
+func TestParseExtendedResources(t *testing.T) {
+	resources, err := ParseExtendedResources([]string{"PROCESSING_UNITS=nvidia.com/gpu", " license_commodity=example.com/license"})
+	if err != nil {
+		t.Fatalf("failed to parse extended resources: %v", err)
+	}
+	if len(resources) != 2 || resources[proto.CommodityDTO_PROCESSING_UNITS] != "nvidia.com/gpu" ||
+		resources[proto.CommodityDTO_LICENSE_COMMODITY] != "example.com/license" {
+		t.Errorf("unexpected extended resources: %v", resources)
+	}
+
+	for _, spec := range []string{"nvidia.com/gpu", "NO_SUCH_COMMODITY=nvidia.com/gpu", "PROCESSING_UNITS=cpu",
+		"PROCESSING_UNITS=kubernetes.io/gpu"} {
+		if _, err := ParseExtendedResources([]string{spec}); err == nil {
+			t.Errorf("expect an error for %q", spec)
+		}
+	}
+}
+
+func TestCheckLimitsRequestsExtendedResources(t *testing.T) {
+	gpu := k8sapi.ResourceName("nvidia.com/gpu")
+	container := &k8sapi.Container{
+		Resources: k8sapi.ResourceRequirements{
+			Limits: k8sapi.ResourceList{
+				gpu:                             resource.MustParse("2"),
+				k8sapi.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+			},
+			Requests: k8sapi.ResourceList{
+				gpu:                             resource.MustParse("2"),
+				k8sapi.ResourceEphemeralStorage: resource.MustParse("512Mi"),
+			},
+		},
+	}
+	if err := checkLimitsRequests(container); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	container.Resources.Requests[k8sapi.ResourceEphemeralStorage] = resource.MustParse("2Gi")
+	if err := checkLimitsRequests(container); err == nil {
+		t.Errorf("expect an error for the ephemeral-storage request larger than limit")
+	}
+
+	container.Resources.Requests[k8sapi.ResourceEphemeralStorage] = resource.MustParse("512Mi")
+	container.Resources.Requests[gpu] = resource.MustParse("1")
+	if err := checkLimitsRequests(container); err == nil {
+		t.Errorf("expect an error for the extended resource request not equal to limit")
+	}
+}
+
+func TestAlignExtendedResources(t *testing.T) {
+	gpu := k8sapi.ResourceName("nvidia.com/gpu")
+	fpga := k8sapi.ResourceName("example.com/fpga")
+	spec := NewContainerResizeSpec(0)
+	spec.NewCapacity[gpu] = resource.MustParse("2")
+	spec.NewCapacity[k8sapi.ResourceEphemeralStorage] = resource.MustParse("1Gi")
+	spec.NewRequest[fpga] = resource.MustParse("1")
+
+	alignExtendedResources(spec)
+
+	if q := spec.NewRequest[gpu]; q.Value() != 2 {
+		t.Errorf("expect the gpu request to follow the limit, but got %v", q.String())
+	}
+	if q := spec.NewCapacity[fpga]; q.Value() != 1 {
+		t.Errorf("expect the fpga limit to follow the request, but got %v", q.String())
+	}
+	if _, exist := spec.NewRequest[k8sapi.ResourceEphemeralStorage]; exist {
+		t.Errorf("expect the ephemeral-storage request not to follow the limit")
+	}
+}
@@ -0,0 +1,542 @@
+package executor
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"strings"
+	"time"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	k8sapi "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "k8s.io/client-go/kubernetes"
+
+	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+)
+
+const (
+	// The container resize modes for the pods owned by controllers:
+	//  pod: create a resized clone of the pod, and delete the original one;
+	//  controller: update the pod template of the controller, and roll it out by the controller.
+	ContainerResizeModePod        = "pod"
+	ContainerResizeModeController = "controller"
+
+	// the reason of Deployment Progressing condition when the progress deadline is exceeded
+	deploymentTimedOutReason = "ProgressDeadlineExceeded"
+)
+
+// update the resources of the container in the pod template of the controller.
+// return true if the controller rolls out the updated template automatically; otherwise,
+// the pods have to be recreated to pick up the updated template.
+// The original resources of the container in the template are returned as well, to roll back the update.
+// If dryRun is not nil, the update is submitted with server-side dry-run only.
+type updateTemplateFunc func(client *kclient.Clientset, namespace, name, containerName string, spec *containerResizeSpec, dryRun *dryRunHelper) (bool, *k8sapi.ResourceRequirements, error)
+
+// check whether the rollout of the controller is finished.
+// return (retry, error)
+type checkRolloutFunc func(client *kclient.Clientset, namespace, name string) (bool, error)
+
+type templateHelper struct {
+	client    *kclient.Clientset
+	nameSpace string
+
+	//controller's kind: ReplicaSet/Deployment/StatefulSet/DaemonSet
+	kind string
+	//controller's name
+	controllerName string
+
+	updateTemplate updateTemplateFunc
+	checkRollout   checkRolloutFunc
+}
+
+func NewTemplateHelper(client *kclient.Clientset, nameSpace string) *templateHelper {
+	return &templateHelper{
+		client:    client,
+		nameSpace: nameSpace,
+	}
+}
+
+func (helper *templateHelper) SetController(kind, name string) error {
+	helper.kind = kind
+	helper.controllerName = name
+
+	switch kind {
+	case goutil.KindReplicaSet:
+		helper.updateTemplate = updateRSTemplate
+		helper.checkRollout = checkRSRollout
+	case goutil.KindDeployment:
+		helper.updateTemplate = updateDeploymentTemplate
+		helper.checkRollout = checkDeploymentRollout
+	case goutil.KindStatefulSet:
+		helper.updateTemplate = updateStatefulSetTemplate
+		helper.checkRollout = checkStatefulSetRollout
+	case goutil.KindDaemonSet:
+		helper.updateTemplate = updateDaemonSetTemplate
+		helper.checkRollout = checkDaemonSetRollout
+	default:
+		err := fmt.Errorf("Unsupport ControllerType[%s] for resizing pod template.", kind)
+		glog.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (helper *templateHelper) fullName() string {
+	return fmt.Sprintf("%s-%s/%s", helper.kind, helper.nameSpace, helper.controllerName)
+}
+
+// Resize the container of the pods in three steps:
+//   step1: update the resources of the container in the controller's pod template;
+//   step2: if the controller doesn't roll out the template by itself, delete the pod to be recreated by the controller,
+//          and wait until the recreated pod is ready with the resized container;
+//   step3: wait until the rollout of the controller converges; if it doesn't, the pod template is rolled back.
+// Returns the recreated pod if the controller doesn't roll out the template by itself; the other pods of the
+// controller keep the original resources until they are recreated. Otherwise, nil is returned.
+func resizeControllerTemplate(helper *templateHelper, pod *k8sapi.Pod, spec *containerResizeSpec, evict bool, progress *ActionProgress) (*k8sapi.Pod, error) {
+	fullName := helper.fullName()
+	if spec.Index >= len(pod.Spec.Containers) {
+		err := fmt.Errorf("Cannot find container[%d] in pod[%s]", spec.Index, pod.Name)
+		glog.Error(err)
+		return nil, err
+	}
+	containerName := pod.Spec.Containers[spec.Index].Name
+
+	//1. update the pod template
+	autoRollout, original, err := helper.updateTemplate(helper.client, helper.nameSpace, helper.controllerName, containerName, spec, nil)
+	if err != nil {
+		glog.Errorf("Failed to update pod template of %s: %v", fullName, err)
+		return nil, err
+	}
+	glog.V(2).Infof("Updated container %s in pod template of %s.", containerName, fullName)
+	progress.Update(progressTemplateUpdated, "Container %s updated in pod template of %s", containerName, fullName)
+
+	//2. recreate the pod if needed, and wait until the recreated pod is ready with the resized container
+	var npod *k8sapi.Pod
+	if !autoRollout {
+		glog.V(2).Infof("%s doesn't roll out pod template automatically; recreating pod %s/%s.", fullName, pod.Namespace, pod.Name)
+		existing, err := recreateControllerPod(helper.client, pod, evict)
+		if err != nil {
+			return nil, err
+		}
+		progress.Update(progressPodDeleted, "Pod %s deleted to be recreated by %s", pod.Name, fullName)
+
+		container := pod.Spec.Containers[spec.Index].DeepCopy()
+		if _, err := updateContainerResourceAmount(container, spec, fullName); err != nil {
+			return nil, err
+		}
+		if npod, err = waitForRecreatedPod(helper.client, pod, existing, container, defaultRetryRollout); err != nil {
+			return nil, rollbackControllerTemplate(helper, containerName, original, spec.Index,
+				NewActionError(ActionErrorVerificationFailed, err, "pod %s/%s is not recreated by %s", pod.Namespace, pod.Name, fullName), progress)
+		}
+		glog.V(2).Infof("Pod %s/%s is recreated by %s as pod %s.", pod.Namespace, pod.Name, fullName, npod.Name)
+	}
+
+	//3. wait for the rollout, and roll back the pod template if the rollout doesn't converge
+	progress.Update(progressTemplateUpdated, "Waiting for the rollout of %s", fullName)
+	if err := helper.waitForRollout(); err != nil {
+		return nil, rollbackControllerTemplate(helper, containerName, original, spec.Index,
+			NewActionError(ActionErrorVerificationFailed, err, "rollout of %s failed", fullName), progress)
+	}
+	progress.Update(progressRolloutFinished, "Rollout of %s finished", fullName)
+	return npod, nil
+}
+
+// Deletes the pod to be recreated by its controller with the updated pod template.
+// Returns the uids of the pods of the controller before the deletion, which are not the recreated pod.
+func recreateControllerPod(client *kclient.Clientset, pod *k8sapi.Pod, evict bool) (map[types.UID]bool, error) {
+	existing, err := listControllerPodUIDs(client, pod)
+	if err != nil {
+		glog.Errorf("Failed to list the pods of the controller of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return nil, err
+	}
+	if err := deletePod(client, pod, evict); err != nil {
+		glog.Errorf("Failed to delete pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return nil, err
+	}
+	if _, err := waitForPodDeleted(client, pod, defaultRetryLess); err != nil {
+		glog.Errorf("Failed to wait for pod %s/%s to be deleted: %v", pod.Namespace, pod.Name, err)
+		return nil, err
+	}
+	return existing, nil
+}
+
+// list the uids of the pods owned by the controller of the pod
+func listControllerPodUIDs(client *kclient.Clientset, pod *k8sapi.Pod) (map[types.UID]bool, error) {
+	podList, err := client.CoreV1().Pods(pod.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	owner := metav1.GetControllerOf(pod)
+	uids := make(map[types.UID]bool)
+	for i := range podList.Items {
+		if o := metav1.GetControllerOf(&podList.Items[i]); o != nil && owner != nil && o.UID == owner.UID {
+			uids[podList.Items[i].UID] = true
+		}
+	}
+	return uids, nil
+}
+
+// Waits until the controller of the deleted pod recreates it, and the recreated pod is ready.
+// An error is returned without retrying if the recreated pod doesn't have the resized container.
+func waitForRecreatedPod(client *kclient.Clientset, pod *k8sapi.Pod, existing map[types.UID]bool, container *k8sapi.Container,
+	retryNum int) (*k8sapi.Pod, error) {
+	var npod *k8sapi.Pod
+	interval := defaultRolloutCheckSleep
+	timeout := time.Duration(retryNum+1) * interval
+	err := goutil.RetrySimple(retryNum, timeout, interval, func() (bool, error) {
+		podList, err := client.CoreV1().Pods(pod.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return true, err
+		}
+		npod = findRecreatedPod(podList.Items, pod, existing)
+		if npod == nil {
+			return true, fmt.Errorf("waiting for pod %s/%s to be recreated", pod.Namespace, pod.Name)
+		}
+		return checkRecreatedPod(npod, container)
+	})
+	return npod, err
+}
+
+// find the pod of the controller of the pod which is not one of the existing pods, nor being deleted
+func findRecreatedPod(pods []k8sapi.Pod, pod *k8sapi.Pod, existing map[types.UID]bool) *k8sapi.Pod {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+	for i := range pods {
+		p := &pods[i]
+		if o := metav1.GetControllerOf(p); o == nil || o.UID != owner.UID || existing[p.UID] || p.DeletionTimestamp != nil {
+			continue
+		}
+		return p
+	}
+	return nil
+}
+
+// Checks that the recreated pod has the resized container, and it is ready.
+// return (retry, error)
+func checkRecreatedPod(npod *k8sapi.Pod, container *k8sapi.Container) (bool, error) {
+	for i := range npod.Spec.Containers {
+		c := &npod.Spec.Containers[i]
+		if c.Name != container.Name {
+			continue
+		}
+		if diff := containerResourceDiff(container, c); len(diff) > 0 {
+			return false, fmt.Errorf("container %s of recreated pod %s/%s is not resized: %s", c.Name, npod.Namespace, npod.Name,
+				strings.Join(diff, ", "))
+		}
+		if !podutil.PodIsReady(npod) {
+			return true, fmt.Errorf("recreated pod %s/%s is not ready yet", npod.Namespace, npod.Name)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot find container %s in recreated pod %s/%s", container.Name, npod.Namespace, npod.Name)
+}
+
+// get the resized container in the pod template of the controller before and after the resize of the pod
+func newResizedTemplateSpecs(helper *templateHelper, pod *k8sapi.Pod, spec *containerResizeSpec) (*ControllerSpec, *ControllerSpec) {
+	original := pod.Spec.Containers[spec.Index]
+	resized := original.DeepCopy()
+	if _, err := updateContainerResourceAmount(resized, spec, helper.fullName()); err != nil {
+		glog.Warningf("Failed to get the resized container %s of %s: %v", original.Name, helper.fullName(), err)
+	}
+	return &ControllerSpec{Name: helper.fullName(), Containers: []k8sapi.Container{original}},
+		&ControllerSpec{Name: helper.fullName(), Containers: []k8sapi.Container{*resized}}
+}
+
+func (helper *templateHelper) waitForRollout() error {
+	retryNum := defaultRetryRollout
+	interval := defaultRolloutCheckSleep
+	timeout := time.Duration(retryNum+1) * interval
+	err := goutil.RetrySimple(retryNum, timeout, interval, func() (bool, error) {
+		return helper.checkRollout(helper.client, helper.nameSpace, helper.controllerName)
+	})
+
+	if err != nil {
+		glog.Errorf("Rollout of %s is not finished: %v", helper.fullName(), err)
+		return err
+	}
+
+	glog.V(2).Infof("Rollout of %s is finished.", helper.fullName())
+	return nil
+}
+
+// update the resources of the named container in the pod template.
+// return the original resources of the container.
+func updateTemplateContainer(template *k8sapi.PodTemplateSpec, containerName string, spec *containerResizeSpec, fullName string) (*k8sapi.ResourceRequirements, error) {
+	for i := range template.Spec.Containers {
+		container := &(template.Spec.Containers[i])
+		if container.Name != containerName {
+			continue
+		}
+
+		original := container.Resources.DeepCopy()
+		changed, err := updateContainerResourceAmount(container, spec, fullName)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return nil, NewActionError(ActionErrorNoChange, nil, "no need to resize container %s in pod template of %s", containerName, fullName)
+		}
+		return original, nil
+	}
+
+	return nil, fmt.Errorf("Cannot find container %s in pod template of %s", containerName, fullName)
+}
+
+// update the pod template of ReplicaSet.
+// ReplicaSet doesn't roll out its template to the existing pods.
+func updateRSTemplate(client *kclient.Clientset, namespace, name, containerName string, spec *containerResizeSpec, dryRun *dryRunHelper) (bool, *k8sapi.ResourceRequirements, error) {
+	rsClient := client.ExtensionsV1beta1().ReplicaSets(namespace)
+	fullName := fmt.Sprintf("%s/%s", namespace, name)
+
+	rs, err := rsClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get ReplicaSet: %s: %v", fullName, err)
+		return false, nil, err
+	}
+
+	original, err := updateTemplateContainer(&rs.Spec.Template, containerName, spec, fullName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if dryRun != nil {
+		err = dryRun.update(client.ExtensionsV1beta1().RESTClient(), namespace, "replicasets", name, rs)
+	} else {
+		_, err = rsClient.Update(rs)
+	}
+	if err != nil {
+		glog.Errorf("Failed to update ReplicaSet[%s]: %v", fullName, err)
+		return false, nil, err
+	}
+
+	return false, original, nil
+}
+
+// update the pod template of Deployment.
+// A paused Deployment is refused, since it rolls out neither the updated template, nor the recreated pods.
+func updateDeploymentTemplate(client *kclient.Clientset, namespace, name, containerName string, spec *containerResizeSpec, dryRun *dryRunHelper) (bool, *k8sapi.ResourceRequirements, error) {
+	depClient := client.AppsV1beta1().Deployments(namespace)
+	fullName := fmt.Sprintf("%s/%s", namespace, name)
+
+	dep, err := depClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get Deployment: %s: %v", fullName, err)
+		return false, nil, err
+	}
+	if dep.Spec.Paused {
+		return false, nil, NewActionError(ActionErrorInvalidAction, nil, "Deployment %s is paused", fullName)
+	}
+
+	original, err := updateTemplateContainer(&dep.Spec.Template, containerName, spec, fullName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if dryRun != nil {
+		err = dryRun.update(client.AppsV1beta1().RESTClient(), namespace, "deployments", name, dep)
+	} else {
+		_, err = depClient.Update(dep)
+	}
+	if err != nil {
+		glog.Errorf("Failed to update Deployment[%s]: %v", fullName, err)
+		return false, nil, err
+	}
+
+	return true, original, nil
+}
+
+// update the pod template of StatefulSet.
+// StatefulSet with OnDelete update strategy doesn't roll out its template to the existing pods.
+func updateStatefulSetTemplate(client *kclient.Clientset, namespace, name, containerName string, spec *containerResizeSpec, dryRun *dryRunHelper) (bool, *k8sapi.ResourceRequirements, error) {
+	ssClient := client.AppsV1beta1().StatefulSets(namespace)
+	fullName := fmt.Sprintf("%s/%s", namespace, name)
+
+	ss, err := ssClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get StatefulSet: %s: %v", fullName, err)
+		return false, nil, err
+	}
+
+	original, err := updateTemplateContainer(&ss.Spec.Template, containerName, spec, fullName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if dryRun != nil {
+		err = dryRun.update(client.AppsV1beta1().RESTClient(), namespace, "statefulsets", name, ss)
+	} else {
+		_, err = ssClient.Update(ss)
+	}
+	if err != nil {
+		glog.Errorf("Failed to update StatefulSet[%s]: %v", fullName, err)
+		return false, nil, err
+	}
+
+	return ss.Spec.UpdateStrategy.Type != appsv1beta1.OnDeleteStatefulSetStrategyType, original, nil
+}
+
+// update the pod template of DaemonSet.
+// DaemonSet with OnDelete update strategy doesn't roll out its template to the existing pods.
+func updateDaemonSetTemplate(client *kclient.Clientset, namespace, name, containerName string, spec *containerResizeSpec, dryRun *dryRunHelper) (bool, *k8sapi.ResourceRequirements, error) {
+	dsClient := client.ExtensionsV1beta1().DaemonSets(namespace)
+	fullName := fmt.Sprintf("%s/%s", namespace, name)
+
+	ds, err := dsClient.Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Failed to get DaemonSet: %s: %v", fullName, err)
+		return false, nil, err
+	}
+
+	original, err := updateTemplateContainer(&ds.Spec.Template, containerName, spec, fullName)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if dryRun != nil {
+		err = dryRun.update(client.ExtensionsV1beta1().RESTClient(), namespace, "daemonsets", name, ds)
+	} else {
+		_, err = dsClient.Update(ds)
+	}
+	if err != nil {
+		glog.Errorf("Failed to update DaemonSet[%s]: %v", fullName, err)
+		return false, nil, err
+	}
+
+	return ds.Spec.UpdateStrategy.Type == extv1beta1.RollingUpdateDaemonSetStrategyType, original, nil
+}
+
+func checkRSRollout(client *kclient.Clientset, namespace, name string) (bool, error) {
+	rs, err := client.ExtensionsV1beta1().ReplicaSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return true, err
+	}
+
+	replicas := int32(1)
+	if rs.Spec.Replicas != nil {
+		replicas = *rs.Spec.Replicas
+	}
+
+	if rs.Status.ObservedGeneration < rs.Generation {
+		return true, fmt.Errorf("waiting for ReplicaSet %s spec update to be observed", name)
+	}
+	if rs.Status.Replicas != replicas {
+		return true, fmt.Errorf("waiting for ReplicaSet %s: %d of %d replicas are created", name, rs.Status.Replicas, replicas)
+	}
+	if rs.Status.ReadyReplicas < replicas {
+		return true, fmt.Errorf("waiting for ReplicaSet %s: %d of %d replicas are ready", name, rs.Status.ReadyReplicas, replicas)
+	}
+
+	return false, nil
+}
+
+func checkDeploymentRollout(client *kclient.Clientset, namespace, name string) (bool, error) {
+	dep, err := client.AppsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return true, err
+	}
+
+	return deploymentRolloutStatus(dep)
+}
+
+// the same conditions as "kubectl rollout status"
+func deploymentRolloutStatus(dep *appsv1beta1.Deployment) (bool, error) {
+	name := dep.Name
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return true, fmt.Errorf("waiting for Deployment %s spec update to be observed", name)
+	}
+
+	for _, cond := range dep.Status.Conditions {
+		if cond.Type == appsv1beta1.DeploymentProgressing && cond.Reason == deploymentTimedOutReason {
+			return false, fmt.Errorf("Deployment %s exceeded its progress deadline", name)
+		}
+	}
+
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	if dep.Status.UpdatedReplicas < replicas {
+		return true, fmt.Errorf("waiting for Deployment %s: %d out of %d new replicas have been updated", name, dep.Status.UpdatedReplicas, replicas)
+	}
+	if dep.Status.Replicas > dep.Status.UpdatedReplicas {
+		return true, fmt.Errorf("waiting for Deployment %s: %d old replicas are pending termination", name, dep.Status.Replicas-dep.Status.UpdatedReplicas)
+	}
+	if dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas {
+		return true, fmt.Errorf("waiting for Deployment %s: %d of %d updated replicas are available", name, dep.Status.AvailableReplicas, dep.Status.UpdatedReplicas)
+	}
+
+	return false, nil
+}
+
+func checkStatefulSetRollout(client *kclient.Clientset, namespace, name string) (bool, error) {
+	ss, err := client.AppsV1beta1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return true, err
+	}
+
+	return statefulSetRolloutStatus(ss)
+}
+
+// the same conditions as "kubectl rollout status"
+func statefulSetRolloutStatus(ss *appsv1beta1.StatefulSet) (bool, error) {
+	name := ss.Name
+	if ss.Status.ObservedGeneration == nil || *ss.Status.ObservedGeneration < ss.Generation {
+		return true, fmt.Errorf("waiting for StatefulSet %s spec update to be observed", name)
+	}
+
+	replicas := int32(1)
+	if ss.Spec.Replicas != nil {
+		replicas = *ss.Spec.Replicas
+	}
+	if ss.Status.ReadyReplicas < replicas {
+		return true, fmt.Errorf("waiting for StatefulSet %s: %d of %d pods are ready", name, ss.Status.ReadyReplicas, replicas)
+	}
+
+	strategy := ss.Spec.UpdateStrategy
+	if strategy.Type == appsv1beta1.RollingUpdateStatefulSetStrategyType && strategy.RollingUpdate != nil &&
+		strategy.RollingUpdate.Partition != nil && *strategy.RollingUpdate.Partition > 0 {
+		if ss.Status.UpdatedReplicas < replicas-*strategy.RollingUpdate.Partition {
+			return true, fmt.Errorf("waiting for StatefulSet %s partitioned rollout: %d pods are updated", name, ss.Status.UpdatedReplicas)
+		}
+		return false, nil
+	}
+
+	if strategy.Type != appsv1beta1.OnDeleteStatefulSetStrategyType && ss.Status.UpdateRevision != ss.Status.CurrentRevision {
+		return true, fmt.Errorf("waiting for StatefulSet %s rolling update to complete: %d pods at revision %s", name, ss.Status.UpdatedReplicas, ss.Status.UpdateRevision)
+	}
+
+	return false, nil
+}
+
+func checkDaemonSetRollout(client *kclient.Clientset, namespace, name string) (bool, error) {
+	ds, err := client.ExtensionsV1beta1().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return true, err
+	}
+
+	return daemonSetRolloutStatus(ds)
+}
+
+// the same conditions as "kubectl rollout status"
+func daemonSetRolloutStatus(ds *extv1beta1.DaemonSet) (bool, error) {
+	name := ds.Name
+	if ds.Status.ObservedGeneration < ds.Generation {
+		return true, fmt.Errorf("waiting for DaemonSet %s spec update to be observed", name)
+	}
+
+	desired := ds.Status.DesiredNumberScheduled
+	if ds.Spec.UpdateStrategy.Type == extv1beta1.RollingUpdateDaemonSetStrategyType && ds.Status.UpdatedNumberScheduled < desired {
+		return true, fmt.Errorf("waiting for DaemonSet %s: %d out of %d new pods have been updated", name, ds.Status.UpdatedNumberScheduled, desired)
+	}
+	if ds.Status.NumberAvailable < desired {
+		return true, fmt.Errorf("waiting for DaemonSet %s: %d of %d updated pods are available", name, ds.Status.NumberAvailable, desired)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,243 @@
+package executor
+
+import (
+	"testing"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	k8sapi "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestUpdateTemplateContainer(t *testing.T) {
+	template := &k8sapi.PodTemplateSpec{}
+	template.Spec.Containers = []k8sapi.Container{{Name: "foo"}, {Name: "bar"}}
+	setContainerResourceLimit(&template.Spec.Containers[1], 300, 410)
+
+	spec := NewContainerResizeSpec(1)
+	patch, err := generateResourceList(250, 500)
+	if err != nil {
+		t.Errorf("unable to test: %v", err)
+	}
+	spec.NewCapacity = patch
+
+	original, err := updateTemplateContainer(template, "bar", spec, "ns/dep")
+	if err != nil {
+		t.Errorf("Failed to update template container: %v", err)
+	}
+	if err := compareResourceList(template.Spec.Containers[1].Resources.Limits, 250, 500); err != nil {
+		t.Error(err)
+	}
+	if err := compareResourceList(original.Limits, 300, 410); err != nil {
+		t.Errorf("Unexpected original resources: %v", err)
+	}
+	if len(template.Spec.Containers[0].Resources.Limits) != 0 {
+		t.Errorf("Unexpected change of container foo: %v", template.Spec.Containers[0].Resources.Limits)
+	}
+
+	// no change
+	if _, err := updateTemplateContainer(template, "bar", spec, "ns/dep"); err == nil {
+		t.Errorf("Expect error for no change")
+	}
+
+	// container not found
+	if _, err := updateTemplateContainer(template, "none", spec, "ns/dep"); err == nil {
+		t.Errorf("Expect error for missing container")
+	}
+
+	// roll back to the original resources
+	rollback := newRollbackSpec(1, original)
+	if _, err := updateTemplateContainer(template, "bar", rollback, "ns/dep"); err != nil {
+		t.Errorf("Failed to roll back template container: %v", err)
+	}
+	if err := compareResourceList(template.Spec.Containers[1].Resources.Limits, 300, 410); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeploymentRolloutStatus(t *testing.T) {
+	replicas := int32(3)
+	dep := &appsv1beta1.Deployment{}
+	dep.Name = "dep"
+	dep.Generation = 2
+	dep.Spec.Replicas = &replicas
+
+	tests := []struct {
+		name      string
+		status    appsv1beta1.DeploymentStatus
+		wantRetry bool
+		wantErr   bool
+	}{
+		{"not observed", appsv1beta1.DeploymentStatus{ObservedGeneration: 1}, true, true},
+		{"updating", appsv1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 2}, true, true},
+		{"old pending", appsv1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3}, true, true},
+		{"not available", appsv1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}, true, true},
+		{"done", appsv1beta1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, false, false},
+		{"timed out", appsv1beta1.DeploymentStatus{ObservedGeneration: 2, Conditions: []appsv1beta1.DeploymentCondition{
+			{Type: appsv1beta1.DeploymentProgressing, Reason: deploymentTimedOutReason}}}, false, true},
+	}
+
+	for _, tt := range tests {
+		dep.Status = tt.status
+		retry, err := deploymentRolloutStatus(dep)
+		if retry != tt.wantRetry || (err != nil) != tt.wantErr {
+			t.Errorf("%s: deploymentRolloutStatus() = (%v, %v), want (%v, error=%v)", tt.name, retry, err, tt.wantRetry, tt.wantErr)
+		}
+	}
+}
+
+func TestStatefulSetRolloutStatus(t *testing.T) {
+	replicas := int32(2)
+	generation := int64(3)
+	ss := &appsv1beta1.StatefulSet{}
+	ss.Name = "web"
+	ss.Generation = generation
+	ss.Spec.Replicas = &replicas
+	ss.Spec.UpdateStrategy.Type = appsv1beta1.RollingUpdateStatefulSetStrategyType
+
+	ss.Status = appsv1beta1.StatefulSetStatus{ObservedGeneration: &generation, ReadyReplicas: 2,
+		CurrentRevision: "web-1", UpdateRevision: "web-2"}
+	if retry, err := statefulSetRolloutStatus(ss); !retry || err == nil {
+		t.Errorf("Expect retry for revision mismatch: (%v, %v)", retry, err)
+	}
+
+	ss.Status.CurrentRevision = "web-2"
+	if retry, err := statefulSetRolloutStatus(ss); retry || err != nil {
+		t.Errorf("Expect rollout done: (%v, %v)", retry, err)
+	}
+
+	ss.Status.ReadyReplicas = 1
+	if retry, err := statefulSetRolloutStatus(ss); !retry || err == nil {
+		t.Errorf("Expect retry for not ready pods: (%v, %v)", retry, err)
+	}
+}
+
+func TestDaemonSetRolloutStatus(t *testing.T) {
+	ds := &extv1beta1.DaemonSet{}
+	ds.Name = "ds"
+	ds.Generation = 1
+	ds.Spec.UpdateStrategy.Type = extv1beta1.RollingUpdateDaemonSetStrategyType
+	ds.Status = extv1beta1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 2, NumberAvailable: 3}
+
+	if retry, err := daemonSetRolloutStatus(ds); !retry || err == nil {
+		t.Errorf("Expect retry for updating pods: (%v, %v)", retry, err)
+	}
+
+	ds.Status.UpdatedNumberScheduled = 3
+	if retry, err := daemonSetRolloutStatus(ds); retry || err != nil {
+		t.Errorf("Expect rollout done: (%v, %v)", retry, err)
+	}
+}
+
+func TestUpdateDeploymentTemplatePaused(t *testing.T) {
+	server := newFakeAPIServer(t)
+	defer server.close()
+
+	path := "/apis/apps/v1beta1/namespaces/default/deployments/dep"
+	dep := &appsv1beta1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dep", ResourceVersion: "1"}}
+	dep.Spec.Paused = true
+	dep.Spec.Template.Spec.Containers = []k8sapi.Container{{Name: "foo"}}
+	server.set(path, dep)
+
+	spec := NewContainerResizeSpec(0)
+	patch, err := generateResourceList(250, 500)
+	if err != nil {
+		t.Fatalf("unable to test: %v", err)
+	}
+	spec.NewCapacity = patch
+
+	// a paused Deployment doesn't roll out the template, so the pods would be recreated from the old one
+	_, _, err = updateDeploymentTemplate(server.client(), "default", "dep", "foo", spec, nil)
+	if category := GetActionErrorCategory(err); category != ActionErrorInvalidAction {
+		t.Errorf("Expect the paused Deployment to be refused, but got %v", err)
+	}
+	updated := &appsv1beta1.Deployment{}
+	server.get(path, updated)
+	if len(updated.Spec.Template.Spec.Containers[0].Resources.Limits) != 0 {
+		t.Errorf("Unexpected update of the paused Deployment: %v", updated.Spec.Template.Spec.Containers[0].Resources)
+	}
+}
+
+func TestGetTemplateHelper(t *testing.T) {
+	isController := true
+	newOwnedPod := func(kind string) *k8sapi.Pod {
+		return newTestPod("default", "foo-1", func(pod *k8sapi.Pod) {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: "foo", Controller: &isController}}
+		})
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		pod        *k8sapi.Pod
+		wantHelper bool
+	}{
+		{"pod mode", ContainerResizeModePod, newOwnedPod("StatefulSet"), false},
+		{"bare pod", ContainerResizeModeController, newTestPod("default", "foo-1"), false},
+		{"StatefulSet", ContainerResizeModeController, newOwnedPod("StatefulSet"), true},
+		// the pods of ReplicationController are resized by cloning them
+		{"ReplicationController", ContainerResizeModeController, newOwnedPod("ReplicationController"), false},
+	}
+
+	for _, tt := range tests {
+		resizer := NewContainerResizer(TurboK8sActionExecutor{}, nil, nil, tt.mode)
+		helper, err := resizer.getTemplateHelper(tt.pod)
+		if err != nil {
+			t.Errorf("%s: failed to get template helper: %v", tt.name, err)
+			continue
+		}
+		if (helper != nil) != tt.wantHelper {
+			t.Errorf("%s: expect template helper %v, but got %+v", tt.name, tt.wantHelper, helper)
+		}
+	}
+}
+
+func TestFindRecreatedPod(t *testing.T) {
+	owned := func(uid string) func(pod *k8sapi.Pod) {
+		return func(pod *k8sapi.Pod) {
+			pod.OwnerReferences[0].UID = types.UID(uid)
+		}
+	}
+	pod := newTestPod("ns", "foo-a", withPodOwner("ReplicaSet", "foo"), owned("rs-foo"))
+	existing := map[types.UID]bool{"foo-a": true, "foo-b": true}
+	deleting := newTestPod("ns", "foo-d", withPodOwner("ReplicaSet", "foo"), owned("rs-foo"))
+	deleting.DeletionTimestamp = &metav1.Time{}
+	pods := []k8sapi.Pod{
+		*newTestPod("ns", "foo-b", withPodOwner("ReplicaSet", "foo"), owned("rs-foo")),
+		*newTestPod("ns", "bar-c", withPodOwner("ReplicaSet", "bar"), owned("rs-bar")),
+		*deleting,
+	}
+	if npod := findRecreatedPod(pods, pod, existing); npod != nil {
+		t.Errorf("Expect no recreated pod but got %s", npod.Name)
+	}
+
+	pods = append(pods, *newTestPod("ns", "foo-e", withPodOwner("ReplicaSet", "foo"), owned("rs-foo")))
+	if npod := findRecreatedPod(pods, pod, existing); npod == nil || npod.Name != "foo-e" {
+		t.Errorf("Expect the recreated pod foo-e but got %v", npod)
+	}
+}
+
+func TestCheckRecreatedPod(t *testing.T) {
+	container := &k8sapi.Container{Name: "foo", Resources: k8sapi.ResourceRequirements{
+		Requests: k8sapi.ResourceList{k8sapi.ResourceCPU: resource.MustParse("200m")},
+	}}
+
+	tests := []struct {
+		name  string
+		pod   *k8sapi.Pod
+		retry bool
+		err   bool
+	}{
+		{"resized and ready", newTestPod("ns", "foo", withPodCPURequest("200m")), false, false},
+		{"not ready", newTestPod("ns", "foo", withPodCPURequest("200m"), withPodPhase(k8sapi.PodPending)), true, true},
+		{"not resized", newTestPod("ns", "foo", withPodCPURequest("100m")), false, true},
+	}
+	for _, test := range tests {
+		retry, err := checkRecreatedPod(test.pod, container)
+		if retry != test.retry || (err != nil) != test.err {
+			t.Errorf("%s: expected retry %v and error %v, but got %v and %v", test.name, test.retry, test.err, retry, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	k8sapi "k8s.io/api/core/v1"
+)
+
+// RollbackError is returned when an action fails after changing the pod or its controller;
+// the changes are then rolled back to restore the original configuration.
+type RollbackError struct {
+	// why the action failed
+	cause error
+	// the error of the rollback, nil if the original configuration is restored
+	rollbackErr error
+}
+
+func NewRollbackError(cause, rollbackErr error) *RollbackError {
+	return &RollbackError{
+		cause:       cause,
+		rollbackErr: rollbackErr,
+	}
+}
+
+func (e *RollbackError) Error() string {
+	if e.rollbackErr != nil {
+		return fmt.Sprintf("%v; rollback failed: %v", e.cause, e.rollbackErr)
+	}
+	return fmt.Sprintf("%v; rolled back to the original configuration", e.cause)
+}
+
+// RolledBack returns whether the original configuration is restored.
+func (e *RollbackError) RolledBack() bool {
+	return e.rollbackErr == nil
+}
+
+func IsRollbackError(err error) bool {
+	_, ok := err.(*RollbackError)
+	return ok
+}
+
+// build the resize spec to restore the original resources of the container.
+// Different from the resize spec of the action, the resources are replaced as a whole,
+// so that the limits and requests added by the action are removed as well.
+func newRollbackSpec(index int, original *k8sapi.ResourceRequirements) *containerResizeSpec {
+	spec := NewContainerResizeSpec(index)
+	spec.Resources = original.DeepCopy()
+	return spec
+}
+
+// restore the original resources of the container in the resized pod, by resizing the resized pod back.
+func rollbackResizedPod(r *ContainerResizer, npod *k8sapi.Pod, original *k8sapi.ResourceRequirements, index int, cause error,
+	progress *ActionProgress) error {
+	glog.Warningf("Begin to roll back resized pod %s/%s: %v", npod.Namespace, npod.Name, cause)
+	progress.Update(ProgressStarted, "Rolling back resized pod %s: %v", npod.Name, cause)
+
+	spec := newRollbackSpec(index, original)
+	rpod, err := resizeContainer(r.kubeClient, npod, spec, defaultRetryMore, false, r.journal, progress)
+	if err != nil {
+		glog.Errorf("Failed to roll back resized pod %s/%s: %v", npod.Namespace, npod.Name, err)
+		return NewRollbackError(cause, err)
+	}
+
+	glog.V(2).Infof("Rolled back resized pod %s/%s to pod %s/%s with the original resources.",
+		npod.Namespace, npod.Name, rpod.Namespace, rpod.Name)
+	return NewRollbackError(cause, nil)
+}
+
+// restore the original resources of the container in the pod template of the controller, and wait for the rollout.
+// The pods already recreated from the resized template by a controller which doesn't roll out its template
+// automatically (e.g., ReplicaSet) are left to be replaced by the controller.
+func rollbackControllerTemplate(helper *templateHelper, containerName string, original *k8sapi.ResourceRequirements, index int, cause error,
+	progress *ActionProgress) error {
+	fullName := helper.fullName()
+	glog.Warningf("Begin to roll back pod template of %s: %v", fullName, cause)
+	progress.Update(ProgressStarted, "Rolling back pod template of %s: %v", fullName, cause)
+
+	spec := newRollbackSpec(index, original)
+	autoRollout, _, err := helper.updateTemplate(helper.client, helper.nameSpace, helper.controllerName, containerName, spec, nil)
+	if err != nil {
+		glog.Errorf("Failed to roll back pod template of %s: %v", fullName, err)
+		return NewRollbackError(cause, err)
+	}
+
+	if autoRollout {
+		if err = helper.waitForRollout(); err != nil {
+			glog.Errorf("Failed to wait for the rollback rollout of %s: %v", fullName, err)
+			return NewRollbackError(cause, err)
+		}
+	}
+
+	glog.V(2).Infof("Rolled back pod template of %s with the original resources.", fullName)
+	return NewRollbackError(cause, nil)
+}
@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"time"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestPod creates a running and ready pod with a container "foo", whose uid is its name, changed by the options.
+func newTestPod(namespace, name string, options ...func(pod *api.Pod)) *api.Pod {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(name)},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "foo"}},
+		},
+		Status: api.PodStatus{
+			Phase:      api.PodRunning,
+			Conditions: []api.PodCondition{{Type: api.PodReady, Status: api.ConditionTrue}},
+		},
+	}
+	for _, option := range options {
+		option(pod)
+	}
+	return pod
+}
+
+func withPodNode(nodeName string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.NodeName = nodeName
+	}
+}
+
+func withPodLabels(labels map[string]string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Labels = labels
+	}
+}
+
+func withPodAnnotations(annotations map[string]string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Annotations = annotations
+	}
+}
+
+// withPodAction annotates the pod as the clone pod created by the action
+func withPodAction(action string) func(pod *api.Pod) {
+	return withPodAnnotations(map[string]string{TurboActionAnnotationKey: action})
+}
+
+// withPodOwner sets the controller of the pod
+func withPodOwner(kind, name string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		isController := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+	}
+}
+
+// withPodPhase sets the phase of the pod, which is not ready unless it is running
+func withPodPhase(phase api.PodPhase) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Status.Phase = phase
+		if phase != api.PodRunning {
+			pod.Status.Conditions = nil
+		}
+	}
+}
+
+func withPodCreated(created time.Time) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.CreationTimestamp = metav1.NewTime(created)
+	}
+}
+
+func withPodContainers(containers ...api.Container) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.Containers = containers
+	}
+}
+
+// withPodCPURequest sets the cpu request of the container "foo"
+func withPodCPURequest(cpu string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.Containers[0].Resources.Requests = api.ResourceList{api.ResourceCPU: resource.MustParse(cpu)}
+	}
+}
+
+func withPodVolumes(volumes ...api.Volume) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.Volumes = volumes
+	}
+}
+
+// newTestNode creates a node with the allocatable cpu and 10 pods, labeled with its hostname.
+func newTestNode(name, cpu string) *api.Node {
+	return &api.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/hostname": name}},
+		Status: api.NodeStatus{
+			Allocatable: api.ResourceList{
+				api.ResourceCPU:  resource.MustParse(cpu),
+				api.ResourcePods: resource.MustParse("10"),
+			},
+		},
+	}
+}
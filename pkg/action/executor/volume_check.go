@@ -0,0 +1,207 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/turbonomic/kubeturbo/pkg/action/util"
+	"github.com/turbonomic/kubeturbo/pkg/discovery/worker/compliance"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// how to move the pods with emptyDir volumes, whose data is lost by the move:
+	// allow the moves, or refuse them unless the pod is annotated as safe to evict
+	EmptyDirPolicyAllow  = "allow"
+	EmptyDirPolicyRefuse = "refuse"
+
+	// the pods with this annotation set to "true" are moved even if the emptyDir policy is refuse
+	safeToEvictAnnotationKey = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+)
+
+var (
+	// the labels of the zone and the region of the nodes and the zonal persistent volumes;
+	// the value of the label of a persistent volume available in multiple zones is separated by "__"
+	zoneLabelKeys   = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+	regionLabelKeys = []string{"topology.kubernetes.io/region", "failure-domain.beta.kubernetes.io/region"}
+)
+
+const zoneLabelValueSeparator = "__"
+
+// volumeChecker checks whether the volumes of a pod can be attached on the destination node of its move.
+type volumeChecker struct {
+	emptyDirPolicy string
+
+	// get the PersistentVolumeClaim, the PersistentVolume and the Node; replaced in the tests
+	getPVC  func(namespace, name string) (*api.PersistentVolumeClaim, error)
+	getPV   func(name string) (*api.PersistentVolume, error)
+	getNode func(name string) (*api.Node, error)
+}
+
+func newVolumeChecker(kubeClient *kclient.Clientset, emptyDirPolicy string) *volumeChecker {
+	return &volumeChecker{
+		emptyDirPolicy: emptyDirPolicy,
+		getPVC: func(namespace, name string) (*api.PersistentVolumeClaim, error) {
+			return kubeClient.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+		},
+		getPV: func(name string) (*api.PersistentVolume, error) {
+			return kubeClient.CoreV1().PersistentVolumes().Get(name, metav1.GetOptions{})
+		},
+		getNode: func(name string) (*api.Node, error) {
+			return kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		},
+	}
+}
+
+// Checks the volumes of the pod moved to the node, so that a move which can never succeed is refused
+// instead of waiting for the clone pod to get ready:
+//   - the persistent volumes must be accessible from the node, by their node affinity and zone labels;
+//   - the ReadWriteOnce volumes can not be attached to the clone pod on another node while the original pod is running,
+//     which is fine if the pod is recreated, e.g., the pod of a StatefulSet;
+//   - the inline zonal disks are attached by a single node, and stay in the zone of the current node;
+//   - the data of the emptyDir volumes is lost, which is refused by the emptyDir policy refuse.
+//
+// An ActionError of ActionErrorVolumeConflict is returned if the volumes can't be moved to the node.
+func (c *volumeChecker) check(pod *api.Pod, node *api.Node, recreated bool) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		switch {
+		case volume.EmptyDir != nil:
+			if c.emptyDirPolicy == EmptyDirPolicyRefuse && pod.Annotations[safeToEvictAnnotationKey] != "true" {
+				return NewActionError(ActionErrorVolumeConflict, nil, "the data of emptyDir volume %s of pod %s would be lost by the move",
+					volume.Name, fullName)
+			}
+			glog.V(3).Infof("The data of emptyDir volume %s of pod %s is not moved to node %s", volume.Name, fullName, node.Name)
+		case volume.PersistentVolumeClaim != nil:
+			if err := c.checkClaim(pod, volume.PersistentVolumeClaim, node, recreated); err != nil {
+				return err
+			}
+		case isZonalDisk(volume):
+			if err := c.checkZonalDisk(pod, volume, node, recreated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *volumeChecker) checkClaim(pod *api.Pod, source *api.PersistentVolumeClaimVolumeSource, node *api.Node, recreated bool) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	pvc, err := c.getPVC(pod.Namespace, source.ClaimName)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get PersistentVolumeClaim %s of pod %s", source.ClaimName, fullName)
+	}
+	if pvc.Spec.VolumeName == "" {
+		glog.Warningf("PersistentVolumeClaim %s of pod %s is not bound; its volume is not checked", source.ClaimName, fullName)
+		return nil
+	}
+	pv, err := c.getPV(pvc.Spec.VolumeName)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get PersistentVolume %s of pod %s", pvc.Spec.VolumeName, fullName)
+	}
+
+	//1. the node affinity of the volume, e.g., of the local volumes
+	if affinity := pv.Spec.NodeAffinity; affinity != nil && affinity.Required != nil {
+		if !compliance.NodeMatchesNodeSelectorTerms(node, affinity.Required.NodeSelectorTerms) {
+			return NewActionError(ActionErrorVolumeConflict, nil, "PersistentVolume %s of pod %s is not accessible from node %s by its node affinity",
+				pv.Name, fullName, node.Name)
+		}
+	} else if pv.Spec.Local != nil {
+		return NewActionError(ActionErrorVolumeConflict, nil, "local PersistentVolume %s of pod %s is not accessible from node %s",
+			pv.Name, fullName, node.Name)
+	}
+
+	//2. the zone and the region of the volume
+	if !matchesZoneLabels(pv.Labels, node.Labels) {
+		return NewActionError(ActionErrorVolumeConflict, nil, "PersistentVolume %s of pod %s in zone %s is not accessible from node %s in zone %s",
+			pv.Name, fullName, getZone(pv.Labels), node.Name, getZone(node.Labels))
+	}
+
+	//3. the access modes of the volume: the original pod and the clone pod use the volume at the same time
+	if !recreated && !isMultiNodeAccessible(pv.Spec.AccessModes, source.ReadOnly) {
+		return NewActionError(ActionErrorVolumeConflict, nil, "PersistentVolume %s of pod %s with access modes %v can not be attached "+
+			"to the clone pod on node %s while the pod is running", pv.Name, fullName, pv.Spec.AccessModes, node.Name)
+	}
+	return nil
+}
+
+// The inline zonal disk is in the zone of the current node of the pod, and can be attached by a single node
+// unless it is read only.
+func (c *volumeChecker) checkZonalDisk(pod *api.Pod, volume *api.Volume, node *api.Node, recreated bool) error {
+	fullName := util.BuildIdentifier(pod.Namespace, pod.Name)
+	if !recreated && !isReadOnlyZonalDisk(volume) {
+		return NewActionError(ActionErrorVolumeConflict, nil, "disk volume %s of pod %s can not be attached to the clone pod on node %s "+
+			"while the pod is running", volume.Name, fullName, node.Name)
+	}
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+	current, err := c.getNode(pod.Spec.NodeName)
+	if err != nil {
+		return NewActionError(ActionErrorAPIFailure, err, "cannot get node %s of pod %s", pod.Spec.NodeName, fullName)
+	}
+	if !matchesZoneLabels(current.Labels, node.Labels) {
+		return NewActionError(ActionErrorVolumeConflict, nil, "disk volume %s of pod %s in zone %s is not accessible from node %s in zone %s",
+			volume.Name, fullName, getZone(current.Labels), node.Name, getZone(node.Labels))
+	}
+	return nil
+}
+
+func isZonalDisk(volume *api.Volume) bool {
+	return volume.GCEPersistentDisk != nil || volume.AWSElasticBlockStore != nil || volume.AzureDisk != nil || volume.Cinder != nil
+}
+
+// only the GCE persistent disks can be attached by multiple nodes in read only mode
+func isReadOnlyZonalDisk(volume *api.Volume) bool {
+	return volume.GCEPersistentDisk != nil && volume.GCEPersistentDisk.ReadOnly
+}
+
+// Checks whether the volume with the access modes can be used by the pods on multiple nodes at the same time.
+func isMultiNodeAccessible(modes []api.PersistentVolumeAccessMode, readOnly bool) bool {
+	for _, mode := range modes {
+		if mode == api.ReadWriteMany || (readOnly && mode == api.ReadOnlyMany) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether the zone and region labels of the volume, or the current node, match those of the node.
+// A label missing on either side matches anything.
+func matchesZoneLabels(volumeLabels, nodeLabels map[string]string) bool {
+	for _, keys := range [][]string{zoneLabelKeys, regionLabelKeys} {
+		for _, key := range keys {
+			value, exist := volumeLabels[key]
+			if !exist || value == "" {
+				continue
+			}
+			nodeValue, exist := nodeLabels[key]
+			if !exist {
+				continue
+			}
+			matched := false
+			for _, v := range strings.Split(value, zoneLabelValueSeparator) {
+				if v == nodeValue {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func getZone(labels map[string]string) string {
+	for _, key := range zoneLabelKeys {
+		if zone, exist := labels[key]; exist {
+			return zone
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+
+// newVolumeTestNode creates the node in the zone
+func newVolumeTestNode(name, zone string) *api.Node {
+	node := newTestNode(name, "4")
+	node.Labels[testZoneLabel] = zone
+	return node
+}
+
+func newClaimVolume(claim string, readOnly bool) api.Volume {
+	return api.Volume{
+		Name: claim,
+		VolumeSource: api.VolumeSource{
+			PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: claim, ReadOnly: readOnly},
+		},
+	}
+}
+
+// the volume checker with the claims bound to the volumes of the same names
+func newTestVolumeChecker(policy string, pvs ...*api.PersistentVolume) *volumeChecker {
+	c := newVolumeChecker(nil, policy)
+	c.getPVC = func(namespace, name string) (*api.PersistentVolumeClaim, error) {
+		return &api.PersistentVolumeClaim{Spec: api.PersistentVolumeClaimSpec{VolumeName: name}}, nil
+	}
+	c.getPV = func(name string) (*api.PersistentVolume, error) {
+		for _, pv := range pvs {
+			if pv.Name == name {
+				return pv, nil
+			}
+		}
+		return nil, fmt.Errorf("PersistentVolume %s not found", name)
+	}
+	c.getNode = func(name string) (*api.Node, error) {
+		return newVolumeTestNode(name, "zone-1"), nil
+	}
+	return c
+}
+
+func TestVolumeCheckAccessModes(t *testing.T) {
+	rwo := &api.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "rwo"},
+		Spec:       api.PersistentVolumeSpec{AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteOnce, api.ReadOnlyMany}},
+	}
+	rwx := &api.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "rwx"},
+		Spec:       api.PersistentVolumeSpec{AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteMany}},
+	}
+	c := newTestVolumeChecker(EmptyDirPolicyAllow, rwo, rwx)
+	node := newVolumeTestNode("node-b", "zone-1")
+
+	tests := []struct {
+		volume    api.Volume
+		recreated bool
+		expected  bool
+	}{
+		{newClaimVolume("rwo", false), false, false},
+		{newClaimVolume("rwo", false), true, true},
+		{newClaimVolume("rwo", true), false, true},
+		{newClaimVolume("rwx", false), false, true},
+	}
+	for _, test := range tests {
+		err := c.check(newTestPod("default", "foo", withPodNode("node-a"), withPodVolumes(test.volume)), node, test.recreated)
+		if (err == nil) != test.expected {
+			t.Errorf("volume %s recreated %v: unexpected result %v", test.volume.Name, test.recreated, err)
+		}
+		if err != nil && GetActionErrorCategory(err) != ActionErrorVolumeConflict {
+			t.Errorf("unexpected error category: %v", err)
+		}
+	}
+}
+
+func TestVolumeCheckTopology(t *testing.T) {
+	local := &api.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "local"},
+		Spec: api.PersistentVolumeSpec{
+			AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteOnce},
+			NodeAffinity: &api.VolumeNodeAffinity{
+				Required: &api.NodeSelector{
+					NodeSelectorTerms: []api.NodeSelectorTerm{{
+						MatchExpressions: []api.NodeSelectorRequirement{{
+							Key:      "kubernetes.io/hostname",
+							Operator: api.NodeSelectorOpIn,
+							Values:   []string{"node-a"},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	zonal := &api.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "zonal", Labels: map[string]string{testZoneLabel: "zone-1__zone-2"}},
+		Spec:       api.PersistentVolumeSpec{AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteOnce}},
+	}
+	c := newTestVolumeChecker(EmptyDirPolicyAllow, local, zonal)
+
+	pod := newTestPod("default", "foo", withPodNode("node-a"), withPodVolumes(newClaimVolume("local", false)))
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-1"), true); err == nil {
+		t.Errorf("expect the local volume not to be accessible from another node")
+	}
+	pod = newTestPod("default", "foo", withPodNode("node-a"), withPodVolumes(newClaimVolume("zonal", false)))
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-2"), true); err != nil {
+		t.Errorf("expect the volume to be accessible from a node in its zones: %v", err)
+	}
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-3"), true); err == nil {
+		t.Errorf("expect the volume not to be accessible from a node in another zone")
+	}
+
+	disk := api.Volume{
+		Name:         "disk",
+		VolumeSource: api.VolumeSource{AWSElasticBlockStore: &api.AWSElasticBlockStoreVolumeSource{VolumeID: "vol-1"}},
+	}
+	pod = newTestPod("default", "foo", withPodNode("node-a"), withPodVolumes(disk))
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-1"), false); err == nil {
+		t.Errorf("expect the disk not to be attached to the clone pod")
+	}
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-1"), true); err != nil {
+		t.Errorf("expect the disk to be attached to the recreated pod in the same zone: %v", err)
+	}
+	if err := c.check(pod, newVolumeTestNode("node-b", "zone-2"), true); err == nil {
+		t.Errorf("expect the disk not to be attached in another zone")
+	}
+}
+
+func TestVolumeCheckEmptyDir(t *testing.T) {
+	emptyDir := api.Volume{Name: "cache", VolumeSource: api.VolumeSource{EmptyDir: &api.EmptyDirVolumeSource{}}}
+	node := newVolumeTestNode("node-b", "zone-1")
+	pod := newTestPod("default", "foo", withPodNode("node-a"), withPodVolumes(emptyDir))
+
+	if err := newTestVolumeChecker(EmptyDirPolicyAllow).check(pod, node, false); err != nil {
+		t.Errorf("expect the pod with emptyDir to be moved: %v", err)
+	}
+
+	c := newTestVolumeChecker(EmptyDirPolicyRefuse)
+	if err := c.check(pod, node, false); GetActionErrorCategory(err) != ActionErrorVolumeConflict {
+		t.Errorf("expect the pod with emptyDir to be refused, but got %v", err)
+	}
+	pod.Annotations = map[string]string{safeToEvictAnnotationKey: "true"}
+	if err := c.check(pod, node, false); err != nil {
+		t.Errorf("expect the pod safe to evict to be moved: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	client "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the stores of the action locks: in memory of this kubeturbo, or in the Lease objects shared by
+	// all the kubeturbo instances of the cluster, e.g., during a rolling upgrade
+	ActionLockStoreMemory = "memory"
+	ActionLockStoreLease  = "lease"
+
+	LeaseAPIVersion = "coordination.k8s.io/v1"
+	leaseKind       = "Lease"
+	leasesResource  = "leases"
+	leaseNamePrefix = "kubeturbo-lock-"
+
+	// the annotation of a Lease with the key of its lock
+	LockKeyAnnotationKey = "kubeturbo.io/lock-key"
+)
+
+// Lease is the coordination.k8s.io Lease object, with the fields used by the action locks.
+type Lease struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LeaseSpec `json:"spec,omitempty"`
+}
+
+type LeaseSpec struct {
+	HolderIdentity       *string           `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32            `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *metav1.MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *metav1.MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32            `json:"leaseTransitions,omitempty"`
+}
+
+func (l *Lease) holder() string {
+	if l.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *l.Spec.HolderIdentity
+}
+
+// The lease is expired if it is not renewed within its duration.
+func (l *Lease) expired(now time.Time) bool {
+	if l.Spec.RenewTime == nil || l.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return l.Spec.RenewTime.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+// the operations on the Leases in a namespace
+type leaseClient interface {
+	get(name string) (*Lease, error)
+	create(lease *Lease) (*Lease, error)
+	// update the lease, which fails with a conflict if it is changed since it was got
+	update(lease *Lease) (*Lease, error)
+	// delete the lease, which fails with a conflict if it is recreated with another uid
+	delete(lease *Lease) error
+}
+
+// restLeaseClient operates the Leases through the REST client, as the coordination API is not in the client-go.
+type restLeaseClient struct {
+	kubeClient *client.Clientset
+	namespace  string
+}
+
+func newRESTLeaseClient(kubeClient *client.Clientset, namespace string) *restLeaseClient {
+	return &restLeaseClient{kubeClient: kubeClient, namespace: namespace}
+}
+
+func (c *restLeaseClient) path(name string) string {
+	path := strings.Join([]string{goutil.GroupVersionPath(LeaseAPIVersion), "namespaces", c.namespace, leasesResource}, "/")
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+func (c *restLeaseClient) get(name string) (*Lease, error) {
+	data, err := c.kubeClient.Discovery().RESTClient().Get().AbsPath(c.path(name)).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalLease(data)
+}
+
+func (c *restLeaseClient) create(lease *Lease) (*Lease, error) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+	data, err = c.kubeClient.Discovery().RESTClient().Post().AbsPath(c.path("")).Body(data).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalLease(data)
+}
+
+func (c *restLeaseClient) update(lease *Lease) (*Lease, error) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+	data, err = c.kubeClient.Discovery().RESTClient().Put().AbsPath(c.path(lease.Name)).Body(data).DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalLease(data)
+}
+
+func (c *restLeaseClient) delete(lease *Lease) error {
+	options := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &lease.UID}}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.Discovery().RESTClient().Delete().AbsPath(c.path(lease.Name)).Body(data).DoRaw()
+	return err
+}
+
+func unmarshalLease(data []byte) (*Lease, error) {
+	lease := &Lease{}
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// LeaseActionLockStore keeps the action locks in the Leases in the namespace kubeturbo runs in, so that the actions
+// of multiple kubeturbo instances on the same controller are not executed at the same time.
+// The keys of the locks are the same as those of ActionLockStore. A lock is renewed while its action is executed,
+// and expires if not renewed within the lease duration, e.g., when its kubeturbo is gone.
+// The lease is deleted when its lock is released; the leases of the kubeturbo instances which are gone are
+// taken over and deleted by the next actions with the same keys.
+type LeaseActionLockStore struct {
+	client leaseClient
+
+	// identifies this kubeturbo instance; the holder of a lease is the instance with the action
+	identity      string
+	leaseDuration time.Duration
+
+	waitTimeout time.Duration
+	waitSleep   time.Duration
+
+	// The function to get the related pod from action item
+	podFunc func(ai *proto.ActionItemDTO) *api.Pod
+}
+
+func newLeaseActionLockStore(client leaseClient, leaseDuration time.Duration, podFunc func(ai *proto.ActionItemDTO) *api.Pod) *LeaseActionLockStore {
+	return &LeaseActionLockStore{
+		client:        client,
+		identity:      newLockIdentity(),
+		leaseDuration: leaseDuration,
+		waitTimeout:   defaultWaitLockTimeOut,
+		waitSleep:     defaultWaitLockSleep,
+		podFunc:       podFunc,
+	}
+}
+
+// identify this kubeturbo instance by its hostname, i.e., the pod name, and its start time
+func newLockIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "kubeturbo"
+	}
+	return hostname + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Acquires the lock for the action item in its lease. It will wait and retry if the lease is held by another action,
+// of this or another kubeturbo, and not expired.
+func (s *LeaseActionLockStore) getLock(actionItem *proto.ActionItemDTO) (IActionLock, error) {
+	id := actionItem.GetUuid()
+	key, err := getActionLockKey(actionItem, s.podFunc(actionItem))
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &leaseLock{
+		client:   s.client,
+		key:      key,
+		name:     leaseName(key),
+		holder:   s.identity + "_" + id,
+		duration: s.leaseDuration,
+		stop:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	glog.V(4).Infof("Action %s: getting lock with key %s in lease %s", id, key, lock.name)
+	err = goutil.RetryDuring(1000, s.waitTimeout, s.waitSleep, lock.tryAcquire)
+	if err != nil {
+		glog.Errorf("Action %s: failed to get lock with key %s: %v", id, key, err)
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Gets the name of the lease of the lock key, which is not a valid object name, e.g., Deployment-default/foo.
+// The hash of the key is appended to avoid the conflicts of the keys with the same valid characters.
+func leaseName(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(key))
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return fmt.Sprintf("%s%s-%08x", leaseNamePrefix, strings.Trim(name, "-"), h.Sum32())
+}
+
+// leaseLock is the lock of an action held in a lease.
+type leaseLock struct {
+	client   leaseClient
+	key      string
+	name     string
+	holder   string
+	duration time.Duration
+
+	// serializes the renewal and the release of the lease
+	mutex sync.Mutex
+	lease *Lease
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// closed when the lease is taken over by another one while the action is executed
+	lost chan struct{}
+}
+
+// Tries to acquire the lease: create it, or take it over if it is released or expired.
+func (l *leaseLock) tryAcquire() error {
+	now := metav1.NowMicro()
+	lease, err := l.client.get(l.name)
+	if errors.IsNotFound(err) {
+		lease, err = l.client.create(l.newLease(now))
+		if err != nil {
+			return err
+		}
+		l.lease = lease
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if holder := lease.holder(); holder != "" && holder != l.holder && !lease.expired(now.Time) {
+		return fmt.Errorf("lock %s is held by %s", l.key, holder)
+	}
+	if lease.holder() != l.holder {
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	durationSeconds := int32(l.duration / time.Second)
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+
+	// the update fails with a conflict if another one takes over the lease in the meantime
+	if lease, err = l.client.update(lease); err != nil {
+		return err
+	}
+	l.lease = lease
+	return nil
+}
+
+func (l *leaseLock) newLease(now metav1.MicroTime) *Lease {
+	durationSeconds := int32(l.duration / time.Second)
+	transitions := int32(0)
+	return &Lease{
+		TypeMeta: metav1.TypeMeta{APIVersion: LeaseAPIVersion, Kind: leaseKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        l.name,
+			Annotations: map[string]string{LockKeyAnnotationKey: l.key},
+		},
+		Spec: LeaseSpec{
+			HolderIdentity:       &l.holder,
+			LeaseDurationSeconds: &durationSeconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+			LeaseTransitions:     &transitions,
+		},
+	}
+}
+
+// Renews the lease. Returns false if the lease is lost, i.e., taken over by another one after it expired,
+// or deleted by the new holder.
+func (l *leaseLock) renew() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	select {
+	case <-l.stop:
+		// the lease is released while waiting for the mutex
+		return true
+	default:
+	}
+
+	now := metav1.NowMicro()
+	l.lease.Spec.RenewTime = &now
+	lease, err := l.client.update(l.lease)
+	if errors.IsConflict(err) {
+		// the lease is changed since it was got: renew it again if it is still held
+		if lease, err = l.client.get(l.name); err == nil {
+			if lease.holder() != l.holder {
+				return false
+			}
+			lease.Spec.RenewTime = &now
+			lease, err = l.client.update(lease)
+		}
+	}
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		glog.Warningf("Failed to renew lease %s of lock %s: %v", l.name, l.key, err)
+		return true
+	}
+	l.lease = lease
+	return true
+}
+
+func (l *leaseLock) KeepRenewLock() {
+	interval := l.duration / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	go func() {
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-time.After(interval):
+				if !l.renew() {
+					glog.Errorf("Lost lease %s of lock %s to another holder", l.name, l.key)
+					close(l.lost)
+					return
+				}
+				glog.V(4).Infof("Renewed lease %s of lock %s", l.name, l.key)
+			}
+		}
+	}()
+}
+
+func (l *leaseLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Releases the lease by deleting it if it is still held, so that the other actions don't wait for it to expire,
+// and the leases don't pile up in the namespace.
+func (l *leaseLock) ReleaseLock() {
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lease, err := l.client.get(l.name)
+	if err == nil && lease.holder() == l.holder {
+		err = l.client.delete(lease)
+	}
+	if errors.IsNotFound(err) {
+		err = nil
+	}
+	if err != nil {
+		glog.Warningf("Failed to release lease %s of lock %s; it expires in %v: %v", l.name, l.key, l.duration, err)
+		return
+	}
+	glog.V(4).Infof("Released lease %s of lock %s", l.name, l.key)
+}
@@ -0,0 +1,230 @@
+package action
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var leaseResource = schema.GroupResource{Group: "coordination.k8s.io", Resource: leasesResource}
+
+// mockLeaseClient keeps the leases in memory, and rejects the updates of the stale leases by their resourceVersions.
+type mockLeaseClient struct {
+	mutex   sync.Mutex
+	leases  map[string]*Lease
+	version int
+}
+
+func newMockLeaseClient() *mockLeaseClient {
+	return &mockLeaseClient{leases: make(map[string]*Lease)}
+}
+
+func (c *mockLeaseClient) save(lease *Lease) *Lease {
+	c.version++
+	saved := *lease
+	saved.ResourceVersion = strconv.Itoa(c.version)
+	c.leases[lease.Name] = &saved
+	result := saved
+	return &result
+}
+
+func (c *mockLeaseClient) get(name string) (*Lease, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lease, exist := c.leases[name]
+	if !exist {
+		return nil, errors.NewNotFound(leaseResource, name)
+	}
+	result := *lease
+	return &result, nil
+}
+
+func (c *mockLeaseClient) create(lease *Lease) (*Lease, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, exist := c.leases[lease.Name]; exist {
+		return nil, errors.NewAlreadyExists(leaseResource, lease.Name)
+	}
+	return c.save(lease), nil
+}
+
+func (c *mockLeaseClient) update(lease *Lease) (*Lease, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	current, exist := c.leases[lease.Name]
+	if !exist {
+		return nil, errors.NewNotFound(leaseResource, lease.Name)
+	}
+	if current.ResourceVersion != lease.ResourceVersion {
+		return nil, errors.NewConflict(leaseResource, lease.Name, nil)
+	}
+	return c.save(lease), nil
+}
+
+func (c *mockLeaseClient) delete(lease *Lease) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	current, exist := c.leases[lease.Name]
+	if !exist {
+		return errors.NewNotFound(leaseResource, lease.Name)
+	}
+	if current.UID != lease.UID {
+		return errors.NewConflict(leaseResource, lease.Name, nil)
+	}
+	delete(c.leases, lease.Name)
+	return nil
+}
+
+func newTestLeaseLockStore(client leaseClient, identity string) *LeaseActionLockStore {
+	store := newLeaseActionLockStore(client, time.Second*10, func(ai *proto.ActionItemDTO) *api.Pod {
+		return nil
+	})
+	store.identity = identity
+	store.waitTimeout = time.Millisecond * 50
+	store.waitSleep = time.Millisecond * 5
+	return store
+}
+
+func newLockActionItem(uuid, targetId string) *proto.ActionItemDTO {
+	return &proto.ActionItemDTO{Uuid: &uuid, TargetSE: &proto.EntityDTO{Id: &targetId}}
+}
+
+func TestLeaseName(t *testing.T) {
+	name := leaseName("Deployment-default/foo")
+	if !strings.HasPrefix(name, "kubeturbo-lock-deployment-default-foo-") {
+		t.Errorf("Unexpected lease name %s", name)
+	}
+	if other := leaseName("Deployment-default.foo"); other == name {
+		t.Errorf("Expect the keys with the same valid characters to have different lease names: %s", name)
+	}
+	if name := leaseName(strings.Repeat("a", 300)); len(name) > 253 {
+		t.Errorf("Lease name is too long: %d", len(name))
+	}
+}
+
+func TestLeaseActionLockStore(t *testing.T) {
+	client := newMockLeaseClient()
+	store1 := newTestLeaseLockStore(client, "kubeturbo-1")
+	store2 := newTestLeaseLockStore(client, "kubeturbo-2")
+
+	lock, err := store1.getLock(newLockActionItem("a1", "node-1"))
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired: %v", err)
+	}
+	// the same key is locked by the other kubeturbo, or by another action of the same kubeturbo
+	if _, err := store2.getLock(newLockActionItem("a2", "node-1")); err == nil {
+		t.Errorf("Expect the lock held by another kubeturbo not to be acquired")
+	}
+	if _, err := store1.getLock(newLockActionItem("a3", "node-1")); err == nil {
+		t.Errorf("Expect the lock held by another action not to be acquired")
+	}
+	if _, err := store2.getLock(newLockActionItem("a4", "node-2")); err != nil {
+		t.Errorf("Expect the lock of another key to be acquired: %v", err)
+	}
+
+	lock.ReleaseLock()
+	if _, err := client.get(leaseName("node-1")); !errors.IsNotFound(err) {
+		t.Errorf("Expect the released lease to be deleted, but got %v", err)
+	}
+	if _, err := store2.getLock(newLockActionItem("a2", "node-1")); err != nil {
+		t.Errorf("Expect the released lock to be acquired: %v", err)
+	}
+	lease, _ := client.get(leaseName("node-1"))
+	if lease.holder() != "kubeturbo-2_a2" || lease.Annotations[LockKeyAnnotationKey] != "node-1" {
+		t.Errorf("Unexpected lease %+v", lease)
+	}
+}
+
+func TestLeaseActionLockStoreExpiry(t *testing.T) {
+	client := newMockLeaseClient()
+	store1 := newTestLeaseLockStore(client, "kubeturbo-1")
+	store2 := newTestLeaseLockStore(client, "kubeturbo-2")
+
+	lock1, err := store1.getLock(newLockActionItem("a1", "node-1"))
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired: %v", err)
+	}
+
+	// the lease is not renewed in its duration, e.g., the kubeturbo is gone
+	lease, _ := client.get(leaseName("node-1"))
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	lease.Spec.RenewTime = &expired
+	client.update(lease)
+
+	if _, err := store2.getLock(newLockActionItem("a2", "node-1")); err != nil {
+		t.Fatalf("Expect the expired lock to be taken over: %v", err)
+	}
+	if lock1.(*leaseLock).renew() {
+		t.Errorf("Expect the renewal of the lost lease to fail")
+	}
+	if lease, _ := client.get(leaseName("node-1")); *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("Expect the lease to be taken over once, but got %d transitions", *lease.Spec.LeaseTransitions)
+	}
+	// the release of the lost lease doesn't delete the lease of the new holder
+	lock1.ReleaseLock()
+	if lease, err := client.get(leaseName("node-1")); err != nil || lease.holder() != "kubeturbo-2_a2" {
+		t.Errorf("Expect the lease to be still held by the new holder, but got %v", err)
+	}
+}
+
+func TestLeaseLockLost(t *testing.T) {
+	client := newMockLeaseClient()
+	store1 := newTestLeaseLockStore(client, "kubeturbo-1")
+	store2 := newTestLeaseLockStore(client, "kubeturbo-2")
+
+	lock1, err := store1.getLock(newLockActionItem("a1", "node-1"))
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired: %v", err)
+	}
+	lease, _ := client.get(leaseName("node-1"))
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	lease.Spec.RenewTime = &expired
+	client.update(lease)
+	lock2, err := store2.getLock(newLockActionItem("a2", "node-1"))
+	if err != nil {
+		t.Fatalf("Expect the expired lock to be taken over: %v", err)
+	}
+
+	// the new holder deletes the lease when it is done, before the old one renews it
+	lock2.ReleaseLock()
+	lock1.(*leaseLock).duration = time.Second
+	lock1.KeepRenewLock()
+	defer lock1.ReleaseLock()
+	select {
+	case <-lock1.Lost():
+	case <-time.After(time.Second * 5):
+		t.Errorf("Expect the loss of the lease to be reported")
+	}
+}
+
+func TestLeaseLockRenew(t *testing.T) {
+	client := newMockLeaseClient()
+	store := newTestLeaseLockStore(client, "kubeturbo-1")
+
+	lock, err := store.getLock(newLockActionItem("a1", "node-1"))
+	if err != nil {
+		t.Fatalf("Expect the lock to be acquired: %v", err)
+	}
+	before, _ := client.get(leaseName("node-1"))
+
+	// the lease is changed by someone else, e.g., the labels are edited, while it is still held
+	changed := *before
+	changed.Labels = map[string]string{"foo": "bar"}
+	client.update(&changed)
+
+	if !lock.(*leaseLock).renew() {
+		t.Fatalf("Expect the lease to be renewed")
+	}
+	after, _ := client.get(leaseName("node-1"))
+	if after.holder() != "kubeturbo-1_a1" || !after.Spec.RenewTime.After(before.Spec.RenewTime.Time) {
+		t.Errorf("Expect the lease to be renewed, but got %+v", after.Spec)
+	}
+}
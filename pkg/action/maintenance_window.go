@@ -0,0 +1,209 @@
+package action
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+)
+
+const (
+	// what to do with the disruptive actions outside the maintenance windows
+	MaintenanceWindowRefuse = "refuse"
+	MaintenanceWindowHold   = "hold"
+
+	defaultMaintenanceMaxHold = time.Hour * 24
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// MaintenanceWindow is a recurring time range in which the disruptive actions, e.g., the moves and resizes recreating
+// the pods, may be executed on the pods in its scope. The window opens at the start time on the given days of week,
+// and closes at the end time; a window ending before it starts closes on the next day.
+// The disruptive actions in the scope of any window are only executed when one of their windows is open;
+// outside the windows they are refused, or held until a window opens. The windows are checked again once an action
+// gets its lock, and the action is refused if its window closed in the meantime.
+//
+//  maintenanceWindows:
+//  - name: nightly
+//    namespaces: [production]
+//    days: [Mon, Tue, Wed, Thu, Fri]
+//    start: "22:00"
+//    end: "06:00"
+//    timeZone: America/New_York
+//    outside: hold
+//    maxHoldMinutes: 720
+type MaintenanceWindow struct {
+	Name string `json:"name"`
+	PolicyScope
+
+	// the days of week on which the window opens, e.g., Sat or Saturday; every day if empty
+	Days []string `json:"days,omitempty"`
+	// the time of day the window opens and closes, in HH:MM
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// the IANA time zone of the window, e.g., Europe/Paris; default to UTC
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// what to do with the disruptive actions outside the window: refuse (default) or hold
+	Outside string `json:"outside,omitempty"`
+	// the longest time to hold an action until the window opens, in minutes; default to 24 hours
+	MaxHoldMinutes int `json:"maxHoldMinutes,omitempty"`
+
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+	maxHold  time.Duration
+}
+
+// parse the fields of the window
+func (w *MaintenanceWindow) parse() error {
+	if err := w.PolicyScope.parse(); err != nil {
+		return err
+	}
+
+	w.days = make(map[time.Weekday]bool)
+	for _, day := range w.Days {
+		name := strings.ToLower(day)
+		if len(name) < 3 {
+			return fmt.Errorf("invalid day %q", day)
+		}
+		weekday, exist := weekdays[name[:3]]
+		if !exist {
+			return fmt.Errorf("invalid day %q", day)
+		}
+		w.days[weekday] = true
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseTimeOfDay(w.End); err != nil {
+		return err
+	}
+	if w.start == w.end {
+		return fmt.Errorf("the window is empty: start %s equals end %s", w.Start, w.End)
+	}
+
+	if w.location, err = time.LoadLocation(w.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone %q: %v", w.TimeZone, err)
+	}
+
+	switch w.Outside {
+	case "":
+		w.Outside = MaintenanceWindowRefuse
+	case MaintenanceWindowRefuse, MaintenanceWindowHold:
+	default:
+		return fmt.Errorf("invalid outside %q: should be either %s or %s", w.Outside, MaintenanceWindowRefuse, MaintenanceWindowHold)
+	}
+
+	w.maxHold = defaultMaintenanceMaxHold
+	if w.MaxHoldMinutes > 0 {
+		w.maxHold = time.Duration(w.MaxHoldMinutes) * time.Minute
+	}
+	return nil
+}
+
+// parse the time of day in HH:MM, as the duration since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: should be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// get the opening and closing times of the window opening on the day of the given time
+func (w *MaintenanceWindow) openingOn(day time.Time) (time.Time, time.Time, bool) {
+	if len(w.days) > 0 && !w.days[day.Weekday()] {
+		return time.Time{}, time.Time{}, false
+	}
+	open := w.timeOfDay(day, 0, w.start)
+	closing := w.timeOfDay(day, 0, w.end)
+	if w.end < w.start {
+		closing = w.timeOfDay(day, 1, w.end)
+	}
+	return open, closing, true
+}
+
+// get the wall clock time of day in the location of the window, on the given number of days after the day.
+// The time is built from its date instead of added to midnight, so that it is kept across the daylight saving changes.
+func (w *MaintenanceWindow) timeOfDay(day time.Time, days int, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+days, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, w.location)
+}
+
+// check whether the window is open at the time
+func (w *MaintenanceWindow) isOpen(now time.Time) bool {
+	local := now.In(w.location)
+	// the window opening today, or the one opened yesterday which closes today
+	for _, day := range []time.Time{local, local.AddDate(0, 0, -1)} {
+		if open, closing, ok := w.openingOn(day); ok && !now.Before(open) && now.Before(closing) {
+			return true
+		}
+	}
+	return false
+}
+
+// get the next time the window opens after the time
+func (w *MaintenanceWindow) nextOpen(now time.Time) time.Time {
+	local := now.In(w.location)
+	for i := 0; i <= 7; i++ {
+		if open, _, ok := w.openingOn(local.AddDate(0, 0, i)); ok && open.After(now) {
+			return open
+		}
+	}
+	return time.Time{}
+}
+
+// Check the disruptive action against the maintenance windows in its scope at the time.
+// Returns how long to hold the action until a window opens, or an ActionError of ActionErrorOutsideMaintenanceWindow
+// to refuse it. The action may be executed immediately if it is in no window, or one of its windows is open.
+func (p *ExecutionPolicy) checkMaintenanceWindows(target *policyTarget, now time.Time) (time.Duration, error) {
+	if p == nil {
+		return 0, nil
+	}
+
+	var names []string
+	var next *MaintenanceWindow
+	var nextOpen time.Time
+	for _, window := range p.MaintenanceWindows {
+		if !window.matches(target) {
+			continue
+		}
+		if window.isOpen(now) {
+			return 0, nil
+		}
+		names = append(names, window.Name)
+		if open := window.nextOpen(now); !open.IsZero() && (next == nil || open.Before(nextOpen)) {
+			next, nextOpen = window, open
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	actionItem := target.actionItem
+	action := policyActionNames[actionItem.GetActionType()]
+	if next == nil {
+		return 0, executor.NewActionError(executor.ActionErrorOutsideMaintenanceWindow, nil, "%s of %s is outside maintenance windows %s",
+			action, actionItem.GetTargetSE().GetDisplayName(), strings.Join(names, ","))
+	}
+
+	wait := nextOpen.Sub(now)
+	if next.Outside == MaintenanceWindowHold && wait <= next.maxHold {
+		return wait, nil
+	}
+	return 0, executor.NewActionError(executor.ActionErrorOutsideMaintenanceWindow, nil, "%s of %s is outside maintenance windows %s; the next window %s opens at %s",
+		action, actionItem.GetTargetSE().GetDisplayName(), strings.Join(names, ","), next.Name, nextOpen.Format(time.RFC3339))
+}
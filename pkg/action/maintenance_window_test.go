@@ -0,0 +1,157 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+)
+
+const testMaintenanceWindows = `
+maintenanceWindows:
+- name: weeknights
+  namespaces: [production]
+  days: [Mon, Tue, Wed, Thu, Friday]
+  start: "22:00"
+  end: "06:00"
+  outside: hold
+  maxHoldMinutes: 720
+- name: weekend
+  selector: app=db
+  days: [Sat, Sun]
+  start: "00:00"
+  end: "23:59"
+`
+
+// 2019-01-07 is a Monday
+func testTime(day, hour, minute int) time.Time {
+	return time.Date(2019, 1, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestMaintenanceWindowIsOpen(t *testing.T) {
+	policy, err := parseExecutionPolicy([]byte(testMaintenanceWindows))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	window := policy.MaintenanceWindows[0]
+
+	tests := []struct {
+		now  time.Time
+		open bool
+	}{
+		{testTime(7, 21, 59), false},
+		{testTime(7, 22, 0), true},
+		// opened on Monday night, closes on Tuesday morning
+		{testTime(8, 5, 59), true},
+		{testTime(8, 6, 0), false},
+		// opened on Friday night, closes on Saturday morning
+		{testTime(12, 3, 0), true},
+		// no window opens on Saturday night
+		{testTime(12, 23, 0), false},
+		// no window opened on Sunday night
+		{testTime(7, 3, 0), false},
+	}
+	for _, test := range tests {
+		if open := window.isOpen(test.now); open != test.open {
+			t.Errorf("%v: expected open %v but got %v", test.now, test.open, open)
+		}
+	}
+
+	// from Saturday morning, the next window opens on Monday night
+	if next := window.nextOpen(testTime(12, 7, 0)); !next.Equal(testTime(14, 22, 0)) {
+		t.Errorf("expected next opening %v but got %v", testTime(14, 22, 0), next)
+	}
+}
+
+func TestMaintenanceWindowTimeZone(t *testing.T) {
+	window := &MaintenanceWindow{Start: "22:00", End: "23:00", TimeZone: "Asia/Tokyo"}
+	if err := window.parse(); err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+
+	// 22:30 in Tokyo is 13:30 in UTC
+	if !window.isOpen(testTime(7, 13, 30)) {
+		t.Errorf("expected the window to be open at 13:30 UTC")
+	}
+	if window.isOpen(testTime(7, 22, 30)) {
+		t.Errorf("expected the window to be closed at 22:30 UTC")
+	}
+}
+
+func TestMaintenanceWindowDaylightSaving(t *testing.T) {
+	window := &MaintenanceWindow{Start: "22:00", End: "06:00", TimeZone: "Europe/Paris"}
+	if err := window.parse(); err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+
+	// the clocks in Paris are moved forward from 02:00 CET to 03:00 CEST on 2019-03-31,
+	// the window opened at 22:00 CET (21:00 UTC) closes at 06:00 CEST (04:00 UTC)
+	tests := []struct {
+		now  time.Time
+		open bool
+	}{
+		{time.Date(2019, 3, 30, 20, 59, 0, 0, time.UTC), false},
+		{time.Date(2019, 3, 30, 21, 0, 0, 0, time.UTC), true},
+		{time.Date(2019, 3, 31, 3, 59, 0, 0, time.UTC), true},
+		{time.Date(2019, 3, 31, 4, 0, 0, 0, time.UTC), false},
+		// the window opening on the day of the change opens at 22:00 CEST (20:00 UTC)
+		{time.Date(2019, 3, 31, 20, 0, 0, 0, time.UTC), true},
+	}
+	for _, test := range tests {
+		if open := window.isOpen(test.now); open != test.open {
+			t.Errorf("%v: expected open %v but got %v", test.now, test.open, open)
+		}
+	}
+}
+
+func TestCheckMaintenanceWindows(t *testing.T) {
+	policy, err := parseExecutionPolicy([]byte(testMaintenanceWindows))
+	if err != nil {
+		t.Fatalf("Failed to parse execution policy: %v", err)
+	}
+	move := newPolicyActionItem(proto.ActionItemDTO_MOVE, 0, 0)
+
+	tests := []struct {
+		name     string
+		target   *policyTarget
+		now      time.Time
+		wait     time.Duration
+		category executor.ActionErrorCategory
+	}{
+		{"no window", &policyTarget{move, "default", map[string]string{"app": "web"}, true}, testTime(7, 12, 0), 0, ""},
+		{"window open", &policyTarget{move, "production", nil, true}, testTime(7, 23, 0), 0, ""},
+		{"hold", &policyTarget{move, "production", nil, true}, testTime(7, 12, 0), time.Hour * 10, ""},
+		{"hold too long", &policyTarget{move, "production", nil, true}, testTime(7, 7, 0), 0,
+			executor.ActionErrorOutsideMaintenanceWindow},
+		{"refuse", &policyTarget{move, "default", map[string]string{"app": "db"}, true}, testTime(7, 12, 0), 0,
+			executor.ActionErrorOutsideMaintenanceWindow},
+		{"weekend open", &policyTarget{move, "default", map[string]string{"app": "db"}, true}, testTime(13, 12, 0), 0, ""},
+		{"node action", &policyTarget{move, "", nil, false}, testTime(7, 12, 0), 0, ""},
+	}
+
+	for _, test := range tests {
+		wait, err := policy.checkMaintenanceWindows(test.target, test.now)
+		if category := executor.GetActionErrorCategory(err); category != test.category {
+			t.Errorf("%s: expected category %q but got %q: %v", test.name, test.category, category, err)
+		}
+		if wait != test.wait {
+			t.Errorf("%s: expected to hold %v but got %v", test.name, test.wait, wait)
+		}
+	}
+}
+
+func TestParseMaintenanceWindowInvalid(t *testing.T) {
+	invalid := []string{
+		"maintenanceWindows:\n- days: [Someday]\n  start: '22:00'\n  end: '06:00'\n",
+		"maintenanceWindows:\n- start: '25:00'\n  end: '06:00'\n",
+		"maintenanceWindows:\n- start: '06:00'\n  end: '06:00'\n",
+		"maintenanceWindows:\n- start: '22:00'\n  end: '06:00'\n  timeZone: Nowhere/Foo\n",
+		"maintenanceWindows:\n- start: '22:00'\n  end: '06:00'\n  outside: wait\n",
+	}
+	for _, data := range invalid {
+		if _, err := parseExecutionPolicy([]byte(data)); err == nil {
+			t.Errorf("Expect error parsing maintenance window %q", data)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package action
+
+import (
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestPod creates a pod with a container "foo", whose uid is its name, changed by the options.
+func newTestPod(namespace, name string, options ...func(pod *api.Pod)) *api.Pod {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(name)},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "foo"}},
+		},
+	}
+	for _, option := range options {
+		option(pod)
+	}
+	return pod
+}
+
+func withPodNode(nodeName string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.NodeName = nodeName
+	}
+}
+
+// withPodOwner sets the controller of the pod
+func withPodOwner(kind, name string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		isController := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+	}
+}
+
+// withPodCPULimit sets the cpu limit of the container "foo"
+func withPodCPULimit(cpu string) func(pod *api.Pod) {
+	return func(pod *api.Pod) {
+		pod.Spec.Containers[0].Resources.Limits = api.ResourceList{api.ResourceCPU: resource.MustParse(cpu)}
+	}
+}
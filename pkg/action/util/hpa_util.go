@@ -0,0 +1,48 @@
+package util
+
+import (
+	"github.com/golang/glog"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	client "k8s.io/client-go/kubernetes"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+)
+
+// IsScaleTargetOf checks whether the owner is the scale target of the HorizontalPodAutoscaler.
+// Only the kind and name are compared, as the api version of the target may differ from the one
+// in the owner reference, e.g., extensions/v1beta1 vs. apps/v1 for a Deployment.
+func IsScaleTargetOf(hpa *autoscalingv1.HorizontalPodAutoscaler, owner *goutil.OwnerInfo) bool {
+	ref := hpa.Spec.ScaleTargetRef
+	return hpa.Namespace == owner.Namespace && ref.Kind == owner.Kind && ref.Name == owner.Name
+}
+
+// FindHorizontalPodAutoscaler finds the HorizontalPodAutoscaler targeting the owner.
+// Returns nil if the owner is not scaled by any HorizontalPodAutoscaler.
+func FindHorizontalPodAutoscaler(kubeClient *client.Clientset, owner *goutil.OwnerInfo) (*autoscalingv1.HorizontalPodAutoscaler, error) {
+	hpaList, err := kubeClient.AutoscalingV1().HorizontalPodAutoscalers(owner.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("Failed to list HorizontalPodAutoscalers in namespace %s: %v", owner.Namespace, err)
+		return nil, err
+	}
+
+	for i := range hpaList.Items {
+		hpa := &hpaList.Items[i]
+		if IsScaleTargetOf(hpa, owner) {
+			glog.V(3).Infof("%s is scaled by HorizontalPodAutoscaler %s", owner, BuildIdentifier(hpa.Namespace, hpa.Name))
+			return hpa, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetHPAReplicaRange returns the minReplicas and maxReplicas of the HorizontalPodAutoscaler.
+// The minReplicas defaults to 1 if not set.
+func GetHPAReplicaRange(hpa *autoscalingv1.HorizontalPodAutoscaler) (int32, int32) {
+	min := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		min = *hpa.Spec.MinReplicas
+	}
+	return min, hpa.Spec.MaxReplicas
+}
@@ -20,6 +20,9 @@ type LockHelper struct {
 	//stop Renewing
 	stop       chan struct{}
 	isRenewing bool
+
+	//closed if the lock expires while renewing
+	lost chan struct{}
 }
 
 func NewLockHelper(podkey string, emap *ExpirationMap) (*LockHelper, error) {
@@ -28,6 +31,7 @@ func NewLockHelper(podkey string, emap *ExpirationMap) (*LockHelper, error) {
 		emap:       emap,
 		stop:       make(chan struct{}),
 		isRenewing: false,
+		lost:       make(chan struct{}),
 	}
 
 	if emap.GetTTL() < time.Second*2 {
@@ -80,11 +84,15 @@ func (h *LockHelper) Trylock(timeout, interval time.Duration) error {
 }
 
 func (h *LockHelper) ReleaseLock() {
-	h.emap.Del(h.key, h.version)
 	h.StopRenew()
+	h.emap.Del(h.key, h.version)
 	glog.V(4).Infof("Released lock for [%s]", h.key)
 }
 
+func (h *LockHelper) Lost() <-chan struct{} {
+	return h.lost
+}
+
 func (h *LockHelper) lockCallBack() {
 	// do nothing
 	return
@@ -110,6 +118,8 @@ func (h *LockHelper) KeepRenewLock() {
 				return
 			default:
 				if !h.RenewLock() {
+					glog.Errorf("schedulerHelper lost lock for [%s].", h.key)
+					close(h.lost)
 					return
 				}
 				time.Sleep(interval)
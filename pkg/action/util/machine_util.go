@@ -0,0 +1,238 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+)
+
+const (
+	// the api groups of the Machines and MachineSets: the upstream Cluster API, and the one of Openshift.
+	ClusterAPIGroup   = "cluster.x-k8s.io"
+	OpenshiftAPIGroup = "machine.openshift.io"
+
+	// the annotations of the node referring to its Machine.
+	// Cluster API sets the name of the Machine, and its namespace in a separate annotation;
+	// Openshift sets the namespace/name of the Machine.
+	clusterAPIMachineAnnotation   = "cluster.x-k8s.io/machine"
+	clusterAPINamespaceAnnotation = "cluster.x-k8s.io/cluster-namespace"
+	openshiftMachineAnnotation    = "machine.openshift.io/machine"
+
+	// the annotations of the Machine to delete it first when its MachineSet is scaled down
+	clusterAPIDeleteMachineAnnotation = "cluster.x-k8s.io/delete-machine"
+	openshiftDeleteMachineAnnotation  = "machine.openshift.io/cluster-api-delete-machine"
+
+	KindMachineSet        = "MachineSet"
+	KindMachineDeployment = "MachineDeployment"
+	machinesResource      = "machines"
+	machineSetsResource   = "machinesets"
+)
+
+// MachineInfo identifies the Machine of a node, and the api version it is served with.
+type MachineInfo struct {
+	APIVersion string
+	Namespace  string
+	Name       string
+
+	// the name of the node of the Machine, empty if the node is not created yet
+	NodeName string
+}
+
+func (m *MachineInfo) String() string {
+	return fmt.Sprintf("Machine-%s/%s", m.Namespace, m.Name)
+}
+
+// Path returns the absolute REST path of the Machine.
+func (m *MachineInfo) Path() string {
+	return strings.Join([]string{goutil.GroupVersionPath(m.APIVersion), "namespaces", m.Namespace, machinesResource, m.Name}, "/")
+}
+
+// DeleteAnnotation returns the annotation of the Machine to delete it first when its MachineSet is scaled down.
+func (m *MachineInfo) DeleteAnnotation() string {
+	if strings.HasPrefix(m.APIVersion, OpenshiftAPIGroup+"/") {
+		return openshiftDeleteMachineAnnotation
+	}
+	return clusterAPIDeleteMachineAnnotation
+}
+
+// GetMachineOwnerOfNode finds the owner to scale to provision a node like the given one, by walking the
+// owner references of the Machine of the node: the MachineDeployment owning the MachineSet of the Machine if any,
+// so that the MachineDeployment doesn't revert the replicas of its MachineSet; otherwise the MachineSet.
+// The Machine is found by the annotations of the node, or by the providerID of the node if not annotated.
+func GetMachineOwnerOfNode(rc goutil.ResourceClient, node *api.Node) (*goutil.OwnerInfo, error) {
+	machine, err := GetMachineOfNode(rc, node)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := rc.GetRaw(machine.Path())
+	if err != nil {
+		glog.Errorf("Failed to get %s of node %s: %v", machine, node.Name, err)
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	chain, err := goutil.GetObjectOwnerChain(rc, machine.Namespace, obj.GetOwnerReferences(), machine.String())
+	if err != nil {
+		return nil, err
+	}
+	if chain[0].Kind != KindMachineSet || !chain[0].Scalable {
+		return nil, fmt.Errorf("%s of node %s is not owned by a scalable MachineSet", machine, node.Name)
+	}
+	owner := chain[0]
+	if len(chain) > 1 && chain[1].Kind == KindMachineDeployment && chain[1].Scalable {
+		owner = chain[1]
+	}
+
+	glog.V(3).Infof("Node %s is provisioned by %s of %s", node.Name, machine, owner)
+	return owner, nil
+}
+
+// GetMachineOfNode finds the Machine of the node: by the annotations of the node,
+// or by listing the Machines with the providerID of the node.
+func GetMachineOfNode(rc goutil.ResourceClient, node *api.Node) (*MachineInfo, error) {
+	for _, group := range []string{ClusterAPIGroup, OpenshiftAPIGroup} {
+		apiVersion, err := getPreferredGroupVersion(rc, group)
+		if err != nil {
+			glog.V(4).Infof("API group %s is not served: %v", group, err)
+			continue
+		}
+
+		if namespace, name, found := getMachineFromAnnotations(node.Annotations, group); found {
+			return &MachineInfo{APIVersion: apiVersion, Namespace: namespace, Name: name, NodeName: node.Name}, nil
+		}
+
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		data, err := rc.GetRaw(goutil.GroupVersionPath(apiVersion) + "/" + machinesResource)
+		if err != nil {
+			glog.Errorf("Failed to list Machines of %s: %v", apiVersion, err)
+			continue
+		}
+		list := &unstructured.UnstructuredList{}
+		if err := list.UnmarshalJSON(data); err != nil {
+			glog.Errorf("Failed to decode Machines of %s: %v", apiVersion, err)
+			continue
+		}
+		if machine := findMachineByProviderID(list.Items, node.Spec.ProviderID); machine != nil {
+			return &MachineInfo{APIVersion: apiVersion, Namespace: machine.GetNamespace(), Name: machine.GetName(), NodeName: node.Name}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot find the Machine of node %s", node.Name)
+}
+
+// GetOwnedMachines gets the Machines owned by the MachineSet, or by the MachineSets of the MachineDeployment.
+func GetOwnedMachines(rc goutil.ResourceClient, owner *goutil.OwnerInfo) ([]*MachineInfo, error) {
+	machineSets := map[string]bool{owner.Name: true}
+	if owner.Kind == KindMachineDeployment {
+		list, err := listObjects(rc, owner.APIVersion, owner.Namespace, machineSetsResource)
+		if err != nil {
+			glog.Errorf("Failed to list MachineSets of %s: %v", owner, err)
+			return nil, err
+		}
+		machineSets = getControlledNames(list.Items, KindMachineDeployment, map[string]bool{owner.Name: true})
+	}
+
+	list, err := listObjects(rc, owner.APIVersion, owner.Namespace, machinesResource)
+	if err != nil {
+		glog.Errorf("Failed to list Machines of %s: %v", owner, err)
+		return nil, err
+	}
+
+	result := []*MachineInfo{}
+	for i := range list.Items {
+		machine := &list.Items[i]
+		if !isControlledBy(machine, KindMachineSet, machineSets) {
+			continue
+		}
+		nodeName, _, _ := unstructured.NestedString(machine.Object, "status", "nodeRef", "name")
+		result = append(result, &MachineInfo{APIVersion: owner.APIVersion, Namespace: machine.GetNamespace(),
+			Name: machine.GetName(), NodeName: nodeName})
+	}
+	return result, nil
+}
+
+// list the objects of the resource in the namespace
+func listObjects(rc goutil.ResourceClient, apiVersion, namespace, resource string) (*unstructured.UnstructuredList, error) {
+	data, err := rc.GetRaw(strings.Join([]string{goutil.GroupVersionPath(apiVersion), "namespaces", namespace, resource}, "/"))
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// get the preferred version of the api group, e.g., cluster.x-k8s.io/v1alpha3
+func getPreferredGroupVersion(rc goutil.ResourceClient, group string) (string, error) {
+	groups, err := rc.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+	for _, g := range groups.Groups {
+		if g.Name == group {
+			return g.PreferredVersion.GroupVersion, nil
+		}
+	}
+	return "", fmt.Errorf("api group %s not found", group)
+}
+
+// get the namespace and name of the Machine from the annotations of the node
+func getMachineFromAnnotations(annotations map[string]string, group string) (string, string, bool) {
+	switch group {
+	case ClusterAPIGroup:
+		name := annotations[clusterAPIMachineAnnotation]
+		if name == "" {
+			return "", "", false
+		}
+		return annotations[clusterAPINamespaceAnnotation], name, true
+	case OpenshiftAPIGroup:
+		value := annotations[openshiftMachineAnnotation]
+		items := strings.Split(value, "/")
+		if len(items) != 2 || items[0] == "" || items[1] == "" {
+			return "", "", false
+		}
+		return items[0], items[1], true
+	}
+	return "", "", false
+}
+
+// find the Machine with the providerID
+func findMachineByProviderID(machines []unstructured.Unstructured, providerID string) *unstructured.Unstructured {
+	for i := range machines {
+		id, _, _ := unstructured.NestedString(machines[i].Object, "spec", "providerID")
+		if id == providerID {
+			return &machines[i]
+		}
+	}
+	return nil
+}
+
+// get the names of the objects controlled by the owners of the kind with the names
+func getControlledNames(objects []unstructured.Unstructured, kind string, owners map[string]bool) map[string]bool {
+	result := make(map[string]bool)
+	for i := range objects {
+		if isControlledBy(&objects[i], kind, owners) {
+			result[objects[i].GetName()] = true
+		}
+	}
+	return result
+}
+
+// check whether the object is controlled by one of the owners of the kind with the names
+func isControlledBy(obj *unstructured.Unstructured, kind string, owners map[string]bool) bool {
+	ref := goutil.GetControllerRef(obj.GetOwnerReferences())
+	return ref != nil && ref.Kind == kind && owners[ref.Name]
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
+)
+
+func newMachine(namespace, name, machineSet, providerID, nodeName string) unstructured.Unstructured {
+	machine := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": testClusterAPIVersion, "kind": "Machine"}}
+	machine.SetNamespace(namespace)
+	machine.SetName(name)
+	if machineSet != "" {
+		controller := true
+		machine.SetOwnerReferences([]metav1.OwnerReference{
+			{APIVersion: testClusterAPIVersion, Kind: KindMachineSet, Name: machineSet, Controller: &controller},
+		})
+	}
+	if providerID != "" {
+		unstructured.SetNestedField(machine.Object, providerID, "spec", "providerID")
+	}
+	if nodeName != "" {
+		unstructured.SetNestedField(machine.Object, nodeName, "status", "nodeRef", "name")
+	}
+	return machine
+}
+
+func TestGetMachineFromAnnotations(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		group       string
+		namespace   string
+		name        string
+		found       bool
+	}{
+		{
+			annotations: map[string]string{clusterAPIMachineAnnotation: "m1", clusterAPINamespaceAnnotation: "ns1"},
+			group:       ClusterAPIGroup,
+			namespace:   "ns1", name: "m1", found: true,
+		},
+		{
+			annotations: map[string]string{openshiftMachineAnnotation: "openshift-machine-api/m2"},
+			group:       OpenshiftAPIGroup,
+			namespace:   "openshift-machine-api", name: "m2", found: true,
+		},
+		{
+			annotations: map[string]string{openshiftMachineAnnotation: "m2"},
+			group:       OpenshiftAPIGroup,
+		},
+		{
+			annotations: map[string]string{openshiftMachineAnnotation: "openshift-machine-api/m2"},
+			group:       ClusterAPIGroup,
+		},
+		{
+			annotations: nil,
+			group:       ClusterAPIGroup,
+		},
+	}
+
+	for i, test := range tests {
+		namespace, name, found := getMachineFromAnnotations(test.annotations, test.group)
+		if namespace != test.namespace || name != test.name || found != test.found {
+			t.Errorf("test[%d]: expected (%s, %s, %v) but got (%s, %s, %v)", i,
+				test.namespace, test.name, test.found, namespace, name, found)
+		}
+	}
+}
+
+func TestFindMachineByProviderID(t *testing.T) {
+	machines := []unstructured.Unstructured{
+		newMachine("ns", "m1", "ms", "aws:///us-east-1a/i-1", "node1"),
+		newMachine("ns", "m2", "ms", "aws:///us-east-1a/i-2", "node2"),
+	}
+
+	machine := findMachineByProviderID(machines, "aws:///us-east-1a/i-2")
+	if machine == nil || machine.GetName() != "m2" {
+		t.Errorf("expected machine m2 but got %v", machine)
+	}
+	if machine := findMachineByProviderID(machines, "aws:///us-east-1a/i-3"); machine != nil {
+		t.Errorf("expected no machine but got %s", machine.GetName())
+	}
+}
+
+// mockResourceClient serves the objects in memory by their REST paths, and the api groups and resources of Cluster API.
+type mockResourceClient struct {
+	objects map[string]interface{}
+}
+
+const testClusterAPIVersion = "cluster.x-k8s.io/v1alpha3"
+
+func newMockResourceClient() *mockResourceClient {
+	return &mockResourceClient{objects: make(map[string]interface{})}
+}
+
+func (c *mockResourceClient) ServerGroups() (*metav1.APIGroupList, error) {
+	version := metav1.GroupVersionForDiscovery{GroupVersion: testClusterAPIVersion, Version: "v1alpha3"}
+	return &metav1.APIGroupList{Groups: []metav1.APIGroup{
+		{Name: ClusterAPIGroup, Versions: []metav1.GroupVersionForDiscovery{version}, PreferredVersion: version},
+	}}, nil
+}
+
+func (c *mockResourceClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	if groupVersion != testClusterAPIVersion {
+		return nil, fmt.Errorf("%s not found", groupVersion)
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: []metav1.APIResource{
+		{Name: "machines", Kind: "Machine"},
+		{Name: "machinesets", Kind: KindMachineSet}, {Name: "machinesets/scale", Kind: "Scale"},
+		{Name: "machinedeployments", Kind: KindMachineDeployment}, {Name: "machinedeployments/scale", Kind: "Scale"},
+	}}, nil
+}
+
+func (c *mockResourceClient) GetRaw(path string) ([]byte, error) {
+	obj, exist := c.objects[path]
+	if !exist {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return json.Marshal(obj)
+}
+
+func (c *mockResourceClient) setObject(resource string, obj unstructured.Unstructured) {
+	path := strings.Join([]string{"/apis", testClusterAPIVersion, "namespaces", obj.GetNamespace(), resource, obj.GetName()}, "/")
+	c.objects[path] = obj.Object
+}
+
+func (c *mockResourceClient) setList(namespace, resource string, items ...unstructured.Unstructured) {
+	list := map[string]interface{}{"apiVersion": testClusterAPIVersion, "kind": "List"}
+	objects := []interface{}{}
+	for _, item := range items {
+		objects = append(objects, item.Object)
+	}
+	list["items"] = objects
+	c.objects[strings.Join([]string{"/apis", testClusterAPIVersion, "namespaces", namespace, resource}, "/")] = list
+}
+
+func newMachineOwner(kind, namespace, name, owner string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": testClusterAPIVersion, "kind": kind}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	if owner != "" {
+		controller := true
+		obj.SetOwnerReferences([]metav1.OwnerReference{
+			{APIVersion: testClusterAPIVersion, Kind: KindMachineDeployment, Name: owner, Controller: &controller},
+		})
+	}
+	return obj
+}
+
+func TestGetMachineOwnerOfNode(t *testing.T) {
+	rc := newMockResourceClient()
+	rc.setObject(machinesResource, newMachine("ns", "m1", "ms1", "", "node1"))
+	rc.setObject(machinesResource, newMachine("ns", "m2", "ms2", "", "node2"))
+	rc.setObject(machineSetsResource, newMachineOwner(KindMachineSet, "ns", "ms1", ""))
+	rc.setObject(machineSetsResource, newMachineOwner(KindMachineSet, "ns", "ms2", "md"))
+	rc.setObject("machinedeployments", newMachineOwner(KindMachineDeployment, "ns", "md", ""))
+
+	tests := []struct {
+		machine string
+		kind    string
+		name    string
+	}{
+		{"m1", KindMachineSet, "ms1"},
+		// the MachineDeployment is scaled, otherwise it reverts the replicas of its MachineSet
+		{"m2", KindMachineDeployment, "md"},
+	}
+	for _, test := range tests {
+		node := &api.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: map[string]string{
+			clusterAPIMachineAnnotation: test.machine, clusterAPINamespaceAnnotation: "ns",
+		}}}
+		owner, err := GetMachineOwnerOfNode(rc, node)
+		if err != nil {
+			t.Errorf("%s: failed to get the owner: %v", test.machine, err)
+			continue
+		}
+		if owner.Kind != test.kind || owner.Name != test.name || !owner.Scalable {
+			t.Errorf("%s: expected %s %s but got %+v", test.machine, test.kind, test.name, owner)
+		}
+	}
+
+	// the Machine is not owned by a MachineSet
+	rc.setObject(machinesResource, newMachine("ns", "m3", "", "", "node3"))
+	node := &api.Node{ObjectMeta: metav1.ObjectMeta{Name: "node3", Annotations: map[string]string{
+		clusterAPIMachineAnnotation: "m3", clusterAPINamespaceAnnotation: "ns",
+	}}}
+	if owner, err := GetMachineOwnerOfNode(rc, node); err == nil {
+		t.Errorf("expected no owner but got %+v", owner)
+	}
+}
+
+func TestGetOwnedMachines(t *testing.T) {
+	rc := newMockResourceClient()
+	rc.setList("ns", machinesResource,
+		newMachine("ns", "m1", "ms1", "", "node1"),
+		newMachine("ns", "m2", "other", "", "node2"),
+		newMachine("ns", "m3", "ms1", "", ""),
+		newMachine("ns", "m4", "ms2", "", "node4"),
+	)
+	rc.setList("ns", machineSetsResource,
+		newMachineOwner(KindMachineSet, "ns", "ms1", "md"),
+		newMachineOwner(KindMachineSet, "ns", "ms2", "md"),
+		newMachineOwner(KindMachineSet, "ns", "other", ""),
+	)
+
+	tests := []struct {
+		owner    *goutil.OwnerInfo
+		expected []string
+	}{
+		{&goutil.OwnerInfo{APIVersion: testClusterAPIVersion, Kind: KindMachineSet, Namespace: "ns", Name: "ms1"}, []string{"m1/node1", "m3/"}},
+		{&goutil.OwnerInfo{APIVersion: testClusterAPIVersion, Kind: KindMachineDeployment, Namespace: "ns", Name: "md"},
+			[]string{"m1/node1", "m3/", "m4/node4"}},
+	}
+	for _, test := range tests {
+		machines, err := GetOwnedMachines(rc, test.owner)
+		if err != nil {
+			t.Errorf("%s: failed to get Machines: %v", test.owner, err)
+			continue
+		}
+		names := []string{}
+		for _, machine := range machines {
+			names = append(names, machine.Name+"/"+machine.NodeName)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected %v but got %v", test.owner, test.expected, names)
+		}
+	}
+}
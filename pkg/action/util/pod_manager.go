@@ -32,6 +32,13 @@ func NewPodCachedManager(podCache turbostore.ITurboCache, podsGetter v1.PodsGett
 
 // CachePod caches the pod name and uid with the default expiration duration
 func (p *PodCachedManager) CachePod(old, new *api.Pod) {
+	// Pods of StatefulSet keep their names after actions; only the uid changes.
+	if old.Name == new.Name && old.UID != new.UID {
+		p.podCache.Set(string(old.UID), string(new.UID), 0)
+		glog.V(4).Infof("Cached pod uid: (%s,%v) -> (%s,%v)", old.Name, old.UID, new.Name, new.UID)
+		return
+	}
+
 	// Same name or uid is not normal and will not be cached.
 	if old.Name == new.Name || old.UID == new.UID {
 		glog.Errorf("The pods have same name or uid: old(%s,%v), new(%s,%v)", old.Name, old.UID, new.Name, new.UID)
@@ -102,8 +102,9 @@ func BuildIdentifier(namespace, name string) string {
 }
 
 // check whether parentKind is supported for MovePod/ResizeContainer actions
-// currently, these actions can only works on barePod, ReplicaSet, and ReplicationController
+// currently, these actions can only works on barePod, ReplicaSet, ReplicationController and Deployment
 //   Note: pod's parent cannot be Deployment. Deployment will create/control ReplicaSet, and ReplicaSet will create/control Pods.
+//         Deployment is returned as the grand parent of the pod (see podutil.GetPodGrandInfo).
 func SupportedParent(parentKind string) bool {
 	if parentKind == "" {
 		return true
@@ -117,9 +118,29 @@ func SupportedParent(parentKind string) bool {
 		return true
 	}
 
+	if strings.EqualFold(parentKind, util.KindDeployment) {
+		return true
+	}
+
 	return false
 }
 
+// check whether parentKind is supported for MovePod actions.
+// Besides the parents supported by SupportedParent, pods of StatefulSet can also be moved
+// as long as their names and PVC bindings are kept.
+func SupportedMoveParent(parentKind string) bool {
+	if SupportedParent(parentKind) {
+		return true
+	}
+
+	return IsStatefulSet(parentKind)
+}
+
+// check whether parentKind is StatefulSet
+func IsStatefulSet(parentKind string) bool {
+	return strings.EqualFold(parentKind, util.KindStatefulSet)
+}
+
 func AddAnnotation(pod *api.Pod, key, value string) {
 	annotations := pod.Annotations
 	if annotations == nil {
@@ -1,9 +1,12 @@
 package util
 
 import (
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
+
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
 )
 
 func TestAddAnnotation(t *testing.T) {
@@ -186,6 +189,30 @@ func testSupportPrivilegePod(t *testing.T, sccAllowedSet map[string]struct{}, wa
 	}
 }
 
+func TestSupportedMoveParent(t *testing.T) {
+	tests := []struct {
+		kind string
+		want bool
+	}{
+		{"", true},
+		{"ReplicaSet", true},
+		{"ReplicationController", true},
+		{"Deployment", true},
+		{"StatefulSet", true},
+		{"DaemonSet", false},
+		{"Job", false},
+	}
+	for _, tt := range tests {
+		if got := SupportedMoveParent(tt.kind); got != tt.want {
+			t.Errorf("SupportedMoveParent(%s) = %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+
+	if SupportedParent("StatefulSet") {
+		t.Errorf("SupportedParent(StatefulSet) should be false")
+	}
+}
+
 func podWithSccAnnotations(name, scc string) *api.Pod {
 	annotations := make(map[string]string)
 	annotations["openshift.io/scc"] = scc
@@ -208,3 +235,19 @@ func newPod(name string, annotations map[string]string) *api.Pod {
 		Spec: api.PodSpec{},
 	}
 }
+
+func TestIsScaleTargetOf(t *testing.T) {
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+	hpa.Namespace = "ns"
+	hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{APIVersion: "extensions/v1beta1", Kind: "Deployment", Name: "web"}
+
+	owner := &goutil.OwnerInfo{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "web"}
+	if !IsScaleTargetOf(hpa, owner) {
+		t.Errorf("Expect %s to be the scale target of the HPA", owner)
+	}
+
+	other := &goutil.OwnerInfo{APIVersion: "apps/v1", Kind: "StatefulSet", Namespace: "ns", Name: "web"}
+	if IsScaleTargetOf(hpa, other) {
+		t.Errorf("Expect %s not to be the scale target of the HPA", other)
+	}
+}
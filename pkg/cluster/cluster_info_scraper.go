@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"fmt"
+	"time"
 
 	api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,11 +12,15 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	goutil "github.com/turbonomic/kubeturbo/pkg/util"
 )
 
 const (
 	k8sDefaultNamespace   = "default"
 	kubernetesServiceName = "kubernetes"
+
+	// how long the discovered API resources are cached to resolve the scale targets in every discovery
+	resourceCacheTTL = 10 * time.Minute
 )
 
 var (
@@ -35,11 +40,15 @@ type ClusterScraperInterface interface {
 
 type ClusterScraper struct {
 	*client.Clientset
+
+	// resolves the scale targets of the HorizontalPodAutoscalers
+	resourceClient goutil.ResourceClient
 }
 
 func NewClusterScraper(kclient *client.Clientset) *ClusterScraper {
 	return &ClusterScraper{
-		Clientset: kclient,
+		Clientset:      kclient,
+		resourceClient: goutil.NewCachedResourceClient(goutil.NewResourceClient(kclient), resourceCacheTTL),
 	}
 }
 
@@ -179,6 +188,43 @@ func (s *ClusterScraper) GetKubernetesServiceID() (svcID string, err error) {
 	return
 }
 
+// Return a map from the pod key (namespace/name) to the HorizontalPodAutoscaler (namespace/name) which scales the pod.
+// The given pods of each HorizontalPodAutoscaler are matched by the label selector in the scale subresource of its target.
+func (s *ClusterScraper) GetPodHPAMap(pods []*api.Pod) (map[string]string, error) {
+	hpaList, err := s.AutoscalingV1().HorizontalPodAutoscalers(api.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list all HorizontalPodAutoscalers in the cluster: %s", err)
+	}
+
+	podHPAMap := make(map[string]string)
+	for i := range hpaList.Items {
+		hpa := &hpaList.Items[i]
+		hpaName := hpa.Namespace + "/" + hpa.Name
+		target, err := goutil.GetScaleTarget(s.resourceClient, hpa)
+		if err != nil {
+			glog.Errorf("Failed to get scale target of HorizontalPodAutoscaler %s: %v", hpaName, err)
+			continue
+		}
+		scale, err := goutil.GetScale(s.Clientset, target)
+		if err != nil {
+			glog.Errorf("Failed to get scale of the target of HorizontalPodAutoscaler %s: %v", hpaName, err)
+			continue
+		}
+		selector, err := goutil.GetScaleSelector(scale)
+		if err != nil {
+			glog.Errorf("Failed to get pod selector of HorizontalPodAutoscaler %s: %v", hpaName, err)
+			continue
+		}
+
+		for _, pod := range pods {
+			if pod.Namespace == hpa.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+				podHPAMap[util.PodKeyFunc(pod)] = hpaName
+			}
+		}
+	}
+	return podHPAMap, nil
+}
+
 func (s *ClusterScraper) GetRunningAndReadyPodsOnNodes(nodeList []*api.Node) []*api.Pod {
 	pods := []*api.Pod{}
 	for _, node := range nodeList {
@@ -4,6 +4,8 @@ import (
 	"github.com/turbonomic/kubeturbo/pkg/discovery/monitoring"
 	"github.com/turbonomic/kubeturbo/pkg/discovery/stitching"
 	"github.com/turbonomic/kubeturbo/pkg/kubeclient"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
+	api "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -18,4 +20,7 @@ type ProbeConfig struct {
 	ClusterClient *kubernetes.Clientset
 	// Rest Client for the kubelet module in each node
 	NodeClient *kubeclient.KubeletClient
+
+	// the extended resources of the containers sold as the commodities of the types
+	ExtendedResources map[proto.CommodityDTO_CommodityType]api.ResourceName
 }
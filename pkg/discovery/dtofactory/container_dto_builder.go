@@ -34,6 +34,9 @@ var (
 
 type containerDTOBuilder struct {
 	generalBuilder
+
+	// the extended resources sold as the commodities of the types
+	extendedResources map[proto.CommodityDTO_CommodityType]api.ResourceName
 }
 
 func NewContainerDTOBuilder(sink *metrics.EntityMetricSink) *containerDTOBuilder {
@@ -42,6 +45,11 @@ func NewContainerDTOBuilder(sink *metrics.EntityMetricSink) *containerDTOBuilder
 	}
 }
 
+func (builder *containerDTOBuilder) WithExtendedResources(resources map[proto.CommodityDTO_CommodityType]api.ResourceName) *containerDTOBuilder {
+	builder.extendedResources = resources
+	return builder
+}
+
 // get cpu frequency
 func (builder *containerDTOBuilder) getNodeCPUFrequency(pod *api.Pod) (float64, error) {
 	key := util.NodeKeyFromPodFunc(pod)
@@ -92,6 +100,15 @@ func (builder *containerDTOBuilder) BuildDTOs(pods []*api.Pod) ([]*proto.EntityD
 				glog.Errorf("failed to create commoditiesSold for container[%s]: %v", name, err)
 				continue
 			}
+			if !container.Resources.Limits.StorageEphemeral().IsZero() {
+				storageCommodity, err := builder.getStorageCommoditySold(containerMId)
+				if err != nil {
+					glog.V(3).Infof("Container[%s] doesn't sell VStorage: %v", name, err)
+				} else {
+					commoditiesSold = append(commoditiesSold, storageCommodity)
+				}
+			}
+			commoditiesSold = append(commoditiesSold, builder.getExtendedResourceCommoditiesSold(name, container)...)
 			ebuilder.SellsCommodities(commoditiesSold)
 
 			//2. commodities bought
@@ -177,6 +194,43 @@ func (builder *containerDTOBuilder) getCommoditiesSold(containerName, containerI
 	return result, nil
 }
 
+// VStorage, the ephemeral-storage of the container, is sold by Container with the ephemeral-storage limit as the capacity,
+// so that the limit is resized.
+func (builder *containerDTOBuilder) getStorageCommoditySold(containerMId string) (*proto.CommodityDTO, error) {
+	attrSetter := NewCommodityAttrSetter()
+	attrSetter.Add(func(commBuilder *sdkbuilder.CommodityDTOBuilder) { commBuilder.Resizable(true) }, metrics.EphemeralStorage)
+
+	return builder.getSoldResourceCommodityWithKey(metrics.ContainerType, containerMId, metrics.EphemeralStorage, "", nil, attrSetter)
+}
+
+// The configured extended resources with limits, e.g., nvidia.com/gpu, are sold by Container as their commodities,
+// so that they are resized. The extended resources are allocated as a whole, so the request of the container is used,
+// and its limit, which is required, is the capacity.
+func (builder *containerDTOBuilder) getExtendedResourceCommoditiesSold(containerName string, container *api.Container) []*proto.CommodityDTO {
+	var result []*proto.CommodityDTO
+	for ctype, resourceName := range builder.extendedResources {
+		limit, exist := container.Resources.Limits[resourceName]
+		if !exist {
+			continue
+		}
+		used := limit
+		if request, exist := container.Resources.Requests[resourceName]; exist {
+			used = request
+		}
+		commodity, err := sdkbuilder.NewCommodityDTOBuilder(ctype).
+			Capacity(float64(limit.Value())).
+			Used(float64(used.Value())).
+			Resizable(true).
+			Create()
+		if err != nil {
+			glog.Errorf("Failed to build commodity %s of extended resource %s for container[%s]: %v", ctype, resourceName, containerName, err)
+			continue
+		}
+		result = append(result, commodity)
+	}
+	return result
+}
+
 // vCPU, vMem and VMPMAccess are bought by Container from Pod;
 // the VMPMAccess is to bind the container to the hosting pod.
 func (builder *containerDTOBuilder) getCommoditiesBought(podId, containerName, containerMId string, cpuFrequency float64) ([]*proto.CommodityDTO, error) {
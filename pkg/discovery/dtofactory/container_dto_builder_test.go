@@ -2,8 +2,11 @@ package dtofactory
 
 import (
 	"fmt"
+	"github.com/turbonomic/kubeturbo/pkg/discovery/metrics"
 	podutil "github.com/turbonomic/kubeturbo/pkg/discovery/util"
+	"github.com/turbonomic/turbo-go-sdk/pkg/proto"
 	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"testing"
 )
 
@@ -61,3 +64,25 @@ func dumpPodFlags(pods []*api.Pod) {
 			parentKind)
 	}
 }
+
+func TestExtendedResourceCommoditiesSold(t *testing.T) {
+	gpu := api.ResourceName("nvidia.com/gpu")
+	builder := NewContainerDTOBuilder(metrics.NewEntityMetricSink()).
+		WithExtendedResources(map[proto.CommodityDTO_CommodityType]api.ResourceName{proto.CommodityDTO_PROCESSING_UNITS: gpu})
+
+	container := &api.Container{Name: "foo"}
+	if sold := builder.getExtendedResourceCommoditiesSold("foo", container); len(sold) != 0 {
+		t.Errorf("Expect no extended resource sold without the limit, but got %v", sold)
+	}
+
+	container.Resources.Limits = api.ResourceList{gpu: resource.MustParse("2")}
+	container.Resources.Requests = api.ResourceList{gpu: resource.MustParse("2")}
+	sold := builder.getExtendedResourceCommoditiesSold("foo", container)
+	if len(sold) != 1 {
+		t.Fatalf("Expect one extended resource sold, but got %v", sold)
+	}
+	if sold[0].GetCommodityType() != proto.CommodityDTO_PROCESSING_UNITS || sold[0].GetCapacity() != 2 ||
+		sold[0].GetUsed() != 2 || !sold[0].GetResizable() {
+		t.Errorf("Unexpected extended resource sold: %v", sold[0])
+	}
+}
@@ -20,6 +20,7 @@ var (
 		metrics.Transaction:       proto.CommodityDTO_TRANSACTION,
 		metrics.CPULimit:          proto.CommodityDTO_CPU_ALLOCATION,
 		metrics.MemoryLimit:       proto.CommodityDTO_MEM_ALLOCATION,
+		metrics.EphemeralStorage:  proto.CommodityDTO_VSTORAGE,
 	}
 )
 
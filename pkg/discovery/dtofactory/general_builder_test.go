@@ -192,3 +192,19 @@ func TestBuildCommBought(t *testing.T) {
 		fmt.Printf("%++v\n", err)
 	}
 }
+
+func TestBuildStorageSold(t *testing.T) {
+	container1 := "container1"
+	metricsSink = metrics.NewEntityMetricSink()
+	metricsSink.AddNewMetricEntries(
+		metrics.NewEntityResourceMetric(metrics.ContainerType, container1, metrics.EphemeralStorage, metrics.Used, 100.0),
+		metrics.NewEntityResourceMetric(metrics.ContainerType, container1, metrics.EphemeralStorage, metrics.Capacity, 512.0))
+
+	dtoBuilder := NewContainerDTOBuilder(metricsSink)
+	commSold, err := dtoBuilder.getStorageCommoditySold(container1)
+	assert.Nil(t, err)
+	assert.Equal(t, proto.CommodityDTO_VSTORAGE, commSold.GetCommodityType())
+	assert.Equal(t, 100.0, commSold.GetUsed())
+	assert.Equal(t, 512.0, commSold.GetCapacity())
+	assert.True(t, commSold.GetResizable())
+}
@@ -45,6 +45,8 @@ type podEntityDTOBuilder struct {
 	stitchingManager *stitching.StitchingManager
 	nodeNameUIDMap   map[string]string
 	quotaNameUIDMap  map[string]string
+	// pod key to the HorizontalPodAutoscaler scaling the pod
+	podHPAMap map[string]string
 }
 
 func NewPodEntityDTOBuilder(sink *metrics.EntityMetricSink, stitchingManager *stitching.StitchingManager,
@@ -57,6 +59,11 @@ func NewPodEntityDTOBuilder(sink *metrics.EntityMetricSink, stitchingManager *st
 	}
 }
 
+func (builder *podEntityDTOBuilder) WithPodHPAMap(podHPAMap map[string]string) *podEntityDTOBuilder {
+	builder.podHPAMap = podHPAMap
+	return builder
+}
+
 // Build entityDTOs based on the given pod list.
 func (builder *podEntityDTOBuilder) BuildEntityDTOs(pods []*api.Pod) ([]*proto.EntityDTO, error) {
 	var result []*proto.EntityDTO
@@ -301,6 +308,11 @@ func (builder *podEntityDTOBuilder) getPodProperties(pod *api.Pod) ([]*proto.Ent
 	podProperties := property.BuildPodProperties(pod)
 	properties = append(properties, podProperties...)
 
+	// the HorizontalPodAutoscaler scaling the pod, if any.
+	if hpaName, exist := builder.podHPAMap[util.PodKeyFunc(pod)]; exist {
+		properties = append(properties, property.BuildPodHPAProperty(hpaName))
+	}
+
 	podClusterID := util.GetPodClusterID(pod)
 	nodeName := pod.Spec.NodeName
 	if nodeName == "" {
@@ -14,6 +14,7 @@ const (
 	k8sPodName           = "KubernetesPodName"
 	k8sNodeName          = "KubernetesNodeName"
 	k8sContainerIndex    = "Kubernetes-Container-Index"
+	k8sHPAName           = "KubernetesHorizontalPodAutoscaler"
 )
 
 // Build entity properties of a pod. The properties are consisted of name and namespace of a pod.
@@ -41,6 +42,18 @@ func BuildPodProperties(pod *api.Pod) []*proto.EntityDTO_EntityProperty {
 	return properties
 }
 
+// Build the entity property of the HorizontalPodAutoscaler (namespace/name) scaling the pod.
+func BuildPodHPAProperty(hpaName string) *proto.EntityDTO_EntityProperty {
+	propertyNamespace := k8sPropertyNamespace
+	propertyName := k8sHPAName
+	propertyValue := hpaName
+	return &proto.EntityDTO_EntityProperty{
+		Namespace: &propertyNamespace,
+		Name:      &propertyName,
+		Value:     &propertyValue,
+	}
+}
+
 // Get the namespace and name of a pod from entity property.
 func GetPodInfoFromProperty(properties []*proto.EntityDTO_EntityProperty) (string, string, error) {
 	podNamespace := ""
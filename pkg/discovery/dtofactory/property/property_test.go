@@ -71,6 +71,13 @@ func TestBuildPodProperties(t *testing.T) {
 	}
 }
 
+func TestPodHPAProperty(t *testing.T) {
+	p := BuildPodHPAProperty("my-namespace/my-hpa")
+	if p.GetNamespace() != k8sPropertyNamespace || p.GetName() != k8sHPAName || p.GetValue() != "my-namespace/my-hpa" {
+		t.Errorf("Pod HPA property test failed: %++v", p)
+	}
+}
+
 func TestAddHostingPodProperties(t *testing.T) {
 	namespace := "xyz"
 	name := "poda"
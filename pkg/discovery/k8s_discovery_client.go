@@ -163,6 +163,16 @@ func (dc *K8sDiscoveryClient) discoverWithNewFramework() ([]*proto.EntityDTO, er
 	}
 	clusterSummary := repository.CreateClusterSummary(kubeCluster)
 
+	// HorizontalPodAutoscalers of the pods, matched against all the pods listed once
+	pods, err := dc.k8sClusterScraper.GetAllPods()
+	if err != nil {
+		glog.Errorf("Failed to list pods for HorizontalPodAutoscalers: %s", err)
+	} else if podHPAMap, err := dc.k8sClusterScraper.GetPodHPAMap(pods); err != nil {
+		glog.Errorf("Failed to discover HorizontalPodAutoscalers: %s", err)
+	} else {
+		clusterSummary.PodHPAMap = podHPAMap
+	}
+
 	// Multiple discovery workers to create node and pod DTOs
 	nodes := clusterSummary.NodeList
 	// Call cache cleanup
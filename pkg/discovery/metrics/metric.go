@@ -27,6 +27,7 @@ const (
 	MemoryRequest     ResourceType = "MemoryRequest"
 	CPUProvisioned    ResourceType = "CPUProvisioned"
 	MemoryProvisioned ResourceType = "MemoryProvisioned"
+	EphemeralStorage  ResourceType = "EphemeralStorage"
 	Transaction       ResourceType = "Transaction"
 	ObjectCount       ResourceType = "ObjectCount"
 
@@ -194,7 +194,14 @@ func (m *KubeletMonitor) parseContainerStats(pod *stats.PodStats) (float64, floa
 
 		glog.V(4).Infof("container[%s-%s] cpu/memory usage:%.3f, %.3f", pod.PodRef.Name, container.Name, cpuUsed, memUsed)
 
-		//2. app Used
+		//2. container ephemeral-storage Used
+		if storageUsed, exist := getEphemeralStorageUsed(container); exist {
+			m.metricSink.AddNewMetricEntries(metrics.NewEntityResourceMetric(metrics.ContainerType, containerMId,
+				metrics.EphemeralStorage, metrics.Used, storageUsed))
+			glog.V(4).Infof("container[%s-%s] ephemeral-storage usage:%.3f MB", pod.PodRef.Name, container.Name, storageUsed)
+		}
+
+		//3. app Used
 		appMId := util.ApplicationMetricId(containerMId)
 		m.genUsedMetrics(metrics.ApplicationType, appMId, cpuUsed, memUsed)
 	}
@@ -202,6 +209,19 @@ func (m *KubeletMonitor) parseContainerStats(pod *stats.PodStats) (float64, floa
 	return totalUsedCPU, totalUsedMem
 }
 
+// the ephemeral-storage used by the container, in MB: its writable layer and its logs.
+func getEphemeralStorageUsed(container *stats.ContainerStats) (float64, bool) {
+	exist := false
+	used := uint64(0)
+	for _, fs := range []*stats.FsStats{container.Rootfs, container.Logs} {
+		if fs != nil && fs.UsedBytes != nil {
+			used += *fs.UsedBytes
+			exist = true
+		}
+	}
+	return float64(used) / util.MegabytesToBytes, exist
+}
+
 func (m *KubeletMonitor) genUsedMetrics(etype metrics.DiscoveredEntityType, key string, cpu, memory float64) {
 	cpuMetric := metrics.NewEntityResourceMetric(etype, key, metrics.CPU, metrics.Used, cpu)
 	memMetric := metrics.NewEntityResourceMetric(etype, key, metrics.Memory, metrics.Used, memory)
@@ -207,3 +207,19 @@ func TestParseStats(t *testing.T) {
 		}
 	}
 }
+
+func TestGetEphemeralStorageUsed(t *testing.T) {
+	container := createContainerStat("container1", 100, 100)
+	if _, exist := getEphemeralStorageUsed(&container); exist {
+		t.Errorf("Unexpected ephemeral-storage usage without the filesystem stats")
+	}
+
+	rootfs := uint64(3 * util.MegabytesToBytes)
+	logs := uint64(util.MegabytesToBytes)
+	container.Rootfs = &stats.FsStats{UsedBytes: &rootfs}
+	container.Logs = &stats.FsStats{UsedBytes: &logs}
+	used, exist := getEphemeralStorageUsed(&container)
+	if !exist || math.Abs(used-4) > myzero {
+		t.Errorf("Expect ephemeral-storage usage of 4 MB, but got %v, %v", used, exist)
+	}
+}
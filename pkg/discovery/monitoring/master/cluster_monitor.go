@@ -218,6 +218,7 @@ func (m *ClusterMonitor) genPodMetrics(pod *api.Pod, nodeCPUCapacity, nodeMemCap
 }
 
 // Container.Capacity = container.Limit if limit is set, otherwise is Pod.Capacity
+// The ephemeral-storage of the container is only sold with its limit as the capacity.
 // Application won't sell CPU/Memory, so no need to application CPU/Memory Capacity for application
 func (m *ClusterMonitor) genContainerMetrics(pod *api.Pod, podCPU, podMem float64) (float64, float64) {
 
@@ -253,6 +254,12 @@ func (m *ClusterMonitor) genContainerMetrics(pod *api.Pod, podCPU, podMem float6
 
 		totalCPU += cpuRequest
 		totalMem += memRequest
+
+		//3. ephemeral-storage capacity in MB, only if the limit is set
+		if storageLimit := limits.StorageEphemeral().Value(); storageLimit > 0 {
+			m.sink.AddNewMetricEntries(metrics.NewEntityResourceMetric(metrics.ContainerType, containerMId,
+				metrics.EphemeralStorage, metrics.Capacity, float64(storageLimit)/util.MegabytesToBytes))
+		}
 	}
 
 	return totalCPU, totalMem
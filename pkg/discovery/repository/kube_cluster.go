@@ -99,6 +99,8 @@ type ClusterSummary struct {
 	QuotaMap        map[string]*KubeQuota
 	NodeNameUIDMap  map[string]string
 	QuotaNameUIDMap map[string]string
+	// pod key (namespace/name) to the HorizontalPodAutoscaler (namespace/name) scaling the pod
+	PodHPAMap map[string]string
 }
 
 func CreateClusterSummary(kubeCluster *KubeCluster) *ClusterSummary {
@@ -109,6 +111,7 @@ func CreateClusterSummary(kubeCluster *KubeCluster) *ClusterSummary {
 		QuotaMap:        make(map[string]*KubeQuota),
 		NodeNameUIDMap:  make(map[string]string),
 		QuotaNameUIDMap: make(map[string]string),
+		PodHPAMap:       make(map[string]string),
 	}
 
 	clusterSummary.computeNodeMap()
@@ -254,6 +257,19 @@ type KubeQuota struct {
 	QuotaList               []*v1.ResourceQuota
 	AverageNodeCpuFrequency float64
 	AllocationDefined       map[metrics.ResourceType]bool
+	// the most restrictive resource quota object of each allocation resource, which is changed to resize the resource
+	AllocationQuota map[metrics.ResourceType]*v1.ResourceQuota
+}
+
+// Create an empty Quota object for a namespace, to be reconciled with the resource quota objects.
+func NewKubeQuota(clusterName, namespace, uuid string) *KubeQuota {
+	return &KubeQuota{
+		KubeEntity: NewKubeEntity(metrics.QuotaType, clusterName,
+			namespace, namespace, uuid),
+		QuotaList:         []*v1.ResourceQuota{},
+		AllocationDefined: make(map[metrics.ResourceType]bool),
+		AllocationQuota:   make(map[metrics.ResourceType]*v1.ResourceQuota),
+	}
 }
 
 func (quotaEntity *KubeQuota) String() string {
@@ -285,12 +301,7 @@ func (quotaEntity *KubeQuota) String() string {
 // The resource quota limits are based on the cluster compute resource limits.
 func CreateDefaultQuota(clusterName, namespace, uuid string,
 	clusterResources map[metrics.ResourceType]*KubeDiscoveredResource) *KubeQuota {
-	quota := &KubeQuota{
-		KubeEntity: NewKubeEntity(metrics.QuotaType, clusterName,
-			namespace, namespace, uuid),
-		QuotaList:         []*v1.ResourceQuota{},
-		AllocationDefined: make(map[metrics.ResourceType]bool),
-	}
+	quota := NewKubeQuota(clusterName, namespace, uuid)
 
 	// create quota allocation resources
 	for _, rt := range metrics.ComputeAllocationResources {
@@ -347,10 +358,12 @@ func (quotaEntity *KubeQuota) ReconcileQuotas(quotas []*v1.ResourceQuota) {
 				if existingResource.Capacity == DEFAULT_METRIC_VALUE || capacityValue < existingResource.Capacity {
 					existingResource.Capacity = capacityValue
 					existingResource.Used = usedValue
+					quotaEntity.AllocationQuota[resourceType] = item
 				}
 			} else {
 				// create resource if it does not exist
 				quotaEntity.AddAllocationResource(resourceType, capacityValue, usedValue)
+				quotaEntity.AllocationQuota[resourceType] = item
 			}
 		}
 	}
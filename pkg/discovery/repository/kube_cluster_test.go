@@ -137,6 +137,34 @@ func TestKubeQuota(t *testing.T) {
 	}
 }
 
+func TestKubeQuotaMostRestrictive(t *testing.T) {
+	namespace := "ns1"
+
+	var quotaList []*v1.ResourceQuota
+	for _, testQuota := range TestQuotas {
+		quotaList = append(quotaList, &v1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testQuota.name,
+				UID:       types.UID(testQuota.name),
+				Namespace: namespace,
+			},
+			Status: v1.ResourceQuotaStatus{
+				Hard: v1.ResourceList{
+					v1.ResourceLimitsCPU:    resource.MustParse(testQuota.cpuLimit),
+					v1.ResourceLimitsMemory: resource.MustParse(testQuota.memLimit),
+				},
+			},
+		})
+	}
+
+	kubeQuota := NewKubeQuota("cluster1", namespace, "vdc-1")
+	kubeQuota.ReconcileQuotas(quotaList)
+
+	assert.Equal(t, "quota2", kubeQuota.AllocationQuota[metrics.CPULimit].Name)
+	assert.Equal(t, "quota3", kubeQuota.AllocationQuota[metrics.MemoryLimit].Name)
+	assert.Nil(t, kubeQuota.AllocationQuota[metrics.CPURequest])
+}
+
 func TestKubeQuotaWithMissingAllocations(t *testing.T) {
 	namespace := "ns1"
 	cluster := "cluster1"
@@ -8,4 +8,6 @@ const (
 	MilliToUnit float64 = 1E3
 
 	MegaToKilo float64 = 1E3
+
+	MegabytesToBytes float64 = 1024.0 * 1024.0
 )
@@ -18,7 +18,7 @@ import (
 
 //----------------------------------------- Node Affinity -------------------------------------------------------
 
-func matchesNodeSelector(pod *api.Pod, node *api.Node) bool {
+func MatchesNodeSelector(pod *api.Pod, node *api.Node) bool {
 	// Check if node.Labels match pod.Spec.NodeSelector.
 	if len(pod.Spec.NodeSelector) > 0 {
 		selector := labels.SelectorFromSet(pod.Spec.NodeSelector)
@@ -30,7 +30,7 @@ func matchesNodeSelector(pod *api.Pod, node *api.Node) bool {
 }
 
 // The pod can only schedule onto nodes that satisfy requirements in both NodeAffinity and nodeSelector.
-func matchesNodeAffinity(pod *api.Pod, node *api.Node) bool {
+func MatchesNodeAffinity(pod *api.Pod, node *api.Node) bool {
 	nodeAffinityMatches := true
 	affinity := pod.Spec.Affinity
 	if affinity != nil && affinity.NodeAffinity != nil {
@@ -44,15 +44,15 @@ func matchesNodeAffinity(pod *api.Pod, node *api.Node) bool {
 		if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
 			nodeSelectorTerms := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
 			glog.V(10).Infof("Match for RequiredDuringSchedulingIgnoredDuringExecution node selector terms %+v", nodeSelectorTerms)
-			nodeAffinityMatches = nodeAffinityMatches && nodeMatchesNodeSelectorTerms(node, nodeSelectorTerms)
+			nodeAffinityMatches = nodeAffinityMatches && NodeMatchesNodeSelectorTerms(node, nodeSelectorTerms)
 		}
 	}
 	return nodeAffinityMatches
 }
 
-// nodeMatchesNodeSelectorTerms checks if a node's labels satisfy a list of node selector terms,
+// NodeMatchesNodeSelectorTerms checks if a node's labels satisfy a list of node selector terms,
 // terms are ORed, and an empty list of terms will match nothing.
-func nodeMatchesNodeSelectorTerms(node *api.Node, nodeSelectorTerms []api.NodeSelectorTerm) bool {
+func NodeMatchesNodeSelectorTerms(node *api.Node, nodeSelectorTerms []api.NodeSelectorTerm) bool {
 	for _, req := range nodeSelectorTerms {
 		nodeSelector, err := nodeSelectorRequirementsAsSelector(req.MatchExpressions)
 		if err != nil {
@@ -68,7 +68,7 @@ func nodeMatchesNodeSelectorTerms(node *api.Node, nodeSelectorTerms []api.NodeSe
 
 //----------------------------------------- Pod Affinity -------------------------------------------------------
 
-func interPodAffinityMatches(pod *api.Pod, node *api.Node, allPodsNodesMap map[*api.Pod]*api.Node) bool {
+func InterPodAffinityMatches(pod *api.Pod, node *api.Node, allPodsNodesMap map[*api.Pod]*api.Node) bool {
 	if !satisfiesExistingPodsAntiAffinity(pod, node, allPodsNodesMap) {
 		return false
 	}
@@ -84,10 +84,10 @@ func (am *AffinityProcessor) processAffinityPerPod(pod *api.Pod, podsNodesMap ma
 	}
 
 	for _, node := range am.nodes {
-		if matchesNodeSelector(pod, node) && matchesNodeAffinity(pod, node) {
+		if MatchesNodeSelector(pod, node) && MatchesNodeAffinity(pod, node) {
 			am.addAffinityAccessCommodities(pod, node, nodeAffinityAccessCommoditiesSold, nodeAffinityAccessCommoditiesBought)
 		}
-		if interPodAffinityMatches(pod, node, podsNodesMap) {
+		if InterPodAffinityMatches(pod, node, podsNodesMap) {
 			am.addAffinityAccessCommodities(pod, node, podAffinityCommodityDTOsSold, podAffinityCommodityDTOsBought)
 		}
 	}
@@ -29,6 +29,9 @@ type k8sDiscoveryWorkerConfig struct {
 	monitoringSourceConfigs map[types.MonitorType][]monitoring.MonitorWorkerConfig
 
 	stitchingPropertyType stitching.StitchingPropertyType
+
+	// the extended resources of the containers sold as the commodities of the types
+	extendedResources map[proto.CommodityDTO_CommodityType]api.ResourceName
 }
 
 func NewK8sDiscoveryWorkerConfig(sType stitching.StitchingPropertyType) *k8sDiscoveryWorkerConfig {
@@ -38,6 +41,11 @@ func NewK8sDiscoveryWorkerConfig(sType stitching.StitchingPropertyType) *k8sDisc
 	}
 }
 
+func (c *k8sDiscoveryWorkerConfig) WithExtendedResources(resources map[proto.CommodityDTO_CommodityType]api.ResourceName) *k8sDiscoveryWorkerConfig {
+	c.extendedResources = resources
+	return c
+}
+
 // Add new monitoring worker config to the discovery worker config.
 func (c *k8sDiscoveryWorkerConfig) WithMonitoringWorkerConfig(config monitoring.MonitorWorkerConfig) *k8sDiscoveryWorkerConfig {
 	monitorType := config.GetMonitorType()
@@ -307,15 +315,17 @@ func (worker *k8sDiscoveryWorker) buildDTOs(currTask *task.Task) ([]*proto.Entit
 	//2. build entityDTOs for pods
 	quotaNameUIDMap := make(map[string]string)
 	nodeNameUIDMap := make(map[string]string)
+	podHPAMap := make(map[string]string)
 	if cluster != nil {
 		quotaNameUIDMap = cluster.QuotaNameUIDMap // quota providers
 		nodeNameUIDMap = cluster.NodeNameUIDMap   // node providers
+		podHPAMap = cluster.PodHPAMap
 	}
 	pods := currTask.PodList()
 	glog.V(3).Infof("Worker %s receives %d pods.", worker.id, len(pods))
 
 	podEntityDTOBuilder := dtofactory.NewPodEntityDTOBuilder(worker.sink, stitchingManager,
-		nodeNameUIDMap, quotaNameUIDMap)
+		nodeNameUIDMap, quotaNameUIDMap).WithPodHPAMap(podHPAMap)
 	podEntityDTOs, err := podEntityDTOBuilder.BuildEntityDTOs(pods)
 	if err != nil {
 		glog.Errorf("Error while creating pod entityDTOs: %v", err)
@@ -328,7 +338,7 @@ func (worker *k8sDiscoveryWorker) buildDTOs(currTask *task.Task) ([]*proto.Entit
 	pods = excludeFailedPods(pods, podEntityDTOs)
 
 	//3. build entityDTOs for containers
-	containerDTOBuilder := dtofactory.NewContainerDTOBuilder(worker.sink)
+	containerDTOBuilder := dtofactory.NewContainerDTOBuilder(worker.sink).WithExtendedResources(worker.config.extendedResources)
 	containerDTOs, err := containerDTOBuilder.BuildDTOs(pods)
 	//util.DumpTopology(containerDTOs, "test-topology.dat")
 	if err != nil {
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	restclient "k8s.io/client-go/rest"
 
 	"github.com/turbonomic/kubeturbo/pkg/action"
+	"github.com/turbonomic/kubeturbo/pkg/action/executor"
 	"github.com/turbonomic/kubeturbo/pkg/discovery"
 	"github.com/turbonomic/kubeturbo/pkg/discovery/configs"
 	"github.com/turbonomic/kubeturbo/pkg/registration"
@@ -107,9 +109,47 @@ func NewKubernetesTAPService(config *Config) (*K8sTAPService, error) {
 	registrationClientConfig := registration.NewRegistrationClientConfig(config.StitchingPropType, config.VMPriority, config.VMIsBase)
 
 	probeConfig := createProbeConfigOrDie(config)
+	// the extended resources are sold by the containers, and resized by the container resize actions
+	extendedResources, err := executor.ParseExtendedResources(config.ExtendedResources)
+	if err != nil {
+		return nil, err
+	}
+	probeConfig.ExtendedResources = extendedResources
 	discoveryClientConfig := discovery.NewDiscoveryConfig(probeConfig, config.tapSpec.K8sTargetConfig, config.ValidationWorkers, config.ValidationTimeoutSec)
 
-	actionHandlerConfig := action.NewActionHandlerConfig(config.Client, config.KubeletClient, config.SccSupport)
+	actionHandlerConfig := action.NewActionHandlerConfig(config.Client, config.KubeletClient, config.SccSupport).
+		WithPodEviction(config.UsePodEviction).
+		WithContainerResizeMode(config.ContainerResizeMode).
+		WithHPAScalingPolicy(config.HPAScalingPolicy).
+		WithEmptyDirPolicy(config.EmptyDirPolicy).
+		WithDryRun(config.DryRun).
+		WithEventRecorder(config.Recorder).
+		WithActionJournalNamespace(config.ActionJournalNamespace).
+		WithActionLockStore(config.ActionLockStore).
+		WithCloneGarbageCollector(config.CloneGCMode, time.Duration(config.CloneGCIntervalSec)*time.Second,
+			time.Duration(config.CloneGCGracePeriodSec)*time.Second).
+		WithApproval(config.ActionApproval, time.Duration(config.ActionApprovalTimeoutSec)*time.Second).
+		WithConcurrencyBudgets(action.ConcurrencyBudgets{
+			Cluster:            config.ActionBudgetCluster,
+			Namespace:          config.ActionBudgetNamespace,
+			Controller:         config.ActionBudgetController,
+			ControllerFraction: config.ActionBudgetControllerFraction,
+		}).
+		WithExtendedResources(extendedResources)
+	if config.ActionPolicyFile != "" {
+		policy, err := action.LoadExecutionPolicy(config.ActionPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		actionHandlerConfig.WithExecutionPolicy(policy)
+	}
+	if config.ActionAuditLog != "" {
+		auditLog, err := action.NewAuditLog(config.ActionAuditLog, config.ActionAuditLogMaxSizeMB)
+		if err != nil {
+			return nil, err
+		}
+		actionHandlerConfig.WithAuditLog(auditLog)
+	}
 
 	// Kubernetes Probe Registration Client
 	registrationClient := registration.NewK8sRegistrationClient(registrationClientConfig)
@@ -119,6 +159,7 @@ func NewKubernetesTAPService(config *Config) (*K8sTAPService, error) {
 
 	// Kubernetes Probe Action Execution Client
 	actionHandler := action.NewActionHandler(actionHandlerConfig)
+	actionHandler.Start()
 
 	// The KubeTurbo TAP Service that will register the kubernetes target with the
 	// Turbonomic server and await for validation, discovery, action execution requests
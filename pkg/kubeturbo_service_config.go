@@ -4,6 +4,7 @@ import (
 	"github.com/turbonomic/kubeturbo/pkg/discovery/stitching"
 	"github.com/turbonomic/kubeturbo/pkg/kubeclient"
 	client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 // Configuration created using the parameters passed to the kubeturbo service container.
@@ -28,6 +29,55 @@ type Config struct {
 	ValidationTimeoutSec int
 
 	SccSupport []string
+
+	// Delete pods through the Eviction subresource during actions, to honor PodDisruptionBudgets
+	UsePodEviction bool
+
+	// The container resize mode for the pods owned by controllers: pod or controller
+	ContainerResizeMode string
+
+	// How to scale the controllers which are scaled by HorizontalPodAutoscalers: refuse or adjust
+	HPAScalingPolicy string
+
+	// How to move the pods with emptyDir volumes: allow or refuse
+	EmptyDirPolicy string
+
+	// The extended resources of the containers resized by the commodities of the types, in COMMODITY_TYPE=resource-name
+	ExtendedResources []string
+
+	// Execute all the actions in dry-run mode
+	DryRun bool
+
+	// The recorder of the Kubernetes Events for the actions
+	Recorder record.EventRecorder
+
+	// The namespace of the ConfigMap storing the action journal
+	ActionJournalNamespace string
+
+	// The store of the action locks: memory, or lease to share the locks with the other kubeturbo instances
+	ActionLockStore string
+
+	// The garbage collector of the orphaned clone pods: delete, report or disabled
+	CloneGCMode           string
+	CloneGCIntervalSec    int
+	CloneGCGracePeriodSec int
+
+	// The path of the file declaring which actions may be executed
+	ActionPolicyFile string
+
+	// The concurrency budgets of the disruptive actions in the cluster, per namespace and per controller
+	ActionBudgetCluster            int
+	ActionBudgetNamespace          int
+	ActionBudgetController         int
+	ActionBudgetControllerFraction float64
+
+	// The audit log of the executed actions, and its max size in MB before rotation
+	ActionAuditLog          string
+	ActionAuditLogMaxSizeMB int
+
+	// All the actions wait for approval through their TurboAction custom resources, and how long they wait
+	ActionApproval           bool
+	ActionApprovalTimeoutSec int
 }
 
 func NewVMTConfig2() *Config {
@@ -92,3 +142,80 @@ func (c *Config) WithSccSupport(sccSupport []string) *Config {
 	c.SccSupport = sccSupport
 	return c
 }
+
+func (c *Config) WithPodEviction(usePodEviction bool) *Config {
+	c.UsePodEviction = usePodEviction
+	return c
+}
+
+func (c *Config) WithContainerResizeMode(mode string) *Config {
+	c.ContainerResizeMode = mode
+	return c
+}
+
+func (c *Config) WithHPAScalingPolicy(policy string) *Config {
+	c.HPAScalingPolicy = policy
+	return c
+}
+
+func (c *Config) WithDryRun(dryRun bool) *Config {
+	c.DryRun = dryRun
+	return c
+}
+
+func (c *Config) WithEventRecorder(recorder record.EventRecorder) *Config {
+	c.Recorder = recorder
+	return c
+}
+
+func (c *Config) WithActionJournalNamespace(namespace string) *Config {
+	c.ActionJournalNamespace = namespace
+	return c
+}
+
+func (c *Config) WithCloneGarbageCollector(mode string, intervalSec, gracePeriodSec int) *Config {
+	c.CloneGCMode = mode
+	c.CloneGCIntervalSec = intervalSec
+	c.CloneGCGracePeriodSec = gracePeriodSec
+	return c
+}
+
+func (c *Config) WithActionPolicyFile(path string) *Config {
+	c.ActionPolicyFile = path
+	return c
+}
+
+func (c *Config) WithActionApproval(required bool, timeoutSec int) *Config {
+	c.ActionApproval = required
+	c.ActionApprovalTimeoutSec = timeoutSec
+	return c
+}
+
+func (c *Config) WithActionAuditLog(path string, maxSizeMB int) *Config {
+	c.ActionAuditLog = path
+	c.ActionAuditLogMaxSizeMB = maxSizeMB
+	return c
+}
+
+func (c *Config) WithActionLockStore(store string) *Config {
+	c.ActionLockStore = store
+	return c
+}
+
+func (c *Config) WithEmptyDirPolicy(policy string) *Config {
+	c.EmptyDirPolicy = policy
+	return c
+}
+
+func (c *Config) WithExtendedResources(resources []string) *Config {
+	c.ExtendedResources = resources
+	return c
+}
+
+func (c *Config) WithActionBudgets(cluster, namespace, controller int, controllerFraction float64) *Config {
+	c.ActionBudgetCluster = cluster
+	c.ActionBudgetNamespace = namespace
+	c.ActionBudgetController = controller
+	c.ActionBudgetControllerFraction = controllerFraction
+	return c
+}
@@ -112,6 +112,27 @@ func (rClient *K8sRegistrationClient) GetActionPolicy() []*proto.ActionPolicyDTO
 
 	rClient.addActionPolicy(ab, app, appPolicy)
 
+	//4. node: support suspend (cordon and drain), start (uncordon) and provision (through Cluster API); not move or resize
+	node := proto.EntityDTO_VIRTUAL_MACHINE
+	nodePolicy := make(map[proto.ActionItemDTO_ActionType]proto.ActionPolicyDTO_ActionCapability)
+	nodePolicy[proto.ActionItemDTO_SUSPEND] = supported
+	nodePolicy[proto.ActionItemDTO_START] = supported
+	nodePolicy[proto.ActionItemDTO_PROVISION] = supported
+	nodePolicy[proto.ActionItemDTO_MOVE] = notSupported
+	nodePolicy[proto.ActionItemDTO_RIGHT_SIZE] = notSupported
+
+	rClient.addActionPolicy(ab, node, nodePolicy)
+
+	//5. quota of namespace: support resize (of the ResourceQuota); not move, provision or suspend
+	quota := proto.EntityDTO_VIRTUAL_DATACENTER
+	quotaPolicy := make(map[proto.ActionItemDTO_ActionType]proto.ActionPolicyDTO_ActionCapability)
+	quotaPolicy[proto.ActionItemDTO_RIGHT_SIZE] = supported
+	quotaPolicy[proto.ActionItemDTO_MOVE] = notSupported
+	quotaPolicy[proto.ActionItemDTO_PROVISION] = notSupported
+	quotaPolicy[proto.ActionItemDTO_SUSPEND] = notSupported
+
+	rClient.addActionPolicy(ab, quota, quotaPolicy)
+
 	return ab.Create()
 }
 
@@ -41,11 +41,14 @@ func TestK8sRegistrationClient_GetActionPolicy(t *testing.T) {
 	pod := proto.EntityDTO_CONTAINER_POD
 	container := proto.EntityDTO_CONTAINER
 	app := proto.EntityDTO_APPLICATION
+	node := proto.EntityDTO_VIRTUAL_MACHINE
+	quota := proto.EntityDTO_VIRTUAL_DATACENTER
 
 	move := proto.ActionItemDTO_MOVE
 	resize := proto.ActionItemDTO_RIGHT_SIZE
 	provision := proto.ActionItemDTO_PROVISION
 	suspend := proto.ActionItemDTO_SUSPEND
+	start := proto.ActionItemDTO_START
 
 	expected_pod := make(map[proto.ActionItemDTO_ActionType]proto.ActionPolicyDTO_ActionCapability)
 	expected_pod[move] = supported
@@ -65,6 +68,19 @@ func TestK8sRegistrationClient_GetActionPolicy(t *testing.T) {
 	expected_app[provision] = recommend
 	expected_app[suspend] = recommend
 
+	expected_node := make(map[proto.ActionItemDTO_ActionType]proto.ActionPolicyDTO_ActionCapability)
+	expected_node[move] = notSupported
+	expected_node[resize] = notSupported
+	expected_node[provision] = supported
+	expected_node[suspend] = supported
+	expected_node[start] = supported
+
+	expected_quota := make(map[proto.ActionItemDTO_ActionType]proto.ActionPolicyDTO_ActionCapability)
+	expected_quota[move] = notSupported
+	expected_quota[resize] = supported
+	expected_quota[provision] = notSupported
+	expected_quota[suspend] = notSupported
+
 	policies := reg.GetActionPolicy()
 
 	for _, item := range policies {
@@ -77,6 +93,10 @@ func TestK8sRegistrationClient_GetActionPolicy(t *testing.T) {
 			expected = expected_container
 		} else if entity == app {
 			expected = expected_app
+		} else if entity == node {
+			expected = expected_node
+		} else if entity == quota {
+			expected = expected_quota
 		} else {
 			t.Errorf("Unknown entity type: %v", entity)
 			continue
@@ -4,4 +4,6 @@ const (
 	KindReplicationController = "ReplicationController"
 	KindReplicaSet            = "ReplicaSet"
 	KindDeployment            = "Deployment"
+	KindStatefulSet           = "StatefulSet"
+	KindDaemonSet             = "DaemonSet"
 )
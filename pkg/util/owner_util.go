@@ -0,0 +1,329 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	client "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the name of the scale subresource
+	ScaleSubResource = "scale"
+
+	// the maximal depth of the owner reference chain to walk, in case of cyclic references
+	maxOwnerDepth = 10
+)
+
+// ResourceClient gets the objects of any kind by their REST paths, and discovers the resources served by the API server.
+// It decouples the generic owner and Machine utilities from the typed Clientset.
+// The owners are resolved for both the actions and the discovery, so these utilities are shared by them.
+type ResourceClient interface {
+	ServerGroups() (*metav1.APIGroupList, error)
+	ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error)
+	// get the object or the list of objects of the absolute REST path
+	GetRaw(path string) ([]byte, error)
+}
+
+type clientsetResourceClient struct {
+	kubeClient *client.Clientset
+}
+
+// NewResourceClient creates the ResourceClient with the discovery client of the Clientset.
+func NewResourceClient(kubeClient *client.Clientset) ResourceClient {
+	return &clientsetResourceClient{kubeClient: kubeClient}
+}
+
+func (c *clientsetResourceClient) ServerGroups() (*metav1.APIGroupList, error) {
+	return c.kubeClient.Discovery().ServerGroups()
+}
+
+func (c *clientsetResourceClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	return c.kubeClient.Discovery().ServerResourcesForGroupVersion(groupVersion)
+}
+
+func (c *clientsetResourceClient) GetRaw(path string) ([]byte, error) {
+	return c.kubeClient.Discovery().RESTClient().Get().AbsPath(path).DoRaw()
+}
+
+// cachedResourceClient caches the discovered resources of the group versions for the ttl,
+// as they rarely change but are looked up for every owner.
+type cachedResourceClient struct {
+	ResourceClient
+	ttl time.Duration
+
+	lock      sync.Mutex
+	resources map[string]*cachedResourceList
+}
+
+type cachedResourceList struct {
+	list    *metav1.APIResourceList
+	expires time.Time
+}
+
+// NewCachedResourceClient creates the ResourceClient caching the discovered resources of the ResourceClient for the ttl.
+func NewCachedResourceClient(rc ResourceClient, ttl time.Duration) ResourceClient {
+	return &cachedResourceClient{
+		ResourceClient: rc,
+		ttl:            ttl,
+		resources:      make(map[string]*cachedResourceList),
+	}
+}
+
+func (c *cachedResourceClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	c.lock.Lock()
+	cached, exist := c.resources[groupVersion]
+	c.lock.Unlock()
+	if exist && time.Now().Before(cached.expires) {
+		return cached.list, nil
+	}
+
+	list, err := c.ResourceClient.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.resources[groupVersion] = &cachedResourceList{list: list, expires: time.Now().Add(c.ttl)}
+	c.lock.Unlock()
+	return list, nil
+}
+
+// OwnerInfo describes a kubernetes object owning pods, e.g., a ReplicaSet, a Deployment, or a custom resource.
+type OwnerInfo struct {
+	APIVersion string
+	Kind       string
+	// the plural resource name of the kind, e.g., deployments
+	Resource  string
+	Namespace string
+	Name      string
+
+	// whether the resource has the /scale subresource
+	Scalable bool
+}
+
+func (o *OwnerInfo) String() string {
+	return fmt.Sprintf("%s-%s/%s", o.Kind, o.Namespace, o.Name)
+}
+
+// Path returns the absolute REST path of the owner object, e.g., /apis/apps/v1/namespaces/foo/deployments/bar
+func (o *OwnerInfo) Path(subresources ...string) string {
+	segments := []string{GroupVersionPath(o.APIVersion), "namespaces", o.Namespace, o.Resource, o.Name}
+	segments = append(segments, subresources...)
+	return strings.Join(segments, "/")
+}
+
+// GroupVersionPath returns the REST path prefix of the api version: /api/v1 for the core group, /apis/group/version otherwise.
+func GroupVersionPath(apiVersion string) string {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil || gv.Group == "" {
+		return "/api/" + apiVersion
+	}
+	return "/apis/" + gv.Group + "/" + gv.Version
+}
+
+// GetTopOwner walks the controller owner references from the pod, and returns the top-level owner,
+// e.g., Pod -> ReplicaSet -> Deployment returns the Deployment.
+// The owners can be of any kind, including custom resources, as long as they are discoverable from the API server.
+func GetTopOwner(kubeClient *client.Clientset, pod *api.Pod) (*OwnerInfo, error) {
+	chain, err := GetOwnerChain(kubeClient, pod)
+	if err != nil {
+		return nil, err
+	}
+	owner := chain[len(chain)-1]
+	glog.V(3).Infof("Top-level owner of pod %s/%s is %s", pod.Namespace, pod.Name, owner)
+	return owner, nil
+}
+
+// GetScalableOwner walks the controller owner references from the pod, and returns the highest owner which has
+// the /scale subresource, e.g., the Deployment of a custom resource managing Deployments without /scale.
+// The top-level owner is returned if none of the owners has the /scale subresource.
+func GetScalableOwner(kubeClient *client.Clientset, pod *api.Pod) (*OwnerInfo, error) {
+	chain, err := GetOwnerChain(kubeClient, pod)
+	if err != nil {
+		return nil, err
+	}
+	owner := getHighestScalableOwner(chain)
+	glog.V(3).Infof("Scalable owner of pod %s/%s is %s", pod.Namespace, pod.Name, owner)
+	return owner, nil
+}
+
+// GetOwnerChain walks the controller owner references from the pod, and returns the owners from the controller
+// of the pod up to the top-level owner, e.g., [ReplicaSet, Deployment].
+func GetOwnerChain(kubeClient *client.Clientset, pod *api.Pod) ([]*OwnerInfo, error) {
+	return GetObjectOwnerChain(NewResourceClient(kubeClient), pod.Namespace, pod.OwnerReferences,
+		fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name))
+}
+
+// GetObjectOwnerChain walks the controller owner references of the object in the namespace, described by the name for logging.
+func GetObjectOwnerChain(rc ResourceClient, namespace string, refs []metav1.OwnerReference, name string) ([]*OwnerInfo, error) {
+	ref := GetControllerRef(refs)
+	if ref == nil {
+		return nil, fmt.Errorf("%s has no controller", name)
+	}
+
+	var chain []*OwnerInfo
+	for i := 0; i < maxOwnerDepth && ref != nil; i++ {
+		resource, scalable, err := getResourceForKind(rc, ref.APIVersion, ref.Kind)
+		if err != nil {
+			return nil, err
+		}
+
+		owner := &OwnerInfo{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Resource:   resource,
+			Namespace:  namespace,
+			Name:       ref.Name,
+			Scalable:   scalable,
+		}
+		chain = append(chain, owner)
+
+		meta, err := getObjectMeta(rc, owner)
+		if err != nil {
+			return nil, err
+		}
+		ref = GetControllerRef(meta.OwnerReferences)
+	}
+
+	return chain, nil
+}
+
+// get the highest owner of the chain which has the /scale subresource, or the top-level owner if none has it
+func getHighestScalableOwner(chain []*OwnerInfo) *OwnerInfo {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].Scalable {
+			return chain[i]
+		}
+	}
+	return chain[len(chain)-1]
+}
+
+// GetResourceForKind finds the plural resource name of the kind in the api version through discovery,
+// and whether the resource has the /scale subresource.
+func GetResourceForKind(kubeClient *client.Clientset, apiVersion, kind string) (string, bool, error) {
+	return getResourceForKind(NewResourceClient(kubeClient), apiVersion, kind)
+}
+
+func getResourceForKind(rc ResourceClient, apiVersion, kind string) (string, bool, error) {
+	resourceList, err := rc.ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		glog.Errorf("Failed to discover resources of %s: %v", apiVersion, err)
+		return "", false, err
+	}
+
+	resource := ""
+	for _, r := range resourceList.APIResources {
+		if r.Kind == kind && !strings.Contains(r.Name, "/") {
+			resource = r.Name
+			break
+		}
+	}
+	if resource == "" {
+		return "", false, fmt.Errorf("cannot find resource of kind %s in %s", kind, apiVersion)
+	}
+
+	scalable := false
+	for _, r := range resourceList.APIResources {
+		if r.Name == resource+"/"+ScaleSubResource {
+			scalable = true
+			break
+		}
+	}
+
+	return resource, scalable, nil
+}
+
+// GetScaleTarget returns the owner info of the scale target of the HorizontalPodAutoscaler.
+func GetScaleTarget(rc ResourceClient, hpa *autoscalingv1.HorizontalPodAutoscaler) (*OwnerInfo, error) {
+	ref := hpa.Spec.ScaleTargetRef
+	resource, scalable, err := getResourceForKind(rc, ref.APIVersion, ref.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if !scalable {
+		return nil, fmt.Errorf("scale target %s/%s of HorizontalPodAutoscaler %s/%s has no scale subresource",
+			ref.Kind, ref.Name, hpa.Namespace, hpa.Name)
+	}
+
+	return &OwnerInfo{
+		APIVersion: ref.APIVersion,
+		Kind:       ref.Kind,
+		Resource:   resource,
+		Namespace:  hpa.Namespace,
+		Name:       ref.Name,
+		Scalable:   scalable,
+	}, nil
+}
+
+// GetScale gets the scale subresource of the owner.
+// The Scale object is kept unstructured, as its api group differs among resources, e.g.,
+// extensions/v1beta1 for Deployment of extensions group and autoscaling/v1 for apps/v1 and custom resources.
+func GetScale(kubeClient *client.Clientset, owner *OwnerInfo) (*unstructured.Unstructured, error) {
+	data, err := kubeClient.Discovery().RESTClient().Get().AbsPath(owner.Path(ScaleSubResource)).DoRaw()
+	if err != nil {
+		glog.Errorf("Failed to get scale of %s: %v", owner, err)
+		return nil, err
+	}
+
+	scale := &unstructured.Unstructured{}
+	if err := scale.UnmarshalJSON(data); err != nil {
+		glog.Errorf("Failed to decode scale of %s: %v", owner, err)
+		return nil, err
+	}
+
+	return scale, nil
+}
+
+// GetScaleSelector gets the label selector of the pods from the scale status.
+// The selector is a string in autoscaling/v1, and a map in the older api groups.
+func GetScaleSelector(scale *unstructured.Unstructured) (labels.Selector, error) {
+	if selector, found, err := unstructured.NestedString(scale.Object, "status", "selector"); err == nil && found {
+		return labels.Parse(selector)
+	}
+
+	if selector, found, err := unstructured.NestedStringMap(scale.Object, "status", "selector"); err == nil && found {
+		return labels.SelectorFromSet(selector), nil
+	}
+
+	return nil, fmt.Errorf("no pod selector found in scale %s", scale.GetName())
+}
+
+// getObjectMeta gets the metadata of the owner object through the generic REST API.
+func getObjectMeta(rc ResourceClient, owner *OwnerInfo) (*metav1.ObjectMeta, error) {
+	data, err := rc.GetRaw(owner.Path())
+	if err != nil {
+		glog.Errorf("Failed to get %s: %v", owner, err)
+		return nil, err
+	}
+
+	obj := &struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(data, obj); err != nil {
+		glog.Errorf("Failed to decode %s: %v", owner, err)
+		return nil, err
+	}
+
+	return &obj.Metadata, nil
+}
+
+// GetControllerRef returns the owner reference of the controller, or nil if there is none.
+func GetControllerRef(owners []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range owners {
+		owner := &owners[i]
+		if owner.Controller != nil && *owner.Controller && len(owner.Kind) > 0 && len(owner.Name) > 0 {
+			return owner
+		}
+	}
+	return nil
+}
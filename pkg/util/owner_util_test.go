@@ -0,0 +1,101 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOwnerInfoPath(t *testing.T) {
+	owner := &OwnerInfo{APIVersion: "apps/v1", Kind: "Deployment", Resource: "deployments", Namespace: "foo", Name: "bar"}
+	if got := owner.Path(ScaleSubResource); got != "/apis/apps/v1/namespaces/foo/deployments/bar/scale" {
+		t.Errorf("OwnerInfo.Path() = %s", got)
+	}
+
+	owner = &OwnerInfo{APIVersion: "v1", Kind: "ReplicationController", Resource: "replicationcontrollers", Namespace: "foo", Name: "bar"}
+	if got := owner.Path(); got != "/api/v1/namespaces/foo/replicationcontrollers/bar" {
+		t.Errorf("OwnerInfo.Path() = %s", got)
+	}
+}
+
+func TestGetScaleSelector(t *testing.T) {
+	// autoscaling/v1 Scale
+	scale := &unstructured.Unstructured{}
+	err := scale.UnmarshalJSON([]byte(`{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"web"},
+		"spec":{"replicas":3},"status":{"replicas":2,"selector":"app=web,tier=frontend"}}`))
+	if err != nil {
+		t.Fatalf("Failed to decode scale: %v", err)
+	}
+	selector, err := GetScaleSelector(scale)
+	if err != nil || selector.String() != "app=web,tier=frontend" {
+		t.Errorf("GetScaleSelector() = (%v, %v)", selector, err)
+	}
+
+	// extensions/v1beta1 Scale
+	scale = &unstructured.Unstructured{}
+	err = scale.UnmarshalJSON([]byte(`{"apiVersion":"extensions/v1beta1","kind":"Scale","metadata":{"name":"web"},
+		"spec":{"replicas":1},"status":{"replicas":1,"selector":{"app":"web"}}}`))
+	if err != nil {
+		t.Fatalf("Failed to decode scale: %v", err)
+	}
+	selector, err = GetScaleSelector(scale)
+	if err != nil || selector.String() != "app=web" {
+		t.Errorf("GetScaleSelector() = (%v, %v)", selector, err)
+	}
+}
+
+// mockResourceClient serves the resources of apps/v1, and counts the discoveries.
+type mockResourceClient struct {
+	discoveries int
+}
+
+func (c *mockResourceClient) ServerGroups() (*metav1.APIGroupList, error) {
+	return &metav1.APIGroupList{}, nil
+}
+
+func (c *mockResourceClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	c.discoveries++
+	if groupVersion != "apps/v1" {
+		return nil, fmt.Errorf("%s not found", groupVersion)
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: []metav1.APIResource{
+		{Name: "deployments", Kind: "Deployment"}, {Name: "deployments/scale", Kind: "Scale"},
+		{Name: "daemonsets", Kind: "DaemonSet"},
+	}}, nil
+}
+
+func (c *mockResourceClient) GetRaw(path string) ([]byte, error) {
+	return nil, fmt.Errorf("%s not found", path)
+}
+
+func TestGetScaleTargetCached(t *testing.T) {
+	mock := &mockResourceClient{}
+	rc := NewCachedResourceClient(mock, time.Hour)
+
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{}
+	hpa.Namespace = "ns"
+	for _, name := range []string{"web", "api"} {
+		hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: name}
+		target, err := GetScaleTarget(rc, hpa)
+		if err != nil {
+			t.Fatalf("Failed to get scale target: %v", err)
+		}
+		if got := target.Path(ScaleSubResource); got != "/apis/apps/v1/namespaces/ns/deployments/"+name+"/scale" {
+			t.Errorf("Unexpected scale path of the target: %s", got)
+		}
+	}
+	// the resources of apps/v1 are discovered once
+	if mock.discoveries != 1 {
+		t.Errorf("Expect the resources to be discovered once, but got %d", mock.discoveries)
+	}
+
+	// the target without the scale subresource
+	hpa.Spec.ScaleTargetRef = autoscalingv1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "agent"}
+	if _, err := GetScaleTarget(rc, hpa); err == nil {
+		t.Errorf("Expect error of the scale target without scale subresource")
+	}
+}